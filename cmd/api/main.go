@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/escoutdoor/ecommerce/internal/server"
 )
@@ -11,14 +18,27 @@ import (
 func main() {
 	s := server.NewServer()
 
-	defer func() {
-		if err := s.Close(); err != nil {
-			log.Printf("Error closing the server: %s", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		fmt.Printf("server is running on port: %s\n", strings.Join(strings.Split(s.Addr, "")[1:], ""))
+		if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			panic(err)
 		}
 	}()
 
-	fmt.Printf("server is running on port: %s\n", strings.Join(strings.Split(s.Addr, "")[1:], ""))
-	if err := s.ListenAndServe(); err != nil {
-		panic(err)
+	<-ctx.Done()
+	stop()
+	fmt.Println("shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down the server: %s", err)
+		if err := s.Close(); err != nil {
+			log.Printf("Error closing the server: %s", err)
+		}
 	}
 }
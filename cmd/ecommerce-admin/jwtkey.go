@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/pkg/tokens"
+)
+
+// runJWTKey writes a new signing key to -dir and prints the entry to add
+// to the keyset file. Scheduling it with -active-from ahead of time lets
+// verifiers fetch it from the jwks endpoint before the first token signed
+// with it shows up.
+func runJWTKey(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("jwt-key", flag.ExitOnError)
+	alg := fs.String("alg", tokens.EdDSA, "signing algorithm, RS256 or EdDSA")
+	kid := fs.String("kid", time.Now().UTC().Format("20060102"), "key id")
+	dir := fs.String("dir", ".", "directory to write <kid>.pem to")
+	activeFrom := fs.String("active-from", "", "RFC 3339 time the key starts signing tokens (default now)")
+	fs.Parse(args)
+
+	from := time.Now().UTC().Truncate(time.Second)
+	if *activeFrom != "" {
+		t, err := time.Parse(time.RFC3339, *activeFrom)
+		if err != nil {
+			return fmt.Errorf("invalid -active-from: %w", err)
+		}
+		from = t
+	}
+
+	key, err := tokens.GenerateKey(*alg)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(*dir, *kid+".pem")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	entry, err := json.MarshalIndent(map[string]any{
+		"kid":              *kid,
+		"alg":              *alg,
+		"private_key_file": *kid + ".pem",
+		"active_from":      from,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "wrote %s, add it to the keyset file and set expires_at on the key it replaces\n", path)
+	fmt.Println(string(entry))
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `usage: ecommerce-admin <command> [flags]
+
+commands:
+  migrate up               apply all pending migrations
+  migrate down [-steps n]  revert the latest n migrations (default 1)
+  migrate status           list migrations and whether they are applied
+  migrate create <name>    add an empty up/down migration pair to -dir
+  create-admin             create an admin user
+  reset-password           set a new password for a user
+  seed                     fill an empty database with sample categories and products
+  openapi [-check]         print the api document, or check it matches the router
+  jwt-key [-alg] [-kid]    generate a jwt signing key for the keyset file
+  webhook-listen -secret   receive and check webhook deliveries locally
+`
+
+type command func(ctx context.Context, args []string) error
+
+func main() {
+	// the .env file is optional here, deployments usually set the environment
+	_ = godotenv.Load()
+
+	commands := map[string]command{
+		"migrate":        runMigrate,
+		"create-admin":   runCreateAdmin,
+		"reset-password": runResetPassword,
+		"seed":           runSeed,
+		"openapi":        runOpenAPI,
+		"jwt-key":        runJWTKey,
+		"webhook-listen": runWebhookListen,
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd(ctx, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/migrate"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/migrations"
+)
+
+var migrationNameRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func runMigrate(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("expected one of up, down, status, create")
+	}
+
+	if args[0] == "create" {
+		return createMigration(args[1:])
+	}
+
+	db, err := store.Open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return nil
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := fs.Int("steps", 1, "number of migrations to revert")
+		fs.Parse(args[1:])
+
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+
+			fmt.Printf("%d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+func createMigration(args []string) error {
+	fs := flag.NewFlagSet("migrate create", flag.ExitOnError)
+	dir := fs.String("dir", "migrations", "directory holding the migration files")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || !migrationNameRe.MatchString(fs.Arg(0)) {
+		return errors.New("expected a single snake_case migration name")
+	}
+
+	base := fmt.Sprintf("%s_%s", time.Now().UTC().Format("20060102150405"), fs.Arg(0))
+	for _, suffix := range []string{".up.sql", ".down.sql"} {
+		path := filepath.Join(*dir, base+suffix)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+
+		fmt.Println("created", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/escoutdoor/ecommerce/internal/server"
+)
+
+// runOpenAPI prints the api document. With -check it only verifies that
+// the document still matches the router, without touching the database.
+func runOpenAPI(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	check := fs.Bool("check", false, "fail if routes and the document drifted apart")
+	fs.Parse(args)
+
+	doc, err := server.New(server.Stores{}, nil, 0).OpenAPI()
+	if err != nil {
+		return err
+	}
+	if *check {
+		return nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var seedCatalog = map[string][]models.ProductReq{
+	"Electronics": {
+		{Name: "Wireless Headphones", Description: "Over-ear, noise cancelling", Price: 129.99},
+		{Name: "Mechanical Keyboard", Description: "Hot-swappable switches", Price: 89.50},
+	},
+	"Books": {
+		{Name: "The Go Programming Language", Description: "Donovan & Kernighan", Price: 39.90},
+	},
+	"Clothing": {
+		{Name: "Rain Jacket", Description: "Waterproof, breathable", Price: 74.00},
+		{Name: "Wool Socks", Description: "Pack of three", Price: 15.00},
+	},
+}
+
+func runSeed(ctx context.Context, args []string) error {
+	db, err := store.ConnectToDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var categories int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM CATEGORIES").Scan(&categories); err != nil {
+		return err
+	}
+	if categories > 0 {
+		return fmt.Errorf("database already has %d categories, refusing to seed", categories)
+	}
+
+	categoryStore := store.NewCategoryStore(db)
+	productStore := store.NewProductStore(db)
+
+	for name, products := range seedCatalog {
+		category, err := categoryStore.Create(ctx, models.CategoryReq{Name: name})
+		if err != nil {
+			return err
+		}
+
+		for _, p := range products {
+			p.CategoryID = category.ID
+			if _, err := productStore.Create(ctx, p); err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("seeded %s with %d products\n", name, len(products))
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/pkg/password"
+	"github.com/go-playground/validator/v10"
+)
+
+func runCreateAdmin(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := fs.String("email", "", "email address of the admin")
+	firstName := fs.String("first-name", "Admin", "first name of the admin")
+	lastName := fs.String("last-name", "", "last name of the admin")
+	fs.Parse(args)
+
+	if err := password.ConfigureFromEnv(); err != nil {
+		return err
+	}
+
+	pw, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	req := models.RegisterReq{
+		Email:     *email,
+		FirstName: *firstName,
+		LastName:  *lastName,
+		Password:  pw,
+	}
+	v := validator.New()
+	if err := password.RegisterValidation(v); err != nil {
+		return err
+	}
+	if err := v.Struct(req); err != nil {
+		return err
+	}
+
+	db, err := store.ConnectToDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	user, err := store.NewAuthStore(db).RegisterAdmin(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin %s with id %d\n", user.Email, user.ID)
+	return nil
+}
+
+func runResetPassword(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	email := fs.String("email", "", "email address of the user")
+	fs.Parse(args)
+
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	if err := password.ConfigureFromEnv(); err != nil {
+		return err
+	}
+
+	pw, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	if err := password.Check(pw); err != nil {
+		p := password.CurrentPolicy()
+		return fmt.Errorf("%w, it should be %d to %d characters long and not a commonly used password", err, p.MinLength, p.MaxLength)
+	}
+
+	db, err := store.ConnectToDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userStore := store.NewUserStore(db)
+	user, err := userStore.GetByEmail(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	if err := userStore.SetPassword(ctx, user.ID, pw); err != nil {
+		return err
+	}
+
+	// whoever knew the old password may still be logged in
+	if _, err := store.NewSessionStore(db).RevokeAll(ctx, user.ID); err != nil {
+		return err
+	}
+
+	fmt.Printf("password of %s has been reset and its sessions revoked\n", user.Email)
+	return nil
+}
+
+// readPassword takes the password from ADMIN_PASSWORD or the first line of
+// stdin, so it never ends up in the shell history.
+func readPassword() (string, error) {
+	if pw := os.Getenv("ADMIN_PASSWORD"); pw != "" {
+		return pw, nil
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
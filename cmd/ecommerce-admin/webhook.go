@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/pkg/webhook"
+)
+
+// runWebhookListen serves a receiver that checks and prints the webhook
+// deliveries posted to it, for trying out webhooks locally. -fail answers
+// the first n deliveries with 500 to watch the retries.
+func runWebhookListen(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("webhook-listen", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:9000", "address to listen on")
+	secret := fs.String("secret", "", "secret of the webhook, returned when it was created")
+	tolerance := fs.Duration("tolerance", 5*time.Minute, "maximum age of a delivery")
+	fail := fs.Int("fail", 0, "number of deliveries to answer with 500")
+	fs.Parse(args)
+
+	if *secret == "" {
+		return errors.New("-secret is required")
+	}
+
+	var received int64
+	srv := &http.Server{
+		Addr: *addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if err := webhook.Verify(r.Header, body, *secret, *tolerance, time.Now()); err != nil {
+				log.Printf("delivery %s refused: %s", r.Header.Get(webhook.HeaderID), err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if atomic.AddInt64(&received, 1) <= int64(*fail) {
+				log.Printf("delivery %s (%s) failed on purpose", r.Header.Get(webhook.HeaderID), r.Header.Get(webhook.HeaderEvent))
+				http.Error(w, "failing on purpose", http.StatusInternalServerError)
+				return
+			}
+
+			log.Printf("delivery %s (%s): %s", r.Header.Get(webhook.HeaderID), r.Header.Get(webhook.HeaderEvent), body)
+			w.WriteHeader(http.StatusNoContent)
+		}),
+		ReadTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	fmt.Printf("listening on http://%s\n", *addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+// Command mockoidc serves a local OpenID Connect provider for trying out
+// social login without registering a client with a real one. Every login
+// succeeds, as the user given by the flags or by the login_hint parameter.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/escoutdoor/ecommerce/pkg/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9999", "address to listen on")
+	clientID := flag.String("client-id", "ecommerce", "accepted client id")
+	clientSecret := flag.String("client-secret", "secret", "accepted client secret")
+	email := flag.String("email", "jane@example.com", "email of the user logged in")
+	verified := flag.Bool("email-verified", true, "whether the email is verified")
+	flag.Parse()
+
+	iss, err := oidctest.New("http://"+*addr, *clientID, *clientSecret, oidctest.User{
+		Subject:       "mock|" + *email,
+		Email:         *email,
+		EmailVerified: *verified,
+		GivenName:     "Jane",
+		FamilyName:    "Doe",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("OIDC_PROVIDERS=mock\nOIDC_MOCK_ISSUER=%s\nOIDC_MOCK_CLIENT_ID=%s\nOIDC_MOCK_CLIENT_SECRET=%s\n", iss.URL, *clientID, *clientSecret)
+	log.Fatal(http.ListenAndServe(*addr, iss))
+}
@@ -0,0 +1,126 @@
+// Package audit chains audit log entries with SHA-256 hashes and computes
+// the changes they record.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+// Genesis is the previous hash of the first entry.
+var Genesis = strings.Repeat("0", 64)
+
+// Hash returns the hash of e, which covers every field set when the entry
+// is appended, including the hash of the previous entry, but not its id.
+func Hash(e models.AuditEntry) string {
+	actor := ""
+	if e.ActorID != nil {
+		actor = strconv.Itoa(*e.ActorID)
+	}
+
+	h := sha256.New()
+	for _, field := range []string{
+		e.PrevHash,
+		actor,
+		e.Action,
+		e.EntityType,
+		e.EntityID,
+		string(e.Before),
+		string(e.After),
+		e.IP,
+		e.RequestID,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	} {
+		// the length prefix keeps the boundaries of the fields unambiguous
+		fmt.Fprintf(h, "%d:%s;", len(field), field)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Chain sets the previous hash and the hash of e, to append it after the
+// entry with hash prev, or Genesis for the first one. CreatedAt is cut to
+// microseconds, what Postgres stores, so the hash can be checked again.
+func Chain(e models.AuditEntry, prev string) models.AuditEntry {
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Microsecond)
+	e.PrevHash = prev
+	e.Hash = Hash(e)
+
+	return e
+}
+
+// Valid reports whether e follows the entry with hash prev and still has
+// the hash it was appended with.
+func Valid(e models.AuditEntry, prev string) bool {
+	return e.PrevHash == prev && Hash(e) == e.Hash
+}
+
+// Diff returns the fields of before and after, both encoded as json
+// objects, that differ. A nil before or after, for created or deleted
+// entities, returns every field of the other one.
+func Diff(before, after any) (json.RawMessage, json.RawMessage, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a, err := fields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if b != nil && a != nil {
+		for k, v := range b {
+			if reflect.DeepEqual(v, a[k]) {
+				delete(b, k)
+				delete(a, k)
+			}
+		}
+	}
+
+	bj, err := encode(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aj, err := encode(a)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bj, aj, nil
+}
+
+func fields(v any) (map[string]any, error) {
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func encode(m map[string]any) (json.RawMessage, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(m)
+}
@@ -0,0 +1,86 @@
+// Package events delivers the events the stores write to the outbox to the
+// subscribers that react to them, in process or outside of it.
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+// Handler reacts to an event. Events are delivered at least once, an event
+// is handed to every subscriber again when one of them failed, so handlers
+// must tolerate seeing the same event ID twice.
+type Handler func(ctx context.Context, e models.Event) error
+
+type subscription struct {
+	name   string
+	types  map[string]bool
+	handle Handler
+}
+
+// Bus fans events out to its subscribers.
+type Bus struct {
+	mu   sync.RWMutex
+	subs []subscription
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls handle for the events of the given types, or for every
+// event if none are given. name identifies the subscriber in errors.
+func (b *Bus) Subscribe(name string, handle Handler, types ...string) {
+	sub := subscription{name: name, handle: handle}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subs = append(b.subs, sub)
+}
+
+// Publish hands e to every subscriber of its type, also after one of them
+// failed, and returns the errors of those that did.
+func (b *Bus) Publish(ctx context.Context, e models.Event) error {
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+
+	var failed []string
+	for _, sub := range subs {
+		if sub.types != nil && !sub.types[e.Type] {
+			continue
+		}
+
+		if err := call(ctx, sub.handle, e); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", sub.name, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// call keeps a panicking subscriber from taking down the dispatcher.
+func call(ctx context.Context, handle Handler, e models.Event) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+
+	return handle(ctx, e)
+}
@@ -0,0 +1,128 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+// Policy controls how the dispatcher reads the outbox and retries failed
+// deliveries.
+type Policy struct {
+	// Poll is how often the outbox is checked for due events.
+	Poll time.Duration
+	// Batch is how many events are claimed at once.
+	Batch int
+	// Lease is how long claimed events are hidden from other dispatchers.
+	// Events of a dispatcher that stopped are delivered again after it.
+	Lease time.Duration
+	// Timeout bounds the delivery of one event to all subscribers.
+	Timeout time.Duration
+	// MinBackoff is the delay after the first failed delivery, it doubles
+	// with every further failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// backoff returns the delay before the next delivery of an event that
+// failed attempts times.
+func (p Policy) backoff(attempts int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
+
+// Dispatcher delivers the events in the outbox to the subscribers of a bus.
+// Every replica can run one, claims keep them from delivering the same
+// event at the same time.
+type Dispatcher struct {
+	outbox store.OutboxStorer
+	bus    *Bus
+	policy Policy
+}
+
+func NewDispatcher(outbox store.OutboxStorer, bus *Bus, policy Policy) *Dispatcher {
+	return &Dispatcher{
+		outbox: outbox,
+		bus:    bus,
+		policy: policy,
+	}
+}
+
+// Run delivers due events every poll interval until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.policy.Poll)
+	defer ticker.Stop()
+
+	for {
+		// a full batch means more events may be due already
+		for {
+			n, err := d.dispatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("dispatch events error: %s", err)
+				}
+				break
+			}
+			if n < d.policy.Batch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch delivers one batch of due events and returns how many were
+// claimed.
+func (d *Dispatcher) dispatch(ctx context.Context) (int, error) {
+	events, err := d.outbox.Claim(ctx, d.policy.Batch, d.policy.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, e := range events {
+		// the rest of the batch is claimed again once the lease ends
+		if ctx.Err() != nil {
+			return len(events), ctx.Err()
+		}
+
+		d.deliver(ctx, e)
+	}
+
+	return len(events), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, e models.Event) {
+	pctx, cancel := context.WithTimeout(ctx, d.policy.Timeout)
+	err := d.bus.Publish(pctx, e)
+	cancel()
+
+	if err != nil {
+		delay := d.policy.backoff(e.Attempts)
+		log.Printf("deliver event %d (%s) attempt %d error, retrying in %s: %s", e.ID, e.Type, e.Attempts, delay, err)
+
+		if err := d.outbox.Failed(ctx, e.ID, time.Now().Add(delay), err.Error()); err != nil {
+			log.Printf("reschedule event %d error: %s", e.ID, err)
+		}
+		return
+	}
+
+	// the event is delivered again after the lease if this fails
+	if err := d.outbox.Delivered(ctx, e.ID); err != nil {
+		log.Printf("mark event %d delivered error: %s", e.ID, err)
+	}
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+// OrderFeed wakes the event streams of an order when status events of it
+// are committed. A wake only says there may be new events, streams read
+// them from the outbox, so a wake that is missed while a stream is busy is
+// merged with the next one.
+type OrderFeed struct {
+	mu      sync.Mutex
+	subs    map[int]map[chan struct{}]struct{}
+	stopped bool
+}
+
+func NewOrderFeed() *OrderFeed {
+	return &OrderFeed{
+		subs: make(map[int]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe returns a channel that receives when there may be new events
+// of the order, and is closed once the feed stops. cancel has to be called
+// when the stream ends.
+func (f *OrderFeed) Subscribe(orderID int) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stopped {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if f.subs[orderID] == nil {
+		f.subs[orderID] = make(map[chan struct{}]struct{})
+	}
+	f.subs[orderID][ch] = struct{}{}
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if _, ok := f.subs[orderID][ch]; !ok {
+			return
+		}
+		delete(f.subs[orderID], ch)
+		if len(f.subs[orderID]) == 0 {
+			delete(f.subs, orderID)
+		}
+	}
+}
+
+// Run wakes the subscribers with what l is notified of until ctx is done,
+// then closes every subscription so the streams end.
+func (f *OrderFeed) Run(ctx context.Context, l store.OrderListener) {
+	defer f.stop()
+
+	for {
+		err := l.Listen(ctx, f.notify)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("listen for order events error, retrying: %s", err)
+
+		// the streams catch up with what was missed meanwhile
+		f.notify(0)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// notify wakes the subscribers of the order, or of every order for 0.
+func (f *OrderFeed) notify(orderID int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id, subs := range f.subs {
+		if orderID != 0 && id != orderID {
+			continue
+		}
+		for ch := range subs {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (f *OrderFeed) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, subs := range f.subs {
+		for ch := range subs {
+			close(ch)
+		}
+	}
+	f.subs = make(map[int]map[chan struct{}]struct{})
+	f.stopped = true
+}
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+// Log writes events to the log.
+func Log(ctx context.Context, e models.Event) error {
+	log.Printf("event %d %s: %s", e.ID, e.Type, e.Data)
+	return nil
+}
+
+// HTTP returns a handler that posts events as json to url. A response other
+// than 2xx fails the delivery. Receivers should deduplicate on the Event-ID
+// header.
+func HTTP(client *http.Client, url string) Handler {
+	return func(ctx context.Context, e models.Event) error {
+		body, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Event-ID", strconv.FormatInt(e.ID, 10))
+		req.Header.Set("Event-Type", e.Type)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		// drained so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("sink responded %s", resp.Status)
+		}
+
+		return nil
+	}
+}
+
+// SinkFromEnv returns the external sink selected by EVENT_SINK, nil if
+// events are only delivered in process.
+func SinkFromEnv() Handler {
+	switch v := os.Getenv("EVENT_SINK"); v {
+	case "":
+		return nil
+	case "log":
+		return Log
+	case "http":
+		url := os.Getenv("EVENT_SINK_URL")
+		if len(url) == 0 {
+			log.Fatal("EVENT_SINK_URL is required for EVENT_SINK=http")
+		}
+
+		return HTTP(&http.Client{Timeout: 10 * time.Second}, url)
+	default:
+		log.Fatalf("invalid EVENT_SINK: %q", v)
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/pkg/webhook"
+)
+
+// WebhookEvents are the event types partners can subscribe webhooks to.
+var WebhookEvents = []string{
+	models.EventOrderCreated,
+	models.EventOrderStatusChanged,
+}
+
+// WebhookPolicy controls how deliveries are sent and retried. Poll, Batch,
+// Lease and the backoff work like those of the dispatcher, Timeout bounds
+// one request.
+type WebhookPolicy struct {
+	Policy
+	// MaxAttempts is the number of attempts after which a delivery is
+	// dead, until it is redelivered by hand.
+	MaxAttempts int
+}
+
+// WebhookSender posts the deliveries of webhooks. Its Enqueue subscribes to
+// the bus and turns events into deliveries, Run sends them.
+type WebhookSender struct {
+	store  store.WebhookStorer
+	client *http.Client
+	policy WebhookPolicy
+}
+
+func NewWebhookSender(s store.WebhookStorer, policy WebhookPolicy) *WebhookSender {
+	return &WebhookSender{
+		store: s,
+		client: &http.Client{
+			Timeout: policy.Timeout,
+			// a redirect is not a delivery, partners have to fix the url
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		policy: policy,
+	}
+}
+
+// Enqueue adds a delivery of e to every webhook subscribed to it. It only
+// writes to the database, so a slow partner does not hold up the bus.
+func (s *WebhookSender) Enqueue(ctx context.Context, e models.Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Enqueue(ctx, e, payload)
+}
+
+// Run sends due deliveries every poll interval until ctx is done.
+func (s *WebhookSender) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.policy.Poll)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := s.send(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("send webhooks error: %s", err)
+				}
+				break
+			}
+			if n < s.policy.Batch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// send posts one batch of due deliveries and returns how many were claimed.
+// The deliveries of a webhook are posted in order, but every webhook gets
+// its own goroutine, so a slow or unreachable endpoint only holds up its
+// own deliveries. Each request is bounded by the timeout of the policy.
+func (s *WebhookSender) send(ctx context.Context) (int, error) {
+	deliveries, err := s.store.Claim(ctx, s.policy.Batch, s.policy.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	byWebhook := make(map[int][]models.WebhookDelivery)
+	for _, d := range deliveries {
+		byWebhook[d.WebhookID] = append(byWebhook[d.WebhookID], d)
+	}
+
+	var wg sync.WaitGroup
+	for id, ds := range byWebhook {
+		wg.Add(1)
+		go func(id int, ds []models.WebhookDelivery) {
+			defer wg.Done()
+			s.sendTo(ctx, id, ds)
+		}(id, ds)
+	}
+	wg.Wait()
+
+	return len(deliveries), ctx.Err()
+}
+
+// sendTo posts the deliveries of one webhook, one after the other.
+func (s *WebhookSender) sendTo(ctx context.Context, webhookID int, deliveries []models.WebhookDelivery) {
+	w, err := s.store.GetByID(ctx, webhookID)
+	if err != nil {
+		// deleted meanwhile, its deliveries went with it
+		log.Printf("load webhook %d error: %s", webhookID, err)
+		return
+	}
+
+	for _, d := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.deliver(ctx, w, d)
+	}
+}
+
+func (s *WebhookSender) deliver(ctx context.Context, w *models.Webhook, d models.WebhookDelivery) {
+	code, err := s.post(ctx, w, d)
+	if err == nil {
+		if err := s.store.Succeeded(ctx, d.ID, code); err != nil {
+			log.Printf("mark webhook delivery %d succeeded error: %s", d.ID, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	if d.Attempts < s.policy.MaxAttempts {
+		t := time.Now().Add(s.policy.backoff(d.Attempts))
+		retryAt = &t
+		log.Printf("webhook delivery %d to %s attempt %d error, retrying at %s: %s", d.ID, w.URL, d.Attempts, t.Format(time.RFC3339), err)
+	} else {
+		log.Printf("webhook delivery %d to %s is dead after %d attempts: %s", d.ID, w.URL, d.Attempts, err)
+	}
+
+	if err := s.store.Failed(ctx, d.ID, code, err.Error(), retryAt); err != nil {
+		log.Printf("mark webhook delivery %d failed error: %s", d.ID, err)
+	}
+}
+
+// post sends the delivery and returns the status code of the response, 0
+// if there was none.
+func (s *WebhookSender) post(ctx context.Context, w *models.Webhook, d models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ecommerce-webhooks")
+	// the id stays the same across attempts, receivers deduplicate on it
+	req.Header.Set(webhook.HeaderID, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(webhook.HeaderEvent, d.EventType)
+	webhook.SetHeaders(req.Header, w.Secret, time.Now(), d.Payload)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,281 @@
+package events
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store/memstore"
+	"github.com/escoutdoor/ecommerce/pkg/webhook"
+)
+
+const testSecret = "whsec_test"
+
+func testWebhookPolicy() WebhookPolicy {
+	return WebhookPolicy{
+		Policy: Policy{
+			Poll:       time.Hour,
+			Batch:      10,
+			Lease:      time.Minute,
+			Timeout:    5 * time.Second,
+			MinBackoff: 50 * time.Millisecond,
+			MaxBackoff: time.Second,
+		},
+		MaxAttempts: 3,
+	}
+}
+
+// newTestWebhook subscribes a webhook for url to created orders.
+func newTestWebhook(t *testing.T, s *memstore.WebhookStore, url string) *models.Webhook {
+	t.Helper()
+
+	w, err := s.Create(context.Background(), models.Webhook{
+		URL:        url,
+		Secret:     testSecret,
+		EventTypes: []string{models.EventOrderCreated},
+		Active:     true,
+	})
+	if err != nil {
+		t.Fatalf("create webhook: %s", err)
+	}
+
+	return w
+}
+
+func enqueueOrderCreated(t *testing.T, sender *WebhookSender, id int64) {
+	t.Helper()
+
+	err := sender.Enqueue(context.Background(), models.Event{
+		ID:        id,
+		Type:      models.EventOrderCreated,
+		Data:      []byte(`{"order":{"id":1}}`),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+}
+
+func delivery(t *testing.T, s *memstore.WebhookStore, webhookID int) models.WebhookDelivery {
+	t.Helper()
+
+	list, err := s.Deliveries(context.Background(), webhookID, models.WebhookDeliveryFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("deliveries: %s", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(list))
+	}
+
+	return list[0]
+}
+
+func sendOnce(t *testing.T, sender *WebhookSender) int {
+	t.Helper()
+
+	n, err := sender.send(context.Background())
+	if err != nil {
+		t.Fatalf("send: %s", err)
+	}
+
+	return n
+}
+
+func TestWebhookSignedDelivery(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []*http.Request
+		bodies   [][]byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		received = append(received, r)
+		bodies = append(bodies, body)
+		mu.Unlock()
+
+		if err := webhook.Verify(r.Header, body, testSecret, time.Minute, time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	s := memstore.NewWebhookStore(memstore.NewDB())
+	sender := NewWebhookSender(s, testWebhookPolicy())
+	w := newTestWebhook(t, s, srv.URL)
+	enqueueOrderCreated(t, sender, 7)
+
+	if n := sendOnce(t, sender); n != 1 {
+		t.Fatalf("sent %d deliveries, want 1", n)
+	}
+
+	d := delivery(t, s, w.ID)
+	if d.Status != models.WebhookDeliverySucceeded {
+		t.Fatalf("got status %s, last error %q, want %s", d.Status, d.LastError, models.WebhookDeliverySucceeded)
+	}
+
+	if len(received) != 1 {
+		t.Fatalf("got %d requests, want 1", len(received))
+	}
+	r := received[0]
+	if got := r.Header.Get(webhook.HeaderID); got != strconv.FormatInt(d.ID, 10) {
+		t.Errorf("got %s %q, want %d", webhook.HeaderID, got, d.ID)
+	}
+	if got := r.Header.Get(webhook.HeaderEvent); got != models.EventOrderCreated {
+		t.Errorf("got %s %q, want %s", webhook.HeaderEvent, got, models.EventOrderCreated)
+	}
+
+	// a receiver with another secret refuses the delivery
+	if err := webhook.Verify(r.Header, bodies[0], "whsec_other", time.Minute, time.Now()); err != webhook.ErrInvalidSignature {
+		t.Errorf("verify with another secret: got %v, want %v", err, webhook.ErrInvalidSignature)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts []time.Time
+		ids      []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts = append(attempts, time.Now())
+		ids = append(ids, r.Header.Get(webhook.HeaderID))
+		if len(attempts) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	s := memstore.NewWebhookStore(memstore.NewDB())
+	policy := testWebhookPolicy()
+	sender := NewWebhookSender(s, policy)
+	w := newTestWebhook(t, s, srv.URL)
+	enqueueOrderCreated(t, sender, 7)
+
+	sendOnce(t, sender)
+	d := delivery(t, s, w.ID)
+	if d.Status != models.WebhookDeliveryPending || d.LastStatusCode == nil || *d.LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got %+v after a 503, want it pending with the status", d)
+	}
+
+	// not due before the backoff is over
+	if n := sendOnce(t, sender); n != 0 {
+		t.Fatalf("claimed %d deliveries during the backoff, want 0", n)
+	}
+
+	for _, wait := range []time.Duration{policy.backoff(1), policy.backoff(2)} {
+		time.Sleep(wait)
+		if n := sendOnce(t, sender); n != 1 {
+			t.Fatalf("claimed %d deliveries after the backoff, want 1", n)
+		}
+	}
+
+	d = delivery(t, s, w.ID)
+	if d.Status != models.WebhookDeliverySucceeded || d.Attempts != 3 {
+		t.Fatalf("got status %s after %d attempts, want %s after 3", d.Status, d.Attempts, models.WebhookDeliverySucceeded)
+	}
+
+	// every retry waited at least its backoff, the second one twice as long
+	for i, want := range []time.Duration{policy.backoff(1), policy.backoff(2)} {
+		if got := attempts[i+1].Sub(attempts[i]); got < want {
+			t.Errorf("attempt %d came %s after the one before, want at least %s", i+2, got, want)
+		}
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Errorf("got delivery ids %q, want the same id on every attempt", ids)
+			break
+		}
+	}
+}
+
+func TestWebhookDeadAfterMaxAttempts(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	s := memstore.NewWebhookStore(memstore.NewDB())
+	policy := testWebhookPolicy()
+	policy.MinBackoff, policy.MaxBackoff = time.Millisecond, time.Millisecond
+	sender := NewWebhookSender(s, policy)
+	w := newTestWebhook(t, s, srv.URL)
+	enqueueOrderCreated(t, sender, 7)
+
+	for i := 0; i < policy.MaxAttempts; i++ {
+		time.Sleep(2 * time.Millisecond)
+		sendOnce(t, sender)
+	}
+
+	d := delivery(t, s, w.ID)
+	if d.Status != models.WebhookDeliveryDead || d.NextAttemptAt != nil {
+		t.Fatalf("got %+v after %d failed attempts, want it dead", d, policy.MaxAttempts)
+	}
+
+	// a dead delivery is not tried again
+	time.Sleep(2 * time.Millisecond)
+	if n := sendOnce(t, sender); n != 0 {
+		t.Fatalf("claimed %d dead deliveries, want 0", n)
+	}
+	if calls != policy.MaxAttempts {
+		t.Errorf("got %d requests, want %d", calls, policy.MaxAttempts)
+	}
+}
+
+func TestWebhookSlowEndpointDoesNotBlockOthers(t *testing.T) {
+	fastDone := make(chan struct{})
+	var blocked bool
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// holds its delivery until the other endpoint got its own
+		select {
+		case <-fastDone:
+		case <-time.After(2 * time.Second):
+			blocked = true
+		}
+	}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(fastDone)
+	}))
+	defer fast.Close()
+
+	s := memstore.NewWebhookStore(memstore.NewDB())
+	sender := NewWebhookSender(s, testWebhookPolicy())
+	// created first, so its delivery is claimed first
+	slowHook := newTestWebhook(t, s, slow.URL)
+	fastHook := newTestWebhook(t, s, fast.URL)
+	enqueueOrderCreated(t, sender, 7)
+
+	if n := sendOnce(t, sender); n != 2 {
+		t.Fatalf("sent %d deliveries, want 2", n)
+	}
+	if blocked {
+		t.Errorf("the slow endpoint held up the delivery to the other one")
+	}
+
+	for _, id := range []int{slowHook.ID, fastHook.ID} {
+		if d := delivery(t, s, id); d.Status != models.WebhookDeliverySucceeded {
+			t.Errorf("got status %s for webhook %d, want %s", d.Status, id, models.WebhookDeliverySucceeded)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Package jobs runs work outside of requests, e.g. sending emails. Jobs are
+// rows of the jobs table, claimed with SELECT ... FOR UPDATE SKIP LOCKED, so
+// every replica can run workers without two of them running the same job.
+//
+// A job is at least once: a worker that stops in the middle of a job leaves
+// it running until its lease ends, then it is claimed again.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+// Policy controls the workers of a queue and how failed jobs are retried.
+type Policy struct {
+	// Workers is the number of jobs run at the same time.
+	Workers int
+	// Poll is how often idle workers check for due jobs.
+	Poll time.Duration
+	// Lease is how long a claimed job is hidden from other workers. It has
+	// to be longer than Timeout, or a slow job is run twice.
+	Lease time.Duration
+	// Timeout bounds one run of a job.
+	Timeout time.Duration
+	// MinBackoff is the delay after the first failed run, it doubles with
+	// every further failure up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// MaxAttempts is the number of runs after which a job has failed, for
+	// jobs enqueued without one.
+	MaxAttempts int
+}
+
+// backoff returns the delay before the next run of a job that failed
+// attempts times.
+func (p Policy) backoff(attempts int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
+
+type handler func(ctx context.Context, payload json.RawMessage) error
+
+// Queue enqueues jobs and runs them with the handlers registered for their
+// kinds.
+type Queue struct {
+	store  store.JobStorer
+	policy Policy
+
+	mu       sync.RWMutex
+	handlers map[string]handler
+
+	// wake tells an idle worker of this replica that a job was enqueued,
+	// workers of other replicas find it when they poll
+	wake chan struct{}
+}
+
+func NewQueue(s store.JobStorer, policy Policy) *Queue {
+	return &Queue{
+		store:    s,
+		policy:   policy,
+		handlers: make(map[string]handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Option changes a job before it is enqueued.
+type Option func(*models.Job)
+
+// Delay makes the job due after d.
+func Delay(d time.Duration) Option {
+	return func(j *models.Job) {
+		j.RunAt = time.Now().Add(d)
+	}
+}
+
+// At makes the job due at t.
+func At(t time.Time) Option {
+	return func(j *models.Job) {
+		j.RunAt = t
+	}
+}
+
+// MaxAttempts overrides the number of runs after which the job has failed.
+func MaxAttempts(n int) Option {
+	return func(j *models.Job) {
+		j.MaxAttempts = n
+	}
+}
+
+// Kind is a kind of job with a payload of type T. Declare kinds as package
+// variables, the name is stored with every job and has to stay the same.
+type Kind[T any] struct {
+	Name string
+}
+
+// Enqueue adds a job of kind k, due right away unless an option says
+// otherwise.
+func (k Kind[T]) Enqueue(ctx context.Context, q *Queue, payload T, opts ...Option) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s job error: %w", k.Name, err)
+	}
+
+	job := models.Job{
+		Kind:        k.Name,
+		Payload:     data,
+		MaxAttempts: q.policy.MaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(&job)
+	}
+
+	created, err := q.store.Enqueue(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+
+	if !created.RunAt.After(time.Now()) {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return created, nil
+}
+
+// Handle runs fn for the jobs of kind k. It has to be called before the
+// queue runs, the workers only claim kinds that have a handler.
+func (k Kind[T]) Handle(q *Queue, fn func(ctx context.Context, payload T) error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.handlers[k.Name] = func(ctx context.Context, data json.RawMessage) error {
+		var payload T
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return Permanent(fmt.Errorf("decode payload error: %w", err))
+		}
+
+		return fn(ctx, payload)
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying will not fix, the job fails
+// without using its remaining attempts.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// Run starts the workers and blocks until ctx is done and every job that
+// was running has finished, so the caller can wait for the queue to drain
+// before closing the database.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.policy.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.policy.Poll)
+	defer ticker.Stop()
+
+	for {
+		// keep running jobs while there are due ones
+		for ctx.Err() == nil {
+			ran, err := q.runNext(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("claim job error: %s", err)
+				}
+				break
+			}
+			if !ran {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// runNext claims a due job and runs it, it returns false if none was due.
+func (q *Queue) runNext(ctx context.Context) (bool, error) {
+	kinds := q.kinds()
+	if len(kinds) == 0 {
+		return false, nil
+	}
+
+	job, err := q.store.Claim(ctx, kinds, q.policy.Lease)
+	if err != nil {
+		if errors.Is(err, store.ErrJobNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// a claimed job is finished even when the queue is stopping, so it
+	// does not wait for its lease to end
+	q.run(context.Background(), job)
+
+	return true, nil
+}
+
+func (q *Queue) kinds() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	kinds := make([]string, 0, len(q.handlers))
+	for k := range q.handlers {
+		kinds = append(kinds, k)
+	}
+
+	return kinds
+}
+
+func (q *Queue) run(ctx context.Context, job *models.Job) {
+	var err error
+	if job.Attempts > job.MaxAttempts {
+		// the leases of the earlier attempts ran out, the job keeps taking
+		// its workers down or does not finish in time
+		err = Permanent(errors.New("no attempts left, the last one did not finish"))
+	} else {
+		q.mu.RLock()
+		handle := q.handlers[job.Kind]
+		q.mu.RUnlock()
+
+		err = q.call(ctx, handle, job)
+	}
+
+	if err == nil {
+		if err := q.store.Succeeded(ctx, job.ID, job.Attempts); err != nil {
+			q.logFinishError(job, "succeeded", err)
+		}
+		return
+	}
+
+	var (
+		retryAt   *time.Time
+		permanent permanentError
+	)
+	if job.Attempts < job.MaxAttempts && !errors.As(err, &permanent) {
+		t := time.Now().Add(q.policy.backoff(job.Attempts))
+		retryAt = &t
+		log.Printf("job %d (%s) attempt %d error, retrying at %s: %s", job.ID, job.Kind, job.Attempts, t.Format(time.RFC3339), err)
+	} else {
+		log.Printf("job %d (%s) failed after %d attempts: %s", job.ID, job.Kind, job.Attempts, err)
+	}
+
+	if err := q.store.Failed(ctx, job.ID, job.Attempts, err.Error(), retryAt); err != nil {
+		q.logFinishError(job, "failed", err)
+	}
+}
+
+// logFinishError logs that the outcome of the attempt was not recorded. An
+// attempt that outlived its lease has to leave the job to the attempt that
+// claimed it since.
+func (q *Queue) logFinishError(job *models.Job, outcome string, err error) {
+	if errors.Is(err, store.ErrJobLeaseLost) {
+		log.Printf("job %d (%s) attempt %d %s after its lease ran out, left to the next attempt", job.ID, job.Kind, job.Attempts, outcome)
+		return
+	}
+
+	log.Printf("mark job %d %s error: %s", job.ID, outcome, err)
+}
+
+// call runs the handler of job, a panic fails the attempt instead of the
+// worker.
+func (q *Queue) call(ctx context.Context, handle handler, job *models.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, q.policy.Timeout)
+	defer cancel()
+
+	return handle(ctx, job.Payload)
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File writes every message as an .eml file to a directory instead of
+// sending it, e.g. to look at the emails in development or have another
+// process pick them up.
+type File struct {
+	dir  string
+	from *mail.Address
+}
+
+func NewFile(dir, from string) (*File, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &File{
+		dir:  dir,
+		from: sender,
+	}, nil
+}
+
+func (m *File) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	body, err := msg.encode(m.from, now)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	name := now.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(b) + ".eml"
+
+	// renamed once complete, so a reader never sees half a message
+	tmp := filepath.Join(m.dir, "."+name)
+	if err := os.WriteFile(tmp, body, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(m.dir, name))
+}
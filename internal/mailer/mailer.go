@@ -0,0 +1,62 @@
+// Package mailer sends emails to users.
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+)
+
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	// HTML is sent next to Text if set, clients show the one they support.
+	HTML string `json:"html,omitempty"`
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Log writes messages to the log instead of sending them.
+type Log struct{}
+
+func (Log) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
+
+// FromEnv returns the mailer selected by MAILER: log, smtp to send through
+// SMTP_ADDR or file to write to MAIL_DROP_DIR. MAIL_FROM is the sender.
+func FromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "ecommerce <noreply@localhost>"
+	}
+
+	switch v := os.Getenv("MAILER"); v {
+	case "", "log":
+		return Log{}
+	case "smtp":
+		m, err := NewSMTP(os.Getenv("SMTP_ADDR"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+		if err != nil {
+			log.Fatalf("invalid smtp mailer: %s", err)
+		}
+		return m
+	case "file":
+		dir := os.Getenv("MAIL_DROP_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+
+		m, err := NewFile(dir, from)
+		if err != nil {
+			log.Fatalf("invalid file mailer: %s", err)
+		}
+		return m
+	default:
+		log.Fatalf("invalid MAILER: %q", v)
+		return nil
+	}
+}
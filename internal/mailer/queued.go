@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/escoutdoor/ecommerce/internal/jobs"
+)
+
+// sendJob sends a message queued by a Queued mailer.
+var sendJob = jobs.Kind[Message]{Name: "mail.send"}
+
+type queued struct {
+	queue *jobs.Queue
+}
+
+// Queued returns a Mailer that queues messages as jobs which send them
+// through m, so the caller does not wait for the mail server and a message
+// that could not be sent is retried. It has to be called before the queue
+// runs.
+func Queued(q *jobs.Queue, m Mailer) Mailer {
+	sendJob.Handle(q, m.Send)
+
+	return queued{queue: q}
+}
+
+func (m queued) Send(ctx context.Context, msg Message) error {
+	_, err := sendJob.Enqueue(ctx, m.queue, msg)
+	return err
+}
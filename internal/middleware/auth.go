@@ -2,49 +2,213 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/escoutdoor/ecommerce/internal/models"
 	"github.com/escoutdoor/ecommerce/internal/store"
 	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/apikey"
 	"github.com/escoutdoor/ecommerce/pkg/tokens"
 )
 
-func JWTAuth(s store.UserStorer) func(h http.Handler) http.Handler {
+var (
+	ErrInvalidAPIKey    = errors.New("invalid api key")
+	ErrAPIKeyScope      = errors.New("the api key has no scope for this route")
+	ErrAPIKeyNotAllowed = errors.New("this route cannot be used with an api key, log in instead")
+)
+
+// AuthStores are the stores JWTAuth checks credentials against.
+type AuthStores struct {
+	Users    store.UserStorer
+	Sessions store.SessionStorer
+	APIKeys  store.APIKeyStorer
+}
+
+// JWTAuth authenticates requests with an access token of a session that
+// was not revoked, sent as "Authorization: Bearer <token>", or with a
+// personal api key, sent as "Authorization: ApiKey <key>". Api keys are
+// only accepted by the route group if one of their scopes is group.
+func JWTAuth(s AuthStores, issuer *tokens.Issuer, group string) func(h http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			token := r.Header.Get("Authorization")
-			if len(token) == 0 {
-				respond.Error(w, http.StatusUnauthorized, respond.ErrUnauthorized)
-				return
-			}
-			token = token[len("Bearer "):]
+			var (
+				userID    int
+				twoFactor bool
+				sessionID string
+				apiKeyID  int
+			)
 
-			userID, err := tokens.VerifyToken(token)
-			if err != nil {
-				respond.Error(w, http.StatusUnauthorized, err)
+			scheme, credential, ok := authorization(r)
+			switch {
+			case ok && strings.EqualFold(scheme, "Bearer"):
+				claims, err := issuer.VerifyToken(credential)
+				if err != nil {
+					respond.Error(w, r, http.StatusUnauthorized, err)
+					return
+				}
+
+				userID, err = strconv.Atoi(claims.ID)
+				if err != nil {
+					respond.Error(w, r, http.StatusUnauthorized, respond.ErrUnauthorized)
+					return
+				}
+				twoFactor = contains(claims.AMR, "otp")
+
+				// tokens without a session predate sessions and cannot be
+				// revoked, so they are not accepted either
+				sessionID = claims.RegisteredClaims.ID
+				session, err := s.Sessions.Get(r.Context(), sessionID)
+				if err != nil {
+					if errors.Is(err, store.ErrSessionNotFound) {
+						respond.Error(w, r, http.StatusUnauthorized, err)
+						return
+					}
+
+					respond.Error(w, r, http.StatusInternalServerError, err)
+					return
+				}
+				if session.UserID != userID {
+					respond.Error(w, r, http.StatusUnauthorized, respond.ErrUnauthorized)
+					return
+				}
+			case ok && strings.EqualFold(scheme, "ApiKey"):
+				key, err := apiKey(r.Context(), s.APIKeys, credential)
+				if err != nil {
+					if errors.Is(err, ErrInvalidAPIKey) {
+						respond.Error(w, r, http.StatusUnauthorized, err)
+						return
+					}
+
+					respond.Error(w, r, http.StatusInternalServerError, err)
+					return
+				}
+				if !contains(key.Scopes, group) {
+					respond.Error(w, r, http.StatusForbidden, ErrAPIKeyScope)
+					return
+				}
+
+				userID, apiKeyID = key.UserID, key.ID
+			default:
+				respond.Error(w, r, http.StatusUnauthorized, respond.ErrUnauthorized)
 				return
 			}
 
-			user, err := s.GetByID(userID)
+			user, err := s.Users.GetByID(r.Context(), userID)
 			if err != nil {
-				respond.Error(w, http.StatusUnauthorized, err)
+				if errors.Is(err, store.ErrUserNotFound) {
+					respond.Error(w, r, http.StatusUnauthorized, respond.ErrUnauthorized)
+					return
+				}
+
+				respond.Error(w, r, http.StatusInternalServerError, err)
 				return
 			}
 
 			ctx := context.WithValue(r.Context(), "user_id", fmt.Sprintf("%d", userID))
 			ctx = context.WithValue(ctx, "role", user.Role)
+			ctx = context.WithValue(ctx, "two_factor", twoFactor)
+			if sessionID != "" {
+				ctx = context.WithValue(ctx, "session_id", sessionID)
+			}
+			if apiKeyID != 0 {
+				ctx = context.WithValue(ctx, "api_key_id", apiKeyID)
+			}
 			newReq := r.WithContext(ctx)
 			h.ServeHTTP(w, newReq)
 		})
 	}
 }
 
+// apiKey looks up the key and records its use.
+func apiKey(ctx context.Context, keys store.APIKeyStorer, credential string) (*models.APIKey, error) {
+	prefix, ok := apikey.Prefix(credential)
+	if !ok || keys == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := keys.GetByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+
+		return nil, err
+	}
+	if !apikey.Verify(credential, key.Hash) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := keys.Touch(ctx, key.ID); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// authorization returns the scheme and credentials of the Authorization
+// header.
+func authorization(r *http.Request) (scheme, credential string, ok bool) {
+	scheme, credential, ok = strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || len(credential) == 0 {
+		return "", "", false
+	}
+
+	return scheme, credential, true
+}
+
+// DenyAPIKeys refuses requests authenticated with an api key, for routes
+// that manage the account itself.
+func DenyAPIKeys(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value("api_key_id").(int); ok {
+			respond.Error(w, r, http.StatusForbidden, ErrAPIKeyNotAllowed)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+var ErrTwoFactorRequired = errors.New("two-factor authentication is required for this route, enable it and log in again")
+
+// RequireTwoFactor refuses requests whose token was issued without a second
+// factor when required is set.
+func RequireTwoFactor(required bool) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if !required {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, _ := r.Context().Value("two_factor").(bool); !ok {
+				respond.Error(w, r, http.StatusForbidden, ErrTwoFactorRequired)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
 func RoleGuard(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		role, ok := r.Context().Value("role").(string)
 		if !ok || role != "admin" {
-			respond.Error(w, http.StatusForbidden, respond.ErrForbidden)
+			respond.Error(w, r, http.StatusForbidden, respond.ErrForbidden)
 			return
 		}
 
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Deprecated marks every response as coming from a deprecated endpoint
+// (RFC 9745) that will be removed at sunset (RFC 8594), and links to the
+// same path under successor.
+func Deprecated(deprecatedAt, sunset time.Time, successor string) func(h http.Handler) http.Handler {
+	deprecation := fmt.Sprintf("@%d", deprecatedAt.Unix())
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetDate)
+			w.Header().Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successor, r.URL.Path))
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
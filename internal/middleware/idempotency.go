@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	chimiddle "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+var (
+	ErrIdempotencyKeyInvalid    = errors.New("idempotency key must be between 1 and 255 characters")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still being processed")
+)
+
+// Idempotency makes requests carrying an Idempotency-Key header safe to
+// retry. The first request with a key is handled and its response stored
+// for ttl; retries with the same method, path and body get the stored
+// response back instead of being handled again. Responses with a 5xx status
+// are not stored, so the request can be retried with the same key.
+//
+// A request holds its key for lease. Retries within the lease get a
+// conflict, a retry after it takes the key over, so a request that crashed
+// does not block its key until it expires. lease has to be longer than any
+// request takes.
+//
+// Keys are scoped to the authenticated user, or to the client address on
+// public routes, so it must run after JWTAuth.
+func Idempotency(s store.IdempotencyStorer, ttl, lease time.Duration) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if _, ok := r.Header[IdempotencyKeyHeader]; !ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if len(key) == 0 || len(key) > maxIdempotencyKeyLength {
+				respond.Error(w, r, http.StatusBadRequest, ErrIdempotencyKeyInvalid)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentRequestBytes))
+			if err != nil {
+				respond.Error(w, r, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scope := clientKey(r)
+			existing, reserved, err := s.Reserve(r.Context(), models.IdempotencyKey{
+				Scope:       scope,
+				Key:         key,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				Fingerprint: fingerprint(r, body),
+				ExpiresAt:   time.Now().Add(ttl),
+				LockedUntil: time.Now().Add(lease),
+			})
+			if err != nil {
+				respond.Error(w, r, http.StatusInternalServerError, err)
+				return
+			}
+
+			if !reserved {
+				switch {
+				case existing.Fingerprint != fingerprint(r, body):
+					respond.Error(w, r, http.StatusUnprocessableEntity, ErrIdempotencyKeyReused)
+				case existing.Status == nil:
+					w.Header().Set("Retry-After", "1")
+					respond.Error(w, r, http.StatusConflict, ErrIdempotencyKeyInProgress)
+				default:
+					replay(w, existing)
+				}
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			h.ServeHTTP(rec, r)
+
+			// the request context may already be done, the outcome must be
+			// recorded regardless or the key stays in progress until it expires
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if rec.status >= http.StatusInternalServerError {
+				err = s.Release(ctx, scope, key, existing.LockedUntil)
+			} else {
+				err = s.Complete(ctx, scope, key, existing.LockedUntil, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes())
+			}
+			if err != nil {
+				log.Printf("[%s] store idempotency key: %s", chimiddle.GetReqID(r.Context()), err)
+			}
+		})
+	}
+}
+
+// clientKey identifies the client making r, by the authenticated user if
+// there is one and by address otherwise.
+func clientKey(r *http.Request) string {
+	if userID, ok := r.Context().Value("user_id").(string); ok {
+		return "user:" + userID
+	}
+
+	return "ip:" + ClientIP(r)
+}
+
+// ClientIP returns the address of the client making r, without the port.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, k *models.IdempotencyKey) {
+	if len(k.ContentType) > 0 {
+		w.Header().Set("Content-Type", k.ContentType)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(*k.Status)
+	w.Write(k.Body)
+}
+
+// responseRecorder passes the response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
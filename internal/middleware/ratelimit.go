@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	chimiddle "github.com/go-chi/chi/v5/middleware"
+)
+
+var ErrRateLimited = errors.New("too many requests")
+
+// RateLimit allows every client limit.Burst requests per limit.Period to the
+// routes it wraps, sharing one bucket per client across the routes of group.
+// Clients are told their quota with the RateLimit headers of
+// draft-ietf-httpapi-ratelimit-headers. A zero limit disables limiting.
+//
+// Clients are keyed by user after JWTAuth and by address before it.
+func RateLimit(s store.RateLimitStorer, group string, limit models.RateLimit) func(h http.Handler) http.Handler {
+	policy := fmt.Sprintf("%d;w=%d", limit.Burst, int(limit.Period.Seconds()))
+
+	return func(h http.Handler) http.Handler {
+		if limit.Burst <= 0 {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := s.Take(r.Context(), group+":"+clientKey(r), limit)
+			if err != nil {
+				// an unavailable backend should not take the api down with it
+				log.Printf("[%s] rate limit: %s", chimiddle.GetReqID(r.Context()), err)
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", ceilSeconds(res.Reset))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", ceilSeconds(res.RetryAfter))
+				respond.Error(w, r, http.StatusTooManyRequests, ErrRateLimited)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Timeout bounds the request context, and with it every database query
+// issued while handling the request, to d.
+func Timeout(d time.Duration) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,360 @@
+// Package migrate applies the SQL migrations embedded in the binary and
+// records them in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// lockKey identifies the advisory lock held while migrating so that several
+// instances starting at once don't apply the same migration twice.
+const lockKey = 0x65636f6d
+
+var (
+	ErrNoMigrations = errors.New("no migrations to revert")
+
+	fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New loads migrations named <version>_<name>.up.sql and
+// <version>_<name>.down.sql from fsys.
+func New(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		m := fileRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, m[2])
+		}
+
+		if m[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest returns the version of the newest migration in fsys.
+func Latest(fsys fs.FS) (int64, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Latest returns the version of the newest known migration.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration, each in its own transaction, and
+// returns the ones it applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+
+				_, err := tx.ExecContext(ctx, `
+					INSERT INTO SCHEMA_MIGRATIONS(VERSION, NAME) VALUES($1, $2)
+				`, migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("apply %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+
+				_, err := tx.ExecContext(ctx, `
+					DELETE FROM SCHEMA_MIGRATIONS WHERE VERSION = $1
+				`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("revert %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		if len(reverted) == 0 {
+			return ErrNoMigrations
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status lists every known migration with the time it was applied, if it
+// was. It only reads, so it takes no lock and creates no table. A database
+// still migrated by the sqlx cli is reported from its table.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var table, legacy sql.NullString
+	err = conn.QueryRowContext(ctx, "SELECT TO_REGCLASS('schema_migrations')::TEXT, TO_REGCLASS('_sqlx_migrations')::TEXT").Scan(&table, &legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[int64]time.Time)
+	if table.Valid {
+		if done, err = appliedVersions(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+	if legacy.Valid {
+		imported, err := queryVersions(ctx, conn, "SELECT VERSION, INSTALLED_ON FROM _SQLX_MIGRATIONS WHERE SUCCESS")
+		if err != nil {
+			return nil, err
+		}
+		// like ensureTable, versions already recorded are kept
+		for version, appliedAt := range imported {
+			if _, ok := done[version]; !ok {
+				done[version] = appliedAt
+			}
+		}
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := done[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// locked runs fn on a single connection holding the migration advisory lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT PG_ADVISORY_LOCK($1)", lockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT PG_ADVISORY_UNLOCK($1)", lockKey)
+
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// ensureTable creates schema_migrations and, on databases previously
+// migrated with the sqlx cli, carries over the versions it recorded.
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS SCHEMA_MIGRATIONS(
+			VERSION BIGINT PRIMARY KEY,
+			NAME TEXT NOT NULL,
+			APPLIED_AT TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	var legacy sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT TO_REGCLASS('_sqlx_migrations')::TEXT").Scan(&legacy); err != nil {
+		return err
+	}
+	if !legacy.Valid {
+		return nil
+	}
+
+	// the legacy table is renamed once imported so that versions reverted
+	// later are not brought back on the next run
+	return inTx(ctx, conn, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO SCHEMA_MIGRATIONS(VERSION, NAME, APPLIED_AT)
+			SELECT VERSION, DESCRIPTION, INSTALLED_ON FROM _SQLX_MIGRATIONS WHERE SUCCESS
+			ON CONFLICT (VERSION) DO NOTHING
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "ALTER TABLE _SQLX_MIGRATIONS RENAME TO _SQLX_MIGRATIONS_IMPORTED")
+		return err
+	})
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int64]time.Time, error) {
+	return queryVersions(ctx, conn, "SELECT VERSION, APPLIED_AT FROM SCHEMA_MIGRATIONS")
+}
+
+// queryVersions reads the versions and times query selects.
+func queryVersions(ctx context.Context, conn *sql.Conn, query string) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+
+		versions[version] = appliedAt
+	}
+
+	return versions, rows.Err()
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
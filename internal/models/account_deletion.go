@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+const (
+	DeletionPending   = "pending"
+	DeletionCancelled = "cancelled"
+	DeletionCompleted = "completed"
+)
+
+// AccountDeletion is a request to delete an account. The user is anonymized
+// once ScheduledFor passes, unless the request is cancelled before. Requests
+// are kept afterwards as the record of who deleted the account and when.
+type AccountDeletion struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"user_id"`
+	Status string `json:"status"`
+	// RequestedBy is the user themselves or the admin who deleted the
+	// account for them.
+	RequestedBy  *int       `json:"requested_by,omitempty"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	CancelledBy  *int       `json:"cancelled_by,omitempty"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+}
+
+// PersonalData is everything stored about a user, as exported to them.
+type PersonalData struct {
+	ExportedAt time.Time `json:"exported_at"`
+	Profile    User      `json:"profile"`
+	// Addresses are the shipping details of the user's orders.
+	Addresses        []ShippingDetails `json:"addresses"`
+	Orders           []Order           `json:"orders"`
+	Identities       []Identity        `json:"identities"`
+	APIKeys          []APIKey          `json:"api_keys"`
+	TwoFactorEnabled bool              `json:"two_factor_enabled"`
+	// Notifications are the defaults unless the user changed them.
+	Notifications NotificationPreferences `json:"notifications"`
+	Deletion      *AccountDeletion        `json:"deletion,omitempty"`
+}
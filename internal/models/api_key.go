@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// APIKeyReq creates a key. Each scope allows the route group of the same
+// name.
+type APIKeyReq struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=users categories products orders"`
+}
+
+// CreatedAPIKey is only returned when the key is created, it cannot be shown
+// again.
+type CreatedAPIKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
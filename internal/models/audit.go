@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records one change made by an admin, or a login. Entries are
+// only ever appended, each one includes the hash of the entry before it, so
+// changing or removing an entry breaks the chain from there on.
+type AuditEntry struct {
+	ID int64 `json:"id"`
+	// ActorID is the user who made the change, nil for failed logins.
+	ActorID    *int   `json:"actor_id,omitempty"`
+	Action     string `json:"action"`
+	EntityType string `json:"entity_type"`
+	EntityID   string `json:"entity_id,omitempty"`
+	// Before and After hold the fields of the entity that changed, Before
+	// is empty for created entities and After for deleted ones.
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	IP        string          `json:"ip"`
+	RequestID string          `json:"request_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+// AuditFilter selects audit entries, zero fields match every entry.
+type AuditFilter struct {
+	ActorID    *int
+	Action     string
+	EntityType string
+	EntityID   string
+	Since      *time.Time
+	Until      *time.Time
+	// BeforeID continues a listing after its last entry.
+	BeforeID int64
+	Limit    int
+}
+
+// AuditVerification is the result of checking the hash chain.
+type AuditVerification struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// BrokenAt is the first entry whose hash does not match, set when the
+	// log is not valid.
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+}
@@ -6,23 +6,42 @@ import (
 
 type LoginReq struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6,containsany=!@#?*"`
+	Password string `json:"password" validate:"required"`
 }
 
 type RegisterReq struct {
 	Email       string `json:"email" validate:"required,email"`
 	FirstName   string `json:"first_name" validate:"required,min=2"`
 	LastName    string `json:"last_name" validate:"omitempty,min=2"`
-	Password    string `json:"password" validate:"required,min=6,containsany=!@#?*"`
+	Password    string `json:"password" validate:"required,password"`
 	DateOfBirth string `json:"date_of_birth" validate:"omitempty"`
+	// Locale is the language of the emails sent to the user, taken from
+	// the Accept-Language header if left out.
+	Locale string `json:"locale,omitempty" validate:"omitempty,locale"`
 }
 
 type TokenClaims struct {
 	jwt.RegisteredClaims
 	ID string `json:"id"`
+	// Purpose is empty for access tokens and names what other tokens may
+	// only be used for.
+	Purpose string `json:"purpose,omitempty"`
+	// AMR lists the authentication methods used to log in (RFC 8176).
+	AMR []string `json:"amr,omitempty"`
 }
 
 type AuthResponse struct {
 	*User
 	Token string `json:"token"`
 }
+
+// LoginResponse is an AuthResponse, unless the user has two-factor
+// authentication enabled. Then it only holds the challenge token to send
+// with a code to /auth/login/2fa.
+type LoginResponse struct {
+	*User
+	Token string `json:"token,omitempty"`
+
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types written to the outbox.
+const (
+	EventOrderCreated        = "order.created"
+	EventOrderStatusChanged  = "order.status_changed"
+	EventUserRegistered      = "user.registered"
+	EventProductPriceChanged = "product.price_changed"
+)
+
+// Event is a change recorded in the outbox in the same transaction as the
+// change itself. Data holds one of the payloads below, depending on Type.
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	// Attempts counts the deliveries started, including the current one.
+	Attempts int `json:"-"`
+}
+
+type OrderCreated struct {
+	Order Order `json:"order"`
+}
+
+// OrderStatusChanged is written when the status of an item of an order
+// changes, statuses are kept per item.
+type OrderStatusChanged struct {
+	OrderID   int    `json:"order_id"`
+	ItemID    int    `json:"item_id"`
+	UserID    int    `json:"user_id"`
+	OldStatus string `json:"old_status"`
+	NewStatus string `json:"new_status"`
+}
+
+// OrderStatusUpdate is pushed to the event stream of an order for every
+// OrderStatusChanged event, with the ID of the event.
+type OrderStatusUpdate struct {
+	OrderID   int       `json:"order_id"`
+	ItemID    int       `json:"item_id"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type UserRegistered struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+	// Method is "password", or the provider of the identity the user
+	// signed up with.
+	Method string `json:"method"`
+}
+
+type ProductPriceChanged struct {
+	ProductID int     `json:"product_id"`
+	OldPrice  float64 `json:"old_price"`
+	NewPrice  float64 `json:"new_price"`
+}
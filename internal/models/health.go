@@ -0,0 +1,22 @@
+package models
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status          string     `json:"status"`
+	Error           string     `json:"error,omitempty"`
+	Version         int64      `json:"version,omitempty"`
+	ExpectedVersion int64      `json:"expected_version,omitempty"`
+	Pool            *PoolStats `json:"pool,omitempty"`
+}
+
+type PoolStats struct {
+	MaxOpen int   `json:"max_open"`
+	Open    int   `json:"open"`
+	InUse   int   `json:"in_use"`
+	Idle    int   `json:"idle"`
+	Waiting int64 `json:"wait_count"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// IdempotencyKey records the first request made with an Idempotency-Key
+// header and, once it finished, the response to replay for retries.
+type IdempotencyKey struct {
+	Scope       string
+	Key         string
+	Method      string
+	Path        string
+	Fingerprint string
+	// Status is nil while the first request is still being handled.
+	Status      *int
+	ContentType string
+	Body        []byte
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// LockedUntil is when a request that is still being handled loses the
+	// key to a retry. It identifies the reservation, the request completes
+	// or releases the key only while it still holds it.
+	LockedUntil time.Time
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Identity links a user to their account at an OpenID Connect provider.
+type Identity struct {
+	ID       int    `json:"-"`
+	UserID   int    `json:"-"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	Email    string `json:"email"`
+
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
+
+// OIDCState is a login that was sent to a provider and has not come back
+// yet.
+type OIDCState struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
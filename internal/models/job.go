@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Job statuses. Jobs are deleted once they succeed.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobFailed  = "failed"
+)
+
+// Job is a unit of work run by the workers of the job queue.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	// RunAt is when the job is due, for a queued job the next attempt.
+	RunAt       time.Time  `json:"run_at"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FailedAt    *time.Time `json:"failed_at,omitempty"`
+}
+
+// JobFilter selects jobs, zero fields match every job.
+type JobFilter struct {
+	Status   string
+	Kind     string
+	BeforeID int64
+	Limit    int
+}
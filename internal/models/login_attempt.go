@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginAttempt counts the failed logins of an account or client address
+// since the failure window last expired.
+type LoginAttempt struct {
+	Key          string
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// NotificationPreferences are the emails a user wants about their orders
+// and the language they are written in. Account emails, e.g. the welcome
+// email or a password change, are always sent.
+type NotificationPreferences struct {
+	UserID int `json:"-"`
+	// Locale is empty until the user picks one, emails then use the
+	// default locale.
+	Locale      string    `json:"locale"`
+	OrderPlaced bool      `json:"order_placed"`
+	OrderStatus bool      `json:"order_status"`
+	Refunds     bool      `json:"refunds"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type NotificationPreferencesReq struct {
+	Locale      string `json:"locale" validate:"omitempty,locale"`
+	OrderPlaced bool   `json:"order_placed"`
+	OrderStatus bool   `json:"order_status"`
+	Refunds     bool   `json:"refunds"`
+}
@@ -60,3 +60,7 @@ type ShippingDetailsReq struct {
 	Country      string `json:"country" validate:"required,min=3"`
 	Notes        string `json:"notes" validate:"omitempty"`
 }
+
+type OrderItemStatusReq struct {
+	Status string `json:"status" validate:"required,oneof=pending processing shipped delivered cancelled refunded"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// RateLimit is a token bucket holding Burst tokens that refills completely
+// every Period. Every request takes one token.
+type RateLimit struct {
+	Burst  int
+	Period time.Duration
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token, zero if Allowed.
+	RetryAfter time.Duration
+}
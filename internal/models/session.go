@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Session is a login, each access token belongs to one. Deleting the
+// session revokes the token before it expires.
+type Session struct {
+	ID        string
+	UserID    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// TwoFactor is the TOTP enrollment of a user. It only guards logins once
+// EnabledAt is set, after the user proved their app generates valid codes.
+type TwoFactor struct {
+	UserID int
+	Secret string
+	// RecoveryCodes are the sha256 hashes of the unused recovery codes.
+	RecoveryCodes []string
+	// LastUsedStep is the time step of the last accepted code, codes of it
+	// and earlier steps are refused so a code can only be used once.
+	LastUsedStep int64
+	EnabledAt    *time.Time
+	CreatedAt    time.Time
+}
+
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// provisioning uri to render as a QR code.
+	URI string `json:"otpauth_uri"`
+}
+
+type TwoFactorCodeReq struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type TwoFactorLoginReq struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	// Code is a code from the authenticator app or an unused recovery code.
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
@@ -15,9 +15,42 @@ type User struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// UpdateUserReq updates the profile. Email can only be left out or set to
+// the current address, a new one has to be confirmed with ChangeEmailReq.
 type UpdateUserReq struct {
-	Email       string `json:"email" validate:"required,email"`
+	Email       string `json:"email,omitempty" validate:"omitempty,email"`
 	FirstName   string `json:"first_name" validate:"required,min=2"`
 	LastName    string `json:"last_name,omitempty" validate:"omitempty,min=2"`
 	DateOfBirth string `json:"date_of_birth" validate:"omitempty"`
 }
+
+type ChangePasswordReq struct {
+	// CurrentPassword is not needed by users without a password yet, who
+	// logged in with a provider within the last few minutes instead.
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" validate:"required,password"`
+}
+
+type ChangeEmailReq struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password"`
+}
+
+// DeleteAccountReq confirms deleting the account like ChangePasswordReq
+// confirms a new password.
+type DeleteAccountReq struct {
+	Password string `json:"password"`
+}
+
+type ConfirmEmailReq struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// EmailChange is a new email address waiting for confirmation.
+type EmailChange struct {
+	UserID    int
+	Email     string
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook delivery statuses. Deliveries are retried while pending and turn
+// dead after the last attempt failed.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead"
+)
+
+// Webhook posts the events of the given types to a partner's url, signed
+// with its secret.
+type Webhook struct {
+	ID         int      `json:"id"`
+	URL        string   `json:"url"`
+	Secret     string   `json:"-"`
+	EventTypes []string `json:"event_types"`
+	Active     bool     `json:"active"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type WebhookReq struct {
+	URL        string   `json:"url" validate:"required,http_url"`
+	EventTypes []string `json:"event_types" validate:"required,min=1,dive,oneof=order.created order.status_changed"`
+	// Active defaults to true.
+	Active *bool `json:"active"`
+}
+
+// CreatedWebhook is returned once, when the webhook is created, and is the
+// only response that includes the secret.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookDelivery is one event to post to one webhook, and the outcome of
+// the last attempt.
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int    `json:"webhook_id"`
+	EventID   int64  `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Payload is the body posted to the webhook.
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// WebhookDeliveryFilter selects deliveries of a webhook, zero fields match
+// every delivery.
+type WebhookDeliveryFilter struct {
+	Status   string
+	BeforeID int64
+	Limit    int
+}
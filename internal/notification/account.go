@@ -0,0 +1,55 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+// The emails about an account are sent whatever the preferences of the
+// user, only their locale is used.
+
+// PasswordChanged tells user that their password was changed.
+func (n *Notifier) PasswordChanged(ctx context.Context, user *models.User) error {
+	return n.account(ctx, user.Email, user, tmplPasswordChanged, accountData{})
+}
+
+// ConfirmEmail sends the token that confirms email as the new address of
+// user to that address.
+func (n *Notifier) ConfirmEmail(ctx context.Context, user *models.User, email, token string) error {
+	return n.account(ctx, email, user, tmplConfirmEmail, accountData{Email: email, Token: token})
+}
+
+// EmailChanged tells the previous address of user that the account now
+// uses email.
+func (n *Notifier) EmailChanged(ctx context.Context, user *models.User, email string) error {
+	return n.account(ctx, user.Email, user, tmplEmailChanged, accountData{Email: email})
+}
+
+// AccountLocked tells user that their account is locked until the given
+// time after attempts failed logins.
+func (n *Notifier) AccountLocked(ctx context.Context, user *models.User, attempts int, until time.Time) error {
+	return n.account(ctx, user.Email, user, tmplAccountLocked, accountData{Attempts: attempts, At: until})
+}
+
+// DeletionScheduled tells user that their account is deleted at the given
+// time unless they cancel it.
+func (n *Notifier) DeletionScheduled(ctx context.Context, user *models.User, at time.Time) error {
+	return n.account(ctx, user.Email, user, tmplDeletionScheduled, accountData{At: at})
+}
+
+// AccountDeleted tells user that their account was deleted. user is the
+// account as it was before, the preferences outlive the deletion.
+func (n *Notifier) AccountDeleted(ctx context.Context, user *models.User) error {
+	return n.account(ctx, user.Email, user, tmplAccountDeleted, accountData{})
+}
+
+func (n *Notifier) account(ctx context.Context, to string, user *models.User, name string, data accountData) error {
+	prefs, err := n.prefs.Preferences(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return n.sendTo(ctx, to, user, prefs, name, mailData{Account: &data})
+}
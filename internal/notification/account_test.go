@@ -0,0 +1,110 @@
+package notification
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/mailer"
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store/memstore"
+)
+
+// outbox keeps the messages instead of sending them.
+type outbox struct {
+	sent []mailer.Message
+}
+
+func (o *outbox) Send(_ context.Context, msg mailer.Message) error {
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+// newTestNotifier returns a notifier with a user who reads locale, and
+// where the emails it sends end up.
+func newTestNotifier(t *testing.T, locale string) (*Notifier, *models.User, *outbox) {
+	t.Helper()
+
+	templates, err := LoadTemplates("en")
+	if err != nil {
+		t.Fatalf("load templates: %s", err)
+	}
+
+	db := memstore.NewDB()
+	user, err := memstore.NewAuthStore(db).Register(context.Background(), models.RegisterReq{
+		Email:     "olena@example.com",
+		FirstName: "Olena",
+		Password:  "Secret123!",
+		Locale:    locale,
+	})
+	if err != nil {
+		t.Fatalf("register: %s", err)
+	}
+
+	out := &outbox{}
+	n := NewNotifier(memstore.NewUserStore(db), memstore.NewOrderStore(db), memstore.NewProductStore(db), memstore.NewNotificationStore(db), out, templates, "Shop")
+
+	return n, user, out
+}
+
+func TestAccountEmailsUseLocale(t *testing.T) {
+	until := time.Date(2026, time.March, 5, 14, 30, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		locale  string
+		subject string
+		text    []string
+	}{
+		{"en", "Your account has been locked", []string{"Hi Olena,", "there were 5 failed attempts", "5 March 2026 14:30 UTC"}},
+		{"uk", "Ваш обліковий запис заблоковано", []string{"Вітаємо, Olena!", "Було 5 невдалих спроб", "5 березня 2026 14:30 UTC"}},
+	} {
+		n, user, out := newTestNotifier(t, tc.locale)
+
+		if err := n.AccountLocked(context.Background(), user, 5, until); err != nil {
+			t.Fatalf("%s: send: %s", tc.locale, err)
+		}
+		if len(out.sent) != 1 {
+			t.Fatalf("%s: sent %d emails, want 1", tc.locale, len(out.sent))
+		}
+
+		msg := out.sent[0]
+		if msg.To != user.Email {
+			t.Errorf("%s: sent to %q, want %q", tc.locale, msg.To, user.Email)
+		}
+		if msg.Subject != tc.subject {
+			t.Errorf("%s: subject %q, want %q", tc.locale, msg.Subject, tc.subject)
+		}
+		for _, want := range tc.text {
+			if !strings.Contains(msg.Text, want) || !strings.Contains(msg.HTML, want) {
+				t.Errorf("%s: email does not contain %q:\n%s", tc.locale, want, msg.Text)
+			}
+		}
+		// the order email settings do not control account emails
+		if !strings.HasSuffix(msg.Text, "\n--\nShop\n") {
+			t.Errorf("%s: account email has the order settings footer:\n%s", tc.locale, msg.Text)
+		}
+	}
+}
+
+func TestConfirmEmailGoesToNewAddress(t *testing.T) {
+	n, user, out := newTestNotifier(t, "")
+
+	if err := n.ConfirmEmail(context.Background(), user, "new@example.com", "token123"); err != nil {
+		t.Fatalf("send: %s", err)
+	}
+	if len(out.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(out.sent))
+	}
+
+	msg := out.sent[0]
+	if msg.To != "new@example.com" {
+		t.Errorf("sent to %q, want the new address", msg.To)
+	}
+	if msg.Subject != "Confirm your new email address" {
+		t.Errorf("subject %q, want the default locale", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "token123") {
+		t.Errorf("email does not contain the token:\n%s", msg.Text)
+	}
+}
@@ -0,0 +1,126 @@
+package notification
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Locales are the languages the emails are written in.
+var Locales = []string{"en", "uk"}
+
+// LocaleTag is the validate tag of fields holding a locale.
+const LocaleTag = "locale"
+
+// RegisterValidation makes v check that fields tagged with LocaleTag hold
+// one of Locales.
+func RegisterValidation(v *validator.Validate) error {
+	return v.RegisterValidation(LocaleTag, func(fl validator.FieldLevel) bool {
+		return supported(fl.Field().String())
+	})
+}
+
+// MatchLocale returns the locale an Accept-Language header prefers most,
+// or "" if it names none of Locales.
+func MatchLocale(header string) string {
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if !supported(lang) {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if v, ok := cutPrefix(strings.TrimSpace(p), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+
+	return best
+}
+
+func supported(locale string) bool {
+	for _, l := range Locales {
+		if l == locale {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+
+	return s[len(prefix):], true
+}
+
+// statusNames are the item statuses as shown to customers.
+var statusNames = map[string]map[string]string{
+	"en": {
+		"pending":    "pending",
+		"processing": "processing",
+		"shipped":    "shipped",
+		"delivered":  "delivered",
+		"cancelled":  "cancelled",
+		"refunded":   "refunded",
+	},
+	"uk": {
+		"pending":    "очікує",
+		"processing": "обробляється",
+		"shipped":    "відправлено",
+		"delivered":  "доставлено",
+		"cancelled":  "скасовано",
+		"refunded":   "кошти повернено",
+	},
+}
+
+// monthNames are the months in the genitive, as they are written in dates,
+// for the locales whose names differ from the English ones.
+var monthNames = map[string][12]string{
+	"uk": {"січня", "лютого", "березня", "квітня", "травня", "червня", "липня", "серпня", "вересня", "жовтня", "листопада", "грудня"},
+}
+
+// funcs returns the template functions formatting values for locale.
+func funcs(locale string) map[string]any {
+	return map[string]any{
+		"status": func(status string) string {
+			if name, ok := statusNames[locale][status]; ok {
+				return name
+			}
+			return status
+		},
+		"money": func(amount float64) string {
+			s := fmt.Sprintf("%.2f", amount)
+			if locale == "uk" {
+				s = strings.Replace(s, ".", ",", 1)
+			}
+			return s
+		},
+		"date": func(t time.Time) string {
+			t = t.UTC()
+			names, ok := monthNames[locale]
+			if !ok {
+				return t.Format("2 January 2006 15:04 MST")
+			}
+			return fmt.Sprintf("%d %s %d %s", t.Day(), names[t.Month()-1], t.Year(), t.Format("15:04 MST"))
+		},
+	}
+}
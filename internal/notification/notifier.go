@@ -0,0 +1,256 @@
+// Package notification sends customers the emails about their account and
+// orders, written from templates in their language.
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/mailer"
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+// Events are the event types the notifier sends emails for.
+var Events = []string{
+	models.EventUserRegistered,
+	models.EventOrderCreated,
+	models.EventOrderStatusChanged,
+}
+
+// notifiedStatuses are the item statuses customers get an email about,
+// the others are steps of the shop they do not need to follow. Refunds
+// have an email of their own.
+var notifiedStatuses = map[string]bool{
+	"shipped":   true,
+	"delivered": true,
+	"cancelled": true,
+}
+
+// mailData is what the templates are rendered with, not every email fills
+// all of it.
+type mailData struct {
+	Shop      string
+	FirstName string
+	Order     *orderData
+	Item      *itemData
+	Account   *accountData
+}
+
+type orderData struct {
+	ID    int
+	Total float64
+	Items []itemData
+}
+
+// accountData is what the emails about an account are rendered with,
+// their footer leaves out the order email settings.
+type accountData struct {
+	// Email is the new address of an email change.
+	Email    string
+	Token    string
+	Attempts int
+	// At is when a lock ends or a deletion is due.
+	At time.Time
+}
+
+type itemData struct {
+	Product  string
+	Quantity int
+	Status   string
+}
+
+// Notifier turns events into emails. Its Handle subscribes to the bus, the
+// emails are sent through the given mailer, which should queue them.
+type Notifier struct {
+	users     store.UserStorer
+	orders    store.OrderStorer
+	products  store.ProductStorer
+	prefs     store.NotificationStorer
+	mailer    mailer.Mailer
+	templates *Templates
+	shop      string
+}
+
+func NewNotifier(users store.UserStorer, orders store.OrderStorer, products store.ProductStorer, prefs store.NotificationStorer, m mailer.Mailer, templates *Templates, shop string) *Notifier {
+	return &Notifier{
+		users:     users,
+		orders:    orders,
+		products:  products,
+		prefs:     prefs,
+		mailer:    m,
+		templates: templates,
+		shop:      shop,
+	}
+}
+
+// Handle sends the email about e, unless the user turned it off. Events
+// come at least once, an event that was notified already is skipped.
+func (n *Notifier) Handle(ctx context.Context, e models.Event) error {
+	notified, err := n.prefs.Notified(ctx, e.ID)
+	if err != nil {
+		return err
+	}
+	if notified {
+		return nil
+	}
+
+	switch e.Type {
+	case models.EventUserRegistered:
+		err = n.registered(ctx, e)
+	case models.EventOrderCreated:
+		err = n.orderPlaced(ctx, e)
+	case models.EventOrderStatusChanged:
+		err = n.statusChanged(ctx, e)
+	}
+	if err != nil {
+		return err
+	}
+
+	return n.prefs.MarkNotified(ctx, e.ID)
+}
+
+// registered welcomes a new user. It is always sent, there are no
+// preferences to turn it off yet.
+func (n *Notifier) registered(ctx context.Context, e models.Event) error {
+	var data models.UserRegistered
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return err
+	}
+
+	user, prefs, err := n.recipient(ctx, data.UserID)
+	if err != nil || user == nil {
+		return err
+	}
+
+	return n.send(ctx, user, prefs, tmplRegistered, mailData{})
+}
+
+func (n *Notifier) orderPlaced(ctx context.Context, e models.Event) error {
+	var data models.OrderCreated
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return err
+	}
+
+	user, prefs, err := n.recipient(ctx, data.Order.UserID)
+	if err != nil || user == nil || !prefs.OrderPlaced {
+		return err
+	}
+
+	order := &orderData{ID: data.Order.ID, Total: data.Order.Total}
+	for _, item := range data.Order.OrderItems {
+		line, err := n.item(ctx, item)
+		if err != nil {
+			return err
+		}
+		order.Items = append(order.Items, *line)
+	}
+
+	return n.send(ctx, user, prefs, tmplOrderPlaced, mailData{Order: order})
+}
+
+func (n *Notifier) statusChanged(ctx context.Context, e models.Event) error {
+	var data models.OrderStatusChanged
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return err
+	}
+
+	name := tmplOrderStatus
+	if data.NewStatus == "refunded" {
+		name = tmplOrderRefunded
+	} else if !notifiedStatuses[data.NewStatus] {
+		return nil
+	}
+
+	user, prefs, err := n.recipient(ctx, data.UserID)
+	if err != nil || user == nil {
+		return err
+	}
+	if (name == tmplOrderRefunded && !prefs.Refunds) || (name == tmplOrderStatus && !prefs.OrderStatus) {
+		return nil
+	}
+
+	order, err := n.orders.GetByID(ctx, data.OrderID)
+	if err != nil {
+		// a deleted order has nothing left to tell about
+		if errors.Is(err, store.ErrOrderNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	item, err := n.orders.GetItem(ctx, data.OrderID, data.ItemID)
+	if err != nil {
+		if errors.Is(err, store.ErrOrderItemNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	line, err := n.item(ctx, *item)
+	if err != nil {
+		return err
+	}
+	// the status the event is about, the item may have moved on
+	line.Status = data.NewStatus
+
+	return n.send(ctx, user, prefs, name, mailData{
+		Order: &orderData{ID: order.ID, Total: order.Total},
+		Item:  line,
+	})
+}
+
+// recipient returns the user and their preferences, or no user if they
+// were deleted meanwhile.
+func (n *Notifier) recipient(ctx context.Context, userID int) (*models.User, *models.NotificationPreferences, error) {
+	user, err := n.users.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	prefs, err := n.prefs.Preferences(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, prefs, nil
+}
+
+func (n *Notifier) item(ctx context.Context, item models.OrderItem) (*itemData, error) {
+	line := &itemData{Quantity: item.Quantity, Status: item.Status}
+
+	product, err := n.products.GetByID(ctx, item.ProductID)
+	switch {
+	case err == nil:
+		line.Product = product.Name
+	case errors.Is(err, store.ErrProductNotFound):
+		line.Product = fmt.Sprintf("#%d", item.ProductID)
+	default:
+		return nil, err
+	}
+
+	return line, nil
+}
+
+func (n *Notifier) send(ctx context.Context, user *models.User, prefs *models.NotificationPreferences, name string, data mailData) error {
+	return n.sendTo(ctx, user.Email, user, prefs, name, data)
+}
+
+func (n *Notifier) sendTo(ctx context.Context, to string, user *models.User, prefs *models.NotificationPreferences, name string, data mailData) error {
+	data.Shop = n.shop
+	data.FirstName = user.FirstName
+
+	msg, err := n.templates.Render(prefs.Locale, name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+
+	return n.mailer.Send(ctx, msg)
+}
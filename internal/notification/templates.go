@@ -0,0 +1,128 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/escoutdoor/ecommerce/internal/mailer"
+)
+
+// The templates of an email live in templates/<locale>/<name>.txt, which
+// defines its "subject" and "text", and <name>.html, which defines the
+// "content" put into layout.html. Both end with the "footer" of the locale.
+//
+//go:embed templates
+var files embed.FS
+
+const (
+	tmplRegistered    = "registered"
+	tmplOrderPlaced   = "order_placed"
+	tmplOrderStatus   = "order_status"
+	tmplOrderRefunded = "order_refunded"
+
+	tmplPasswordChanged   = "password_changed"
+	tmplConfirmEmail      = "confirm_email"
+	tmplEmailChanged      = "email_changed"
+	tmplAccountLocked     = "account_locked"
+	tmplDeletionScheduled = "deletion_scheduled"
+	tmplAccountDeleted    = "account_deleted"
+)
+
+var templateNames = []string{
+	tmplRegistered, tmplOrderPlaced, tmplOrderStatus, tmplOrderRefunded,
+	tmplPasswordChanged, tmplConfirmEmail, tmplEmailChanged, tmplAccountLocked, tmplDeletionScheduled, tmplAccountDeleted,
+}
+
+// Templates renders the notification emails in every locale.
+type Templates struct {
+	defaultLocale string
+	text          map[string]*texttemplate.Template
+	html          map[string]*htmltemplate.Template
+}
+
+// page is what layout.html is rendered with.
+type page struct {
+	Lang    string
+	Subject string
+	Data    any
+}
+
+// LoadTemplates parses the templates of every locale. Emails to users
+// without a locale are written in defaultLocale.
+func LoadTemplates(defaultLocale string) (*Templates, error) {
+	if !supported(defaultLocale) {
+		return nil, fmt.Errorf("unsupported default locale %q, want one of %s", defaultLocale, strings.Join(Locales, ", "))
+	}
+
+	fsys, err := fs.Sub(files, "templates")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{
+		defaultLocale: defaultLocale,
+		text:          make(map[string]*texttemplate.Template),
+		html:          make(map[string]*htmltemplate.Template),
+	}
+	for _, locale := range Locales {
+		for _, name := range templateNames {
+			key := locale + "/" + name
+
+			text, err := texttemplate.New(name).Funcs(texttemplate.FuncMap(funcs(locale))).ParseFS(fsys, locale+"/footer.txt", key+".txt")
+			if err != nil {
+				return nil, err
+			}
+			html, err := htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcs(locale))).ParseFS(fsys, "layout.html", locale+"/footer.html", key+".html")
+			if err != nil {
+				return nil, err
+			}
+
+			if text.Lookup("subject") == nil || text.Lookup("text") == nil || html.Lookup("content") == nil {
+				return nil, fmt.Errorf("template %s is incomplete, it needs subject, text and content", key)
+			}
+
+			t.text[key] = text
+			t.html[key] = html
+		}
+	}
+
+	return t, nil
+}
+
+// Render writes the email name in locale, or in the default locale if
+// locale is not supported. The recipient is left to the caller.
+func (t *Templates) Render(locale, name string, data any) (mailer.Message, error) {
+	if !supported(locale) {
+		locale = t.defaultLocale
+	}
+
+	key := locale + "/" + name
+	text, ok := t.text[key]
+	if !ok {
+		return mailer.Message{}, fmt.Errorf("unknown email template %s", name)
+	}
+
+	var subject, body, html bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return mailer.Message{}, err
+	}
+	if err := text.ExecuteTemplate(&body, "text", data); err != nil {
+		return mailer.Message{}, err
+	}
+
+	msg := mailer.Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+	}
+	if err := t.html[key].ExecuteTemplate(&html, "layout", page{Lang: locale, Subject: msg.Subject, Data: data}); err != nil {
+		return mailer.Message{}, err
+	}
+	msg.HTML = html.String()
+
+	return msg, nil
+}
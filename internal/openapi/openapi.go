@@ -0,0 +1,305 @@
+// Package openapi builds an OpenAPI 3.1 document from a chi route table and
+// the request and response types of each operation.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const Version = "3.1.0"
+
+var paramRe = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// PathItem maps lower case http methods to operations.
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Operation describes one route of the router. Request and Response are
+// zero values of the body types, nil when there is no body.
+type Operation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tag         string
+	// Security lists the names of the security schemes accepted, empty
+	// for public routes.
+	Security   []string
+	Deprecated bool
+	// Parameters are documented after the path parameters, which are
+	// taken from Path.
+	Parameters []Parameter
+
+	Request  any
+	Response any
+	// ResponseContentType is the media type of Response, application/json
+	// if empty. For text/event-stream Response is the data of one event.
+	ResponseContentType string
+	SuccessStatus       int
+	ErrorStatuses       []int
+	Headers             map[string]Header
+}
+
+// Spec is the set of documented operations of an api.
+type Spec struct {
+	Info            Info
+	SecuritySchemes map[string]SecurityScheme
+	// ErrorContentType and ErrorBody describe the body of every error
+	// response.
+	ErrorContentType string
+	ErrorBody        any
+	Operations       []Operation
+}
+
+// Build walks routes and documents every route with its operation. It
+// returns an error listing routes without an operation and operations
+// without a route, so the document cannot silently drift from the router.
+func Build(spec Spec, routes chi.Routes) (*Document, error) {
+	ops := make(map[string]Operation, len(spec.Operations))
+	for _, op := range spec.Operations {
+		ops[key(op.Method, op.Path)] = op
+	}
+
+	gen := NewGenerator()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    spec.Info,
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas:         gen.Schemas,
+			SecuritySchemes: spec.SecuritySchemes,
+		},
+	}
+
+	var errorSchema *Schema
+	if spec.ErrorBody != nil {
+		errorSchema = gen.Of(spec.ErrorBody)
+	}
+
+	var drift []string
+	seen := make(map[string]bool)
+
+	walkErr := chi.Walk(routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		path := normalize(route)
+		k := key(method, path)
+		if seen[k] {
+			return nil
+		}
+		seen[k] = true
+
+		op, ok := ops[k]
+		if !ok {
+			drift = append(drift, fmt.Sprintf("route %s %s is not documented", method, path))
+			return nil
+		}
+
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = make(PathItem)
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(method)] = operationObject(gen, op, path, spec.ErrorContentType, errorSchema)
+
+		return nil
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	for k, op := range ops {
+		if !seen[k] {
+			drift = append(drift, fmt.Sprintf("operation %s %s has no route", op.Method, op.Path))
+		}
+	}
+
+	if len(drift) > 0 {
+		sort.Strings(drift)
+		return doc, fmt.Errorf("openapi document and router drifted apart:\n  %s", strings.Join(drift, "\n  "))
+	}
+
+	return doc, nil
+}
+
+func operationObject(gen *Generator, op Operation, path, errorContentType string, errorSchema *Schema) *OperationObject {
+	obj := &OperationObject{
+		OperationID: operationID(op.Method, path),
+		Summary:     op.Summary,
+		Description: op.Description,
+		Deprecated:  op.Deprecated,
+		Responses:   make(map[string]Response),
+	}
+	if op.Tag != "" {
+		obj.Tags = []string{op.Tag}
+	}
+
+	for _, m := range paramRe.FindAllStringSubmatch(path, -1) {
+		// ids are integers, other path parameters are names
+		typ := "string"
+		if m[1] == "id" || strings.HasSuffix(m[1], "_id") {
+			typ = "integer"
+		}
+
+		obj.Parameters = append(obj.Parameters, Parameter{
+			Name:     m[1],
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: typ},
+		})
+	}
+
+	obj.Parameters = append(obj.Parameters, op.Parameters...)
+
+	for _, name := range op.Security {
+		obj.Security = append(obj.Security, map[string][]string{name: {}})
+	}
+
+	if op.Request != nil {
+		obj.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {Schema: gen.Of(op.Request)},
+			},
+		}
+	}
+
+	status := op.SuccessStatus
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	success := Response{Description: http.StatusText(status), Headers: op.Headers}
+	if op.Response != nil {
+		contentType := op.ResponseContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+
+		success.Content = map[string]MediaType{
+			contentType: {Schema: gen.Of(op.Response)},
+		}
+	}
+	obj.Responses[fmt.Sprint(status)] = success
+
+	for _, status := range op.ErrorStatuses {
+		resp := Response{Description: http.StatusText(status)}
+		if errorSchema != nil {
+			resp.Content = map[string]MediaType{
+				errorContentType: {Schema: errorSchema},
+			}
+		}
+
+		obj.Responses[fmt.Sprint(status)] = resp
+	}
+
+	return obj
+}
+
+func key(method, path string) string {
+	return strings.ToUpper(method) + " " + path
+}
+
+// normalize strips the trailing slash chi keeps on sub-router index routes
+// and any regular expressions from path parameters.
+func normalize(route string) string {
+	route = paramRe.ReplaceAllString(route, "{$1}")
+	if len(route) > 1 {
+		route = strings.TrimSuffix(route, "/")
+	}
+
+	return route
+}
+
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+
+		if m := paramRe.FindStringSubmatch(part); m != nil {
+			part = "by_" + m[1]
+		}
+
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool {
+			return r == '-' || r == '_' || r == '.'
+		}) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,268 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schema is the subset of JSON Schema 2020-12 used by the generator.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+// Generator derives schemas from Go types. Named struct types are stored in
+// Schemas and referenced with $ref.
+type Generator struct {
+	Schemas map[string]*Schema
+}
+
+func NewGenerator() *Generator {
+	return &Generator{
+		Schemas: make(map[string]*Schema),
+	}
+}
+
+// Of returns the schema of the type of v.
+func (g *Generator) Of(v any) *Schema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *Generator) schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		return g.schema(t.Elem())
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+
+		name := t.Name()
+		if _, ok := g.Schemas[name]; !ok {
+			// reserve the name first so recursive types terminate
+			g.Schemas[name] = &Schema{}
+			*g.Schemas[name] = *g.structSchema(t)
+		}
+
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.addFields(s, t)
+
+	return s
+}
+
+func (g *Generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		name, omitempty := jsonName(f)
+		if name == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := g.schema(f.Type)
+		if f.Type.Kind() == reflect.Pointer && !omitempty {
+			prop = nullable(prop)
+		}
+
+		if required := applyValidate(prop, f.Type, f.Tag.Get("validate")); required {
+			s.Required = append(s.Required, name)
+		}
+
+		s.Properties[name] = prop
+	}
+}
+
+func jsonName(f reflect.StructField) (string, bool) {
+	tag, ok := f.Tag.Lookup("json")
+	if !ok {
+		return "", false
+	}
+
+	parts := strings.Split(tag, ",")
+	omitempty := false
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitempty = true
+		}
+	}
+
+	return parts[0], omitempty
+}
+
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+	}
+
+	if typ, ok := s.Type.(string); ok {
+		s.Type = []string{typ, "null"}
+	}
+
+	return s
+}
+
+// applyValidate maps go-playground/validator rules to schema constraints and
+// reports whether the field is required.
+func applyValidate(s *Schema, t reflect.Type, tag string) bool {
+	if tag == "" || tag == "-" {
+		return false
+	}
+
+	kind := t.Kind()
+	if kind == reflect.Pointer {
+		kind = t.Elem().Kind()
+	}
+
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		if rule == "dive" {
+			// rules after dive apply to the elements
+			break
+		}
+
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		case "uuid":
+			s.Format = "uuid"
+		case "oneof":
+			s.Enum = strings.Fields(param)
+		case "containsany":
+			s.Pattern = "[" + regexpEscapeClass(param) + "]"
+		case "min", "max", "len", "gte", "lte":
+			applyBound(s, kind, name, param)
+		}
+	}
+
+	return required
+}
+
+func applyBound(s *Schema, kind reflect.Kind, rule, param string) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+
+	switch kind {
+	case reflect.String:
+		i := int(n)
+		switch rule {
+		case "min", "gte":
+			s.MinLength = &i
+		case "max", "lte":
+			s.MaxLength = &i
+		case "len":
+			s.MinLength, s.MaxLength = &i, &i
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		i := int(n)
+		switch rule {
+		case "min", "gte":
+			s.MinItems = &i
+		case "max", "lte":
+			s.MaxItems = &i
+		case "len":
+			s.MinItems, s.MaxItems = &i, &i
+		}
+	default:
+		switch rule {
+		case "min", "gte":
+			s.Minimum = &n
+		case "max", "lte":
+			s.Maximum = &n
+		case "len":
+			s.Minimum, s.Maximum = &n, &n
+		}
+	}
+}
+
+func regexpEscapeClass(chars string) string {
+	var b strings.Builder
+	for _, r := range chars {
+		if strings.ContainsRune(`\]^-[`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
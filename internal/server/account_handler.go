@@ -0,0 +1,265 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/notification"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// emailChangeTTL is how long the confirmation sent to a new address is
+	// valid.
+	emailChangeTTL = time.Hour
+	// reauthWindow is how recent the login of a user without a password
+	// must be to count as re-authentication.
+	reauthWindow = 10 * time.Minute
+)
+
+var (
+	errInvalidPassword               = errors.New("current password is wrong")
+	errReauthRequired                = errors.New("log in again to confirm it is you")
+	errEmailUnchanged                = errors.New("email is already the address of the account")
+	errEmailChangeNeedsConfirmation  = errors.New("changing the email has to be confirmed, use /users/email")
+	errEmailChangeConfirmationFailed = errors.New("could not send the confirmation email")
+)
+
+// AccountHandler changes the credentials of the current user. Changes need
+// the current password and log out the user's other sessions.
+type AccountHandler struct {
+	users        store.UserStorer
+	sessions     store.SessionStorer
+	emailChanges store.EmailChangeStorer
+	guard        *loginGuard
+	notifier     *notification.Notifier
+	tasks        *tasks
+}
+
+func NewAccountHandler(users store.UserStorer, sessions store.SessionStorer, emailChanges store.EmailChangeStorer, guard *loginGuard, notifier *notification.Notifier, tasks *tasks) *AccountHandler {
+	return &AccountHandler{
+		users:        users,
+		sessions:     sessions,
+		emailChanges: emailChanges,
+		guard:        guard,
+		notifier:     notifier,
+		tasks:        tasks,
+	}
+}
+
+func (h *AccountHandler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ChangePasswordReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	user, ok := h.guard.reauthenticate(w, r, req.CurrentPassword)
+	if !ok {
+		return
+	}
+
+	if err := h.users.SetPassword(r.Context(), user.ID, req.NewPassword); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.revokeOtherSessions(r); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.tasks.notify("password changed", user.ID, func(ctx context.Context) error {
+		return h.notifier.PasswordChanged(ctx, user)
+	})
+
+	render(w, r, http.StatusOK, "password successfully changed")
+}
+
+// handleChangeEmail sends a confirmation token to the new address. The
+// email only changes once handleConfirmEmail gets the token.
+func (h *AccountHandler) handleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req models.ChangeEmailReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	user, ok := h.guard.reauthenticate(w, r, req.Password)
+	if !ok {
+		return
+	}
+
+	if req.Email == user.Email {
+		respond.Error(w, r, http.StatusBadRequest, errEmailUnchanged)
+		return
+	}
+
+	if _, err := h.users.GetByEmail(r.Context(), req.Email); err == nil {
+		respond.Error(w, r, http.StatusBadRequest, store.ErrEmailAlreadyExists)
+		return
+	} else if !errors.Is(err, store.ErrUserNotFound) {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	change := models.EmailChange{
+		UserID:    user.ID,
+		Email:     req.Email,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(emailChangeTTL),
+	}
+	if err := h.emailChanges.Save(r.Context(), change); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	err = h.notifier.ConfirmEmail(r.Context(), user, req.Email, token)
+	if err != nil {
+		log.Printf("send email change confirmation to user %d error: %s", user.ID, err)
+
+		// the token never left, the change is dropped rather than left to
+		// expire. The request may have timed out, so it has its own context.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := h.emailChanges.Take(ctx, user.ID, change.TokenHash); err != nil && !errors.Is(err, store.ErrEmailChangeNotFound) {
+			log.Printf("drop unsent email change of user %d error: %s", user.ID, err)
+		}
+
+		respond.Error(w, r, http.StatusBadGateway, errEmailChangeConfirmationFailed)
+		return
+	}
+
+	render(w, r, http.StatusAccepted, "confirmation sent to the new email address")
+}
+
+func (h *AccountHandler) handleConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var req models.ConfirmEmailReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	change, err := h.emailChanges.Take(r.Context(), id, hashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, store.ErrEmailChangeNotFound) {
+			respond.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	user, err := h.users.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	data := models.UpdateUserReq{
+		Email:     change.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+	}
+	if user.DateOfBirth != nil {
+		data.DateOfBirth = user.DateOfBirth.Format("2006-01-02")
+	}
+
+	updated, err := h.users.Update(r.Context(), id, data)
+	if err != nil {
+		if errors.Is(err, store.ErrEmailAlreadyExists) {
+			respond.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.revokeOtherSessions(r); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.tasks.notify("email changed", user.ID, func(ctx context.Context) error {
+		return h.notifier.EmailChanged(ctx, user, change.Email)
+	})
+
+	render(w, r, http.StatusOK, updated)
+}
+
+// revokeOtherSessions logs the user out everywhere but in the session of
+// the request.
+func (h *AccountHandler) revokeOtherSessions(r *http.Request) error {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		return err
+	}
+
+	sessionID, _ := r.Context().Value("session_id").(string)
+	_, err = h.sessions.RevokeOthers(r.Context(), id, sessionID)
+
+	return err
+}
+
+// randomToken returns 256 random bits, url safe encoded.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how tokens sent to users are stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
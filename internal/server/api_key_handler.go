@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/apikey"
+	"github.com/go-playground/validator/v10"
+)
+
+type APIKeyHandler struct {
+	store store.APIKeyStorer
+}
+
+func NewAPIKeyHandler(s store.APIKeyStorer) *APIKeyHandler {
+	return &APIKeyHandler{
+		store: s,
+	}
+}
+
+func (h *APIKeyHandler) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var req models.APIKeyReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	key, prefix, err := apikey.Generate()
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.Create(r.Context(), models.APIKey{
+		UserID: id,
+		Name:   req.Name,
+		Prefix: prefix,
+		Hash:   apikey.Hash(key),
+		Scopes: uniqueScopes(req.Scopes),
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusCreated, models.CreatedAPIKey{
+		APIKey: created,
+		Key:    key,
+	})
+}
+
+func (h *APIKeyHandler) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	keys, err := h.store.List(r.Context(), id)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, keys)
+}
+
+func (h *APIKeyHandler) handleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := h.store.Delete(r.Context(), userID, id); err != nil {
+		if errors.Is(err, store.ErrAPIKeyNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, "api key successfully revoked")
+}
+
+// uniqueScopes drops repeated scopes, keeping their order.
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	out := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/audit"
+	"github.com/escoutdoor/ecommerce/internal/middleware"
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	chimiddle "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	// auditVerifyBatch is how many entries verifying reads at once.
+	auditVerifyBatch = 1000
+)
+
+var errInvalidAuditFilter = errors.New("invalid audit filter")
+
+// auditor appends the changes made by admins, and logins, to the audit log.
+//
+// The log is kept longer than the accounts it mentions and is not cleared
+// when an account is deleted, so it holds no direct personal data: users
+// are referred to by id, and addresses that belong to no account by a keyed
+// hash, which tells entries about the same address apart without storing
+// it.
+type auditor struct {
+	log store.AuditStorer
+	// hashKey keys the hashes of addresses
+	hashKey []byte
+}
+
+// auditorFromEnv keys the hashes with AUDIT_HASH_KEY. Without it a random
+// key is used, hashes then only match within one run of the server.
+func auditorFromEnv(s store.AuditStorer) *auditor {
+	key := []byte(os.Getenv("AUDIT_HASH_KEY"))
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal("generate audit hash key error: ", err)
+		}
+		log.Println("AUDIT_HASH_KEY is not set, hashes in the audit log will not match across restarts")
+	}
+
+	return &auditor{log: s, hashKey: key}
+}
+
+// emailHash returns the keyed hash of email recorded instead of it.
+func (a *auditor) emailHash(email string) string {
+	mac := hmac.New(sha256.New, a.hashKey)
+	mac.Write([]byte(strings.ToLower(email)))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// record appends entry with the changes from before to after, nil for
+// created or deleted entities. The actor is the user of the request unless
+// entry has one. The change already happened, so a failed append is only
+// logged.
+func (a *auditor) record(r *http.Request, entry models.AuditEntry, before, after any) {
+	if entry.ActorID == nil {
+		if id, err := getUserIDCtx(r); err == nil {
+			entry.ActorID = &id
+		}
+	}
+
+	var err error
+	entry.Before, entry.After, err = audit.Diff(before, after)
+	if err != nil {
+		log.Printf("audit %s of %s %s error: %s", entry.Action, entry.EntityType, entry.EntityID, err)
+		return
+	}
+
+	entry.IP = middleware.ClientIP(r)
+	entry.RequestID = chimiddle.GetReqID(r.Context())
+	entry.CreatedAt = time.Now()
+
+	if _, err := a.log.Append(r.Context(), entry); err != nil {
+		log.Printf("audit %s of %s %s error: %s", entry.Action, entry.EntityType, entry.EntityID, err)
+	}
+}
+
+type AuditHandler struct {
+	store store.AuditStorer
+}
+
+func NewAuditHandler(s store.AuditStorer) *AuditHandler {
+	return &AuditHandler{
+		store: s,
+	}
+}
+
+func (h *AuditHandler) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	entries, err := h.store.List(r.Context(), filter)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, entries)
+}
+
+// handleVerifyAudit walks the whole chain and reports the first entry that
+// was changed, or follows a removed one.
+func (h *AuditHandler) handleVerifyAudit(w http.ResponseWriter, r *http.Request) {
+	result := models.AuditVerification{Valid: true}
+	prev := audit.Genesis
+
+	var afterID int64
+	for {
+		entries, err := h.store.Chain(r.Context(), afterID, auditVerifyBatch)
+		if err != nil {
+			respond.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		for _, e := range entries {
+			if !audit.Valid(e, prev) {
+				id := e.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				render(w, r, http.StatusOK, result)
+				return
+			}
+
+			result.Checked++
+			prev = e.Hash
+			afterID = e.ID
+		}
+
+		if len(entries) < auditVerifyBatch {
+			break
+		}
+	}
+
+	render(w, r, http.StatusOK, result)
+}
+
+func auditFilter(r *http.Request) (models.AuditFilter, error) {
+	q := r.URL.Query()
+	filter := models.AuditFilter{
+		Action:     q.Get("action"),
+		EntityType: q.Get("entity_type"),
+		EntityID:   q.Get("entity_id"),
+		Limit:      defaultAuditLimit,
+	}
+
+	if v := q.Get("actor_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("%w: actor_id must be a number", errInvalidAuditFilter)
+		}
+		filter.ActorID = &id
+	}
+
+	for name, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%w: %s must be an RFC 3339 time", errInvalidAuditFilter, name)
+			}
+			*dst = &t
+		}
+	}
+
+	if v := q.Get("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return filter, fmt.Errorf("%w: before_id must be a positive number", errInvalidAuditFilter)
+		}
+		filter.BeforeID = id
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			return filter, fmt.Errorf("%w: limit must be between 1 and %d", errInvalidAuditFilter, maxAuditLimit)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
@@ -1,86 +1,415 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/escoutdoor/ecommerce/internal/middleware"
 	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/notification"
 	"github.com/escoutdoor/ecommerce/internal/store"
 	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/oidc"
 	"github.com/escoutdoor/ecommerce/pkg/tokens"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 )
 
 type AuthHandler struct {
-	store store.AuthStorer
+	store      store.AuthStorer
+	twoFactor  store.TwoFactorStorer
+	identities store.IdentityStorer
+	sessions   store.SessionStorer
+	guard      *loginGuard
+	tokens     *tokens.Issuer
+	audit      *auditor
+	// providers are the OpenID Connect providers users can log in with,
+	// by the name used in their routes
+	providers map[string]*oidc.Provider
 }
 
-func NewAuthHandler(s store.AuthStorer) *AuthHandler {
+func NewAuthHandler(s store.AuthStorer, twoFactor store.TwoFactorStorer, identities store.IdentityStorer, sessions store.SessionStorer, guard *loginGuard, issuer *tokens.Issuer, audit *auditor, providers map[string]*oidc.Provider) *AuthHandler {
 	return &AuthHandler{
-		store: s,
+		store:      s,
+		twoFactor:  twoFactor,
+		identities: identities,
+		sessions:   sessions,
+		guard:      guard,
+		tokens:     issuer,
+		audit:      audit,
+		providers:  providers,
 	}
 }
 
 func (h *AuthHandler) handleLoginUser(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := validator.New().Struct(req); err != nil {
+	if err := validate.Struct(req); err != nil {
 		errs := err.(validator.ValidationErrors)
-		respond.Error(w, http.StatusBadRequest, respond.ValidationError(errs))
+		respond.ValidationError(w, r, errs)
 		return
 	}
 
-	user, err := h.store.Login(req)
+	ip := middleware.ClientIP(r)
+	if !h.guard.admit(w, r, req.Email, ip) {
+		return
+	}
+
+	user, err := h.store.Login(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidEmailOrPassword) {
+			if err := h.guard.failed(r.Context(), req.Email, ip); err != nil {
+				respond.Error(w, r, http.StatusInternalServerError, err)
+				return
+			}
+
+			h.recordLoginFailed(r, req.Email)
+
+			respond.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the failures are only forgotten once the second step succeeded too
+	required, err := h.twoFactorRequired(r.Context(), user.ID)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if required {
+		h.respondChallenge(w, r, user.ID, "pwd")
+		return
+	}
+
+	if err := h.guard.succeeded(r.Context(), req.Email); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.respondLogin(w, r, user, "pwd")
+}
+
+// twoFactorRequired reports whether the user has to complete the login with
+// a second factor.
+func (h *AuthHandler) twoFactorRequired(ctx context.Context, userID int) (bool, error) {
+	tf, err := h.twoFactor.Get(ctx, userID)
+	if err != nil && !errors.Is(err, store.ErrTwoFactorNotFound) {
+		return false, err
+	}
+
+	return tf != nil && tf.EnabledAt != nil, nil
+}
+
+func (h *AuthHandler) respondChallenge(w http.ResponseWriter, r *http.Request, userID int, amr ...string) {
+	challenge, err := h.tokens.CreateChallenge(userID, amr...)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, models.LoginResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+	})
+}
+
+// createToken starts a session for the user and returns its access token.
+func (h *AuthHandler) createToken(ctx context.Context, userID int, amr ...string) (string, error) {
+	id, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	session := models.Session{
+		ID:        id,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(tokens.AccessTokenTTL),
+	}
+	if err := h.sessions.Create(ctx, session); err != nil {
+		return "", err
+	}
+
+	return h.tokens.CreateJWT(userID, id, amr...)
+}
+
+func (h *AuthHandler) respondLogin(w http.ResponseWriter, r *http.Request, user *models.User, amr ...string) {
+	token, err := h.createToken(r.Context(), user.ID, amr...)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordLogin(r, user.ID, amr)
+
+	response := models.LoginResponse{
+		User:  user,
+		Token: token,
+	}
+	render(w, r, http.StatusOK, response)
+}
+
+// recordLogin audits a completed login with the methods it used.
+func (h *AuthHandler) recordLogin(r *http.Request, userID int, amr []string) {
+	h.audit.record(r, models.AuditEntry{ActorID: &userID, Action: "auth.login", EntityType: "user", EntityID: strconv.Itoa(userID)}, nil, map[string][]string{"amr": amr})
+}
+
+// recordLoginFailed audits a failed password login, against the account of
+// email if there is one. Failures for unknown addresses keep only a hash of
+// the address, they are often someone else's address or a typo.
+func (h *AuthHandler) recordLoginFailed(r *http.Request, email string) {
+	entry := models.AuditEntry{Action: "auth.login_failed", EntityType: "user"}
+	after := map[string]string{"method": "pwd"}
+
+	user, err := h.guard.users.GetByEmail(r.Context(), email)
+	switch {
+	case err == nil:
+		entry.EntityID = strconv.Itoa(user.ID)
+	case errors.Is(err, store.ErrUserNotFound):
+		after["email_hash"] = h.audit.emailHash(email)
+	default:
+		log.Printf("audit failed login error: %s", err)
+		return
+	}
+
+	h.audit.record(r, entry, nil, after)
+}
+
+func (h *AuthHandler) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorLoginReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	userID, amr, err := h.tokens.VerifyChallenge(req.ChallengeToken)
+	if err != nil {
+		respond.Error(w, r, http.StatusUnauthorized, err)
+		return
+	}
+
+	user, err := h.guard.users.GetByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusUnauthorized, respond.ErrUnauthorized)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	ip := middleware.ClientIP(r)
+	if !h.guard.admit(w, r, user.Email, ip) {
+		return
+	}
+
+	if err := verifyTwoFactor(r.Context(), h.twoFactor, userID, req.Code); err != nil {
+		if errors.Is(err, store.ErrInvalidTwoFactorCode) {
+			if err := h.guard.failed(r.Context(), user.Email, ip); err != nil {
+				respond.Error(w, r, http.StatusInternalServerError, err)
+				return
+			}
+
+			h.audit.record(r, models.AuditEntry{Action: "auth.login_failed", EntityType: "user", EntityID: strconv.Itoa(user.ID)}, nil, map[string]string{"method": "otp"})
+
+			respond.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, store.ErrTwoFactorNotFound) {
+			respond.Error(w, r, http.StatusUnauthorized, respond.ErrUnauthorized)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	token, err := tokens.CreateJWT(user.ID)
+	if err := h.guard.succeeded(r.Context(), user.Email); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	amr = append(amr, "otp")
+	token, err := h.createToken(r.Context(), user.ID, amr...)
 	if err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
+	h.recordLogin(r, user.ID, amr)
+
 	response := models.AuthResponse{
 		User:  user,
 		Token: token,
 	}
-	respond.JSON(w, http.StatusOK, response)
+	render(w, r, http.StatusOK, response)
+}
+
+// handleOIDCLogin sends the user to log in at the provider, which redirects
+// them back to handleOIDCCallback.
+func (h *AuthHandler) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := h.providers[name]
+	if !ok {
+		respond.Error(w, r, http.StatusNotFound, errOIDCProviderNotFound)
+		return
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		v, err := oidc.RandomString()
+		if err != nil {
+			respond.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		secrets[i] = v
+	}
+
+	state := models.OIDCState{
+		State:        secrets[0],
+		Provider:     name,
+		Nonce:        secrets[1],
+		CodeVerifier: secrets[2],
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := h.identities.SaveState(r.Context(), state); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadGateway, fmt.Errorf("%w: %s", errOIDCProvider, err))
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleOIDCCallback completes the login the provider redirected back,
+// logging in, linking or creating the user of the identity.
+func (h *AuthHandler) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	provider, ok := h.providers[name]
+	if !ok {
+		respond.Error(w, r, http.StatusNotFound, errOIDCProviderNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		respond.Error(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", errOIDCLoginDenied, e))
+		return
+	}
+
+	state, err := h.identities.TakeState(r.Context(), query.Get("state"))
+	if err != nil {
+		if errors.Is(err, store.ErrOIDCStateNotFound) {
+			respond.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if state.Provider != name {
+		respond.Error(w, r, http.StatusBadRequest, store.ErrOIDCStateNotFound)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidGrant):
+			respond.Error(w, r, http.StatusBadRequest, err)
+		case errors.Is(err, oidc.ErrInvalidIDToken):
+			respond.Error(w, r, http.StatusUnauthorized, err)
+		default:
+			respond.Error(w, r, http.StatusBadGateway, fmt.Errorf("%w: %s", errOIDCProvider, err))
+		}
+		return
+	}
+
+	user, err := h.identityUser(r.Context(), name, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailNotVerified):
+			respond.Error(w, r, http.StatusForbidden, err)
+		case errors.Is(err, store.ErrEmailAlreadyExists), errors.Is(err, store.ErrIdentityAlreadyLinked):
+			respond.Error(w, r, http.StatusConflict, err)
+		default:
+			respond.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	// a provider does not get around a lock from failed password logins
+	if !h.guard.admitLocked(w, r, user.Email) {
+		return
+	}
+
+	required, err := h.twoFactorRequired(r.Context(), user.ID)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if required {
+		h.respondChallenge(w, r, user.ID, "fed")
+		return
+	}
+
+	h.respondLogin(w, r, user, "fed")
 }
 
 func (h *AuthHandler) handleRegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := validator.New().Struct(req); err != nil {
+	if err := validate.Struct(req); err != nil {
 		errs := err.(validator.ValidationErrors)
-		respond.Error(w, http.StatusBadRequest, respond.ValidationError(errs))
+		respond.ValidationError(w, r, errs)
 		return
 	}
 
-	user, err := h.store.Register(req)
+	if req.Locale == "" {
+		req.Locale = notification.MatchLocale(r.Header.Get("Accept-Language"))
+	}
+
+	user, err := h.store.Register(r.Context(), req)
 	if err != nil {
 		if errors.Is(err, store.ErrEmailAlreadyExists) {
-			respond.Error(w, http.StatusBadRequest, err)
+			respond.Error(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	token, err := tokens.CreateJWT(user.ID)
+	token, err := h.createToken(r.Context(), user.ID, "pwd")
 	if err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -88,5 +417,40 @@ func (h *AuthHandler) handleRegisterUser(w http.ResponseWriter, r *http.Request)
 		User:  user,
 		Token: token,
 	}
-	respond.JSON(w, http.StatusOK, response)
+	render(w, r, http.StatusOK, response)
+}
+
+func (h *AuthHandler) handleUnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := h.guard.users.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.guard.unlock(r.Context(), user.Email); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "user.unlock", EntityType: "user", EntityID: strconv.Itoa(user.ID)}, nil, nil)
+
+	render(w, r, http.StatusOK, "user account successfully unlocked")
+}
+
+// handleJWKS publishes the public keys that verify our tokens, for other
+// services.
+func (h *AuthHandler) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respond.JSON(w, http.StatusOK, h.tokens.JWKS())
 }
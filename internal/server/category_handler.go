@@ -1,10 +1,9 @@
 package server
 
 import (
-	"database/sql"
-	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/escoutdoor/ecommerce/internal/models"
 	"github.com/escoutdoor/ecommerce/internal/store"
@@ -14,103 +13,143 @@ import (
 
 type CategoryHandler struct {
 	store store.CategoryStorer
+	audit *auditor
 }
 
-func NewCategoryHandler(s store.CategoryStorer) *CategoryHandler {
+func NewCategoryHandler(s store.CategoryStorer, audit *auditor) *CategoryHandler {
 	return &CategoryHandler{
 		store: s,
+		audit: audit,
 	}
 }
 
 func (h *CategoryHandler) handleCreateCategory(w http.ResponseWriter, r *http.Request) {
 	var req models.CategoryReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := validator.New().Struct(req); err != nil {
+	if err := validate.Struct(req); err != nil {
 		errs := err.(validator.ValidationErrors)
-		respond.Error(w, http.StatusBadRequest, respond.ValidationError(errs))
+		respond.ValidationError(w, r, errs)
 		return
 	}
 
-	category, err := h.store.Create(req)
+	category, err := h.store.Create(r.Context(), req)
 	if err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusCreated, category)
+	h.audit.record(r, models.AuditEntry{Action: "category.create", EntityType: "category", EntityID: strconv.Itoa(category.ID)}, nil, category)
+
+	render(w, r, http.StatusCreated, category)
 }
 
 func (h *CategoryHandler) handleGetCategoryByID(w http.ResponseWriter, r *http.Request) {
 	id, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	category, err := h.store.GetByID(id)
+	category, err := h.store.GetByID(r.Context(), id)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			respond.Error(w, http.StatusNotFound, store.ErrCategoryNotFound)
+		if errors.Is(err, store.ErrCategoryNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
 			return
 		}
 
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, category)
+	render(w, r, http.StatusOK, category)
 }
 
 func (h *CategoryHandler) handleDeleteCategory(w http.ResponseWriter, r *http.Request) {
 	id, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	before, err := h.store.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrCategoryNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	err = h.store.Delete(id)
+	err = h.store.Delete(r.Context(), id)
 	if err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+		if errors.Is(err, store.ErrCategoryNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, "category successfully deleted")
+	h.audit.record(r, models.AuditEntry{Action: "category.delete", EntityType: "category", EntityID: strconv.Itoa(id)}, before, nil)
+
+	render(w, r, http.StatusOK, "category successfully deleted")
 }
 
 func (h *CategoryHandler) handleUpdateCategory(w http.ResponseWriter, r *http.Request) {
 	var req models.CategoryReq
 	_, err := getUserIDCtx(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	categoryID, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if err = decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := validator.New().Struct(req); err != nil {
+	if err := validate.Struct(req); err != nil {
 		errs := err.(validator.ValidationErrors)
-		respond.Error(w, http.StatusBadRequest, respond.ValidationError(errs))
+		respond.ValidationError(w, r, errs)
 		return
 	}
 
-	category, err := h.store.Update(categoryID, req)
+	before, err := h.store.GetByID(r.Context(), categoryID)
 	if err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+		if errors.Is(err, store.ErrCategoryNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, category)
+	category, err := h.store.Update(r.Context(), categoryID, req)
+	if err != nil {
+		if errors.Is(err, store.ErrCategoryNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "category.update", EntityType: "category", EntityID: strconv.Itoa(categoryID)}, before, category)
+
+	render(w, r, http.StatusOK, category)
 }
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/escoutdoor/ecommerce/internal/middleware"
+	"github.com/escoutdoor/ecommerce/internal/notification"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/oidc"
+	"github.com/escoutdoor/ecommerce/pkg/password"
+	"github.com/escoutdoor/ecommerce/pkg/tokens"
+	"github.com/go-playground/validator/v10"
+)
+
+// validate reports invalid fields by their json names so problem responses
+// point at the fields clients actually send.
+var validate = newValidator()
+
+// errorCodes are the stable problem codes of the domain errors handlers
+// pass to respond.Error. An error wrapping several of them gets the code of
+// the first, so the order is part of the codes.
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{store.ErrUserNotFound, "user_not_found"},
+	{store.ErrInvalidEmailOrPassword, "invalid_credentials"},
+	{store.ErrEmailAlreadyExists, "email_already_exists"},
+	{store.ErrCategoryNotFound, "category_not_found"},
+	{store.ErrProductNotFound, "product_not_found"},
+	{store.ErrOrderNotFound, "order_not_found"},
+	{store.ErrInvalidProductQuantity, "invalid_product_quantity"},
+	{store.ErrOrderItemNotFound, "order_item_not_found"},
+	{middleware.ErrIdempotencyKeyInvalid, "idempotency_key_invalid"},
+	{middleware.ErrIdempotencyKeyReused, "idempotency_key_reused"},
+	{middleware.ErrIdempotencyKeyInProgress, "idempotency_key_in_progress"},
+	{middleware.ErrRateLimited, "rate_limited"},
+	{errLoginThrottled, "login_throttled"},
+	{errAccountLocked, "account_locked"},
+	{store.ErrTwoFactorNotFound, "two_factor_not_enabled"},
+	{store.ErrTwoFactorAlreadyEnabled, "two_factor_already_enabled"},
+	{store.ErrInvalidTwoFactorCode, "invalid_two_factor_code"},
+	{middleware.ErrTwoFactorRequired, "two_factor_required"},
+	{store.ErrIdentityAlreadyLinked, "identity_already_linked"},
+	{store.ErrOIDCStateNotFound, "invalid_oidc_state"},
+	{errOIDCProviderNotFound, "oidc_provider_not_found"},
+	{errOIDCLoginDenied, "oidc_login_denied"},
+	{errOIDCProvider, "oidc_provider_unavailable"},
+	{errEmailNotVerified, "email_not_verified"},
+	{oidc.ErrInvalidGrant, "invalid_grant"},
+	{oidc.ErrInvalidIDToken, "invalid_id_token"},
+	{store.ErrAPIKeyNotFound, "api_key_not_found"},
+	{middleware.ErrInvalidAPIKey, "invalid_api_key"},
+	{middleware.ErrAPIKeyScope, "api_key_scope"},
+	{middleware.ErrAPIKeyNotAllowed, "api_key_not_allowed"},
+	{store.ErrSessionNotFound, "session_revoked"},
+	{store.ErrEmailChangeNotFound, "invalid_email_change_token"},
+	{errInvalidPassword, "invalid_current_password"},
+	{errReauthRequired, "reauthentication_required"},
+	{errEmailUnchanged, "email_unchanged"},
+	{errEmailChangeNeedsConfirmation, "email_change_requires_confirmation"},
+	{errEmailChangeConfirmationFailed, "email_not_sent"},
+	{store.ErrAccountDeletionNotFound, "account_deletion_not_found"},
+	{store.ErrAccountDeletionPending, "account_deletion_pending"},
+	{errInvalidExportFormat, "invalid_export_format"},
+	{errInvalidDeletionStatus, "invalid_deletion_status"},
+	{errInvalidAuditFilter, "invalid_audit_filter"},
+	{store.ErrWebhookNotFound, "webhook_not_found"},
+	{store.ErrWebhookDeliveryNotFound, "webhook_delivery_not_found"},
+	{errInvalidDeliveryFilter, "invalid_delivery_filter"},
+	{store.ErrJobNotFound, "job_not_found"},
+	{store.ErrJobNotFailed, "job_not_failed"},
+	{errInvalidJobFilter, "invalid_job_filter"},
+	{errInvalidLastEventID, "invalid_last_event_id"},
+	{errStreamingUnsupported, "streaming_unsupported"},
+	{tokens.ErrWrongPurpose, "wrong_token_type"},
+	{tokens.ErrInvalidToken, "invalid_token"},
+	{errInvalidID, "invalid_id"},
+	{errInvalidBody, "invalid_body"},
+}
+
+func init() {
+	for _, c := range errorCodes {
+		respond.RegisterCode(c.err, c.code)
+	}
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	if err := password.RegisterValidation(v); err != nil {
+		panic(err)
+	}
+	if err := notification.RegisterValidation(v); err != nil {
+		panic(err)
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+
+		return name
+	})
+
+	return v
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+)
+
+// bothErrors is an error wrapping two registered errors.
+type bothErrors struct{}
+
+func (bothErrors) Error() string { return "both" }
+
+func (bothErrors) Is(target error) bool {
+	return target == errInvalidID || target == store.ErrUserNotFound
+}
+
+func TestErrorCodeOfWrappedErrors(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		w := httptest.NewRecorder()
+		respond.Error(w, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusBadRequest, bothErrors{})
+
+		var problem respond.Problem
+		if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+			t.Fatalf("decode problem: %s", err)
+		}
+		// user_not_found is listed before invalid_id
+		if problem.Code != "user_not_found" {
+			t.Fatalf("got code %q, want user_not_found", problem.Code)
+		}
+	}
+}
+
+func TestErrorCodesUnique(t *testing.T) {
+	seen := make(map[error]bool)
+	for _, c := range errorCodes {
+		if seen[c.err] {
+			t.Errorf("%q is registered twice", c.err)
+		}
+		seen[c.err] = true
+	}
+}
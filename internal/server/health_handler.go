@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+	statusDraining    = "draining"
+)
+
+// The probe is public, so the errors behind a failed check are only logged,
+// they can name hosts, users and queries.
+const (
+	errDatabaseUnavailable   = "database unavailable"
+	errMigrationsUnavailable = "migration version unavailable"
+)
+
+type HealthHandler struct {
+	store           store.HealthStorer
+	expectedVersion int64
+	draining        int32
+}
+
+func NewHealthHandler(s store.HealthStorer, expectedVersion int64) *HealthHandler {
+	return &HealthHandler{
+		store:           s,
+		expectedVersion: expectedVersion,
+	}
+}
+
+// drain makes the readiness probe fail so the orchestrator stops routing
+// traffic to this instance while in-flight requests are finished.
+func (h *HealthHandler) drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+func (h *HealthHandler) isDraining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+func (h *HealthHandler) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, models.HealthResponse{Status: statusOK})
+}
+
+func (h *HealthHandler) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	if h.isDraining() {
+		respond.JSON(w, http.StatusServiceUnavailable, models.HealthResponse{Status: statusDraining})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	resp := models.HealthResponse{
+		Status: statusOK,
+		Checks: map[string]models.HealthCheck{
+			"database":   h.checkDatabase(ctx),
+			"migrations": h.checkMigrations(ctx),
+		},
+	}
+
+	status := http.StatusOK
+	for _, check := range resp.Checks {
+		if check.Status != statusOK {
+			resp.Status = statusUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	respond.JSON(w, status, resp)
+}
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) models.HealthCheck {
+	stats := h.store.Stats()
+	pool := &models.PoolStats{
+		MaxOpen: stats.MaxOpenConnections,
+		Open:    stats.OpenConnections,
+		InUse:   stats.InUse,
+		Idle:    stats.Idle,
+		Waiting: stats.WaitCount,
+	}
+
+	if err := h.store.Ping(ctx); err != nil {
+		log.Printf("readiness check database error: %s", err)
+		return models.HealthCheck{Status: statusUnavailable, Error: errDatabaseUnavailable, Pool: pool}
+	}
+
+	return models.HealthCheck{Status: statusOK, Pool: pool}
+}
+
+func (h *HealthHandler) checkMigrations(ctx context.Context) models.HealthCheck {
+	version, err := h.store.MigrationVersion(ctx)
+	if err != nil {
+		log.Printf("readiness check migrations error: %s", err)
+		return models.HealthCheck{Status: statusUnavailable, Error: errMigrationsUnavailable}
+	}
+
+	check := models.HealthCheck{
+		Status:          statusOK,
+		Version:         version,
+		ExpectedVersion: h.expectedVersion,
+	}
+	if version != h.expectedVersion {
+		check.Status = statusUnavailable
+		check.Error = "database schema is not at the expected migration version"
+	}
+
+	return check
+}
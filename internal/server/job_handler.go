@@ -0,0 +1,140 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultJobLimit = 100
+	maxJobLimit     = 1000
+)
+
+var errInvalidJobFilter = errors.New("invalid job filter")
+
+// JobHandler lets admins look into the job queue and run failed jobs again.
+type JobHandler struct {
+	store store.JobStorer
+	audit *auditor
+}
+
+func NewJobHandler(s store.JobStorer, audit *auditor) *JobHandler {
+	return &JobHandler{
+		store: s,
+		audit: audit,
+	}
+}
+
+func (h *JobHandler) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	filter, err := jobFilter(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	jobs, err := h.store.List(r.Context(), filter)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, jobs)
+}
+
+func (h *JobHandler) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := getJobID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	job, err := h.store.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrJobNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, job)
+}
+
+// handleRequeueJob makes a failed job due again with all of its attempts
+// left.
+func (h *JobHandler) handleRequeueJob(w http.ResponseWriter, r *http.Request) {
+	id, err := getJobID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	job, err := h.store.Requeue(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrJobNotFound):
+			respond.Error(w, r, http.StatusNotFound, err)
+		case errors.Is(err, store.ErrJobNotFailed):
+			respond.Error(w, r, http.StatusConflict, err)
+		default:
+			respond.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "job.requeue", EntityType: "job", EntityID: strconv.FormatInt(id, 10)}, nil, nil)
+
+	render(w, r, http.StatusAccepted, job)
+}
+
+func getJobID(r *http.Request) (int64, error) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", errInvalidID, idStr)
+	}
+
+	return id, nil
+}
+
+func jobFilter(r *http.Request) (models.JobFilter, error) {
+	q := r.URL.Query()
+	filter := models.JobFilter{
+		Status: q.Get("status"),
+		Kind:   q.Get("kind"),
+		Limit:  defaultJobLimit,
+	}
+
+	switch filter.Status {
+	case "", models.JobQueued, models.JobRunning, models.JobFailed:
+	default:
+		return filter, fmt.Errorf("%w: status must be queued, running or failed", errInvalidJobFilter)
+	}
+
+	if v := q.Get("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return filter, fmt.Errorf("%w: before_id must be a positive number", errInvalidJobFilter)
+		}
+		filter.BeforeID = id
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxJobLimit {
+			return filter, fmt.Errorf("%w: limit must be between 1 and %d", errInvalidJobFilter, maxJobLimit)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/middleware"
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/notification"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/password"
+)
+
+var (
+	errLoginThrottled = errors.New("too many failed logins, retry later")
+	errAccountLocked  = errors.New("account is temporarily locked after too many failed logins")
+)
+
+// loginPolicy decides how failed logins slow down further attempts. Every
+// failure of an account doubles the delay before it can be tried again,
+// starting at backoff, and lockAfter failures lock it for lockout. Client
+// addresses are only locked, after ipLockAfter failures across accounts.
+type loginPolicy struct {
+	window      time.Duration
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	lockAfter   int
+	ipLockAfter int
+	lockout     time.Duration
+}
+
+func loginPolicyFromEnv() loginPolicy {
+	return loginPolicy{
+		window:      durationEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		backoff:     durationEnv("LOGIN_BACKOFF", time.Second),
+		maxBackoff:  durationEnv("LOGIN_MAX_BACKOFF", time.Minute),
+		lockAfter:   intEnv("LOGIN_LOCK_AFTER", 5),
+		ipLockAfter: intEnv("LOGIN_IP_LOCK_AFTER", 20),
+		lockout:     durationEnv("LOGIN_LOCKOUT", 15*time.Minute),
+	}
+}
+
+// delay is the time an account has to wait after its nth failure.
+func (p loginPolicy) delay(failures int) time.Duration {
+	d := p.backoff
+	for i := 1; i < failures && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+
+	return d
+}
+
+// loginGuard tracks failed logins per account and per client address.
+// Accounts are tracked by email whether they exist or not, so the responses
+// do not tell which emails are registered.
+type loginGuard struct {
+	attempts store.LoginAttemptStorer
+	users    store.UserStorer
+	sessions store.SessionStorer
+	notifier *notification.Notifier
+	tasks    *tasks
+	policy   loginPolicy
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// allow returns errLoginThrottled or errAccountLocked, and how long to
+// wait, if email may not be tried from ip right now.
+func (g *loginGuard) allow(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	account, err := g.attempts.Get(ctx, accountKey(email))
+	if err != nil && !errors.Is(err, store.ErrLoginAttemptNotFound) {
+		return 0, err
+	}
+	if account != nil {
+		if account.LockedUntil != nil && account.LockedUntil.After(now) {
+			return account.LockedUntil.Sub(now), errAccountLocked
+		}
+
+		if account.LastFailedAt.After(now.Add(-g.policy.window)) {
+			if wait := account.LastFailedAt.Add(g.policy.delay(account.Failures)).Sub(now); wait > 0 {
+				return wait, errLoginThrottled
+			}
+		}
+	}
+
+	client, err := g.attempts.Get(ctx, ipKey(ip))
+	if err != nil && !errors.Is(err, store.ErrLoginAttemptNotFound) {
+		return 0, err
+	}
+	if client != nil && client.LockedUntil != nil && client.LockedUntil.After(now) {
+		return client.LockedUntil.Sub(now), errLoginThrottled
+	}
+
+	return 0, nil
+}
+
+// admit responds with 429 and returns false while the guard blocks
+// attempts on email from ip.
+func (g *loginGuard) admit(w http.ResponseWriter, r *http.Request, email, ip string) bool {
+	wait, err := g.allow(r.Context(), email, ip)
+	return g.respond(w, r, wait, err)
+}
+
+// admitLocked is admit for logins that do not guess a password, e.g.
+// through a provider. They are only refused while the account is locked.
+func (g *loginGuard) admitLocked(w http.ResponseWriter, r *http.Request, email string) bool {
+	account, err := g.attempts.Get(r.Context(), accountKey(email))
+	if err != nil {
+		if errors.Is(err, store.ErrLoginAttemptNotFound) {
+			return true
+		}
+		return g.respond(w, r, 0, err)
+	}
+
+	var wait time.Duration
+	if account.LockedUntil != nil {
+		wait = time.Until(*account.LockedUntil)
+	}
+	if wait > 0 {
+		return g.respond(w, r, wait, errAccountLocked)
+	}
+
+	return true
+}
+
+// respond responds to a refused login and returns false, or returns true
+// if err is nil.
+func (g *loginGuard) respond(w http.ResponseWriter, r *http.Request, wait time.Duration, err error) bool {
+	if err != nil {
+		if errors.Is(err, errLoginThrottled) || errors.Is(err, errAccountLocked) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respond.Error(w, r, http.StatusTooManyRequests, err)
+			return false
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+
+	return true
+}
+
+// failed records a failed login and locks the account or address once it
+// reached its limit.
+func (g *loginGuard) failed(ctx context.Context, email, ip string) error {
+	windowStart := time.Now().Add(-g.policy.window)
+
+	account, err := g.attempts.RecordFailure(ctx, accountKey(email), windowStart)
+	if err != nil {
+		return err
+	}
+	if account.Failures >= g.policy.lockAfter && account.LockedUntil == nil {
+		until := time.Now().Add(g.policy.lockout)
+		if err := g.attempts.Lock(ctx, account.Key, until); err != nil {
+			return err
+		}
+
+		g.tasks.run(30*time.Second, func(ctx context.Context) {
+			g.notifyLocked(ctx, email, until)
+		})
+	}
+
+	client, err := g.attempts.RecordFailure(ctx, ipKey(ip), windowStart)
+	if err != nil {
+		return err
+	}
+	if client.Failures >= g.policy.ipLockAfter && client.LockedUntil == nil {
+		return g.attempts.Lock(ctx, client.Key, time.Now().Add(g.policy.lockout))
+	}
+
+	return nil
+}
+
+// succeeded forgets the failures of the account, those of the address are
+// kept so one valid account does not reset an attacker's count.
+func (g *loginGuard) succeeded(ctx context.Context, email string) error {
+	return g.attempts.Delete(ctx, accountKey(email))
+}
+
+func (g *loginGuard) unlock(ctx context.Context, email string) error {
+	return g.attempts.Delete(ctx, accountKey(email))
+}
+
+// reauthenticate checks the current password of the user, counting wrong
+// ones as failed logins. Users without a password, who only log in with a
+// provider, must have logged in within reauthWindow instead. It responds
+// and returns false if the user could not be confirmed.
+func (g *loginGuard) reauthenticate(w http.ResponseWriter, r *http.Request, pw string) (*models.User, bool) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	user, err := g.users.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return nil, false
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if user.Password == "" {
+		sessionID, _ := r.Context().Value("session_id").(string)
+		session, err := g.sessions.Get(r.Context(), sessionID)
+		if err != nil && !errors.Is(err, store.ErrSessionNotFound) {
+			respond.Error(w, r, http.StatusInternalServerError, err)
+			return nil, false
+		}
+		if session == nil || time.Since(session.CreatedAt) > reauthWindow {
+			respond.Error(w, r, http.StatusForbidden, errReauthRequired)
+			return nil, false
+		}
+
+		return user, true
+	}
+
+	ip := middleware.ClientIP(r)
+	if !g.admit(w, r, user.Email, ip) {
+		return nil, false
+	}
+
+	if !password.ComparePasswords(user.Password, pw) {
+		if err := g.failed(r.Context(), user.Email, ip); err != nil {
+			respond.Error(w, r, http.StatusInternalServerError, err)
+			return nil, false
+		}
+
+		respond.Error(w, r, http.StatusForbidden, errInvalidPassword)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// notifyLocked tells the owner of email, if there is one, that their
+// account was locked. It runs after the request, the logs name the user
+// rather than the address, like the audit log.
+func (g *loginGuard) notifyLocked(ctx context.Context, email string, until time.Time) {
+	user, err := g.users.GetByEmail(ctx, email)
+	if err != nil {
+		if !errors.Is(err, store.ErrUserNotFound) {
+			log.Printf("look up locked account error: %s", err)
+		}
+		return
+	}
+
+	if err := g.notifier.AccountLocked(ctx, user, g.policy.lockAfter, until); err != nil {
+		log.Printf("notify locked account of user %d error: %s", user.ID, err)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/go-playground/validator/v10"
+)
+
+// NotificationHandler lets users choose the emails they get about their
+// orders and the language they are written in.
+type NotificationHandler struct {
+	store store.NotificationStorer
+}
+
+func NewNotificationHandler(s store.NotificationStorer) *NotificationHandler {
+	return &NotificationHandler{
+		store: s,
+	}
+}
+
+func (h *NotificationHandler) handleGetPreferences(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	prefs, err := h.store.Preferences(r.Context(), id)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, prefs)
+}
+
+func (h *NotificationHandler) handleUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var req models.NotificationPreferencesReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	prefs, err := h.store.SetPreferences(r.Context(), id, req)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, prefs)
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/pkg/oidc"
+)
+
+// oidcStateTTL is how long a user may take to log in at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+var (
+	errOIDCProviderNotFound = errors.New("login provider not found")
+	errOIDCLoginDenied      = errors.New("login was denied by the provider")
+	errOIDCProvider         = errors.New("login provider is unavailable")
+	errEmailNotVerified     = errors.New("email is not verified by the login provider")
+)
+
+// oidcProvidersFromEnv configures the providers listed in OIDC_PROVIDERS,
+// each from OIDC_<NAME>_ISSUER, _CLIENT_ID and _CLIENT_SECRET. Providers
+// redirect back to PUBLIC_URL/v1/auth/oidc/<name>/callback.
+func oidcProvidersFromEnv() map[string]*oidc.Provider {
+	publicURL := strings.TrimSuffix(stringEnv("PUBLIC_URL", "http://localhost:8080"), "/")
+
+	providers := make(map[string]*oidc.Provider)
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  publicURL + "/v1/auth/oidc/" + name + "/callback",
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			log.Fatalf("invalid oidc provider %s: %sISSUER and %sCLIENT_ID are required", name, prefix, prefix)
+		}
+
+		providers[name] = oidc.NewProvider(cfg)
+	}
+
+	return providers
+}
+
+// identityUser returns the user logging in with claims from provider. An
+// unknown identity is linked to the user with the same email, or gets a new
+// account, but only if the provider verified the email.
+func (h *AuthHandler) identityUser(ctx context.Context, provider string, claims *oidc.Claims) (*models.User, error) {
+	user, err := h.identities.GetUser(ctx, provider, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, store.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+
+	identity := models.Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+
+	user, err = h.guard.users.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		identity.UserID = user.ID
+		if err := h.identities.Link(ctx, identity); err != nil {
+			return nil, err
+		}
+
+		return user, nil
+	}
+	if !errors.Is(err, store.ErrUserNotFound) {
+		return nil, err
+	}
+
+	firstName := claims.GivenName
+	if firstName == "" {
+		firstName = claims.Name
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	return h.identities.CreateUser(ctx, models.User{
+		Email:     claims.Email,
+		FirstName: firstName,
+		LastName:  claims.FamilyName,
+	}, identity)
+}
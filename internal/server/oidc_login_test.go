@@ -0,0 +1,147 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/pkg/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newOIDCTestAPI serves the api with the providers mock and other, both
+// logging in at the returned issuer.
+func newOIDCTestAPI(t *testing.T, user oidctest.User) (*testAPI, *oidctest.Issuer) {
+	t.Helper()
+
+	iss, srv, err := oidctest.Start("client", "secret", user)
+	if err != nil {
+		t.Fatalf("start issuer: %s", err)
+	}
+	t.Cleanup(srv.Close)
+
+	t.Setenv("OIDC_PROVIDERS", "mock,other")
+	for _, prefix := range []string{"OIDC_MOCK_", "OIDC_OTHER_"} {
+		t.Setenv(prefix+"ISSUER", iss.URL)
+		t.Setenv(prefix+"CLIENT_ID", "client")
+		t.Setenv(prefix+"CLIENT_SECRET", "secret")
+	}
+
+	return newTestAPI(t), iss
+}
+
+// authorizeOIDC starts a login with provider and logs in at the issuer,
+// returning the query the browser would bring back to the callback.
+func (a *testAPI) authorizeOIDC(iss *oidctest.Issuer, provider string) url.Values {
+	a.t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(a.srv.URL + "/v1/auth/oidc/" + provider)
+	if err != nil {
+		a.t.Fatalf("start login: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		a.t.Fatalf("start login: got status %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	code, state, err := iss.Authorize(resp.Header.Get("Location"))
+	if err != nil {
+		a.t.Fatalf("authorize: %s", err)
+	}
+
+	return url.Values{"code": {code}, "state": {state}}
+}
+
+func (a *testAPI) oidcCallback(provider string, query url.Values) testResponse {
+	a.t.Helper()
+
+	return a.do(http.MethodGet, "/v1/auth/oidc/"+provider+"/callback?"+query.Encode(), "", nil)
+}
+
+func TestOIDCLinksAccountByEmail(t *testing.T) {
+	api, iss := newOIDCTestAPI(t, oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true, GivenName: "Jane"})
+	registered := api.register("jane@example.com")
+
+	var login models.LoginResponse
+	api.expect(api.oidcCallback("mock", api.authorizeOIDC(iss, "mock")), http.StatusOK, &login)
+	if login.User == nil || login.User.ID != registered.ID || login.Token == "" {
+		t.Fatalf("got %+v, want a login of user %d", login, registered.ID)
+	}
+
+	// the identity is linked now and logs in even once the email changed
+	iss.SetUser(oidctest.User{Subject: "sub-1", Email: "jane@another.example.com", EmailVerified: true})
+	api.expect(api.oidcCallback("mock", api.authorizeOIDC(iss, "mock")), http.StatusOK, &login)
+	if login.User == nil || login.User.ID != registered.ID {
+		t.Fatalf("got %+v, want a login of user %d", login.User, registered.ID)
+	}
+
+	// an unverified email must not take over the account that has it
+	api.register("john@example.com")
+	iss.SetUser(oidctest.User{Subject: "sub-2", Email: "john@example.com", EmailVerified: false})
+	api.expectProblem(api.oidcCallback("mock", api.authorizeOIDC(iss, "mock")), http.StatusForbidden, "email_not_verified")
+}
+
+func TestOIDCRespectsAccountLock(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF", "1ns")
+	t.Setenv("LOGIN_LOCK_AFTER", "2")
+	api, iss := newOIDCTestAPI(t, oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+	registered := api.register("jane@example.com")
+	admin := api.admin()
+
+	for i := 0; i < 2; i++ {
+		api.expectProblem(api.do(http.MethodPost, "/v1/auth/login", "", models.LoginReq{
+			Email:    "jane@example.com",
+			Password: "Wr0ngPassword!",
+		}), http.StatusBadRequest, "invalid_credentials")
+	}
+
+	// the provider does not get around the lock of the account
+	api.expectProblem(api.oidcCallback("mock", api.authorizeOIDC(iss, "mock")), http.StatusTooManyRequests, "account_locked")
+
+	api.expect(api.do(http.MethodPost, "/v1/users/"+strconv.Itoa(registered.ID)+"/unlock", admin, nil), http.StatusOK, nil)
+	api.expect(api.oidcCallback("mock", api.authorizeOIDC(iss, "mock")), http.StatusOK, nil)
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	api, iss := newOIDCTestAPI(t, oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+
+	query := api.authorizeOIDC(iss, "mock")
+	forged := url.Values{"code": query["code"], "state": {"forged"}}
+	api.expectProblem(api.oidcCallback("mock", forged), http.StatusBadRequest, "invalid_oidc_state")
+
+	// a state only completes the login at the provider it was made for
+	api.expectProblem(api.oidcCallback("other", api.authorizeOIDC(iss, "mock")), http.StatusBadRequest, "invalid_oidc_state")
+
+	api.expect(api.oidcCallback("mock", query), http.StatusOK, nil)
+	// states are single use
+	api.expectProblem(api.oidcCallback("mock", query), http.StatusBadRequest, "invalid_oidc_state")
+}
+
+func TestOIDCRefusesIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+	}{
+		{"wrong nonce", func(c jwt.MapClaims) { c["nonce"] = "another nonce" }},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another client" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://issuer.example.com" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, iss := newOIDCTestAPI(t, oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true})
+			iss.SetClaims(tt.claims)
+
+			api.expectProblem(api.oidcCallback("mock", api.authorizeOIDC(iss, "mock")), http.StatusUnauthorized, "invalid_id_token")
+
+			// no account was created for the refused token
+			iss.SetClaims(nil)
+			api.expectProblem(api.do(http.MethodPost, "/v1/auth/login", "", models.LoginReq{Email: "jane@example.com", Password: testPassword}), http.StatusBadRequest, "invalid_credentials")
+		})
+	}
+}
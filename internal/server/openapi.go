@@ -0,0 +1,291 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+
+	"github.com/escoutdoor/ecommerce/internal/middleware"
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/openapi"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/tokens"
+)
+
+//go:embed docs.html
+var docsPage []byte
+
+const (
+	bearerAuth = "bearerAuth"
+	apiKeyAuth = "apiKeyAuth"
+)
+
+var (
+	authed = []string{bearerAuth, apiKeyAuth}
+	// loggedIn routes manage the account and refuse api keys
+	loggedIn = []string{bearerAuth}
+)
+
+// idempotent documents the Idempotency-Key header accepted by the routes
+// wrapped in middleware.Idempotency.
+var idempotent = []openapi.Parameter{{
+	Name:        middleware.IdempotencyKeyHeader,
+	In:          "header",
+	Description: "Unique key that makes the request safe to retry. Retries with the same key and body get the original response back, reusing it with a different body fails with 422.",
+	Schema:      &openapi.Schema{Type: "string", MinLength: intPtr(1), MaxLength: intPtr(255)},
+}}
+
+// oidcCallback documents the parameters providers redirect back with.
+var oidcCallback = []openapi.Parameter{
+	{Name: "code", In: "query", Description: "Authorization code issued by the provider", Schema: &openapi.Schema{Type: "string"}},
+	{Name: "state", In: "query", Required: true, Description: "State of the login, valid once and for ten minutes", Schema: &openapi.Schema{Type: "string"}},
+	{Name: "error", In: "query", Description: "Set by the provider instead of code when the login failed", Schema: &openapi.Schema{Type: "string"}},
+}
+
+// exportFormat documents the formats of /users/me/export.
+var exportFormat = []openapi.Parameter{
+	{Name: "format", In: "query", Description: "json, the default, or zip", Schema: &openapi.Schema{Type: "string", Enum: []string{"json", "zip"}}},
+}
+
+// deletionStatus filters the account deletions.
+var deletionStatus = []openapi.Parameter{
+	{Name: "status", In: "query", Description: "Only list deletions with this status", Schema: &openapi.Schema{Type: "string", Enum: []string{models.DeletionPending, models.DeletionCancelled, models.DeletionCompleted}}},
+}
+
+// auditFilters documents the filters of /admin/audit.
+var auditFilters = []openapi.Parameter{
+	{Name: "actor_id", In: "query", Description: "Only entries of changes made by this user", Schema: &openapi.Schema{Type: "integer"}},
+	{Name: "action", In: "query", Description: "Only entries with this action, e.g. product.update or auth.login_failed", Schema: &openapi.Schema{Type: "string"}},
+	{Name: "entity_type", In: "query", Description: "Only entries about this kind of entity, e.g. product", Schema: &openapi.Schema{Type: "string"}},
+	{Name: "entity_id", In: "query", Description: "Only entries about the entity with this id", Schema: &openapi.Schema{Type: "string"}},
+	{Name: "since", In: "query", Description: "Only entries made at or after this time", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+	{Name: "until", In: "query", Description: "Only entries made before this time", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+	{Name: "before_id", In: "query", Description: "Only entries older than the entry with this id", Schema: &openapi.Schema{Type: "integer"}},
+	{Name: "limit", In: "query", Description: "Maximum number of entries, 100 by default", Schema: &openapi.Schema{Type: "integer", Minimum: floatPtr(1), Maximum: floatPtr(1000)}},
+}
+
+// deliveryFilters documents the filters of the webhook deliveries.
+var deliveryFilters = []openapi.Parameter{
+	{Name: "status", In: "query", Description: "Only deliveries with this status", Schema: &openapi.Schema{Type: "string", Enum: []string{models.WebhookDeliveryPending, models.WebhookDeliverySucceeded, models.WebhookDeliveryDead}}},
+	{Name: "before_id", In: "query", Description: "Only deliveries older than the delivery with this id", Schema: &openapi.Schema{Type: "integer"}},
+	{Name: "limit", In: "query", Description: "Maximum number of deliveries, 100 by default", Schema: &openapi.Schema{Type: "integer", Minimum: floatPtr(1), Maximum: floatPtr(1000)}},
+}
+
+// jobFilters documents the filters of the job queue.
+var jobFilters = []openapi.Parameter{
+	{Name: "status", In: "query", Description: "Only jobs with this status", Schema: &openapi.Schema{Type: "string", Enum: []string{models.JobQueued, models.JobRunning, models.JobFailed}}},
+	{Name: "kind", In: "query", Description: "Only jobs of this kind, e.g. mail.send", Schema: &openapi.Schema{Type: "string"}},
+	{Name: "before_id", In: "query", Description: "Only jobs older than the job with this id", Schema: &openapi.Schema{Type: "integer"}},
+	{Name: "limit", In: "query", Description: "Maximum number of jobs, 100 by default", Schema: &openapi.Schema{Type: "integer", Minimum: floatPtr(1), Maximum: floatPtr(1000)}},
+}
+
+// lastEventIDHeader documents the header an event stream client resumes with.
+var lastEventIDHeader = []openapi.Parameter{
+	{Name: "Last-Event-ID", In: "header", Description: "The id of the last event received, the stream starts with the events after it. Sent by EventSource when it reconnects.", Schema: &openapi.Schema{Type: "integer", Minimum: floatPtr(0)}},
+}
+
+// apiSpec documents every route registered in Router. openapi.Build fails
+// when the two disagree, which `make test` checks.
+func (s *Server) apiSpec() openapi.Spec {
+	return openapi.Spec{
+		Info: openapi.Info{
+			Title:   "ecommerce api",
+			Version: "1.0.0",
+		},
+		SecuritySchemes: map[string]openapi.SecurityScheme{
+			bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			apiKeyAuth: {Type: "apiKey", In: "header", Name: "Authorization", Description: "A personal api key sent as `ApiKey <key>`. Keys are only accepted by the route groups in their scopes."},
+		},
+		ErrorContentType: respond.ProblemContentType,
+		ErrorBody:        respond.Problem{},
+		Operations: append([]openapi.Operation{
+			{Method: http.MethodGet, Path: "/.well-known/jwks.json", Tag: "auth", Summary: "Public keys that verify our tokens", Description: "Includes keys scheduled to become active, verifiers may cache it for five minutes.", Response: tokens.JWKS{}},
+			{Method: http.MethodGet, Path: "/healthz", Tag: "health", Summary: "Liveness probe", Response: models.HealthResponse{}},
+			{Method: http.MethodGet, Path: "/readyz", Tag: "health", Summary: "Readiness probe", Response: models.HealthResponse{}, ErrorStatuses: []int{503}},
+			{Method: http.MethodGet, Path: "/openapi.json", Tag: "docs", Summary: "This document"},
+			{Method: http.MethodGet, Path: "/docs", Tag: "docs", Summary: "Api documentation browser"},
+		}, versioned(rateLimited(scoped(apiOperations())))...),
+	}
+}
+
+// rateLimited documents the RateLimit headers and the 429 response of ops,
+// every api route group is limited by middleware.RateLimit.
+func rateLimited(ops []openapi.Operation) []openapi.Operation {
+	out := make([]openapi.Operation, 0, len(ops))
+	for _, op := range ops {
+		op.Headers = withHeaders(op.Headers, map[string]openapi.Header{
+			"RateLimit-Policy":    {Description: "The quota of the route group, as requests;w=window in seconds", Schema: &openapi.Schema{Type: "string"}},
+			"RateLimit-Limit":     {Description: "Requests allowed per window", Schema: &openapi.Schema{Type: "integer"}},
+			"RateLimit-Remaining": {Description: "Requests left in the current window", Schema: &openapi.Schema{Type: "integer"}},
+			"RateLimit-Reset":     {Description: "Seconds until the quota is fully restored", Schema: &openapi.Schema{Type: "integer"}},
+		})
+		op.ErrorStatuses = append(append([]int(nil), op.ErrorStatuses...), http.StatusTooManyRequests)
+		out = append(out, op)
+	}
+
+	return out
+}
+
+// scoped documents the 403 of operations accepting api keys, which is
+// returned when the key has no scope for the route.
+func scoped(ops []openapi.Operation) []openapi.Operation {
+	out := make([]openapi.Operation, 0, len(ops))
+	for _, op := range ops {
+		if hasString(op.Security, apiKeyAuth) && !hasStatus(op.ErrorStatuses, http.StatusForbidden) {
+			op.ErrorStatuses = append(append([]int(nil), op.ErrorStatuses...), http.StatusForbidden)
+		}
+		out = append(out, op)
+	}
+
+	return out
+}
+
+// versioned documents every api operation under /v1 and as a deprecated
+// unversioned alias.
+func versioned(ops []openapi.Operation) []openapi.Operation {
+	deprecationHeaders := map[string]openapi.Header{
+		"Deprecation": {Description: "Unix time the endpoint was deprecated at, prefixed with @", Schema: &openapi.Schema{Type: "string"}},
+		"Sunset":      {Description: "Date after which the endpoint will be removed", Schema: &openapi.Schema{Type: "string"}},
+		"Link":        {Description: "The successor-version of the endpoint", Schema: &openapi.Schema{Type: "string"}},
+	}
+
+	out := make([]openapi.Operation, 0, 2*len(ops))
+	for _, op := range ops {
+		alias := op
+		alias.Deprecated = true
+		alias.Description = strings.TrimSpace(alias.Description + " Use /v1" + op.Path + " instead.")
+		alias.Headers = withHeaders(op.Headers, deprecationHeaders)
+		out = append(out, alias)
+
+		op.Path = "/v1" + op.Path
+		out = append(out, op)
+	}
+
+	return out
+}
+
+func apiOperations() []openapi.Operation {
+	return []openapi.Operation{
+		{Method: http.MethodPost, Path: "/auth/login", Tag: "auth", Summary: "Log in with email and password", Description: "Failed logins slow down further attempts on the account and lock it for a while once they pile up, answered with 429 and Retry-After. Users with two-factor authentication get a challenge_token instead of a token, to send with a code to /auth/login/2fa.", Request: models.LoginReq{}, Response: models.LoginResponse{}, ErrorStatuses: []int{400}},
+		{Method: http.MethodPost, Path: "/auth/login/2fa", Tag: "auth", Summary: "Complete a login with a two-factor code", Description: "Accepts a code from the authenticator app or an unused recovery code. Failed codes count as failed logins.", Request: models.TwoFactorLoginReq{}, Response: models.AuthResponse{}, ErrorStatuses: []int{400, 401}},
+		{Method: http.MethodGet, Path: "/auth/oidc/{provider}", Tag: "auth", Summary: "Log in with an OpenID Connect provider", Description: "Redirects the browser to the provider, which sends it back to the callback. Providers are configured with OIDC_PROVIDERS.", SuccessStatus: http.StatusFound, Headers: map[string]openapi.Header{"Location": {Description: "The login page of the provider", Schema: &openapi.Schema{Type: "string"}}}, ErrorStatuses: []int{404, 502}},
+		{Method: http.MethodGet, Path: "/auth/oidc/{provider}/callback", Tag: "auth", Summary: "Complete a login with an OpenID Connect provider", Description: "Logs in the user the identity is linked to. New identities are linked to the user with the same email, or get a new account, if the provider verified the email. Users with two-factor authentication get a challenge_token like on /auth/login. An account locked after failed logins cannot log in with a provider either.", Parameters: oidcCallback, Response: models.LoginResponse{}, ErrorStatuses: []int{400, 401, 403, 404, 409, 429, 502}},
+		{Method: http.MethodPost, Path: "/auth/register", Tag: "auth", Summary: "Create a customer account", Description: "Passwords must be 8 to 256 characters long by default and not appear in the configured list of breached passwords. The emails to the user are written in the given locale, or the one Accept-Language prefers if left out.", Request: models.RegisterReq{}, Response: models.AuthResponse{}, Parameters: idempotent, ErrorStatuses: []int{400, 409, 422}},
+
+		{Method: http.MethodGet, Path: "/users/{id}", Tag: "users", Summary: "Get a user", Description: "Requires the admin role.", Security: authed, Response: models.User{}, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodPost, Path: "/users/{id}/unlock", Tag: "users", Summary: "Unlock a user locked out after failed logins", Description: "Requires the admin role.", Security: authed, Response: "", ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodPost, Path: "/users/2fa", Tag: "users", Summary: "Start enrolling in two-factor authentication", Description: "Returns a new TOTP secret and its otpauth uri, which take effect once confirmed with /users/2fa/enable.", Security: loggedIn, Response: models.TwoFactorEnrollment{}, ErrorStatuses: []int{401, 409}},
+		{Method: http.MethodPost, Path: "/users/2fa/enable", Tag: "users", Summary: "Enable two-factor authentication", Description: "Confirms the enrollment with a code from the authenticator app and returns the recovery codes, which are only shown once. Failed codes count as failed logins of the user.", Security: loggedIn, Request: models.TwoFactorCodeReq{}, Response: models.RecoveryCodes{}, ErrorStatuses: []int{400, 401, 404, 409}},
+		{Method: http.MethodPost, Path: "/users/2fa/disable", Tag: "users", Summary: "Disable two-factor authentication", Description: "Failed codes count as failed logins of the user.", Security: loggedIn, Request: models.TwoFactorCodeReq{}, Response: "", ErrorStatuses: []int{400, 401, 404}},
+		{Method: http.MethodPost, Path: "/users/2fa/recovery-codes", Tag: "users", Summary: "Replace the recovery codes", Description: "Failed codes count as failed logins of the user.", Security: loggedIn, Request: models.TwoFactorCodeReq{}, Response: models.RecoveryCodes{}, ErrorStatuses: []int{400, 401, 404}},
+		{Method: http.MethodPost, Path: "/users/password", Tag: "users", Summary: "Change your password", Description: "Requires the current password, wrong ones count as failed logins. Users who only logged in with a provider so far have none and must have logged in within the last ten minutes instead. Logs out your other sessions.", Security: loggedIn, Request: models.ChangePasswordReq{}, Response: "", ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodPost, Path: "/users/email", Tag: "users", Summary: "Change your email address", Description: "Requires the current password like /users/password and sends a token to the new address, which takes effect once confirmed with /users/email/confirm within an hour.", Security: loggedIn, Request: models.ChangeEmailReq{}, Response: "", SuccessStatus: http.StatusAccepted, ErrorStatuses: []int{400, 401, 403, 404, 502}},
+		{Method: http.MethodPost, Path: "/users/email/confirm", Tag: "users", Summary: "Confirm a new email address", Description: "Applies the change with the token sent to the new address and logs out your other sessions.", Security: loggedIn, Request: models.ConfirmEmailReq{}, Response: models.User{}, ErrorStatuses: []int{400, 401, 404}},
+		{Method: http.MethodPost, Path: "/users/api-keys", Tag: "users", Summary: "Create a personal api key", Description: "The key is only returned once, only its prefix is stored in the clear. Send it as `Authorization: ApiKey <key>`, it acts as the user on the route groups in its scopes.", Security: loggedIn, Request: models.APIKeyReq{}, Response: models.CreatedAPIKey{}, SuccessStatus: http.StatusCreated, ErrorStatuses: []int{400, 401, 404}},
+		{Method: http.MethodGet, Path: "/users/api-keys", Tag: "users", Summary: "List your api keys", Security: loggedIn, Response: []models.APIKey{}, ErrorStatuses: []int{401}},
+		{Method: http.MethodDelete, Path: "/users/api-keys/{id}", Tag: "users", Summary: "Revoke an api key", Security: loggedIn, Response: "", ErrorStatuses: []int{400, 401, 404}},
+		{Method: http.MethodGet, Path: "/users/notifications", Tag: "users", Summary: "Get your notification preferences", Description: "Which emails about your orders you get and their language. Account emails, e.g. after changing the password, are always sent.", Security: authed, Response: models.NotificationPreferences{}, ErrorStatuses: []int{401}},
+		{Method: http.MethodPut, Path: "/users/notifications", Tag: "users", Summary: "Change your notification preferences", Description: "An empty locale writes the emails in the default language of the shop.", Security: authed, Request: models.NotificationPreferencesReq{}, Response: models.NotificationPreferences{}, ErrorStatuses: []int{400, 401, 404}},
+		{Method: http.MethodPut, Path: "/users", Tag: "users", Summary: "Update the current user", Description: "The email can be left out, changing it goes through /users/email.", Security: authed, Request: models.UpdateUserReq{}, Response: models.User{}, ErrorStatuses: []int{400, 401, 404}},
+		{Method: http.MethodDelete, Path: "/users", Tag: "users", Summary: "Delete your account", Description: "Requires the current password like /users/password. Schedules the deletion for after a grace period of 30 days by default, until which it can be cancelled with DELETE /users/deletion. Your personal data is then erased, your orders are kept for accounting without your name and address.", Security: loggedIn, Request: models.DeleteAccountReq{}, Response: models.AccountDeletion{}, SuccessStatus: http.StatusAccepted, ErrorStatuses: []int{400, 401, 403, 404, 409}},
+		{Method: http.MethodGet, Path: "/users/deletion", Tag: "users", Summary: "Get the scheduled deletion of your account", Security: loggedIn, Response: models.AccountDeletion{}, ErrorStatuses: []int{401, 404}},
+		{Method: http.MethodDelete, Path: "/users/deletion", Tag: "users", Summary: "Cancel the deletion of your account", Security: loggedIn, Response: models.AccountDeletion{}, ErrorStatuses: []int{401, 404}},
+		{Method: http.MethodGet, Path: "/users/me/export", Tag: "users", Summary: "Export your personal data", Description: "Returns your profile, the addresses and items of your orders, linked logins and api keys as a json download, or with format=zip as an archive of one json file per section.", Security: loggedIn, Parameters: exportFormat, Response: models.PersonalData{}, Headers: map[string]openapi.Header{"Content-Disposition": {Description: "Name of the file to save the export as", Schema: &openapi.Schema{Type: "string"}}}, ErrorStatuses: []int{400, 401, 404}},
+		{Method: http.MethodGet, Path: "/users/deletions", Tag: "users", Summary: "List account deletions", Description: "Requires the admin role. Includes cancelled and completed deletions with who requested and cancelled them, newest first.", Security: authed, Parameters: deletionStatus, Response: []models.AccountDeletion{}, ErrorStatuses: []int{400, 401, 403}},
+		{Method: http.MethodDelete, Path: "/users/{id}", Tag: "users", Summary: "Delete the account of a user", Description: "Requires the admin role. Schedules the deletion like DELETE /users and records the admin who requested it.", Security: authed, Response: models.AccountDeletion{}, SuccessStatus: http.StatusAccepted, ErrorStatuses: []int{400, 401, 403, 404, 409}},
+		{Method: http.MethodDelete, Path: "/users/{id}/deletion", Tag: "users", Summary: "Cancel the deletion of a user's account", Description: "Requires the admin role.", Security: authed, Response: models.AccountDeletion{}, ErrorStatuses: []int{400, 401, 403, 404}},
+
+		{Method: http.MethodGet, Path: "/categories/{id}", Tag: "categories", Summary: "Get a category", Response: models.Category{}, ErrorStatuses: []int{400, 404}},
+		{Method: http.MethodPost, Path: "/categories", Tag: "categories", Summary: "Create a category", Description: "Requires the admin role.", Security: authed, Request: models.CategoryReq{}, Response: models.Category{}, SuccessStatus: http.StatusCreated, Parameters: idempotent, ErrorStatuses: []int{400, 401, 403, 409, 422}},
+		{Method: http.MethodPut, Path: "/categories/{id}", Tag: "categories", Summary: "Update a category", Description: "Requires the admin role.", Security: authed, Request: models.CategoryReq{}, Response: models.Category{}, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodDelete, Path: "/categories/{id}", Tag: "categories", Summary: "Delete a category", Description: "Requires the admin role.", Security: authed, Response: "", ErrorStatuses: []int{400, 401, 403, 404}},
+
+		{Method: http.MethodGet, Path: "/products/{id}", Tag: "products", Summary: "Get a product", Response: models.Product{}, ErrorStatuses: []int{400, 404}},
+		{Method: http.MethodPost, Path: "/products", Tag: "products", Summary: "Create a product", Description: "Requires the admin role.", Security: authed, Request: models.ProductReq{}, Response: models.Product{}, SuccessStatus: http.StatusCreated, Parameters: idempotent, ErrorStatuses: []int{400, 401, 403, 409, 422}},
+		{Method: http.MethodPut, Path: "/products/{id}", Tag: "products", Summary: "Update a product", Description: "Requires the admin role.", Security: authed, Request: models.ProductReq{}, Response: models.Product{}, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodDelete, Path: "/products/{id}", Tag: "products", Summary: "Delete a product", Description: "Requires the admin role.", Security: authed, Response: "", ErrorStatuses: []int{400, 401, 403, 404}},
+
+		{Method: http.MethodPost, Path: "/orders", Tag: "orders", Summary: "Place an order", Security: authed, Request: models.OrderReq{}, Response: models.Order{}, SuccessStatus: http.StatusCreated, Parameters: idempotent, ErrorStatuses: []int{400, 401, 404, 409, 422}},
+		{Method: http.MethodGet, Path: "/orders/{id}", Tag: "orders", Summary: "Get one of your orders", Security: authed, Response: models.Order{}, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodGet, Path: "/orders/{id}/events", Tag: "orders", Summary: "Stream the status changes of one of your orders", Description: "Server-sent events named `status`, one per status change of an item, with the id of the change. A comment is sent every 15 seconds while nothing changes. The stream ends after about 25 seconds and the client reconnects with Last-Event-ID, missing nothing. Admins may follow any order.", Security: authed, Parameters: lastEventIDHeader, Response: models.OrderStatusUpdate{}, ResponseContentType: "text/event-stream", ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodDelete, Path: "/orders/{id}", Tag: "orders", Summary: "Delete one of your orders", Security: authed, Response: "", ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodPut, Path: "/orders/{id}/items/{item_id}/status", Tag: "orders", Summary: "Change the status of an order item", Description: "Requires the admin role. A change publishes an order.status_changed event.", Security: authed, Request: models.OrderItemStatusReq{}, Response: models.OrderItem{}, ErrorStatuses: []int{400, 401, 403, 404}},
+
+		{Method: http.MethodGet, Path: "/admin/audit", Tag: "admin", Summary: "List the audit log", Description: "Requires the admin role. The log records every change made by admins and every login with who made it, from where and the fields that changed, newest first. It holds no names or emails: users are referred to by id, and failed logins for addresses without an account by a keyed hash of the address. Continue a listing with before_id set to the id of its last entry.", Security: loggedIn, Parameters: auditFilters, Response: []models.AuditEntry{}, ErrorStatuses: []int{400, 401, 403}},
+		{Method: http.MethodGet, Path: "/admin/audit/verify", Tag: "admin", Summary: "Verify the audit log", Description: "Requires the admin role. Each entry includes the hash of the one before it, this recomputes the chain and reports the first entry that was changed or follows a removed one.", Security: loggedIn, Response: models.AuditVerification{}, ErrorStatuses: []int{401, 403}},
+
+		{Method: http.MethodPost, Path: "/admin/webhooks", Tag: "admin", Summary: "Create a webhook", Description: "Requires the admin role. The events of the given types are posted to the url as json, with a Webhook-Signature header holding v1= and the hex HMAC-SHA256 of the Webhook-Timestamp header, a dot and the body, keyed with the secret. The secret is only part of this response. Failed deliveries are retried with exponential backoff and are dead after the last attempt.", Security: loggedIn, Request: models.WebhookReq{}, Response: models.CreatedWebhook{}, SuccessStatus: http.StatusCreated, ErrorStatuses: []int{400, 401, 403, 422}},
+		{Method: http.MethodGet, Path: "/admin/webhooks", Tag: "admin", Summary: "List webhooks", Description: "Requires the admin role.", Security: loggedIn, Response: []models.Webhook{}, ErrorStatuses: []int{401, 403}},
+		{Method: http.MethodGet, Path: "/admin/webhooks/{id}", Tag: "admin", Summary: "Get a webhook", Description: "Requires the admin role.", Security: loggedIn, Response: models.Webhook{}, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodPut, Path: "/admin/webhooks/{id}", Tag: "admin", Summary: "Update a webhook", Description: "Requires the admin role. Deliveries of an inactive webhook wait until it is active again.", Security: loggedIn, Request: models.WebhookReq{}, Response: models.Webhook{}, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodDelete, Path: "/admin/webhooks/{id}", Tag: "admin", Summary: "Delete a webhook", Description: "Requires the admin role. Its deliveries are deleted with it.", Security: loggedIn, Response: "", ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodGet, Path: "/admin/webhooks/{id}/deliveries", Tag: "admin", Summary: "List the deliveries of a webhook", Description: "Requires the admin role. Shows the outcome of the last attempt of each delivery, newest first.", Security: loggedIn, Parameters: deliveryFilters, Response: []models.WebhookDelivery{}, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodPost, Path: "/admin/webhooks/{id}/deliveries/{delivery_id}/redeliver", Tag: "admin", Summary: "Redeliver a webhook delivery", Description: "Requires the admin role. Sends the delivery again as soon as possible, also a dead or succeeded one, with all of its attempts left.", Security: loggedIn, Response: models.WebhookDelivery{}, SuccessStatus: http.StatusAccepted, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodGet, Path: "/admin/jobs", Tag: "admin", Summary: "List jobs", Description: "Requires the admin role. Succeeded jobs are deleted, the queue shows pending, running and failed ones, newest first.", Security: loggedIn, Parameters: jobFilters, Response: []models.Job{}, ErrorStatuses: []int{400, 401, 403}},
+		{Method: http.MethodGet, Path: "/admin/jobs/{id}", Tag: "admin", Summary: "Get a job", Description: "Requires the admin role.", Security: loggedIn, Response: models.Job{}, ErrorStatuses: []int{400, 401, 403, 404}},
+		{Method: http.MethodPost, Path: "/admin/jobs/{id}/requeue", Tag: "admin", Summary: "Requeue a failed job", Description: "Requires the admin role. Runs the job again as soon as possible with all of its attempts left.", Security: loggedIn, Response: models.Job{}, SuccessStatus: http.StatusAccepted, ErrorStatuses: []int{400, 401, 403, 404, 409}},
+	}
+}
+
+// OpenAPI builds the api document, returning an error if it no longer
+// matches the routes of Router.
+func (s *Server) OpenAPI() (*openapi.Document, error) {
+	router, _ := s.routes()
+
+	return openapi.Build(s.apiSpec(), router)
+}
+
+type docsHandler struct {
+	doc *openapi.Document
+}
+
+func (h *docsHandler) handleSpec(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, h.doc)
+}
+
+func (h *docsHandler) handleUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(docsPage)
+}
+
+func hasString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasStatus(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+// withHeaders returns a copy of headers with extra added.
+func withHeaders(headers, extra map[string]openapi.Header) map[string]openapi.Header {
+	out := make(map[string]openapi.Header, len(headers)+len(extra))
+	for name, h := range headers {
+		out[name] = h
+	}
+	for name, h := range extra {
+		out[name] = h
+	}
+
+	return out
+}
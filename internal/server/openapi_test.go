@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the committed api document")
+
+// specPath is the api document published with the repository, regenerated
+// with make openapi.
+var specPath = filepath.Join("..", "..", "api", "openapi.json")
+
+func TestOpenAPI(t *testing.T) {
+	doc, err := New(Stores{}, nil, 0).OpenAPI()
+	if err != nil {
+		t.Fatalf("routes and api document drifted apart: %s", err)
+	}
+
+	var got bytes.Buffer
+	enc := json.NewEncoder(&got)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		t.Fatalf("encode api document: %s", err)
+	}
+
+	if *update {
+		if err := os.WriteFile(specPath, got.Bytes(), 0o644); err != nil {
+			t.Fatalf("write %s: %s", specPath, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(specPath)
+	if err != nil {
+		t.Fatalf("read %s: %s", specPath, err)
+	}
+
+	if !bytes.Equal(got.Bytes(), want) {
+		line, g, w := firstDiff(got.String(), string(want))
+		t.Errorf("%s is out of date, run make openapi\nfirst difference at line %d:\n got: %s\nwant: %s", specPath, line, g, w)
+	}
+}
+
+// firstDiff returns the first line, numbered from 1, where a and b differ
+// and the two versions of it.
+func firstDiff(a, b string) (int, string, string) {
+	al, bl := strings.Split(a, "\n"), strings.Split(b, "\n")
+	for i := 0; i < len(al) || i < len(bl); i++ {
+		var x, y string
+		if i < len(al) {
+			x = al[i]
+		}
+		if i < len(bl) {
+			y = bl[i]
+		}
+		if x != y {
+			return i + 1, x, y
+		}
+	}
+
+	return 0, "", ""
+}
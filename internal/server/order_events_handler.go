@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+)
+
+const (
+	// orderEventBatch is how many events a stream reads from the outbox at
+	// once
+	orderEventBatch = 100
+	// streamRetry is how long a client waits before it reconnects to a
+	// stream that ended
+	streamRetry = time.Second
+)
+
+var (
+	errInvalidLastEventID   = errors.New("invalid Last-Event-ID")
+	errStreamingUnsupported = errors.New("streaming is not supported")
+)
+
+// streamPolicy controls the event streams of orders.
+type streamPolicy struct {
+	// heartbeat is how often an idle stream writes a comment, so proxies do
+	// not close it
+	heartbeat time.Duration
+	// maxDuration ends a stream before the write timeout of the server
+	// does, the client reconnects and resumes with Last-Event-ID
+	maxDuration time.Duration
+	// queryTimeout bounds every query of a stream, the stream itself is not
+	// under the timeout of the orders routes
+	queryTimeout time.Duration
+}
+
+// handleOrderEvents streams the status changes of the items of an order as
+// server-sent events. Every event carries the ID of its outbox event, a
+// client that reconnects with Last-Event-ID gets the events it missed.
+func (h *OrderHandler) handleOrderEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	userID, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	lastID, resume, err := lastEventID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respond.Error(w, r, http.StatusInternalServerError, errStreamingUnsupported)
+		return
+	}
+
+	role := r.Context().Value("role").(string)
+	order, err := h.getOrder(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrOrderNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if order.UserID != userID && role != "admin" {
+		respond.Error(w, r, http.StatusForbidden, respond.ErrForbidden)
+		return
+	}
+
+	// subscribed before the outbox is read, so an event committed in
+	// between wakes the stream instead of being skipped
+	wake, cancel := h.feed.Subscribe(id)
+	defer cancel()
+
+	if !resume {
+		lastID, err = h.lastStatusEvent(r.Context(), id)
+		if err != nil {
+			respond.Error(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses unless told otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// the id sets the Last-Event-ID of a client that gets no event before
+	// it reconnects
+	fmt.Fprintf(w, "retry: %d\nid: %d\n\n", streamRetry.Milliseconds(), lastID)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.stream.heartbeat)
+	defer heartbeat.Stop()
+	end := time.NewTimer(h.stream.maxDuration)
+	defer end.Stop()
+
+	// the first read sends what a resuming client missed
+	pending := resume
+	for {
+		for pending {
+			events, err := h.statusEvents(r.Context(), id, lastID)
+			if err != nil {
+				// the client reconnects and resumes after the last event
+				// it got
+				if r.Context().Err() == nil {
+					log.Printf("read events of order %d error: %s", id, err)
+				}
+				return
+			}
+
+			for _, e := range events {
+				if err := writeStatusEvent(w, e); err != nil {
+					return
+				}
+				lastID = e.ID
+			}
+			if len(events) > 0 {
+				flusher.Flush()
+			}
+
+			pending = len(events) == orderEventBatch
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-end.C:
+			return
+		case _, ok := <-wake:
+			// closed when the server shuts down
+			if !ok {
+				return
+			}
+			pending = true
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (h *OrderHandler) getOrder(ctx context.Context, id int) (*models.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.stream.queryTimeout)
+	defer cancel()
+
+	return h.store.GetByID(ctx, id)
+}
+
+func (h *OrderHandler) lastStatusEvent(ctx context.Context, orderID int) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.stream.queryTimeout)
+	defer cancel()
+
+	return h.store.LastStatusEvent(ctx, orderID)
+}
+
+func (h *OrderHandler) statusEvents(ctx context.Context, orderID int, afterID int64) ([]models.Event, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.stream.queryTimeout)
+	defer cancel()
+
+	return h.store.StatusEvents(ctx, orderID, afterID, orderEventBatch)
+}
+
+// lastEventID returns the ID sent by a client that reconnects, and whether
+// it sent one.
+func lastEventID(r *http.Request) (int64, bool, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		return 0, false, nil
+	}
+
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, fmt.Errorf("%w: %s", errInvalidLastEventID, v)
+	}
+
+	return id, true, nil
+}
+
+func writeStatusEvent(w io.Writer, e models.Event) error {
+	var data models.OrderStatusChanged
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(models.OrderStatusUpdate{
+		OrderID:   data.OrderID,
+		ItemID:    data.ItemID,
+		OldStatus: data.OldStatus,
+		NewStatus: data.NewStatus,
+		ChangedAt: e.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", e.ID, b)
+	return err
+}
@@ -1,125 +1,181 @@
 package server
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/escoutdoor/ecommerce/internal/events"
 	"github.com/escoutdoor/ecommerce/internal/models"
 	"github.com/escoutdoor/ecommerce/internal/store"
 	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 )
 
 type OrderHandler struct {
 	store store.OrderStorer
+	audit *auditor
+	// feed wakes the event streams of orders, stream bounds them
+	feed   *events.OrderFeed
+	stream streamPolicy
 }
 
-func NewOrderHandler(s store.OrderStorer) *OrderHandler {
+func NewOrderHandler(s store.OrderStorer, audit *auditor, feed *events.OrderFeed, stream streamPolicy) *OrderHandler {
 	return &OrderHandler{
-		store: s,
+		store:  s,
+		audit:  audit,
+		feed:   feed,
+		stream: stream,
 	}
 }
 
 func (h *OrderHandler) handleCreateOrder(w http.ResponseWriter, r *http.Request) {
 	id, err := getUserIDCtx(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	var req models.OrderReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := validator.New().Struct(req); err != nil {
+	if err := validate.Struct(req); err != nil {
 		errs := err.(validator.ValidationErrors)
-		respond.Error(w, http.StatusBadRequest, respond.ValidationError(errs))
+		respond.ValidationError(w, r, errs)
 		return
 	}
 
 	order, err := h.store.Create(r.Context(), id, req)
 	if err != nil {
 		if errors.Is(err, store.ErrProductNotFound) {
-			respond.Error(w, http.StatusNotFound, err)
+			respond.Error(w, r, http.StatusNotFound, err)
 			return
 		}
 
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusCreated, order)
+	render(w, r, http.StatusCreated, order)
 }
 
 func (h *OrderHandler) handleGetOrderByID(w http.ResponseWriter, r *http.Request) {
 	id, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	userID, err := getUserIDCtx(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	role := r.Context().Value("role").(string)
-	order, err := h.store.GetByID(id)
+	order, err := h.store.GetByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, store.ErrOrderNotFound) {
-			respond.Error(w, http.StatusNotFound, err)
+			respond.Error(w, r, http.StatusNotFound, err)
 			return
 		}
 
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	if order.UserID != userID && role != "admin" {
-		respond.Error(w, http.StatusForbidden, respond.ErrForbidden)
+		respond.Error(w, r, http.StatusForbidden, respond.ErrForbidden)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, order)
+	render(w, r, http.StatusOK, order)
 }
 
 func (h *OrderHandler) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 	id, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	userID, err := getUserIDCtx(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	order, err := h.store.GetByID(id)
+	order, err := h.store.GetByID(r.Context(), id)
 	if err != nil {
 		fmt.Println(err)
 		if errors.Is(err, store.ErrOrderNotFound) {
-			respond.Error(w, http.StatusNotFound, err)
+			respond.Error(w, r, http.StatusNotFound, err)
 			return
 		}
 
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	if order.UserID != userID {
-		respond.Error(w, http.StatusForbidden, respond.ErrForbidden)
+		respond.Error(w, r, http.StatusForbidden, respond.ErrForbidden)
 		return
 	}
 
-	if err := h.store.Delete(id); err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+	if err := h.store.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, store.ErrOrderNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, "order successfully deleted")
+}
+
+func (h *OrderHandler) handleUpdateItemStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	itemIDStr := chi.URLParam(r, "item_id")
+	itemID, err := strconv.Atoi(itemIDStr)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", errInvalidID, itemIDStr))
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, "order successfully deleted")
+	var req models.OrderItemStatusReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	item, err := h.store.UpdateItemStatus(r.Context(), id, itemID, req.Status)
+	if err != nil {
+		if errors.Is(err, store.ErrOrderItemNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "order.item_status", EntityType: "order_item", EntityID: itemIDStr}, nil, req)
+
+	render(w, r, http.StatusOK, item)
 }
@@ -0,0 +1,356 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/notification"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+)
+
+var (
+	errInvalidExportFormat   = errors.New("format must be json or zip")
+	errInvalidDeletionStatus = errors.New("status must be pending, cancelled or completed")
+)
+
+// PrivacyHandler exports the personal data of users and deletes their
+// accounts. Deleting is scheduled for after a grace period, in which it can
+// be cancelled. The user is then anonymized rather than deleted, so their
+// orders are kept for accounting.
+type PrivacyHandler struct {
+	data      store.PersonalDataStorer
+	deletions store.AccountDeletionStorer
+	users     store.UserStorer
+	guard     *loginGuard
+	notifier  *notification.Notifier
+	tasks     *tasks
+	audit     *auditor
+	// grace is how long after the request an account is deleted
+	grace time.Duration
+}
+
+func NewPrivacyHandler(data store.PersonalDataStorer, deletions store.AccountDeletionStorer, users store.UserStorer, guard *loginGuard, notifier *notification.Notifier, tasks *tasks, audit *auditor, grace time.Duration) *PrivacyHandler {
+	return &PrivacyHandler{
+		data:      data,
+		deletions: deletions,
+		users:     users,
+		guard:     guard,
+		notifier:  notifier,
+		tasks:     tasks,
+		audit:     audit,
+		grace:     grace,
+	}
+}
+
+// handleExport sends everything stored about the user as one json document,
+// or with format=zip as an archive with a json file per section.
+func (h *PrivacyHandler) handleExport(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		respond.Error(w, r, http.StatusBadRequest, errInvalidExportFormat)
+		return
+	}
+
+	data, err := h.data.Export(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	filename := fmt.Sprintf("personal-data-%d-%s.%s", id, data.ExportedAt.UTC().Format("20060102"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	if format == "json" {
+		render(w, r, http.StatusOK, data)
+		return
+	}
+
+	archive, err := exportArchive(data)
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// exportArchive zips the sections of data, each as its own json file.
+func exportArchive(data *models.PersonalData) ([]byte, error) {
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", data.Profile},
+		{"addresses.json", data.Addresses},
+		{"orders.json", data.Orders},
+		{"identities.json", data.Identities},
+		{"api_keys.json", data.APIKeys},
+		{"account.json", map[string]any{
+			"exported_at":        data.ExportedAt,
+			"two_factor_enabled": data.TwoFactorEnabled,
+			"deletion":           data.Deletion,
+		}},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.name,
+			Method:   zip.Deflate,
+			Modified: data.ExportedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// handleRequestDeletion schedules deleting the account of the current user.
+// Like a password change it needs the current password, a stolen token
+// alone cannot delete the account.
+func (h *PrivacyHandler) handleRequestDeletion(w http.ResponseWriter, r *http.Request) {
+	var req models.DeleteAccountReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	user, ok := h.guard.reauthenticate(w, r, req.Password)
+	if !ok {
+		return
+	}
+
+	if deletion, ok := h.schedule(w, r, user.ID, user.ID); ok {
+		render(w, r, http.StatusAccepted, deletion)
+	}
+}
+
+func (h *PrivacyHandler) handleGetDeletion(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	deletion, err := h.deletions.Pending(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrAccountDeletionNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, deletion)
+}
+
+func (h *PrivacyHandler) handleCancelDeletion(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if deletion, ok := h.cancel(w, r, id, id); ok {
+		render(w, r, http.StatusOK, deletion)
+	}
+}
+
+// handleDeleteUser schedules deleting the account of another user, e.g.
+// for a request that reached support. The admin is recorded with it.
+func (h *PrivacyHandler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	adminID, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	deletion, ok := h.schedule(w, r, id, adminID)
+	if !ok {
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "user.delete", EntityType: "user", EntityID: strconv.Itoa(id)}, nil, deletion)
+
+	render(w, r, http.StatusAccepted, deletion)
+}
+
+func (h *PrivacyHandler) handleCancelUserDeletion(w http.ResponseWriter, r *http.Request) {
+	adminID, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	deletion, ok := h.cancel(w, r, id, adminID)
+	if !ok {
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "user.delete_cancel", EntityType: "user", EntityID: strconv.Itoa(id)}, nil, deletion)
+
+	render(w, r, http.StatusOK, deletion)
+}
+
+// handleListDeletions lists the deletion requests, including cancelled and
+// completed ones, as the record of who deleted which account.
+func (h *PrivacyHandler) handleListDeletions(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.DeletionPending, models.DeletionCancelled, models.DeletionCompleted:
+	default:
+		respond.Error(w, r, http.StatusBadRequest, errInvalidDeletionStatus)
+		return
+	}
+
+	deletions, err := h.deletions.List(r.Context(), status)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, deletions)
+}
+
+// schedule schedules deleting the account of userID and tells the user.
+// It responds and returns false if the deletion could not be scheduled.
+func (h *PrivacyHandler) schedule(w http.ResponseWriter, r *http.Request, userID, requestedBy int) (*models.AccountDeletion, bool) {
+	user, err := h.users.GetByID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return nil, false
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	deletion, err := h.deletions.Schedule(r.Context(), userID, requestedBy, time.Now().Add(h.grace))
+	if err != nil {
+		if errors.Is(err, store.ErrAccountDeletionPending) {
+			respond.Error(w, r, http.StatusConflict, err)
+			return nil, false
+		}
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return nil, false
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	h.tasks.notify("deletion scheduled", user.ID, func(ctx context.Context) error {
+		return h.notifier.DeletionScheduled(ctx, user, deletion.ScheduledFor)
+	})
+
+	return deletion, true
+}
+
+// cancel cancels the pending deletion of userID. It responds and returns
+// false if there is none.
+func (h *PrivacyHandler) cancel(w http.ResponseWriter, r *http.Request, userID, cancelledBy int) (*models.AccountDeletion, bool) {
+	deletion, err := h.deletions.Cancel(r.Context(), userID, cancelledBy)
+	if err != nil {
+		if errors.Is(err, store.ErrAccountDeletionNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return nil, false
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return deletion, true
+}
+
+// completeDue anonymizes the accounts whose grace period is over. A failed
+// account does not stop the others, it is retried on the next run.
+func (h *PrivacyHandler) completeDue(ctx context.Context) (int64, error) {
+	due, err := h.deletions.Due(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, d := range due {
+		user, err := h.users.GetByID(ctx, d.UserID)
+		if err != nil {
+			log.Printf("delete account of user %d error: %s", d.UserID, err)
+			continue
+		}
+
+		if err := h.deletions.Complete(ctx, d.ID); err != nil {
+			log.Printf("delete account of user %d error: %s", d.UserID, err)
+			continue
+		}
+		n++
+
+		// the failed logins are keyed by the address that is gone now
+		if err := h.guard.unlock(ctx, user.Email); err != nil {
+			log.Printf("forget login attempts of user %d error: %s", d.UserID, err)
+		}
+
+		h.tasks.notify("account deleted", user.ID, func(ctx context.Context) error {
+			return h.notifier.AccountDeleted(ctx, user)
+		})
+	}
+
+	return n, nil
+}
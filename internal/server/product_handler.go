@@ -1,9 +1,9 @@
 package server
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/escoutdoor/ecommerce/internal/models"
 	"github.com/escoutdoor/ecommerce/internal/store"
@@ -13,113 +13,152 @@ import (
 
 type ProductHandler struct {
 	store store.ProductStorer
+	audit *auditor
 }
 
-func NewProductHandler(s store.ProductStorer) *ProductHandler {
+func NewProductHandler(s store.ProductStorer, audit *auditor) *ProductHandler {
 	return &ProductHandler{
 		store: s,
+		audit: audit,
 	}
 }
 
 func (h *ProductHandler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 	var req models.ProductReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := validator.New().Struct(req); err != nil {
+	if err := validate.Struct(req); err != nil {
 		errs := err.(validator.ValidationErrors)
-		respond.Error(w, http.StatusBadRequest, respond.ValidationError(errs))
+		respond.ValidationError(w, r, errs)
 		return
 	}
 
-	product, err := h.store.Create(req)
+	product, err := h.store.Create(r.Context(), req)
 	if err != nil {
 		if errors.Is(err, store.ErrCategoryNotFound) {
-			respond.Error(w, http.StatusBadRequest, err)
+			respond.Error(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusCreated, product)
+	h.audit.record(r, models.AuditEntry{Action: "product.create", EntityType: "product", EntityID: strconv.Itoa(product.ID)}, nil, product)
+
+	render(w, r, http.StatusCreated, product)
 }
 
 func (h *ProductHandler) handleGetProductByID(w http.ResponseWriter, r *http.Request) {
 	id, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	product, err := h.store.GetByID(id)
+	product, err := h.store.GetByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, store.ErrProductNotFound) {
-			respond.Error(w, http.StatusNotFound, err)
+			respond.Error(w, r, http.StatusNotFound, err)
 			return
 		}
 
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, product)
+	render(w, r, http.StatusOK, product)
 }
 
 func (h *ProductHandler) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
 	id, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := h.store.Delete(id); err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+	before, err := h.store.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrProductNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, store.ErrProductNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, "product successfully deleted")
+	h.audit.record(r, models.AuditEntry{Action: "product.delete", EntityType: "product", EntityID: strconv.Itoa(id)}, before, nil)
+
+	render(w, r, http.StatusOK, "product successfully deleted")
 }
 
 func (h *ProductHandler) handleUpdateProduct(w http.ResponseWriter, r *http.Request) {
 	var req models.ProductReq
 	_, err := getUserIDCtx(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	productID, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := validator.New().Struct(req); err != nil {
+	if err := validate.Struct(req); err != nil {
 		errs := err.(validator.ValidationErrors)
-		respond.Error(w, http.StatusBadRequest, respond.ValidationError(errs))
+		respond.ValidationError(w, r, errs)
 		return
 	}
 
-	product, err := h.store.Update(productID, req)
+	before, err := h.store.GetByID(r.Context(), productID)
 	if err != nil {
+		if errors.Is(err, store.ErrProductNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	product, err := h.store.Update(r.Context(), productID, req)
+	if err != nil {
+		if errors.Is(err, store.ErrProductNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
 		if errors.Is(err, store.ErrCategoryNotFound) {
-			respond.Error(w, http.StatusBadRequest, err)
+			respond.Error(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, product)
+	h.audit.record(r, models.AuditEntry{Action: "product.update", EntityType: "product", EntityID: strconv.Itoa(productID)}, before, product)
+
+	render(w, r, http.StatusOK, product)
 
 }
@@ -1,55 +1,163 @@
 package server
 
 import (
+	"os"
+
 	"github.com/escoutdoor/ecommerce/internal/middleware"
+	"github.com/escoutdoor/ecommerce/internal/openapi"
 	"github.com/go-chi/chi/v5"
 	chimiddle "github.com/go-chi/chi/v5/middleware"
 )
 
-func (s *Server) Router() *chi.Mux {
+// Router returns the handler of the api, with the api document served at
+// /openapi.json. It fails if the document no longer matches the routes.
+func (s *Server) Router() (*chi.Mux, error) {
+	router, docs := s.routes()
+
+	doc, err := openapi.Build(s.apiSpec(), router)
+	if err != nil {
+		return nil, err
+	}
+	docs.doc = doc
+
+	return router, nil
+}
+
+func (s *Server) routes() (*chi.Mux, *docsHandler) {
 	router := chi.NewRouter()
+	router.Use(chimiddle.RequestID)
+	// only behind a proxy that sets these headers, clients could pick their
+	// own address for rate limiting otherwise
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		router.Use(chimiddle.RealIP)
+	}
 	router.Use(chimiddle.Logger)
 	router.Use(chimiddle.StripSlashes)
 
+	docs := &docsHandler{}
+	router.Get("/openapi.json", docs.handleSpec)
+	router.Get("/docs", docs.handleUI)
+
+	router.Get("/.well-known/jwks.json", s.auth.handleJWKS)
+
+	router.Get("/healthz", s.health.handleLiveness)
+	router.Get("/readyz", s.health.handleReadiness)
+
+	router.Route("/v1", func(r chi.Router) {
+		r.Use(withAPIVersion(v1))
+
+		s.apiRoutes(r)
+	})
+
+	// the unversioned routes predate /v1 and are kept until the sunset date
+	router.Group(func(r chi.Router) {
+		r.Use(middleware.Deprecated(rootDeprecatedAt, rootSunset, "/v1"))
+		r.Use(withAPIVersion(v1))
+
+		s.apiRoutes(r)
+	})
+
+	return router, docs
+}
+
+// apiRoutes registers the versioned api on router. Versions share handlers
+// and differ only in the presenter set by withAPIVersion.
+func (s *Server) apiRoutes(router chi.Router) {
+	idempotent := middleware.Idempotency(s.idempotency, s.idempotencyTTL, s.idempotencyLease)
+	authStores := middleware.AuthStores{
+		Users:    s.user.store,
+		Sessions: s.account.sessions,
+		APIKeys:  s.apiKeys.store,
+	}
+	// ahead of JWTAuth, the limits of the groups follow it and are per user
+	throttleClients := middleware.RateLimit(s.rateLimit, "clients", s.limits.clients)
+
 	router.Route("/users", func(r chi.Router) {
-		r.Use(middleware.JWTAuth(s.user.store))
+		r.Use(middleware.Timeout(s.timeouts.users))
+		r.Use(throttleClients)
+		r.Use(middleware.JWTAuth(authStores, s.tokens, "users"))
+		r.Use(middleware.RateLimit(s.rateLimit, "users", s.limits.users))
 
 		r.Group(func(r chi.Router) {
 			r.Use(middleware.RoleGuard)
+			r.Use(middleware.RequireTwoFactor(s.requireAdmin2FA))
 
 			r.Get("/{id}", s.user.handleGetUserByID)
+			r.Post("/{id}/unlock", s.auth.handleUnlockUser)
+			r.Delete("/{id}", s.privacy.handleDeleteUser)
+			r.Delete("/{id}/deletion", s.privacy.handleCancelUserDeletion)
+			r.Get("/deletions", s.privacy.handleListDeletions)
+		})
+
+		// keys must not be able to mint other keys, change the login or take
+		// the personal data out of the account
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.DenyAPIKeys)
+
+			r.Post("/2fa", s.twoFA.handleEnroll)
+			r.Post("/2fa/enable", s.twoFA.handleEnable)
+			r.Post("/2fa/disable", s.twoFA.handleDisable)
+			r.Post("/2fa/recovery-codes", s.twoFA.handleRegenerateRecoveryCodes)
+
+			r.Post("/password", s.account.handleChangePassword)
+			r.Post("/email", s.account.handleChangeEmail)
+			r.Post("/email/confirm", s.account.handleConfirmEmail)
+
+			r.Post("/api-keys", s.apiKeys.handleCreateAPIKey)
+			r.Get("/api-keys", s.apiKeys.handleListAPIKeys)
+			r.Delete("/api-keys/{id}", s.apiKeys.handleDeleteAPIKey)
+
+			r.Get("/me/export", s.privacy.handleExport)
+			r.Delete("/", s.privacy.handleRequestDeletion)
+			r.Get("/deletion", s.privacy.handleGetDeletion)
+			r.Delete("/deletion", s.privacy.handleCancelDeletion)
 		})
 
 		r.Put("/", s.user.handleUpdateUser)
-		r.Delete("/", s.user.handleDeleteUser)
+		r.Get("/notifications", s.notifications.handleGetPreferences)
+		r.Put("/notifications", s.notifications.handleUpdatePreferences)
 	})
 
 	router.Route("/auth", func(r chi.Router) {
+		r.Use(middleware.Timeout(s.timeouts.auth))
+		r.Use(middleware.RateLimit(s.rateLimit, "auth", s.limits.auth))
+
 		r.Post("/login", s.auth.handleLoginUser)
-		r.Post("/register", s.auth.handleRegisterUser)
+		r.Post("/login/2fa", s.auth.handleLoginTwoFactor)
+		r.With(idempotent).Post("/register", s.auth.handleRegisterUser)
+		r.Get("/oidc/{provider}", s.auth.handleOIDCLogin)
+		r.Get("/oidc/{provider}/callback", s.auth.handleOIDCCallback)
 	})
 
 	router.Route("/categories", func(r chi.Router) {
+		r.Use(middleware.Timeout(s.timeouts.categories))
+		r.Use(middleware.RateLimit(s.rateLimit, "categories", s.limits.categories))
+
 		r.Get("/{id}", s.category.handleGetCategoryByID)
 
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.JWTAuth(s.user.store))
+			r.Use(middleware.JWTAuth(authStores, s.tokens, "categories"))
 			r.Use(middleware.RoleGuard)
+			r.Use(middleware.RequireTwoFactor(s.requireAdmin2FA))
 
-			r.Post("/", s.category.handleCreateCategory)
+			r.With(idempotent).Post("/", s.category.handleCreateCategory)
 			r.Delete("/{id}", s.category.handleDeleteCategory)
 			r.Put("/{id}", s.category.handleUpdateCategory)
 		})
 	})
 
 	router.Route("/products", func(r chi.Router) {
+		r.Use(middleware.Timeout(s.timeouts.products))
+		r.Use(middleware.RateLimit(s.rateLimit, "products", s.limits.products))
+
 		r.Get("/{id}", s.product.handleGetProductByID)
 
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.JWTAuth(s.user.store))
+			r.Use(middleware.JWTAuth(authStores, s.tokens, "products"))
 			r.Use(middleware.RoleGuard)
+			r.Use(middleware.RequireTwoFactor(s.requireAdmin2FA))
 
-			r.Post("/", s.product.handleCreateProduct)
+			r.With(idempotent).Post("/", s.product.handleCreateProduct)
 			r.Put("/{id}", s.product.handleUpdateProduct)
 			r.Delete("/{id}", s.product.handleDeleteProduct)
 		})
@@ -57,13 +165,56 @@ func (s *Server) Router() *chi.Mux {
 
 	router.Route("/orders", func(r chi.Router) {
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.JWTAuth(s.user.store))
+			r.Use(middleware.Timeout(s.timeouts.orders))
+			r.Use(throttleClients)
+			r.Use(middleware.JWTAuth(authStores, s.tokens, "orders"))
+			r.Use(middleware.RateLimit(s.rateLimit, "orders", s.limits.orders))
 
-			r.Post("/", s.order.handleCreateOrder)
+			r.With(idempotent).Post("/", s.order.handleCreateOrder)
 			r.Delete("/{id}", s.order.handleDeleteOrder)
 			r.Get("/{id}", s.order.handleGetOrderByID)
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RoleGuard)
+				r.Use(middleware.RequireTwoFactor(s.requireAdmin2FA))
+
+				r.Put("/{id}/items/{item_id}/status", s.order.handleUpdateItemStatus)
+			})
+		})
+
+		// a stream outlives the timeout of the other routes, it bounds its
+		// queries itself
+		r.Group(func(r chi.Router) {
+			r.Use(throttleClients)
+			r.Use(middleware.JWTAuth(authStores, s.tokens, "orders"))
+			r.Use(middleware.RateLimit(s.rateLimit, "orders", s.limits.orders))
+
+			r.Get("/{id}/events", s.order.handleOrderEvents)
 		})
 	})
 
-	return router
+	router.Route("/admin", func(r chi.Router) {
+		r.Use(middleware.Timeout(s.timeouts.admin))
+		r.Use(throttleClients)
+		r.Use(middleware.JWTAuth(authStores, s.tokens, "admin"))
+		r.Use(middleware.DenyAPIKeys)
+		r.Use(middleware.RoleGuard)
+		r.Use(middleware.RequireTwoFactor(s.requireAdmin2FA))
+		r.Use(middleware.RateLimit(s.rateLimit, "admin", s.limits.admin))
+
+		r.Get("/audit", s.audit.handleListAudit)
+		r.Get("/audit/verify", s.audit.handleVerifyAudit)
+
+		r.Post("/webhooks", s.webhooks.handleCreateWebhook)
+		r.Get("/webhooks", s.webhooks.handleListWebhooks)
+		r.Get("/webhooks/{id}", s.webhooks.handleGetWebhook)
+		r.Put("/webhooks/{id}", s.webhooks.handleUpdateWebhook)
+		r.Delete("/webhooks/{id}", s.webhooks.handleDeleteWebhook)
+		r.Get("/webhooks/{id}/deliveries", s.webhooks.handleListDeliveries)
+		r.Post("/webhooks/{id}/deliveries/{delivery_id}/redeliver", s.webhooks.handleRedeliver)
+
+		r.Get("/jobs", s.jobs.handleListJobs)
+		r.Get("/jobs/{id}", s.jobs.handleGetJob)
+		r.Post("/jobs/{id}/requeue", s.jobs.handleRequeueJob)
+	})
 }
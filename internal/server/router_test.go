@@ -0,0 +1,592 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/store/memstore"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/tokens"
+	"github.com/escoutdoor/ecommerce/pkg/totp"
+)
+
+const testPassword = "Passw0rd!23"
+
+// testAPI serves Router over the in-memory stores.
+type testAPI struct {
+	t   *testing.T
+	srv *httptest.Server
+	mem *memstore.DB
+}
+
+// newTestAPI serves the api from in-memory stores, which opts may replace.
+func newTestAPI(t *testing.T, opts ...func(*Stores)) *testAPI {
+	t.Helper()
+
+	// every test registers and logs in more often than the default limits
+	// allow, unless it sets a limit itself
+	for _, key := range []string{"RATE_LIMIT_AUTH", "RATE_LIMIT_USERS", "RATE_LIMIT_ORDERS", "RATE_LIMIT_ADMIN", "RATE_LIMIT_CLIENTS"} {
+		if _, ok := os.LookupEnv(key); !ok {
+			t.Setenv(key, "off")
+		}
+	}
+	t.Setenv("AUDIT_HASH_KEY", "test key")
+
+	mem := memstore.NewDB()
+	stores := Stores{
+		User:     memstore.NewUserStore(mem),
+		Auth:     memstore.NewAuthStore(mem),
+		Product:  memstore.NewProductStore(mem),
+		Order:    memstore.NewOrderStore(mem),
+		Category: memstore.NewCategoryStore(mem),
+		Health:   memstore.NewHealthStore(0),
+
+		Idempotency: memstore.NewIdempotencyStore(mem),
+		RateLimit:   store.NewLocalRateLimitStore(),
+
+		LoginAttempts: memstore.NewLoginAttemptStore(mem),
+		TwoFactor:     memstore.NewTwoFactorStore(mem),
+		Identities:    memstore.NewIdentityStore(mem),
+		APIKeys:       memstore.NewAPIKeyStore(mem),
+		Sessions:      memstore.NewSessionStore(mem),
+		EmailChanges:  memstore.NewEmailChangeStore(mem),
+		Deletions:     memstore.NewAccountDeletionStore(mem),
+		PersonalData:  memstore.NewPersonalDataStore(mem),
+		Audit:         memstore.NewAuditStore(mem),
+		Outbox:        memstore.NewOutboxStore(mem),
+		Webhooks:      memstore.NewWebhookStore(mem),
+		Jobs:          memstore.NewJobStore(mem),
+		Notifications: memstore.NewNotificationStore(mem),
+		OrderListener: memstore.NewOrderListener(mem),
+	}
+	for _, opt := range opts {
+		opt(&stores)
+	}
+
+	router, err := New(stores, testIssuer(t), 0).Router()
+	if err != nil {
+		t.Fatalf("router: %s", err)
+	}
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return &testAPI{t: t, srv: srv, mem: mem}
+}
+
+func testIssuer(t *testing.T) *tokens.Issuer {
+	t.Helper()
+
+	pem, err := tokens.GenerateKey(tokens.EdDSA)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+
+	key, err := tokens.NewKey("test", tokens.EdDSA, pem, time.Now().Add(-time.Minute), time.Time{})
+	if err != nil {
+		t.Fatalf("new key: %s", err)
+	}
+
+	issuer, err := tokens.NewIssuer([]*tokens.Key{key}, "ecommerce", "ecommerce-api")
+	if err != nil {
+		t.Fatalf("new issuer: %s", err)
+	}
+
+	return issuer
+}
+
+type testResponse struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// do sends body as json, with token as bearer token unless it is empty.
+func (a *testAPI) do(method, path, token string, body any) testResponse {
+	a.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			a.t.Fatalf("encode body: %s", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, a.srv.URL+path, reader)
+	if err != nil {
+		a.t.Fatalf("new request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := a.srv.Client().Do(req)
+	if err != nil {
+		a.t.Fatalf("%s %s: %s", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		a.t.Fatalf("read body: %s", err)
+	}
+
+	return testResponse{status: resp.StatusCode, contentType: resp.Header.Get("Content-Type"), body: data}
+}
+
+// expect fails the test unless the response has status, and decodes its
+// body into v if v is not nil.
+func (a *testAPI) expect(resp testResponse, status int, v any) {
+	a.t.Helper()
+
+	if resp.status != status {
+		a.t.Fatalf("got status %d, want %d: %s", resp.status, status, resp.body)
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(resp.body, v); err != nil {
+			a.t.Fatalf("decode %s: %s", resp.body, err)
+		}
+	}
+}
+
+// expectProblem fails the test unless the response is a problem document
+// with status and code.
+func (a *testAPI) expectProblem(resp testResponse, status int, code string) respond.Problem {
+	a.t.Helper()
+
+	if resp.contentType != respond.ProblemContentType {
+		a.t.Fatalf("got content type %q, want %q: %s", resp.contentType, respond.ProblemContentType, resp.body)
+	}
+
+	var problem respond.Problem
+	a.expect(resp, status, &problem)
+
+	if problem.Status != status {
+		a.t.Errorf("got problem status %d, want %d", problem.Status, status)
+	}
+	if problem.Code != code {
+		a.t.Errorf("got problem code %q, want %q: %s", problem.Code, code, resp.body)
+	}
+	if problem.Title != http.StatusText(status) {
+		a.t.Errorf("got problem title %q, want %q", problem.Title, http.StatusText(status))
+	}
+
+	return problem
+}
+
+type authResponse struct {
+	models.User
+	Token string `json:"token"`
+}
+
+func (a *testAPI) register(email string) authResponse {
+	a.t.Helper()
+
+	var user authResponse
+	a.expect(a.do(http.MethodPost, "/v1/auth/register", "", models.RegisterReq{
+		Email:     email,
+		FirstName: "Test",
+		LastName:  "User",
+		Password:  testPassword,
+	}), http.StatusOK, &user)
+
+	if user.Token == "" {
+		a.t.Fatalf("register %s returned no token", email)
+	}
+
+	return user
+}
+
+func (a *testAPI) admin() string {
+	a.t.Helper()
+
+	user := a.register("admin@example.com")
+	if err := a.mem.SetRole(user.ID, "admin"); err != nil {
+		a.t.Fatalf("set role: %s", err)
+	}
+
+	return user.Token
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	api := newTestAPI(t)
+
+	user := api.register("jane@example.com")
+	if user.Email != "jane@example.com" || user.ID == 0 {
+		t.Fatalf("unexpected user %+v", user.User)
+	}
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/auth/register", "", models.RegisterReq{
+		Email:     "jane@example.com",
+		FirstName: "Jane",
+		Password:  testPassword,
+	}), http.StatusBadRequest, "email_already_exists")
+
+	problem := api.expectProblem(api.do(http.MethodPost, "/v1/auth/register", "", models.RegisterReq{
+		Email:     "not an email",
+		FirstName: "J",
+		Password:  testPassword,
+	}), http.StatusBadRequest, respond.CodeValidationFailed)
+	fields := map[string]bool{}
+	for _, e := range problem.Errors {
+		fields[e.Field] = true
+	}
+	if !fields["email"] || !fields["first_name"] {
+		t.Errorf("got field errors %+v, want email and first_name", problem.Errors)
+	}
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/auth/register", "", "{"), http.StatusBadRequest, "invalid_body")
+
+	var login authResponse
+	api.expect(api.do(http.MethodPost, "/v1/auth/login", "", models.LoginReq{
+		Email:    "jane@example.com",
+		Password: testPassword,
+	}), http.StatusOK, &login)
+	if login.Token == "" || login.ID != user.ID {
+		t.Fatalf("login returned %+v", login)
+	}
+
+	api.expect(api.do(http.MethodGet, "/v1/users/notifications", login.Token, nil), http.StatusOK, nil)
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/auth/login", "", models.LoginReq{
+		Email:    "jane@example.com",
+		Password: "Wr0ngPassword!",
+	}), http.StatusBadRequest, "invalid_credentials")
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/auth/login", "", models.LoginReq{
+		Email:    "nobody@example.com",
+		Password: testPassword,
+	}), http.StatusBadRequest, "invalid_credentials")
+}
+
+func TestAuthFailures(t *testing.T) {
+	api := newTestAPI(t)
+	customer := api.register("jane@example.com")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+		code   string
+	}{
+		{"no token", http.MethodGet, "/v1/orders/1", "", http.StatusUnauthorized, "unauthorized"},
+		{"malformed token", http.MethodGet, "/v1/orders/1", "not-a-jwt", http.StatusUnauthorized, "invalid_token"},
+		{"token of another issuer", http.MethodGet, "/v1/users/notifications", foreignToken(t, customer.ID), http.StatusUnauthorized, "invalid_token"},
+		{"customer creates a category", http.MethodPost, "/v1/categories", customer.Token, http.StatusForbidden, "forbidden"},
+		{"customer creates a product", http.MethodPost, "/v1/products", customer.Token, http.StatusForbidden, "forbidden"},
+		{"customer reads another user", http.MethodGet, "/v1/users/1", customer.Token, http.StatusForbidden, "forbidden"},
+		{"customer lists jobs", http.MethodGet, "/v1/admin/jobs", customer.Token, http.StatusForbidden, "forbidden"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.t = t
+			api.expectProblem(api.do(tt.method, tt.path, tt.token, models.CategoryReq{Name: "Books"}), tt.status, tt.code)
+		})
+	}
+}
+
+// foreignToken is a well-formed token for id signed by a key the server
+// does not know.
+func foreignToken(t *testing.T, id int) string {
+	t.Helper()
+
+	token, err := testIssuer(t).CreateJWT(id, "session")
+	if err != nil {
+		t.Fatalf("create token: %s", err)
+	}
+
+	return token
+}
+
+func TestCategoriesAndProducts(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.admin()
+
+	var category models.Category
+	api.expect(api.do(http.MethodPost, "/v1/categories", admin, models.CategoryReq{Name: "Books"}), http.StatusCreated, &category)
+	if category.ID == 0 || category.Name != "Books" {
+		t.Fatalf("unexpected category %+v", category)
+	}
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/categories", admin, models.CategoryReq{Name: "ab"}), http.StatusBadRequest, respond.CodeValidationFailed)
+
+	categoryPath := fmt.Sprintf("/v1/categories/%d", category.ID)
+	api.expect(api.do(http.MethodGet, categoryPath, "", nil), http.StatusOK, &category)
+
+	api.expect(api.do(http.MethodPut, categoryPath, admin, models.CategoryReq{Name: "Novels"}), http.StatusOK, &category)
+	if category.Name != "Novels" {
+		t.Errorf("got category name %q after update, want Novels", category.Name)
+	}
+
+	api.expectProblem(api.do(http.MethodGet, "/v1/categories/999", "", nil), http.StatusNotFound, "category_not_found")
+	api.expectProblem(api.do(http.MethodGet, "/v1/categories/abc", "", nil), http.StatusBadRequest, "invalid_id")
+
+	var product models.Product
+	api.expect(api.do(http.MethodPost, "/v1/products", admin, models.ProductReq{
+		Name:       "Go book",
+		Price:      39.9,
+		CategoryID: category.ID,
+	}), http.StatusCreated, &product)
+	if product.ID == 0 || product.CategoryID != category.ID {
+		t.Fatalf("unexpected product %+v", product)
+	}
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/products", admin, models.ProductReq{
+		Name:       "Orphan",
+		Price:      1,
+		CategoryID: 999,
+	}), http.StatusBadRequest, "category_not_found")
+	api.expectProblem(api.do(http.MethodPost, "/v1/products", admin, models.ProductReq{Name: "No price"}), http.StatusBadRequest, respond.CodeValidationFailed)
+
+	productPath := fmt.Sprintf("/v1/products/%d", product.ID)
+	api.expect(api.do(http.MethodGet, productPath, "", nil), http.StatusOK, &product)
+
+	api.expect(api.do(http.MethodPut, productPath, admin, models.ProductReq{
+		Name:       "Go book, 2nd edition",
+		Price:      44.5,
+		CategoryID: category.ID,
+	}), http.StatusOK, &product)
+	if product.Price != 44.5 {
+		t.Errorf("got price %v after update, want 44.5", product.Price)
+	}
+
+	api.expectProblem(api.do(http.MethodGet, "/v1/products/999", "", nil), http.StatusNotFound, "product_not_found")
+
+	api.expect(api.do(http.MethodDelete, productPath, admin, nil), http.StatusOK, nil)
+	api.expectProblem(api.do(http.MethodGet, productPath, "", nil), http.StatusNotFound, "product_not_found")
+	api.expectProblem(api.do(http.MethodDelete, productPath, admin, nil), http.StatusNotFound, "product_not_found")
+
+	api.expect(api.do(http.MethodDelete, categoryPath, admin, nil), http.StatusOK, nil)
+	api.expectProblem(api.do(http.MethodGet, categoryPath, "", nil), http.StatusNotFound, "category_not_found")
+}
+
+func TestOrders(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.admin()
+	customer := api.register("jane@example.com")
+	other := api.register("john@example.com")
+
+	var category models.Category
+	api.expect(api.do(http.MethodPost, "/v1/categories", admin, models.CategoryReq{Name: "Books"}), http.StatusCreated, &category)
+	var product models.Product
+	api.expect(api.do(http.MethodPost, "/v1/products", admin, models.ProductReq{Name: "Go book", Price: 10, CategoryID: category.ID}), http.StatusCreated, &product)
+
+	shipping := models.ShippingDetailsReq{AddressLine1: "Main 1", City: "Kyiv", Country: "Ukraine"}
+
+	var order models.Order
+	api.expect(api.do(http.MethodPost, "/v1/orders", customer.Token, models.OrderReq{OrderItems: []models.CreateOrderItemReq{
+		{ProductID: product.ID, Quantity: 3, ShippingDetails: shipping},
+	}}), http.StatusCreated, &order)
+	if order.UserID != customer.ID || order.Total != 30 || len(order.OrderItems) != 1 {
+		t.Fatalf("unexpected order %+v", order)
+	}
+	item := order.OrderItems[0]
+	if item.Status != "pending" {
+		t.Errorf("got item status %q, want pending", item.Status)
+	}
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/orders", customer.Token, models.OrderReq{OrderItems: []models.CreateOrderItemReq{
+		{ProductID: 999, Quantity: 1, ShippingDetails: shipping},
+	}}), http.StatusNotFound, "product_not_found")
+	api.expectProblem(api.do(http.MethodPost, "/v1/orders", customer.Token, models.OrderReq{}), http.StatusBadRequest, respond.CodeValidationFailed)
+
+	orderPath := fmt.Sprintf("/v1/orders/%d", order.ID)
+	api.expect(api.do(http.MethodGet, orderPath, customer.Token, nil), http.StatusOK, nil)
+	api.expect(api.do(http.MethodGet, orderPath, admin, nil), http.StatusOK, nil)
+	api.expectProblem(api.do(http.MethodGet, orderPath, other.Token, nil), http.StatusForbidden, "forbidden")
+	api.expectProblem(api.do(http.MethodGet, "/v1/orders/999", customer.Token, nil), http.StatusNotFound, "order_not_found")
+
+	statusPath := fmt.Sprintf("%s/items/%d/status", orderPath, item.ID)
+	api.expectProblem(api.do(http.MethodPut, statusPath, customer.Token, models.OrderItemStatusReq{Status: "shipped"}), http.StatusForbidden, "forbidden")
+	api.expectProblem(api.do(http.MethodPut, statusPath, admin, models.OrderItemStatusReq{Status: "lost"}), http.StatusBadRequest, respond.CodeValidationFailed)
+	api.expectProblem(api.do(http.MethodPut, orderPath+"/items/999/status", admin, models.OrderItemStatusReq{Status: "shipped"}), http.StatusNotFound, "order_item_not_found")
+
+	api.expect(api.do(http.MethodPut, statusPath, admin, models.OrderItemStatusReq{Status: "shipped"}), http.StatusOK, &item)
+	if item.Status != "shipped" {
+		t.Errorf("got item status %q after update, want shipped", item.Status)
+	}
+
+	api.expectProblem(api.do(http.MethodDelete, orderPath, other.Token, nil), http.StatusForbidden, "forbidden")
+	api.expect(api.do(http.MethodDelete, orderPath, customer.Token, nil), http.StatusOK, nil)
+	api.expectProblem(api.do(http.MethodGet, orderPath, customer.Token, nil), http.StatusNotFound, "order_not_found")
+}
+
+func TestTwoFactorCodesThrottled(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.register("jane@example.com")
+
+	var enrollment models.TwoFactorEnrollment
+	api.expect(api.do(http.MethodPost, "/v1/users/2fa", user.Token, nil), http.StatusOK, &enrollment)
+
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("code: %s", err)
+	}
+	api.expect(api.do(http.MethodPost, "/v1/users/2fa/enable", user.Token, models.TwoFactorCodeReq{Code: code}), http.StatusOK, nil)
+
+	// a wrong code counts as a failed login, the next attempt has to wait
+	// for the backoff
+	wrong := models.TwoFactorCodeReq{Code: "wrong-code"}
+	api.expectProblem(api.do(http.MethodPost, "/v1/users/2fa/disable", user.Token, wrong), http.StatusBadRequest, "invalid_two_factor_code")
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/users/2fa/recovery-codes", user.Token, wrong), http.StatusTooManyRequests, "login_throttled")
+
+	// logging in is throttled by the same failures
+	api.expectProblem(api.do(http.MethodPost, "/v1/auth/login", "", models.LoginReq{
+		Email:    "jane@example.com",
+		Password: testPassword,
+	}), http.StatusTooManyRequests, "login_throttled")
+}
+
+func TestFailedLoginAuditHasNoEmail(t *testing.T) {
+	// the same address is tried twice in a row
+	t.Setenv("LOGIN_BACKOFF", "1ns")
+	api := newTestAPI(t)
+	user := api.register("jane@example.com")
+
+	for _, email := range []string{"jane@example.com", "Nobody@example.com", "nobody@example.com"} {
+		api.expectProblem(api.do(http.MethodPost, "/v1/auth/login", "", models.LoginReq{
+			Email:    email,
+			Password: "Wr0ngPassword!",
+		}), http.StatusBadRequest, "invalid_credentials")
+	}
+
+	entries, err := memstore.NewAuditStore(api.mem).List(context.Background(), models.AuditFilter{Action: "auth.login_failed", Limit: 10})
+	if err != nil {
+		t.Fatalf("list audit log: %s", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d failed logins in the audit log, want 3", len(entries))
+	}
+
+	// newest first
+	known, unknown := entries[2], entries[:2]
+	if known.EntityID != strconv.Itoa(user.ID) {
+		t.Errorf("got entity %q for a failed login of user %d", known.EntityID, user.ID)
+	}
+
+	var hashes []string
+	for _, e := range entries {
+		if strings.Contains(strings.ToLower(string(e.After)), "example.com") {
+			t.Errorf("audit entry %s holds the email", e.After)
+		}
+
+		var after map[string]string
+		if err := json.Unmarshal(e.After, &after); err != nil {
+			t.Fatalf("decode %s: %s", e.After, err)
+		}
+		hashes = append(hashes, after["email_hash"])
+	}
+
+	for _, e := range unknown {
+		if e.EntityID != "" {
+			t.Errorf("got entity %q for a failed login of an unknown address", e.EntityID)
+		}
+	}
+	if hashes[0] == "" || hashes[0] != hashes[1] {
+		t.Errorf("got hashes %q for the same unknown address, want them equal", hashes[:2])
+	}
+	if hashes[2] != "" {
+		t.Errorf("got hash %q for a failed login of a user", hashes[2])
+	}
+}
+
+func TestDeleteAccountNeedsPassword(t *testing.T) {
+	// the wrong password is a failed login, the right one follows at once
+	t.Setenv("LOGIN_BACKOFF", "1ns")
+	api := newTestAPI(t)
+	user := api.register("jane@example.com")
+
+	api.expectProblem(api.do(http.MethodDelete, "/v1/users", user.Token, nil), http.StatusBadRequest, "invalid_body")
+	api.expectProblem(api.do(http.MethodDelete, "/v1/users", user.Token, models.DeleteAccountReq{
+		Password: "Wr0ngPassword!",
+	}), http.StatusForbidden, "invalid_current_password")
+	api.expectProblem(api.do(http.MethodGet, "/v1/users/deletion", user.Token, nil), http.StatusNotFound, "account_deletion_not_found")
+
+	var deletion models.AccountDeletion
+	api.expect(api.do(http.MethodDelete, "/v1/users", user.Token, models.DeleteAccountReq{
+		Password: testPassword,
+	}), http.StatusAccepted, &deletion)
+	if deletion.UserID != user.ID || deletion.Status != models.DeletionPending {
+		t.Errorf("got deletion %+v, want a pending one of user %d", deletion, user.ID)
+	}
+}
+
+func TestClientsThrottledBeforeAuth(t *testing.T) {
+	t.Setenv("RATE_LIMIT_CLIENTS", "2/1m")
+	api := newTestAPI(t)
+
+	// an invalid token costs a lookup until the address runs out of
+	// requests
+	for i := 0; i < 2; i++ {
+		api.expectProblem(api.do(http.MethodGet, "/v1/users/notifications", "not a token", nil), http.StatusUnauthorized, "invalid_token")
+	}
+	api.expectProblem(api.do(http.MethodGet, "/v1/orders/1", "not a token", nil), http.StatusTooManyRequests, "rate_limited")
+}
+
+// failingJobs refuses every job, e.g. the emails the handlers queue.
+type failingJobs struct {
+	store.JobStorer
+}
+
+func (failingJobs) Enqueue(context.Context, models.Job) (*models.Job, error) {
+	return nil, errors.New("queue is down")
+}
+
+// savedChanges remembers the token hash of the last saved email change.
+type savedChanges struct {
+	store.EmailChangeStorer
+	tokenHash string
+}
+
+func (s *savedChanges) Save(ctx context.Context, change models.EmailChange) error {
+	s.tokenHash = change.TokenHash
+	return s.EmailChangeStorer.Save(ctx, change)
+}
+
+func TestChangeEmailDropsUnsentChange(t *testing.T) {
+	var changes *savedChanges
+	api := newTestAPI(t, func(s *Stores) {
+		s.Jobs = failingJobs{s.Jobs}
+		changes = &savedChanges{EmailChangeStorer: s.EmailChanges}
+		s.EmailChanges = changes
+	})
+	user := api.register("jane@example.com")
+
+	api.expectProblem(api.do(http.MethodPost, "/v1/users/email", user.Token, models.ChangeEmailReq{
+		Email:    "jane@another.example.com",
+		Password: testPassword,
+	}), http.StatusBadGateway, "email_not_sent")
+
+	if changes.tokenHash == "" {
+		t.Fatal("no email change was saved")
+	}
+	_, err := changes.Take(context.Background(), user.ID, changes.tokenHash)
+	if !errors.Is(err, store.ErrEmailChangeNotFound) {
+		t.Errorf("unsent change: got %v, want %v", err, store.ErrEmailChangeNotFound)
+	}
+}
@@ -1,29 +1,153 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/escoutdoor/ecommerce/internal/events"
+	"github.com/escoutdoor/ecommerce/internal/jobs"
+	"github.com/escoutdoor/ecommerce/internal/mailer"
+	"github.com/escoutdoor/ecommerce/internal/migrate"
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/notification"
 	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/store/memstore"
+	"github.com/escoutdoor/ecommerce/migrations"
+	"github.com/escoutdoor/ecommerce/pkg/password"
+	"github.com/escoutdoor/ecommerce/pkg/tokens"
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
 )
 
 type Server struct {
-	listenAddr string
+	*http.Server
+
+	listenAddr  string
+	drainPeriod time.Duration
+	timeouts    routeTimeouts
+	tokens      *tokens.Issuer
+	limits      routeLimits
+	db          *store.DB
+
+	idempotency      store.IdempotencyStorer
+	idempotencyTTL   time.Duration
+	idempotencyLease time.Duration
+	rateLimit        store.RateLimitStorer
+	// requireAdmin2FA refuses admin routes to tokens issued without a
+	// second factor
+	requireAdmin2FA bool
+	// stop ends the background jobs started by NewServer
+	stop context.CancelFunc
+	// events delivers the events of the outbox to its subscribers
+	events *events.Bus
+	// queue runs the jobs enqueued by the handlers, queueDone is closed
+	// once its workers have finished after stop
+	queue     *jobs.Queue
+	queueDone chan struct{}
+	// tasks is the work requests leave running after they responded
+	tasks *tasks
 
 	user     *UserHandler
 	auth     *AuthHandler
 	product  *ProductHandler
 	order    *OrderHandler
 	category *CategoryHandler
+	health   *HealthHandler
+	twoFA    *TwoFactorHandler
+	apiKeys  *APIKeyHandler
+	account  *AccountHandler
+	privacy  *PrivacyHandler
+	audit    *AuditHandler
+	webhooks *WebhookHandler
+	jobs     *JobHandler
+
+	notifications *NotificationHandler
+}
+
+// routeTimeouts holds the maximum time a request in each route group may spend,
+// including its database queries.
+type routeTimeouts struct {
+	users      time.Duration
+	auth       time.Duration
+	categories time.Duration
+	products   time.Duration
+	orders     time.Duration
+	admin      time.Duration
 }
 
-func NewServer() *http.Server {
+// routeLimits holds the number of requests a client may make to each route
+// group per period.
+type routeLimits struct {
+	users      models.RateLimit
+	auth       models.RateLimit
+	categories models.RateLimit
+	products   models.RateLimit
+	orders     models.RateLimit
+	admin      models.RateLimit
+	// clients limits every address on the routes that need a login. It is
+	// checked before the token, so requests without a valid one are
+	// throttled before they cost a lookup.
+	clients models.RateLimit
+}
+
+// longest is the longest period of the limits, after which every bucket is
+// full again.
+func (l routeLimits) longest() time.Duration {
+	var d time.Duration
+	for _, limit := range []models.RateLimit{l.users, l.auth, l.categories, l.products, l.orders, l.admin, l.clients} {
+		if limit.Period > d {
+			d = limit.Period
+		}
+	}
+
+	return d
+}
+
+var (
+	errInvalidID   = errors.New("invalid id")
+	errInvalidBody = errors.New("invalid request body")
+)
+
+// Stores groups the persistence layer the handlers depend on, so the server
+// can run against Postgres or the in-memory stores from store/memstore.
+type Stores struct {
+	User     store.UserStorer
+	Auth     store.AuthStorer
+	Product  store.ProductStorer
+	Order    store.OrderStorer
+	Category store.CategoryStorer
+	Health   store.HealthStorer
+
+	Idempotency   store.IdempotencyStorer
+	RateLimit     store.RateLimitStorer
+	LoginAttempts store.LoginAttemptStorer
+	TwoFactor     store.TwoFactorStorer
+	Identities    store.IdentityStorer
+	APIKeys       store.APIKeyStorer
+	Sessions      store.SessionStorer
+	EmailChanges  store.EmailChangeStorer
+	Deletions     store.AccountDeletionStorer
+	PersonalData  store.PersonalDataStorer
+	Audit         store.AuditStorer
+	Outbox        store.OutboxStorer
+	Webhooks      store.WebhookStorer
+	Jobs          store.JobStorer
+	Notifications store.NotificationStorer
+	// OrderListener wakes the event streams of orders, it is only run by
+	// NewServer
+	OrderListener store.OrderListener
+}
+
+func NewServer() *Server {
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("load env error: ", err)
 	}
@@ -33,56 +157,489 @@ func NewServer() *http.Server {
 		port = "8080"
 	}
 
-	db, err := store.ConnectToDB()
+	expectedVersion, err := migrate.Latest(migrations.FS)
+	if err != nil {
+		log.Fatal("read migrations error: ", err)
+	}
+
+	var (
+		db     *store.DB
+		stores Stores
+	)
+	switch os.Getenv("STORE") {
+	case "memory":
+		log.Println("using in-memory stores, data will not be persisted")
+
+		mem := memstore.NewDB()
+		stores = Stores{
+			User:     memstore.NewUserStore(mem),
+			Auth:     memstore.NewAuthStore(mem),
+			Product:  memstore.NewProductStore(mem),
+			Order:    memstore.NewOrderStore(mem),
+			Category: memstore.NewCategoryStore(mem),
+			Health:   memstore.NewHealthStore(expectedVersion),
+
+			Idempotency: memstore.NewIdempotencyStore(mem),
+			RateLimit:   store.NewLocalRateLimitStore(),
+
+			LoginAttempts: memstore.NewLoginAttemptStore(mem),
+			TwoFactor:     memstore.NewTwoFactorStore(mem),
+			Identities:    memstore.NewIdentityStore(mem),
+			APIKeys:       memstore.NewAPIKeyStore(mem),
+			Sessions:      memstore.NewSessionStore(mem),
+			EmailChanges:  memstore.NewEmailChangeStore(mem),
+			Deletions:     memstore.NewAccountDeletionStore(mem),
+			PersonalData:  memstore.NewPersonalDataStore(mem),
+			Audit:         memstore.NewAuditStore(mem),
+			Outbox:        memstore.NewOutboxStore(mem),
+			Webhooks:      memstore.NewWebhookStore(mem),
+			Jobs:          memstore.NewJobStore(mem),
+			Notifications: memstore.NewNotificationStore(mem),
+			OrderListener: memstore.NewOrderListener(mem),
+		}
+	default:
+		db, err = store.ConnectToDB()
+		if err != nil {
+			log.Fatal("new server error: ", err)
+		}
+
+		stores = Stores{
+			User:     store.NewUserStore(db),
+			Auth:     store.NewAuthStore(db),
+			Product:  store.NewProductStore(db),
+			Order:    store.NewOrderStore(db),
+			Category: store.NewCategoryStore(db),
+			Health:   store.NewHealthStore(db),
+
+			Idempotency: store.NewIdempotencyStore(db),
+			RateLimit:   store.NewLocalRateLimitStore(),
+
+			LoginAttempts: store.NewLoginAttemptStore(db),
+			TwoFactor:     store.NewTwoFactorStore(db),
+			Identities:    store.NewIdentityStore(db),
+			APIKeys:       store.NewAPIKeyStore(db),
+			Sessions:      store.NewSessionStore(db),
+			EmailChanges:  store.NewEmailChangeStore(db),
+			Deletions:     store.NewAccountDeletionStore(db),
+			PersonalData:  store.NewPersonalDataStore(db),
+			Audit:         store.NewAuditStore(db),
+			Outbox:        store.NewOutboxStore(db),
+			Webhooks:      store.NewWebhookStore(db),
+			Jobs:          store.NewJobStore(db),
+			Notifications: store.NewNotificationStore(db),
+			OrderListener: store.NewOrderListener(),
+		}
+
+		// replicas only share their limits when the buckets live in postgres
+		if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+			stores.RateLimit = store.NewRateLimitStore(db)
+		}
+	}
+
+	if err := password.ConfigureFromEnv(); err != nil {
+		log.Fatal("configure passwords error: ", err)
+	}
+
+	issuer, err := tokens.FromEnv()
 	if err != nil {
-		log.Fatal("new server error: ", err)
+		log.Fatal("load jwt keys error: ", err)
 	}
 
-	userStore := store.NewUserStore(db)
-	user := NewUserHandler(userStore)
+	s := New(stores, issuer, expectedVersion)
+	s.listenAddr = ":" + port
+	s.drainPeriod = durationEnv("SHUTDOWN_DRAIN_PERIOD", 5*time.Second)
+	s.db = db
 
-	authStore := store.NewAuthStore(db)
-	auth := NewAuthHandler(authStore)
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+	go s.purgeEvery(ctx, durationEnv("IDEMPOTENCY_PURGE_INTERVAL", time.Hour), "expired idempotency keys", s.idempotency.DeleteExpired)
+	go s.purgeEvery(ctx, durationEnv("RATE_LIMIT_PURGE_INTERVAL", 10*time.Minute), "stale rate limit buckets", func(ctx context.Context) (int64, error) {
+		return s.rateLimit.DeleteStale(ctx, time.Now().Add(-s.limits.longest()))
+	})
+	go s.purgeEvery(ctx, durationEnv("LOGIN_ATTEMPT_PURGE_INTERVAL", time.Hour), "stale login attempts", func(ctx context.Context) (int64, error) {
+		return s.auth.guard.attempts.DeleteStale(ctx, time.Now().Add(-s.auth.guard.policy.window))
+	})
+	go s.purgeEvery(ctx, durationEnv("OIDC_STATE_PURGE_INTERVAL", time.Hour), "expired oidc login states", s.auth.identities.DeleteExpiredStates)
+	go s.purgeEvery(ctx, durationEnv("SESSION_PURGE_INTERVAL", time.Hour), "expired sessions", s.account.sessions.DeleteExpired)
+	go s.purgeEvery(ctx, durationEnv("EMAIL_CHANGE_PURGE_INTERVAL", time.Hour), "expired email changes", s.account.emailChanges.DeleteExpired)
+	go s.purgeEvery(ctx, durationEnv("ACCOUNT_DELETION_INTERVAL", time.Hour), "accounts due for deletion", s.privacy.completeDue)
 
-	orderStore := store.NewOrderStore(db)
-	order := NewOrderHandler(orderStore)
+	webhooks := events.NewWebhookSender(stores.Webhooks, webhookPolicyFromEnv())
+	s.events.Subscribe("webhooks", webhooks.Enqueue, events.WebhookEvents...)
+	go webhooks.Run(ctx)
 
-	productStore := store.NewProductStore(db)
-	product := NewProductHandler(productStore)
+	go events.NewDispatcher(stores.Outbox, s.events, eventPolicyFromEnv()).Run(ctx)
+	eventRetention := durationEnv("EVENT_RETENTION", 7*24*time.Hour)
+	go s.purgeEvery(ctx, durationEnv("EVENT_PURGE_INTERVAL", time.Hour), "delivered events", func(ctx context.Context) (int64, error) {
+		return stores.Outbox.DeleteDelivered(ctx, time.Now().Add(-eventRetention))
+	})
+	go s.purgeEvery(ctx, durationEnv("EVENT_PURGE_INTERVAL", time.Hour), "notified events", func(ctx context.Context) (int64, error) {
+		return stores.Notifications.DeleteNotified(ctx, time.Now().Add(-eventRetention))
+	})
 
-	categoryStore := store.NewCategoryStore(db)
-	category := NewCategoryHandler(categoryStore)
+	go s.order.feed.Run(ctx, stores.OrderListener)
 
-	s := &Server{
-		listenAddr: ":" + port,
-		user:       user,
-		auth:       auth,
-		product:    product,
-		order:      order,
-		category:   category,
+	s.queueDone = make(chan struct{})
+	go func() {
+		defer close(s.queueDone)
+		s.queue.Run(ctx)
+	}()
+	jobRetention := durationEnv("JOB_RETENTION", 30*24*time.Hour)
+	go s.purgeEvery(ctx, durationEnv("JOB_PURGE_INTERVAL", time.Hour), "failed jobs", func(ctx context.Context) (int64, error) {
+		return stores.Jobs.DeleteFailed(ctx, time.Now().Add(-jobRetention))
+	})
+
+	router, err := s.Router()
+	if err != nil {
+		log.Fatal("build api document error: ", err)
 	}
 
-	server := &http.Server{
+	s.Server = &http.Server{
 		Addr:         s.listenAddr,
-		Handler:      s.Router(),
+		Handler:      router,
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
 
-	return server
+	return s
+}
+
+// New wires the handlers to the given stores. The returned server has no
+// listener configured, Router can be served directly, e.g. with httptest.
+func New(stores Stores, issuer *tokens.Issuer, expectedVersion int64) *Server {
+	dbTimeout := durationEnv("DB_TIMEOUT", 5*time.Second)
+	timeouts := routeTimeouts{
+		users:      durationEnv("DB_TIMEOUT_USERS", dbTimeout),
+		auth:       durationEnv("DB_TIMEOUT_AUTH", dbTimeout),
+		categories: durationEnv("DB_TIMEOUT_CATEGORIES", dbTimeout),
+		products:   durationEnv("DB_TIMEOUT_PRODUCTS", dbTimeout),
+		orders:     durationEnv("DB_TIMEOUT_ORDERS", dbTimeout),
+		admin:      durationEnv("DB_TIMEOUT_ADMIN", dbTimeout),
+	}
+
+	limits := routeLimits{
+		users:      rateLimitEnv("RATE_LIMIT_USERS", models.RateLimit{Burst: 60, Period: time.Minute}),
+		auth:       rateLimitEnv("RATE_LIMIT_AUTH", models.RateLimit{Burst: 10, Period: time.Minute}),
+		categories: rateLimitEnv("RATE_LIMIT_CATEGORIES", models.RateLimit{Burst: 300, Period: time.Minute}),
+		products:   rateLimitEnv("RATE_LIMIT_PRODUCTS", models.RateLimit{Burst: 300, Period: time.Minute}),
+		orders:     rateLimitEnv("RATE_LIMIT_ORDERS", models.RateLimit{Burst: 60, Period: time.Minute}),
+		admin:      rateLimitEnv("RATE_LIMIT_ADMIN", models.RateLimit{Burst: 60, Period: time.Minute}),
+		// users behind one address share it
+		clients: rateLimitEnv("RATE_LIMIT_CLIENTS", models.RateLimit{Burst: 300, Period: time.Minute}),
+	}
+
+	queue := jobs.NewQueue(stores.Jobs, jobPolicyFromEnv())
+	tasks := &tasks{}
+
+	templates, err := notification.LoadTemplates(stringEnv("MAIL_DEFAULT_LOCALE", "en"))
+	if err != nil {
+		log.Fatal("load email templates error: ", err)
+	}
+	notifier := notification.NewNotifier(stores.User, stores.Order, stores.Product, stores.Notifications, mailer.Queued(queue, mailer.FromEnv()), templates, stringEnv("SHOP_NAME", "ecommerce"))
+
+	guard := &loginGuard{
+		attempts: stores.LoginAttempts,
+		users:    stores.User,
+		sessions: stores.Sessions,
+		notifier: notifier,
+		tasks:    tasks,
+		policy:   loginPolicyFromEnv(),
+	}
+
+	audit := auditorFromEnv(stores.Audit)
+
+	bus := events.NewBus()
+	if sink := events.SinkFromEnv(); sink != nil {
+		bus.Subscribe("sink", sink)
+	}
+	bus.Subscribe("notifications", notifier.Handle, notification.Events...)
+
+	return &Server{
+		timeouts:       timeouts,
+		tokens:         issuer,
+		limits:         limits,
+		idempotency:    stores.Idempotency,
+		idempotencyTTL: durationEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		// well past the write timeout of the server
+		idempotencyLease: durationEnv("IDEMPOTENCY_KEY_LEASE", time.Minute),
+		rateLimit:        stores.RateLimit,
+
+		requireAdmin2FA: os.Getenv("ADMIN_REQUIRE_2FA") == "true",
+		events:          bus,
+		queue:           queue,
+		tasks:           tasks,
+
+		user:     NewUserHandler(stores.User),
+		auth:     NewAuthHandler(stores.Auth, stores.TwoFactor, stores.Identities, stores.Sessions, guard, issuer, audit, oidcProvidersFromEnv()),
+		product:  NewProductHandler(stores.Product, audit),
+		order:    NewOrderHandler(stores.Order, audit, events.NewOrderFeed(), streamPolicyFromEnv(timeouts.orders)),
+		category: NewCategoryHandler(stores.Category, audit),
+		health:   NewHealthHandler(stores.Health, expectedVersion),
+		twoFA:    NewTwoFactorHandler(stores.TwoFactor, stores.User, guard, stringEnv("TOTP_ISSUER", "ecommerce")),
+		apiKeys:  NewAPIKeyHandler(stores.APIKeys),
+		account:  NewAccountHandler(stores.User, stores.Sessions, stores.EmailChanges, guard, notifier, tasks),
+		privacy:  NewPrivacyHandler(stores.PersonalData, stores.Deletions, stores.User, guard, notifier, tasks, audit, durationEnv("ACCOUNT_DELETION_GRACE", 30*24*time.Hour)),
+		audit:    NewAuditHandler(stores.Audit),
+		webhooks: NewWebhookHandler(stores.Webhooks, audit),
+		jobs:     NewJobHandler(stores.Jobs, audit),
+
+		notifications: NewNotificationHandler(stores.Notifications),
+	}
+}
+
+// Shutdown marks the server as draining, waits for the drain period so the
+// readiness probe can take the instance out of rotation, and then gracefully
+// shuts down the http server, waits for the running jobs and closes the
+// database.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.drain()
+	s.stopBackground()
+
+	select {
+	case <-time.After(s.drainPeriod):
+	case <-ctx.Done():
+	}
+
+	if err := s.Server.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	if err := s.tasks.wait(ctx); err != nil {
+		return err
+	}
+
+	if s.queueDone != nil {
+		select {
+		case <-s.queueDone:
+		case <-ctx.Done():
+			return fmt.Errorf("wait for running jobs: %w", ctx.Err())
+		}
+	}
+
+	return s.closeDB()
+}
+
+func (s *Server) Close() error {
+	s.stopBackground()
+
+	if err := s.Server.Close(); err != nil {
+		return err
+	}
+
+	return s.closeDB()
+}
+
+// tasks tracks the work requests leave running, e.g. emails, so Shutdown
+// can wait for it before it closes the database.
+type tasks struct {
+	wg sync.WaitGroup
+}
+
+// run calls f in a goroutine, with a context of its own that ends after
+// timeout.
+func (t *tasks) run(timeout time.Duration, f func(ctx context.Context)) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		f(ctx)
+	}()
+}
+
+// notify sends the email of the given kind to userID as a task, a failure
+// is only logged.
+func (t *tasks) notify(kind string, userID int, send func(ctx context.Context) error) {
+	t.run(30*time.Second, func(ctx context.Context) {
+		if err := send(ctx); err != nil {
+			log.Printf("send %s email to user %d error: %s", kind, userID, err)
+		}
+	})
+}
+
+// wait waits for the running tasks until ctx is done.
+func (t *tasks) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for running tasks: %w", ctx.Err())
+	}
+}
+
+func (s *Server) stopBackground() {
+	if s.stop != nil {
+		s.stop()
+	}
+}
+
+// purgeEvery calls purge every interval until ctx is done. The purged rows
+// are already ignored by the stores, this only keeps the tables small.
+func (s *Server) purgeEvery(ctx context.Context, interval time.Duration, what string, purge func(ctx context.Context) (int64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := purge(ctx)
+			if err != nil {
+				log.Printf("purge %s error: %s", what, err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("purged %d %s", n, what)
+			}
+		}
+	}
+}
+
+func eventPolicyFromEnv() events.Policy {
+	return events.Policy{
+		Poll:       durationEnv("EVENT_POLL_INTERVAL", time.Second),
+		Batch:      intEnv("EVENT_BATCH_SIZE", 20),
+		Lease:      durationEnv("EVENT_LEASE", 5*time.Minute),
+		Timeout:    durationEnv("EVENT_DELIVERY_TIMEOUT", 10*time.Second),
+		MinBackoff: durationEnv("EVENT_RETRY_BACKOFF", 5*time.Second),
+		MaxBackoff: durationEnv("EVENT_RETRY_MAX_BACKOFF", time.Hour),
+	}
+}
+
+func webhookPolicyFromEnv() events.WebhookPolicy {
+	return events.WebhookPolicy{
+		Policy: events.Policy{
+			Poll:       durationEnv("WEBHOOK_POLL_INTERVAL", time.Second),
+			Batch:      intEnv("WEBHOOK_BATCH_SIZE", 20),
+			Lease:      durationEnv("WEBHOOK_LEASE", 5*time.Minute),
+			Timeout:    durationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+			MinBackoff: durationEnv("WEBHOOK_RETRY_BACKOFF", 30*time.Second),
+			MaxBackoff: durationEnv("WEBHOOK_RETRY_MAX_BACKOFF", 6*time.Hour),
+		},
+		MaxAttempts: intEnv("WEBHOOK_MAX_ATTEMPTS", 10),
+	}
+}
+
+// streamPolicyFromEnv reads the limits of the order event streams, whose
+// queries get the timeout of the orders routes.
+func streamPolicyFromEnv(queryTimeout time.Duration) streamPolicy {
+	return streamPolicy{
+		heartbeat: durationEnv("ORDER_EVENTS_HEARTBEAT", 15*time.Second),
+		// below the write timeout of the server
+		maxDuration:  durationEnv("ORDER_EVENTS_MAX_DURATION", 25*time.Second),
+		queryTimeout: queryTimeout,
+	}
+}
+
+func jobPolicyFromEnv() jobs.Policy {
+	return jobs.Policy{
+		Workers:     intEnv("JOB_WORKERS", 4),
+		Poll:        durationEnv("JOB_POLL_INTERVAL", time.Second),
+		Lease:       durationEnv("JOB_LEASE", 5*time.Minute),
+		Timeout:     durationEnv("JOB_TIMEOUT", time.Minute),
+		MinBackoff:  durationEnv("JOB_RETRY_BACKOFF", 10*time.Second),
+		MaxBackoff:  durationEnv("JOB_RETRY_MAX_BACKOFF", time.Hour),
+		MaxAttempts: intEnv("JOB_MAX_ATTEMPTS", 10),
+	}
+}
+
+func (s *Server) closeDB() error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
+
+func durationEnv(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if len(v) == 0 {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %s", key, err)
+	}
+
+	return d
+}
+
+func stringEnv(key, def string) string {
+	if v := os.Getenv(key); len(v) > 0 {
+		return v
+	}
+
+	return def
+}
+
+func intEnv(key string, def int) int {
+	v := os.Getenv(key)
+	if len(v) == 0 {
+		return def
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %s", key, err)
+	}
+
+	return n
+}
+
+// rateLimitEnv reads a limit written as requests/period, e.g. 10/1m. "off"
+// disables the limit.
+func rateLimitEnv(key string, def models.RateLimit) models.RateLimit {
+	v := os.Getenv(key)
+	if len(v) == 0 {
+		return def
+	}
+	if v == "off" {
+		return models.RateLimit{}
+	}
+
+	burst, period, ok := strings.Cut(v, "/")
+	n, err := strconv.Atoi(burst)
+	if !ok || err != nil || n <= 0 {
+		log.Fatalf("invalid %s: want requests/period, e.g. 10/1m", key)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		log.Fatalf("invalid %s: want requests/period, e.g. 10/1m", key)
+	}
+
+	return models.RateLimit{Burst: n, Period: d}
 }
 
 func getID(r *http.Request) (int, error) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		return 0, fmt.Errorf("invalid id: %s", idStr)
+		return 0, fmt.Errorf("%w: %s", errInvalidID, idStr)
 	}
 
 	return id, nil
 }
 
+func decodeJSON(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidBody, err)
+	}
+
+	return nil
+}
+
 func getUserIDCtx(r *http.Request) (int, error) {
 	idStr, ok := r.Context().Value("user_id").(string)
 	if !ok {
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/middleware"
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/totp"
+	"github.com/go-playground/validator/v10"
+)
+
+const recoveryCodeCount = 10
+
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+type TwoFactorHandler struct {
+	store store.TwoFactorStorer
+	users store.UserStorer
+	// guard counts wrong codes like failed logins, a stolen session must
+	// not be able to guess the code that turns two-factor off
+	guard  *loginGuard
+	issuer string
+}
+
+func NewTwoFactorHandler(s store.TwoFactorStorer, users store.UserStorer, guard *loginGuard, issuer string) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		store:  s,
+		users:  users,
+		guard:  guard,
+		issuer: issuer,
+	}
+}
+
+func (h *TwoFactorHandler) handleEnroll(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	user, err := h.users.GetByID(r.Context(), id)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if _, err := h.store.Enroll(r.Context(), id, secret); err != nil {
+		if errors.Is(err, store.ErrTwoFactorAlreadyEnabled) {
+			respond.Error(w, r, http.StatusConflict, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, models.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(h.issuer, user.Email, secret),
+	})
+}
+
+func (h *TwoFactorHandler) handleEnable(w http.ResponseWriter, r *http.Request) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var req models.TwoFactorCodeReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	tf, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrTwoFactorNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if tf.EnabledAt != nil {
+		respond.Error(w, r, http.StatusConflict, store.ErrTwoFactorAlreadyEnabled)
+		return
+	}
+
+	user, err := h.users.GetByID(r.Context(), id)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	ip := middleware.ClientIP(r)
+	if !h.guard.admit(w, r, user.Email, ip) {
+		return
+	}
+
+	step, ok := totp.Validate(tf.Secret, normalizeCode(req.Code), time.Now())
+	if !ok {
+		h.invalidCode(w, r, user.Email, ip)
+		return
+	}
+	if !h.validCode(w, r, user.Email) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.Enable(r.Context(), id, step, hashes); err != nil {
+		if errors.Is(err, store.ErrTwoFactorNotFound) {
+			respond.Error(w, r, http.StatusConflict, store.ErrTwoFactorAlreadyEnabled)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, models.RecoveryCodes{Codes: codes})
+}
+
+func (h *TwoFactorHandler) handleDisable(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.verifyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Delete(r.Context(), id); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, "two-factor authentication successfully disabled")
+}
+
+func (h *TwoFactorHandler) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.verifyRequest(w, r)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.SetRecoveryCodes(r.Context(), id, hashes); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, models.RecoveryCodes{Codes: codes})
+}
+
+// verifyRequest checks the code in the body of a request changing the
+// enrollment of the current user. It responds itself if it returns false.
+func (h *TwoFactorHandler) verifyRequest(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := getUserIDCtx(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	var req models.TwoFactorCodeReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return 0, false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return 0, false
+	}
+
+	user, err := h.users.GetByID(r.Context(), id)
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return 0, false
+	}
+
+	ip := middleware.ClientIP(r)
+	if !h.guard.admit(w, r, user.Email, ip) {
+		return 0, false
+	}
+
+	if err := verifyTwoFactor(r.Context(), h.store, id, req.Code); err != nil {
+		switch {
+		case errors.Is(err, store.ErrTwoFactorNotFound):
+			respond.Error(w, r, http.StatusNotFound, err)
+		case errors.Is(err, store.ErrInvalidTwoFactorCode):
+			h.invalidCode(w, r, user.Email, ip)
+		default:
+			respond.Error(w, r, http.StatusInternalServerError, err)
+		}
+		return 0, false
+	}
+	if !h.validCode(w, r, user.Email) {
+		return 0, false
+	}
+
+	return id, true
+}
+
+// invalidCode records a wrong code as a failed login of the user and
+// responds.
+func (h *TwoFactorHandler) invalidCode(w http.ResponseWriter, r *http.Request, email, ip string) {
+	if err := h.guard.failed(r.Context(), email, ip); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	respond.Error(w, r, http.StatusBadRequest, store.ErrInvalidTwoFactorCode)
+}
+
+// validCode forgets the failures of the user, like a login that passed the
+// second step. It responds itself if it returns false.
+func (h *TwoFactorHandler) validCode(w http.ResponseWriter, r *http.Request, email string) bool {
+	if err := h.guard.succeeded(r.Context(), email); err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+
+	return true
+}
+
+// verifyTwoFactor accepts a code from the authenticator app or one of the
+// recovery codes of the user, each only once.
+func verifyTwoFactor(ctx context.Context, s store.TwoFactorStorer, userID int, code string) error {
+	tf, err := s.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if tf.EnabledAt == nil {
+		return store.ErrTwoFactorNotFound
+	}
+
+	code = normalizeCode(code)
+	if step, ok := totp.Validate(tf.Secret, code, time.Now()); ok {
+		return s.UseStep(ctx, userID, step)
+	}
+
+	return s.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+}
+
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// newRecoveryCodes returns recovery codes to show the user once, and their
+// hashes to store. The codes are random enough that an unsalted hash is
+// as good as a password hash.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := recoveryCodeEncoding.EncodeToString(b)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,7 +1,6 @@
 package server
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
 
@@ -24,63 +23,76 @@ func NewUserHandler(s store.UserStorer) *UserHandler {
 func (h *UserHandler) handleGetUserByID(w http.ResponseWriter, r *http.Request) {
 	id, err := getID(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	user, err := h.store.GetByID(id)
+	user, err := h.store.GetByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, store.ErrUserNotFound) {
-			respond.Error(w, http.StatusNotFound, err)
+			respond.Error(w, r, http.StatusNotFound, err)
 			return
 		}
 
-		respond.Error(w, http.StatusInternalServerError, err)
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, user)
+	render(w, r, http.StatusOK, user)
 }
 
 func (h *UserHandler) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 	id, err := getUserIDCtx(r)
 	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	var req models.UpdateUserReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	if err := validator.New().Struct(req); err != nil {
+	if err := validate.Struct(req); err != nil {
 		errs := err.(validator.ValidationErrors)
-		respond.Error(w, http.StatusBadRequest, respond.ValidationError(errs))
+		respond.ValidationError(w, r, errs)
 		return
 	}
 
-	user, err := h.store.Update(id, req)
+	current, err := h.store.GetByID(r.Context(), id)
 	if err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, user)
-}
-
-func (h *UserHandler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
-	id, err := getUserIDCtx(r)
-	if err != nil {
-		respond.Error(w, http.StatusBadRequest, err)
+	if req.Email == "" {
+		req.Email = current.Email
+	}
+	if req.Email != current.Email {
+		respond.Error(w, r, http.StatusBadRequest, errEmailChangeNeedsConfirmation)
 		return
 	}
 
-	if err = h.store.Delete(id); err != nil {
-		respond.Error(w, http.StatusInternalServerError, err)
+	user, err := h.store.Update(r.Context(), id, req)
+	if err != nil {
+		if errors.Is(err, store.ErrEmailAlreadyExists) {
+			respond.Error(w, r, http.StatusBadRequest, err)
+			return
+		}
+		if errors.Is(err, store.ErrUserNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	respond.JSON(w, http.StatusOK, "user account successfully deleted")
+	render(w, r, http.StatusOK, user)
 }
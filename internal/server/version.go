@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+)
+
+// The unversioned routes were deprecated when /v1 was introduced.
+var (
+	rootDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	rootSunset       = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+type apiVersionKey struct{}
+
+// apiVersion describes how one version of the api shapes its responses.
+// Handlers and stores are shared between versions, a new version only
+// needs its own presenter, e.g. one turning prices into money objects.
+type apiVersion struct {
+	name    string
+	present func(v any) any
+}
+
+// v1 responds with the models returned by the stores as they are.
+var v1 = apiVersion{
+	name:    "v1",
+	present: func(v any) any { return v },
+}
+
+func withAPIVersion(v apiVersion) func(h http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Api-Version", v.name)
+
+			ctx := context.WithValue(r.Context(), apiVersionKey{}, v)
+			h.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// render writes v as shaped by the api version of the request.
+func render(w http.ResponseWriter, r *http.Request, status int, v any) {
+	version, ok := r.Context().Value(apiVersionKey{}).(apiVersion)
+	if !ok {
+		version = v1
+	}
+
+	respond.JSON(w, status, version.present(v))
+}
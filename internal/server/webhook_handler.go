@@ -0,0 +1,272 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/utils/respond"
+	"github.com/escoutdoor/ecommerce/pkg/webhook"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	defaultDeliveryLimit = 100
+	maxDeliveryLimit     = 1000
+)
+
+var errInvalidDeliveryFilter = errors.New("invalid delivery filter")
+
+type WebhookHandler struct {
+	store store.WebhookStorer
+	audit *auditor
+}
+
+func NewWebhookHandler(s store.WebhookStorer, audit *auditor) *WebhookHandler {
+	return &WebhookHandler{
+		store: s,
+		audit: audit,
+	}
+}
+
+// handleCreateWebhook responds with the secret deliveries are signed with.
+// It is not shown again, a lost secret means creating a new webhook.
+func (h *WebhookHandler) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req models.WebhookReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.Create(r.Context(), models.Webhook{
+		URL:        req.URL,
+		Secret:     secret,
+		EventTypes: req.EventTypes,
+		Active:     req.Active == nil || *req.Active,
+	})
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "webhook.create", EntityType: "webhook", EntityID: strconv.Itoa(created.ID)}, nil, created)
+
+	render(w, r, http.StatusCreated, models.CreatedWebhook{Webhook: *created, Secret: created.Secret})
+}
+
+func (h *WebhookHandler) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.store.List(r.Context())
+	if err != nil {
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, webhooks)
+}
+
+func (h *WebhookHandler) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	wh, err := h.store.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, wh)
+}
+
+func (h *WebhookHandler) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	var req models.WebhookReq
+	if err := decodeJSON(r, &req); err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		errs := err.(validator.ValidationErrors)
+		respond.ValidationError(w, r, errs)
+		return
+	}
+
+	before, err := h.store.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := h.store.Update(r.Context(), id, req)
+	if err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "webhook.update", EntityType: "webhook", EntityID: strconv.Itoa(id)}, before, updated)
+
+	render(w, r, http.StatusOK, updated)
+}
+
+func (h *WebhookHandler) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	before, err := h.store.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "webhook.delete", EntityType: "webhook", EntityID: strconv.Itoa(id)}, before, nil)
+
+	render(w, r, http.StatusOK, "webhook successfully deleted")
+}
+
+func (h *WebhookHandler) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	filter, err := deliveryFilter(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	deliveries, err := h.store.Deliveries(r.Context(), id, filter)
+	if err != nil {
+		if errors.Is(err, store.ErrWebhookNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	render(w, r, http.StatusOK, deliveries)
+}
+
+// handleRedeliver queues the delivery to be sent again, also a dead or
+// succeeded one, with all of its attempts left.
+func (h *WebhookHandler) handleRedeliver(w http.ResponseWriter, r *http.Request) {
+	id, err := getID(r)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	deliveryIDStr := chi.URLParam(r, "delivery_id")
+	deliveryID, err := strconv.ParseInt(deliveryIDStr, 10, 64)
+	if err != nil {
+		respond.Error(w, r, http.StatusBadRequest, fmt.Errorf("%w: %s", errInvalidID, deliveryIDStr))
+		return
+	}
+
+	delivery, err := h.store.Redeliver(r.Context(), id, deliveryID)
+	if err != nil {
+		if errors.Is(err, store.ErrWebhookDeliveryNotFound) {
+			respond.Error(w, r, http.StatusNotFound, err)
+			return
+		}
+
+		respond.Error(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.audit.record(r, models.AuditEntry{Action: "webhook.redeliver", EntityType: "webhook_delivery", EntityID: deliveryIDStr}, nil, nil)
+
+	render(w, r, http.StatusAccepted, delivery)
+}
+
+func deliveryFilter(r *http.Request) (models.WebhookDeliveryFilter, error) {
+	q := r.URL.Query()
+	filter := models.WebhookDeliveryFilter{
+		Status: q.Get("status"),
+		Limit:  defaultDeliveryLimit,
+	}
+
+	switch filter.Status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliverySucceeded, models.WebhookDeliveryDead:
+	default:
+		return filter, fmt.Errorf("%w: status must be pending, succeeded or dead", errInvalidDeliveryFilter)
+	}
+
+	if v := q.Get("before_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return filter, fmt.Errorf("%w: before_id must be a positive number", errInvalidDeliveryFilter)
+		}
+		filter.BeforeID = id
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxDeliveryLimit {
+			return filter, fmt.Errorf("%w: limit must be between 1 and %d", errInvalidDeliveryFilter, maxDeliveryLimit)
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
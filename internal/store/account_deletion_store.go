@@ -0,0 +1,274 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAccountDeletionNotFound = errors.New("no account deletion is pending")
+	ErrAccountDeletionPending  = errors.New("account deletion is already scheduled")
+	ErrUserHasOrders           = errors.New("user has orders and can only be anonymized")
+)
+
+const accountDeletionColumns = `
+	ID, USER_ID,
+	CASE
+		WHEN COMPLETED_AT IS NOT NULL THEN 'completed'
+		WHEN CANCELLED_AT IS NOT NULL THEN 'cancelled'
+		ELSE 'pending'
+	END,
+	REQUESTED_BY, REQUESTED_AT, SCHEDULED_FOR, CANCELLED_BY, CANCELLED_AT, COMPLETED_AT`
+
+const accountDeletionPending = `CANCELLED_AT IS NULL AND COMPLETED_AT IS NULL`
+
+const (
+	queryScheduleAccountDeletion = `
+		INSERT INTO ACCOUNT_DELETIONS(USER_ID, REQUESTED_BY, SCHEDULED_FOR) VALUES($1, $2, $3)
+		RETURNING ` + accountDeletionColumns
+	queryPendingAccountDeletion = `
+		SELECT ` + accountDeletionColumns + ` FROM ACCOUNT_DELETIONS
+		WHERE USER_ID = $1 AND ` + accountDeletionPending
+	queryCancelAccountDeletion = `
+		UPDATE ACCOUNT_DELETIONS SET CANCELLED_BY = $1, CANCELLED_AT = NOW()
+		WHERE USER_ID = $2 AND ` + accountDeletionPending + `
+		RETURNING ` + accountDeletionColumns
+	queryListAccountDeletions = `
+		SELECT ` + accountDeletionColumns + ` FROM ACCOUNT_DELETIONS
+		WHERE $1::TEXT = ''
+			OR ($1 = 'pending' AND ` + accountDeletionPending + `)
+			OR ($1 = 'cancelled' AND CANCELLED_AT IS NOT NULL)
+			OR ($1 = 'completed' AND COMPLETED_AT IS NOT NULL)
+		ORDER BY ID DESC
+	`
+	queryDueAccountDeletions = `
+		SELECT ` + accountDeletionColumns + ` FROM ACCOUNT_DELETIONS
+		WHERE ` + accountDeletionPending + ` AND SCHEDULED_FOR <= NOW()
+		ORDER BY SCHEDULED_FOR
+	`
+	// locks the deletion so a cancellation cannot race the anonymization
+	queryLockAccountDeletion = `
+		SELECT USER_ID FROM ACCOUNT_DELETIONS
+		WHERE ID = $1 AND ` + accountDeletionPending + ` AND SCHEDULED_FOR <= NOW()
+		FOR UPDATE
+	`
+	queryCompleteAccountDeletion = `
+		UPDATE ACCOUNT_DELETIONS SET COMPLETED_AT = NOW() WHERE ID = $1
+	`
+	// the placeholder email keeps the unique constraint satisfied and can
+	// never receive mail
+	queryAnonymizeUser = `
+		UPDATE USERS
+		SET
+			EMAIL = 'deleted-' || ID || '@deleted.invalid',
+			FIRST_NAME = 'Deleted',
+			LAST_NAME = '',
+			DATE_OF_BIRTH = NULL,
+			PASSWORD = '',
+			ROLE = 'customer',
+			UPDATED_AT = NOW()
+		WHERE ID = $1
+	`
+	// city and country are kept, they are needed for taxes
+	queryAnonymizeShippingDetails = `
+		UPDATE SHIPPING_DETAILS
+		SET ADDRESS_LINE1 = '', ADDRESS_LINE2 = '', POSTAL_CODE = '', NOTES = '', UPDATED_AT = NOW()
+		WHERE ID IN (
+			SELECT SHIPPING_DETAILS_ID FROM ORDER_ITEMS
+			WHERE ORDER_ID IN (SELECT ID FROM ORDERS WHERE USER_ID = $1)
+		)
+	`
+	queryDeleteUserIdentities = `
+		DELETE FROM USER_IDENTITIES WHERE USER_ID = $1
+	`
+	queryDeleteUserAPIKeys = `
+		DELETE FROM API_KEYS WHERE USER_ID = $1
+	`
+	queryDeleteUserEmailChange = `
+		DELETE FROM EMAIL_CHANGES WHERE USER_ID = $1
+	`
+	// the registration event and the deliveries of it to webhooks carry
+	// the address, the rest of them is kept
+	queryScrubUserRegisteredEvents = `
+		UPDATE OUTBOX_EVENTS SET DATA = DATA - 'email'
+		WHERE TYPE = 'user.registered' AND (DATA->>'user_id')::INTEGER = $1
+	`
+	queryScrubUserRegisteredDeliveries = `
+		UPDATE WEBHOOK_DELIVERIES
+		SET PAYLOAD = JSONB_SET(PAYLOAD::JSONB, '{data}', (PAYLOAD::JSONB->'data') - 'email')::JSON
+		WHERE EVENT_TYPE = 'user.registered' AND (PAYLOAD->'data'->>'user_id')::INTEGER = $1
+	`
+	// mail.send jobs hold the rendered message, the ones to the current or
+	// a pending new address of the user are dropped. It runs before the
+	// user and the email change are cleared.
+	queryDeleteUserMailJobs = `
+		DELETE FROM JOBS
+		WHERE KIND = 'mail.send' AND LOWER(PAYLOAD->>'to') IN (
+			SELECT LOWER(EMAIL) FROM USERS WHERE ID = $1
+			UNION SELECT LOWER(EMAIL) FROM EMAIL_CHANGES WHERE USER_ID = $1
+		)
+	`
+)
+
+var accountDeletionQueries = []string{
+	queryScheduleAccountDeletion,
+	queryPendingAccountDeletion,
+	queryCancelAccountDeletion,
+	queryListAccountDeletions,
+	queryDueAccountDeletions,
+	queryLockAccountDeletion,
+	queryCompleteAccountDeletion,
+	queryAnonymizeUser,
+	queryAnonymizeShippingDetails,
+	queryDeleteUserIdentities,
+	queryDeleteUserAPIKeys,
+	queryDeleteUserEmailChange,
+	queryScrubUserRegisteredEvents,
+	queryScrubUserRegisteredDeliveries,
+	queryDeleteUserMailJobs,
+}
+
+type AccountDeletionStorer interface {
+	// Schedule schedules anonymizing the user at scheduledFor. requestedBy
+	// is the user or the admin acting for them.
+	Schedule(ctx context.Context, userID, requestedBy int, scheduledFor time.Time) (*models.AccountDeletion, error)
+	Pending(ctx context.Context, userID int) (*models.AccountDeletion, error)
+	Cancel(ctx context.Context, userID, cancelledBy int) (*models.AccountDeletion, error)
+	// List returns the deletions with status, or all of them if status is
+	// empty, newest first.
+	List(ctx context.Context, status string) ([]models.AccountDeletion, error)
+	// Due returns the pending deletions whose grace period is over.
+	Due(ctx context.Context) ([]models.AccountDeletion, error)
+	// Complete anonymizes the user of a due deletion. The user and their
+	// orders are kept, everything identifying them is cleared, including
+	// the copies of their address in events and queued emails, and their
+	// logins, sessions and keys are deleted.
+	Complete(ctx context.Context, id int) error
+}
+
+type AccountDeletionStore struct {
+	db *DB
+}
+
+func NewAccountDeletionStore(db *DB) *AccountDeletionStore {
+	return &AccountDeletionStore{
+		db: db,
+	}
+}
+
+func (s *AccountDeletionStore) Schedule(ctx context.Context, userID, requestedBy int, scheduledFor time.Time) (*models.AccountDeletion, error) {
+	deletion, err := queryOne(ctx, s.db, ErrAccountDeletionNotFound, scanIntoAccountDeletion, queryScheduleAccountDeletion, userID, requestedBy, scheduledFor)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505":
+				return nil, ErrAccountDeletionPending
+			case "23503":
+				return nil, ErrUserNotFound
+			}
+		}
+
+		return nil, err
+	}
+
+	return deletion, nil
+}
+
+func (s *AccountDeletionStore) Pending(ctx context.Context, userID int) (*models.AccountDeletion, error) {
+	return queryOne(ctx, s.db, ErrAccountDeletionNotFound, scanIntoAccountDeletion, queryPendingAccountDeletion, userID)
+}
+
+func (s *AccountDeletionStore) Cancel(ctx context.Context, userID, cancelledBy int) (*models.AccountDeletion, error) {
+	return queryOne(ctx, s.db, ErrAccountDeletionNotFound, scanIntoAccountDeletion, queryCancelAccountDeletion, cancelledBy, userID)
+}
+
+func (s *AccountDeletionStore) List(ctx context.Context, status string) ([]models.AccountDeletion, error) {
+	return s.list(ctx, queryListAccountDeletions, status)
+}
+
+func (s *AccountDeletionStore) Due(ctx context.Context) ([]models.AccountDeletion, error) {
+	return s.list(ctx, queryDueAccountDeletions)
+}
+
+func (s *AccountDeletionStore) list(ctx context.Context, query string, args ...any) ([]models.AccountDeletion, error) {
+	deletions, err := queryAll(ctx, s.db, scanIntoAccountDeletion, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.AccountDeletion, 0, len(deletions))
+	for _, d := range deletions {
+		list = append(list, *d)
+	}
+
+	return list, nil
+}
+
+func (s *AccountDeletionStore) Complete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	if err := tx.QueryRowContext(ctx, queryLockAccountDeletion, id).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAccountDeletionNotFound
+		}
+
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, queryDeleteUserMailJobs, userID); err != nil {
+		return err
+	}
+
+	if err := execOne(ctx, tx, ErrUserNotFound, queryAnonymizeUser, userID); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		queryAnonymizeShippingDetails,
+		queryDeleteUserIdentities,
+		queryDeleteUserAPIKeys,
+		queryDeleteUserSessions,
+		queryDeleteTwoFactor,
+		queryDeleteUserEmailChange,
+		queryMuteNotifications,
+		queryScrubUserRegisteredEvents,
+		queryScrubUserRegisteredDeliveries,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, queryCompleteAccountDeletion, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func scanIntoAccountDeletion(row scanner) (*models.AccountDeletion, error) {
+	d := &models.AccountDeletion{}
+	err := row.Scan(
+		&d.ID,
+		&d.UserID,
+		&d.Status,
+		&d.RequestedBy,
+		&d.RequestedAt,
+		&d.ScheduledFor,
+		&d.CancelledBy,
+		&d.CancelledAt,
+		&d.CompletedAt,
+	)
+
+	return d, err
+}
@@ -0,0 +1,114 @@
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/store/pgtest"
+)
+
+func TestAccountDeletionStoreSchedule(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	deletions := store.NewAccountDeletionStore(db)
+	user := registerUser(t, db, "jane@example.com")
+	at := time.Now().Add(30 * 24 * time.Hour)
+
+	if _, err := deletions.Schedule(ctx, user.ID, user.ID, at); err != nil {
+		t.Fatalf("schedule: %s", err)
+	}
+
+	_, err := deletions.Schedule(ctx, user.ID, user.ID, at)
+	if !errors.Is(err, store.ErrAccountDeletionPending) {
+		t.Fatalf("schedule twice: got %v, want %v", err, store.ErrAccountDeletionPending)
+	}
+
+	// only pending deletions are unique, a cancelled one can be scheduled
+	// again
+	if _, err := deletions.Cancel(ctx, user.ID, user.ID); err != nil {
+		t.Fatalf("cancel: %s", err)
+	}
+	if _, err := deletions.Schedule(ctx, user.ID, user.ID, at); err != nil {
+		t.Fatalf("schedule after cancel: %s", err)
+	}
+
+	_, err = deletions.Schedule(ctx, user.ID+100, user.ID, at)
+	if !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("schedule for unknown user: got %v, want %v", err, store.ErrUserNotFound)
+	}
+}
+
+func TestAccountDeletionStoreCompleteScrubsAddress(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	const email = "jane@example.com"
+	user := registerUser(t, db, email)
+
+	// a delivery of the registration event and a queued email both copy
+	// the address
+	webhooks := store.NewWebhookStore(db)
+	if _, err := webhooks.Create(ctx, models.Webhook{
+		URL:        "https://example.com/hook",
+		Secret:     "secret",
+		EventTypes: []string{models.EventUserRegistered},
+		Active:     true,
+	}); err != nil {
+		t.Fatalf("create webhook: %s", err)
+	}
+	events, err := store.NewOutboxStore(db).Claim(ctx, 10, time.Minute)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("claim registration event: %d events, %v", len(events), err)
+	}
+	payload, err := json.Marshal(events[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := webhooks.Enqueue(ctx, events[0], payload); err != nil {
+		t.Fatalf("enqueue delivery: %s", err)
+	}
+	if _, err := store.NewJobStore(db).Enqueue(ctx, models.Job{
+		Kind:        "mail.send",
+		Payload:     json.RawMessage(`{"to":"` + email + `","subject":"Your account will be deleted","text":"Hi"}`),
+		MaxAttempts: 3,
+	}); err != nil {
+		t.Fatalf("enqueue mail: %s", err)
+	}
+
+	deletions := store.NewAccountDeletionStore(db)
+	deletion, err := deletions.Schedule(ctx, user.ID, user.ID, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("schedule: %s", err)
+	}
+	if err := deletions.Complete(ctx, deletion.ID); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+
+	for table, query := range map[string]string{
+		"users":              `SELECT COUNT(*) FROM USERS WHERE EMAIL = $1`,
+		"outbox_events":      `SELECT COUNT(*) FROM OUTBOX_EVENTS WHERE STRPOS(DATA::TEXT, $1) > 0`,
+		"webhook_deliveries": `SELECT COUNT(*) FROM WEBHOOK_DELIVERIES WHERE STRPOS(PAYLOAD::TEXT, $1) > 0`,
+		"jobs":               `SELECT COUNT(*) FROM JOBS WHERE STRPOS(PAYLOAD::TEXT, $1) > 0`,
+	} {
+		var n int
+		if err := db.QueryRowContext(ctx, query, email).Scan(&n); err != nil {
+			t.Fatalf("search %s: %s", table, err)
+		}
+		if n != 0 {
+			t.Errorf("%s still holds the address in %d rows", table, n)
+		}
+	}
+
+	// the event itself is kept, only the address is gone
+	var userID int
+	err = db.QueryRowContext(ctx, `SELECT (DATA->>'user_id')::INTEGER FROM OUTBOX_EVENTS WHERE ID = $1`, events[0].ID).Scan(&userID)
+	if err != nil || userID != user.ID {
+		t.Errorf("registration event: user %d, %v, want user %d", userID, err, user.ID)
+	}
+}
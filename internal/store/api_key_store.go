@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// apiKeyTouchInterval limits how often using a key writes its last use.
+const apiKeyTouchInterval = `1 minute`
+
+const apiKeyColumns = `ID, USER_ID, NAME, PREFIX, HASH, SCOPES, CREATED_AT, LAST_USED_AT`
+
+const (
+	queryCreateAPIKey = `
+		INSERT INTO API_KEYS(USER_ID, NAME, PREFIX, HASH, SCOPES) VALUES($1, $2, $3, $4, $5)
+		RETURNING ` + apiKeyColumns
+	queryAPIKeysByUserID = `
+		SELECT ` + apiKeyColumns + ` FROM API_KEYS WHERE USER_ID = $1 ORDER BY ID
+	`
+	queryAPIKeyByPrefix = `
+		SELECT ` + apiKeyColumns + ` FROM API_KEYS WHERE PREFIX = $1
+	`
+	queryTouchAPIKey = `
+		UPDATE API_KEYS SET LAST_USED_AT = NOW()
+		WHERE ID = $1 AND (LAST_USED_AT IS NULL OR LAST_USED_AT < NOW() - INTERVAL '` + apiKeyTouchInterval + `')
+	`
+	queryDeleteAPIKey = `
+		DELETE FROM API_KEYS WHERE ID = $1 AND USER_ID = $2
+	`
+)
+
+var apiKeyQueries = []string{
+	queryCreateAPIKey,
+	queryAPIKeysByUserID,
+	queryAPIKeyByPrefix,
+	queryTouchAPIKey,
+	queryDeleteAPIKey,
+}
+
+type APIKeyStorer interface {
+	Create(ctx context.Context, key models.APIKey) (*models.APIKey, error)
+	List(ctx context.Context, userID int) ([]models.APIKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	// Touch records that the key was used. It only writes once a minute
+	// per key.
+	Touch(ctx context.Context, id int) error
+	Delete(ctx context.Context, userID, id int) error
+}
+
+type APIKeyStore struct {
+	db *DB
+}
+
+func NewAPIKeyStore(db *DB) *APIKeyStore {
+	return &APIKeyStore{
+		db: db,
+	}
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key models.APIKey) (*models.APIKey, error) {
+	created, err := queryOne(
+		ctx,
+		s.db,
+		ErrAPIKeyNotFound,
+		scanIntoAPIKey,
+		queryCreateAPIKey,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		pq.Array(key.Scopes),
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (s *APIKeyStore) List(ctx context.Context, userID int) ([]models.APIKey, error) {
+	keys, err := queryAll(ctx, s.db, scanIntoAPIKey, queryAPIKeysByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.APIKey, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, *k)
+	}
+
+	return list, nil
+}
+
+func (s *APIKeyStore) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	return queryOne(ctx, s.db, ErrAPIKeyNotFound, scanIntoAPIKey, queryAPIKeyByPrefix, prefix)
+}
+
+func (s *APIKeyStore) Touch(ctx context.Context, id int) error {
+	_, err := s.db.ExecContext(ctx, queryTouchAPIKey, id)
+	return err
+}
+
+func (s *APIKeyStore) Delete(ctx context.Context, userID, id int) error {
+	return execOne(ctx, s.db, ErrAPIKeyNotFound, queryDeleteAPIKey, id, userID)
+}
+
+func scanIntoAPIKey(row scanner) (*models.APIKey, error) {
+	k := &models.APIKey{}
+	err := row.Scan(
+		&k.ID,
+		&k.UserID,
+		&k.Name,
+		&k.Prefix,
+		&k.Hash,
+		pq.Array(&k.Scopes),
+		&k.CreatedAt,
+		&k.LastUsedAt,
+	)
+
+	return k, err
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/escoutdoor/ecommerce/internal/audit"
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+const auditColumns = `ID, ACTOR_ID, ACTION, ENTITY_TYPE, ENTITY_ID, BEFORE, AFTER, IP, REQUEST_ID, CREATED_AT, PREV_HASH, HASH`
+
+const (
+	// appends are serialized so every entry chains to the one before it
+	queryLockAuditLog = `
+		SELECT PG_ADVISORY_XACT_LOCK(HASHTEXT('audit_log'))
+	`
+	queryLastAuditHash = `
+		SELECT HASH FROM AUDIT_LOG ORDER BY ID DESC LIMIT 1
+	`
+	queryAppendAuditEntry = `
+		INSERT INTO AUDIT_LOG(ACTOR_ID, ACTION, ENTITY_TYPE, ENTITY_ID, BEFORE, AFTER, IP, REQUEST_ID, CREATED_AT, PREV_HASH, HASH)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING ID
+	`
+	queryListAuditEntries = `
+		SELECT ` + auditColumns + ` FROM AUDIT_LOG
+		WHERE ($1::INTEGER IS NULL OR ACTOR_ID = $1)
+			AND ($2::TEXT = '' OR ACTION = $2)
+			AND ($3::TEXT = '' OR ENTITY_TYPE = $3)
+			AND ($4::TEXT = '' OR ENTITY_ID = $4)
+			AND ($5::TIMESTAMPTZ IS NULL OR CREATED_AT >= $5)
+			AND ($6::TIMESTAMPTZ IS NULL OR CREATED_AT < $6)
+			AND ($7::BIGINT = 0 OR ID < $7)
+		ORDER BY ID DESC
+		LIMIT $8
+	`
+	queryAuditChain = `
+		SELECT ` + auditColumns + ` FROM AUDIT_LOG WHERE ID > $1 ORDER BY ID LIMIT $2
+	`
+)
+
+var auditQueries = []string{
+	queryLockAuditLog,
+	queryLastAuditHash,
+	queryAppendAuditEntry,
+	queryListAuditEntries,
+	queryAuditChain,
+}
+
+type AuditStorer interface {
+	// Append chains entry to the last entry and stores it.
+	Append(ctx context.Context, entry models.AuditEntry) (*models.AuditEntry, error)
+	// List returns the entries matching filter, newest first.
+	List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error)
+	// Chain returns up to limit entries after the entry afterID, in the
+	// order they were appended.
+	Chain(ctx context.Context, afterID int64, limit int) ([]models.AuditEntry, error)
+}
+
+type AuditStore struct {
+	db *DB
+}
+
+func NewAuditStore(db *DB) *AuditStore {
+	return &AuditStore{
+		db: db,
+	}
+}
+
+func (s *AuditStore) Append(ctx context.Context, entry models.AuditEntry) (*models.AuditEntry, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, queryLockAuditLog); err != nil {
+		return nil, err
+	}
+
+	prev := audit.Genesis
+	if err := tx.QueryRowContext(ctx, queryLastAuditHash).Scan(&prev); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	entry = audit.Chain(entry, prev)
+	err = tx.QueryRowContext(
+		ctx,
+		queryAppendAuditEntry,
+		entry.ActorID,
+		entry.Action,
+		entry.EntityType,
+		entry.EntityID,
+		jsonParam(entry.Before),
+		jsonParam(entry.After),
+		entry.IP,
+		entry.RequestID,
+		entry.CreatedAt,
+		entry.PrevHash,
+		entry.Hash,
+	).Scan(&entry.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (s *AuditStore) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	return s.list(
+		ctx,
+		queryListAuditEntries,
+		filter.ActorID,
+		filter.Action,
+		filter.EntityType,
+		filter.EntityID,
+		filter.Since,
+		filter.Until,
+		filter.BeforeID,
+		filter.Limit,
+	)
+}
+
+func (s *AuditStore) Chain(ctx context.Context, afterID int64, limit int) ([]models.AuditEntry, error) {
+	return s.list(ctx, queryAuditChain, afterID, limit)
+}
+
+func (s *AuditStore) list(ctx context.Context, query string, args ...any) ([]models.AuditEntry, error) {
+	entries, err := queryAll(ctx, s.db, scanIntoAuditEntry, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, *e)
+	}
+
+	return list, nil
+}
+
+// jsonParam passes m as text, lib/pq would send a byte slice as bytea.
+func jsonParam(m json.RawMessage) any {
+	if len(m) == 0 {
+		return nil
+	}
+
+	return string(m)
+}
+
+func scanIntoAuditEntry(row scanner) (*models.AuditEntry, error) {
+	var (
+		e             = &models.AuditEntry{}
+		before, after []byte
+	)
+	err := row.Scan(
+		&e.ID,
+		&e.ActorID,
+		&e.Action,
+		&e.EntityType,
+		&e.EntityID,
+		&before,
+		&after,
+		&e.IP,
+		&e.RequestID,
+		&e.CreatedAt,
+		&e.PrevHash,
+		&e.Hash,
+	)
+	e.Before = before
+	e.After = after
+
+	return e, err
+}
@@ -1,12 +1,14 @@
 package store
 
 import (
-	"database/sql"
+	"context"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/escoutdoor/ecommerce/internal/models"
 	"github.com/escoutdoor/ecommerce/pkg/password"
+	"github.com/lib/pq"
 )
 
 var (
@@ -14,25 +16,41 @@ var (
 	ErrEmailAlreadyExists     = errors.New("user with this email address already exist")
 )
 
+const (
+	queryRegisterUser = `
+		INSERT INTO USERS(EMAIL, FIRST_NAME, LAST_NAME, DATE_OF_BIRTH, PASSWORD)
+		VALUES($1, $2, $3, $4, $5)
+		RETURNING ` + userColumns
+	// only replaces the hash that was verified, not one set meanwhile
+	queryRehashPassword = `
+		UPDATE USERS SET PASSWORD = $1 WHERE ID = $2 AND PASSWORD = $3
+	`
+)
+
+var authQueries = []string{
+	queryRegisterUser,
+	queryRehashPassword,
+}
+
 type AuthStorer interface {
-	Login(data models.LoginReq) (*models.User, error)
-	Register(data models.RegisterReq) (*models.User, error)
+	Login(ctx context.Context, data models.LoginReq) (*models.User, error)
+	Register(ctx context.Context, data models.RegisterReq) (*models.User, error)
 }
 
 type AuthStore struct {
-	db        *sql.DB
+	db        *DB
 	userStore UserStore
 }
 
-func NewAuthStore(db *sql.DB) *AuthStore {
+func NewAuthStore(db *DB) *AuthStore {
 	return &AuthStore{
 		db:        db,
 		userStore: UserStore{db: db},
 	}
 }
 
-func (s *AuthStore) Login(data models.LoginReq) (*models.User, error) {
-	user, err := s.userStore.GetByEmail(data.Email)
+func (s *AuthStore) Login(ctx context.Context, data models.LoginReq) (*models.User, error) {
+	user, err := s.userStore.GetByEmail(ctx, data.Email)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
 			return nil, ErrInvalidEmailOrPassword
@@ -41,15 +59,40 @@ func (s *AuthStore) Login(data models.LoginReq) (*models.User, error) {
 		return nil, err
 	}
 
-	if !password.ComparePasswords(user.Password, data.Password) {
+	ok, rehash := password.Verify(user.Password, data.Password)
+	if !ok {
 		return nil, ErrInvalidEmailOrPassword
 	}
 
+	// the password is only known here, so outdated hashes are upgraded
+	// on login. The old hash keeps working if this fails.
+	if rehash {
+		if hashed, err := password.HashPassword(data.Password); err != nil {
+			log.Printf("rehash password of user %d error: %s", user.ID, err)
+		} else if _, err := s.db.ExecContext(ctx, queryRehashPassword, hashed, user.ID, user.Password); err != nil {
+			log.Printf("rehash password of user %d error: %s", user.ID, err)
+		} else {
+			user.Password = hashed
+		}
+	}
+
 	return user, nil
 }
 
-func (s *AuthStore) Register(data models.RegisterReq) (*models.User, error) {
-	u, err := s.userStore.GetByEmail(data.Email)
+func (s *AuthStore) Register(ctx context.Context, data models.RegisterReq) (*models.User, error) {
+	return s.register(ctx, data, "")
+}
+
+// RegisterAdmin registers a user with the admin role. The role is set in
+// the same transaction, so a failure never leaves a customer account
+// behind with the admin's email.
+func (s *AuthStore) RegisterAdmin(ctx context.Context, data models.RegisterReq) (*models.User, error) {
+	return s.register(ctx, data, "admin")
+}
+
+// register registers a user with role, or the default role if it is empty.
+func (s *AuthStore) register(ctx context.Context, data models.RegisterReq, role string) (*models.User, error) {
+	u, err := s.userStore.GetByEmail(ctx, data.Email)
 	if err != nil {
 		if !errors.Is(err, ErrUserNotFound) {
 			return nil, err
@@ -64,14 +107,6 @@ func (s *AuthStore) Register(data models.RegisterReq) (*models.User, error) {
 		return nil, err
 	}
 
-	stmt, err := s.db.Prepare(`
-		INSERT INTO USERS(EMAIL, FIRST_NAME, LAST_NAME, DATE_OF_BIRTH, PASSWORD) 
-		VALUES($1, $2, $3, $4, $5) RETURNING * 
-	`)
-	if err != nil {
-		return nil, err
-	}
-
 	var birthdate *time.Time
 	if data.DateOfBirth != "" {
 		pb, err := time.Parse("2006-01-02", data.DateOfBirth)
@@ -82,14 +117,64 @@ func (s *AuthStore) Register(data models.RegisterReq) (*models.User, error) {
 		birthdate = &pb
 	}
 
-	rows, err := stmt.Query(data.Email, data.FirstName, data.LastName, birthdate, hashedPass)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	user, err := queryOne(
+		ctx,
+		tx,
+		ErrUserNotFound,
+		scanIntoUser,
+		queryRegisterUser,
+		data.Email,
+		data.FirstName,
+		data.LastName,
+		birthdate,
+		hashedPass,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrEmailAlreadyExists
+		}
 
-	if rows.Next() {
-		return scanIntoUser(rows)
+		return nil, err
 	}
 
-	return nil, err
+	if role != "" {
+		if err := execOne(ctx, tx, ErrUserNotFound, querySetUserRole, role, user.ID); err != nil {
+			return nil, err
+		}
+		user.Role = role
+	}
+
+	err = insertEvent(ctx, tx, models.EventUserRegistered, models.UserRegistered{
+		UserID: user.ID,
+		Email:  user.Email,
+		Method: "password",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// saved with the user, so the welcome email is already written in it
+	if data.Locale != "" {
+		_, err := setNotificationPreferences(ctx, tx, user.ID, models.NotificationPreferencesReq{
+			Locale:      data.Locale,
+			OrderPlaced: true,
+			OrderStatus: true,
+			Refunds:     true,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return user, nil
 }
@@ -1,9 +1,8 @@
 package store
 
 import (
-	"database/sql"
+	"context"
 	"errors"
-	"fmt"
 
 	"github.com/escoutdoor/ecommerce/internal/models"
 )
@@ -12,110 +11,62 @@ var (
 	ErrCategoryNotFound = errors.New("category not found")
 )
 
+const categoryColumns = `ID, NAME, CREATED_AT, UPDATED_AT`
+
+const (
+	queryCreateCategory = "INSERT INTO CATEGORIES(NAME) VALUES($1) RETURNING " + categoryColumns
+	queryCategoryByID   = "SELECT " + categoryColumns + " FROM CATEGORIES WHERE ID = $1"
+	queryDeleteCategory = "DELETE FROM CATEGORIES WHERE ID = $1"
+	queryUpdateCategory = `
+		UPDATE CATEGORIES SET
+		NAME = $1
+		WHERE ID = $2
+		RETURNING ` + categoryColumns
+)
+
+var categoryQueries = []string{
+	queryCreateCategory,
+	queryCategoryByID,
+	queryDeleteCategory,
+	queryUpdateCategory,
+}
+
 type CategoryStorer interface {
-	GetByID(id int) (*models.Category, error)
-	Create(data models.CategoryReq) (*models.Category, error)
-	Delete(id int) error
-	Update(id int, data models.CategoryReq) (*models.Category, error)
+	GetByID(ctx context.Context, id int) (*models.Category, error)
+	Create(ctx context.Context, data models.CategoryReq) (*models.Category, error)
+	Delete(ctx context.Context, id int) error
+	Update(ctx context.Context, id int, data models.CategoryReq) (*models.Category, error)
 }
 
 type CategoryStore struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewCategoryStore(db *sql.DB) *CategoryStore {
+func NewCategoryStore(db *DB) *CategoryStore {
 	return &CategoryStore{
 		db: db,
 	}
 }
 
-func (s *CategoryStore) Create(data models.CategoryReq) (*models.Category, error) {
-	var category models.Category
-
-	stmt, err := s.db.Prepare("INSERT INTO CATEGORIES(NAME) VALUES($1) RETURNING *")
-	if err != nil {
-		return nil, err
-	}
-
-	err = stmt.QueryRow(data.Name).Scan(
-		&category.ID,
-		&category.Name,
-		&category.CreatedAt,
-		&category.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &category, err
+func (s *CategoryStore) Create(ctx context.Context, data models.CategoryReq) (*models.Category, error) {
+	return queryOne(ctx, s.db, ErrCategoryNotFound, scanIntoCategory, queryCreateCategory, data.Name)
 }
 
-func (s *CategoryStore) GetByID(id int) (*models.Category, error) {
-	stmt, err := s.db.Prepare("SELECT * FROM CATEGORIES WHERE ID = $1")
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := stmt.Query(id)
-	if err != nil {
-		return nil, err
-	}
-
-	if rows.Next() {
-		return scanIntoCategory(rows)
-	}
-
-	return nil, ErrCategoryNotFound
+func (s *CategoryStore) GetByID(ctx context.Context, id int) (*models.Category, error) {
+	return queryOne(ctx, s.db, ErrCategoryNotFound, scanIntoCategory, queryCategoryByID, id)
 }
 
-func (s *CategoryStore) Delete(id int) error {
-	stmt, err := s.db.Prepare("DELETE FROM CATEGORIES WHERE ID = $1")
-	if err != nil {
-		return err
-	}
-
-	res, err := stmt.Exec(id)
-	if err != nil {
-		return err
-	}
-
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("category cannot be deleted because it doesn't exist")
-	}
-
-	return err
+func (s *CategoryStore) Delete(ctx context.Context, id int) error {
+	return execOne(ctx, s.db, ErrCategoryNotFound, queryDeleteCategory, id)
 }
 
-func (s *CategoryStore) Update(id int, data models.CategoryReq) (*models.Category, error) {
-	stmt, err := s.db.Prepare(`
-		UPDATE CATEGORIES SET
-		NAME = $1
-		WHERE ID = $2
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := stmt.Query(data.Name, id)
-	if err != nil {
-		return nil, err
-	}
-
-	if rows.Next() {
-		return scanIntoCategory(rows)
-	}
-
-	return nil, err
+func (s *CategoryStore) Update(ctx context.Context, id int, data models.CategoryReq) (*models.Category, error) {
+	return queryOne(ctx, s.db, ErrCategoryNotFound, scanIntoCategory, queryUpdateCategory, data.Name, id)
 }
 
-func scanIntoCategory(rows *sql.Rows) (*models.Category, error) {
+func scanIntoCategory(row scanner) (*models.Category, error) {
 	var category models.Category
-	err := rows.Scan(
+	err := row.Scan(
 		&category.ID,
 		&category.Name,
 		&category.CreatedAt,
@@ -1,14 +1,71 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	_ "github.com/lib/pq"
 )
 
-func ConnectToDB() (*sql.DB, error) {
+// ConnectToDB opens the pool and prepares every store statement, so the
+// schema must already be migrated.
+func ConnectToDB() (*DB, error) {
+	conn, err := Open()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db := NewDB(conn)
+	if err := db.Prepare(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Open opens and pings the connection pool configured from the environment.
+func Open() (*sql.DB, error) {
+	conn, err := sql.Open("postgres", dsnFromEnv())
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxOpen, err := intEnv("DB_MAX_OPEN_CONNS", 25)
+	if err != nil {
+		return nil, err
+	}
+
+	maxIdle, err := intEnv("DB_MAX_IDLE_CONNS", maxOpen)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetMaxOpenConns(maxOpen)
+	conn.SetMaxIdleConns(maxIdle)
+	conn.SetConnMaxLifetime(30 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err = conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// dsnFromEnv returns the connection string configured from the environment.
+func dsnFromEnv() string {
 	var (
 		host     = os.Getenv("HOST")
 		port     = os.Getenv("DB_PORT")
@@ -17,20 +74,22 @@ func ConnectToDB() (*sql.DB, error) {
 		dbname   = os.Getenv("DB_NAME")
 	)
 
-	dsn := fmt.Sprintf(
+	return fmt.Sprintf(
 		"host=%s port=%s user=%s "+"password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname,
 	)
+}
 
-	db, err := sql.Open("postgres", dsn)
-
-	if err != nil {
-		return nil, err
+func intEnv(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if len(v) == 0 {
+		return def, nil
 	}
 
-	if err = db.Ping(); err != nil {
-		return nil, err
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
 	}
 
-	return db, nil
+	return n, nil
 }
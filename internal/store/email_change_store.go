@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+var ErrEmailChangeNotFound = errors.New("email change not found or expired")
+
+const (
+	// a user has at most one pending change, requesting another replaces it
+	querySaveEmailChange = `
+		INSERT INTO EMAIL_CHANGES(USER_ID, EMAIL, TOKEN_HASH, EXPIRES_AT) VALUES($1, $2, $3, $4)
+		ON CONFLICT (USER_ID) DO UPDATE SET
+			EMAIL = EXCLUDED.EMAIL,
+			TOKEN_HASH = EXCLUDED.TOKEN_HASH,
+			CREATED_AT = NOW(),
+			EXPIRES_AT = EXCLUDED.EXPIRES_AT
+	`
+	queryTakeEmailChange = `
+		DELETE FROM EMAIL_CHANGES WHERE USER_ID = $1 AND TOKEN_HASH = $2 AND EXPIRES_AT > NOW()
+		RETURNING USER_ID, EMAIL, TOKEN_HASH, CREATED_AT, EXPIRES_AT
+	`
+	queryDeleteExpiredEmailChanges = `
+		DELETE FROM EMAIL_CHANGES WHERE EXPIRES_AT <= NOW()
+	`
+)
+
+var emailChangeQueries = []string{
+	querySaveEmailChange,
+	queryTakeEmailChange,
+	queryDeleteExpiredEmailChanges,
+}
+
+type EmailChangeStorer interface {
+	Save(ctx context.Context, change models.EmailChange) error
+	// Take returns and deletes the pending change of the user if tokenHash
+	// matches and it has not expired.
+	Take(ctx context.Context, userID int, tokenHash string) (*models.EmailChange, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type EmailChangeStore struct {
+	db *DB
+}
+
+func NewEmailChangeStore(db *DB) *EmailChangeStore {
+	return &EmailChangeStore{
+		db: db,
+	}
+}
+
+func (s *EmailChangeStore) Save(ctx context.Context, change models.EmailChange) error {
+	_, err := s.db.ExecContext(ctx, querySaveEmailChange, change.UserID, change.Email, change.TokenHash, change.ExpiresAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrUserNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *EmailChangeStore) Take(ctx context.Context, userID int, tokenHash string) (*models.EmailChange, error) {
+	return queryOne(ctx, s.db, ErrEmailChangeNotFound, scanIntoEmailChange, queryTakeEmailChange, userID, tokenHash)
+}
+
+func (s *EmailChangeStore) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, queryDeleteExpiredEmailChanges)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func scanIntoEmailChange(row scanner) (*models.EmailChange, error) {
+	c := &models.EmailChange{}
+	err := row.Scan(
+		&c.UserID,
+		&c.Email,
+		&c.TokenHash,
+		&c.CreatedAt,
+		&c.ExpiresAt,
+	)
+
+	return c, err
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	queryMigrationVersion = `
+		SELECT COALESCE(MAX(VERSION), 0) FROM SCHEMA_MIGRATIONS
+	`
+)
+
+var healthQueries = []string{
+	queryMigrationVersion,
+}
+
+type HealthStorer interface {
+	Ping(ctx context.Context) error
+	MigrationVersion(ctx context.Context) (int64, error)
+	Stats() sql.DBStats
+}
+
+type HealthStore struct {
+	db *DB
+}
+
+func NewHealthStore(db *DB) *HealthStore {
+	return &HealthStore{
+		db: db,
+	}
+}
+
+func (s *HealthStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *HealthStore) MigrationVersion(ctx context.Context) (int64, error) {
+	var version int64
+	if err := s.db.QueryRowContext(ctx, queryMigrationVersion).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func (s *HealthStore) Stats() sql.DBStats {
+	return s.db.Stats()
+}
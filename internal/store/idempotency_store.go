@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+var (
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+)
+
+const idempotencyKeyColumns = `SCOPE, KEY, METHOD, PATH, FINGERPRINT, STATUS, CONTENT_TYPE, BODY, CREATED_AT, EXPIRES_AT, LOCKED_UNTIL`
+
+const (
+	// an expired key, or one whose request lost its lease without
+	// completing, is taken over by the new request. A live one is left
+	// untouched and returns no row.
+	queryReserveIdempotencyKey = `
+		INSERT INTO IDEMPOTENCY_KEYS(SCOPE, KEY, METHOD, PATH, FINGERPRINT, EXPIRES_AT, LOCKED_UNTIL)
+		VALUES($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (SCOPE, KEY) DO UPDATE SET
+			METHOD = EXCLUDED.METHOD,
+			PATH = EXCLUDED.PATH,
+			FINGERPRINT = EXCLUDED.FINGERPRINT,
+			STATUS = NULL,
+			CONTENT_TYPE = '',
+			BODY = NULL,
+			CREATED_AT = NOW(),
+			EXPIRES_AT = EXCLUDED.EXPIRES_AT,
+			LOCKED_UNTIL = EXCLUDED.LOCKED_UNTIL
+		WHERE IDEMPOTENCY_KEYS.EXPIRES_AT < NOW()
+			OR (IDEMPOTENCY_KEYS.STATUS IS NULL AND IDEMPOTENCY_KEYS.LOCKED_UNTIL < NOW())
+		RETURNING ` + idempotencyKeyColumns
+	queryIdempotencyKey = `
+		SELECT ` + idempotencyKeyColumns + ` FROM IDEMPOTENCY_KEYS WHERE SCOPE = $1 AND KEY = $2
+	`
+	queryCompleteIdempotencyKey = `
+		UPDATE IDEMPOTENCY_KEYS SET STATUS = $1, CONTENT_TYPE = $2, BODY = $3
+		WHERE SCOPE = $4 AND KEY = $5 AND LOCKED_UNTIL = $6 AND STATUS IS NULL
+	`
+	queryReleaseIdempotencyKey = `
+		DELETE FROM IDEMPOTENCY_KEYS WHERE SCOPE = $1 AND KEY = $2 AND LOCKED_UNTIL = $3 AND STATUS IS NULL
+	`
+	queryDeleteExpiredIdempotencyKeys = `
+		DELETE FROM IDEMPOTENCY_KEYS WHERE EXPIRES_AT < NOW()
+	`
+)
+
+var idempotencyQueries = []string{
+	queryReserveIdempotencyKey,
+	queryIdempotencyKey,
+	queryCompleteIdempotencyKey,
+	queryReleaseIdempotencyKey,
+	queryDeleteExpiredIdempotencyKeys,
+}
+
+type IdempotencyStorer interface {
+	// Reserve stores key for a new request, or takes over a key whose
+	// request lost its lease. If the key is already in use it returns the
+	// existing record and false.
+	Reserve(ctx context.Context, key models.IdempotencyKey) (*models.IdempotencyKey, bool, error)
+	// Complete stores the response of the request holding the reservation
+	// that is locked until lockedUntil. It fails with
+	// ErrIdempotencyKeyNotFound if the request lost the key.
+	Complete(ctx context.Context, scope, key string, lockedUntil time.Time, status int, contentType string, body []byte) error
+	// Release forgets a key whose request failed, so it can be retried. A
+	// key the request no longer holds is left alone.
+	Release(ctx context.Context, scope, key string, lockedUntil time.Time) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type IdempotencyStore struct {
+	db *DB
+}
+
+func NewIdempotencyStore(db *DB) *IdempotencyStore {
+	return &IdempotencyStore{
+		db: db,
+	}
+}
+
+func (s *IdempotencyStore) Reserve(ctx context.Context, key models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	existing, reserved, err := s.reserve(ctx, key)
+	// the key was released or purged between the insert and the select, it
+	// is free again
+	if errors.Is(err, ErrIdempotencyKeyNotFound) {
+		return s.reserve(ctx, key)
+	}
+
+	return existing, reserved, err
+}
+
+func (s *IdempotencyStore) reserve(ctx context.Context, key models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	reserved, err := queryOne(
+		ctx,
+		s.db,
+		ErrIdempotencyKeyNotFound,
+		scanIntoIdempotencyKey,
+		queryReserveIdempotencyKey,
+		key.Scope,
+		key.Key,
+		key.Method,
+		key.Path,
+		key.Fingerprint,
+		key.ExpiresAt,
+		key.LockedUntil,
+	)
+	if err == nil {
+		return reserved, true, nil
+	}
+	if !errors.Is(err, ErrIdempotencyKeyNotFound) {
+		return nil, false, err
+	}
+
+	existing, err := queryOne(ctx, s.db, ErrIdempotencyKeyNotFound, scanIntoIdempotencyKey, queryIdempotencyKey, key.Scope, key.Key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return existing, false, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, scope, key string, lockedUntil time.Time, status int, contentType string, body []byte) error {
+	return execOne(ctx, s.db, ErrIdempotencyKeyNotFound, queryCompleteIdempotencyKey, status, contentType, body, scope, key, lockedUntil)
+}
+
+func (s *IdempotencyStore) Release(ctx context.Context, scope, key string, lockedUntil time.Time) error {
+	_, err := s.db.ExecContext(ctx, queryReleaseIdempotencyKey, scope, key, lockedUntil)
+	return err
+}
+
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, queryDeleteExpiredIdempotencyKeys)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func scanIntoIdempotencyKey(row scanner) (*models.IdempotencyKey, error) {
+	k := &models.IdempotencyKey{}
+	err := row.Scan(
+		&k.Scope,
+		&k.Key,
+		&k.Method,
+		&k.Path,
+		&k.Fingerprint,
+		&k.Status,
+		&k.ContentType,
+		&k.Body,
+		&k.CreatedAt,
+		&k.ExpiresAt,
+		&k.LockedUntil,
+	)
+
+	return k, err
+}
@@ -0,0 +1,72 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/store/pgtest"
+)
+
+func TestIdempotencyStoreLease(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	keys := store.NewIdempotencyStore(db)
+	key := models.IdempotencyKey{
+		Scope:       "user:1",
+		Key:         "order-1",
+		Method:      "POST",
+		Path:        "/v1/orders",
+		Fingerprint: "a",
+		ExpiresAt:   time.Now().Add(time.Hour),
+		LockedUntil: time.Now().Add(-time.Second),
+	}
+
+	crashed, reserved, err := keys.Reserve(ctx, key)
+	if err != nil || !reserved {
+		t.Fatalf("reserve: got %v, %v", reserved, err)
+	}
+
+	// the lease of the first request is over, a retry takes the key over
+	key.LockedUntil = time.Now().Add(time.Minute)
+	retry, reserved, err := keys.Reserve(ctx, key)
+	if err != nil || !reserved {
+		t.Fatalf("reserve after the lease: got %v, %v", reserved, err)
+	}
+
+	// while the retry holds it the key is in use
+	existing, reserved, err := keys.Reserve(ctx, key)
+	if err != nil || reserved {
+		t.Fatalf("reserve within the lease: got %v, %v", reserved, err)
+	}
+	if existing.Status != nil {
+		t.Errorf("got status %d for a key in progress", *existing.Status)
+	}
+
+	// the first request finishing late must not touch the key of the retry
+	err = keys.Complete(ctx, key.Scope, key.Key, crashed.LockedUntil, 201, "application/json", []byte(`{}`))
+	if !errors.Is(err, store.ErrIdempotencyKeyNotFound) {
+		t.Fatalf("complete with a lost lease: got %v, want %v", err, store.ErrIdempotencyKeyNotFound)
+	}
+	if err := keys.Release(ctx, key.Scope, key.Key, crashed.LockedUntil); err != nil {
+		t.Fatalf("release with a lost lease: %s", err)
+	}
+
+	if err := keys.Complete(ctx, key.Scope, key.Key, retry.LockedUntil, 201, "application/json", []byte(`{"id":1}`)); err != nil {
+		t.Fatalf("complete: %s", err)
+	}
+
+	// a completed key is replayed even once the lease is over
+	key.LockedUntil = time.Now().Add(-time.Second)
+	existing, reserved, err = keys.Reserve(ctx, key)
+	if err != nil || reserved {
+		t.Fatalf("reserve a completed key: got %v, %v", reserved, err)
+	}
+	if existing.Status == nil || *existing.Status != 201 || string(existing.Body) != `{"id":1}` {
+		t.Errorf("got %+v, want the stored response", existing)
+	}
+}
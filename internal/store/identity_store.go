@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrIdentityAlreadyLinked = errors.New("identity is already linked to a user")
+	ErrOIDCStateNotFound     = errors.New("login state not found or expired")
+)
+
+const (
+	// looking the user up also records the login
+	queryUserByIdentity = `
+		WITH I AS (
+			UPDATE USER_IDENTITIES SET LAST_LOGIN_AT = NOW()
+			WHERE PROVIDER = $1 AND SUBJECT = $2
+			RETURNING USER_ID
+		)
+		SELECT ` + userColumns + ` FROM USERS WHERE ID = (SELECT USER_ID FROM I)
+	`
+	queryCreateIdentity = `
+		INSERT INTO USER_IDENTITIES(USER_ID, PROVIDER, SUBJECT, EMAIL) VALUES($1, $2, $3, $4)
+	`
+	querySaveOIDCState = `
+		INSERT INTO OIDC_LOGIN_STATES(STATE, PROVIDER, NONCE, CODE_VERIFIER, EXPIRES_AT)
+		VALUES($1, $2, $3, $4, $5)
+	`
+	queryTakeOIDCState = `
+		DELETE FROM OIDC_LOGIN_STATES WHERE STATE = $1 AND EXPIRES_AT > NOW()
+		RETURNING STATE, PROVIDER, NONCE, CODE_VERIFIER, EXPIRES_AT
+	`
+	queryDeleteExpiredOIDCStates = `
+		DELETE FROM OIDC_LOGIN_STATES WHERE EXPIRES_AT <= NOW()
+	`
+)
+
+var identityQueries = []string{
+	queryUserByIdentity,
+	queryCreateIdentity,
+	querySaveOIDCState,
+	queryTakeOIDCState,
+	queryDeleteExpiredOIDCStates,
+}
+
+type IdentityStorer interface {
+	// GetUser returns the user the identity subject at provider is linked
+	// to.
+	GetUser(ctx context.Context, provider, subject string) (*models.User, error)
+	Link(ctx context.Context, identity models.Identity) error
+	// CreateUser creates a user without a password, who can only log in
+	// with identity.
+	CreateUser(ctx context.Context, user models.User, identity models.Identity) (*models.User, error)
+
+	SaveState(ctx context.Context, state models.OIDCState) error
+	// TakeState returns and deletes the state, so it can only be used once.
+	TakeState(ctx context.Context, state string) (*models.OIDCState, error)
+	DeleteExpiredStates(ctx context.Context) (int64, error)
+}
+
+type IdentityStore struct {
+	db *DB
+}
+
+func NewIdentityStore(db *DB) *IdentityStore {
+	return &IdentityStore{
+		db: db,
+	}
+}
+
+func (s *IdentityStore) GetUser(ctx context.Context, provider, subject string) (*models.User, error) {
+	return queryOne(ctx, s.db, ErrIdentityNotFound, scanIntoUser, queryUserByIdentity, provider, subject)
+}
+
+func (s *IdentityStore) Link(ctx context.Context, identity models.Identity) error {
+	return createIdentity(ctx, s.db, identity)
+}
+
+func (s *IdentityStore) CreateUser(ctx context.Context, user models.User, identity models.Identity) (*models.User, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, err := queryOne(
+		ctx,
+		tx,
+		ErrUserNotFound,
+		scanIntoUser,
+		queryRegisterUser,
+		user.Email,
+		user.FirstName,
+		user.LastName,
+		user.DateOfBirth,
+		"",
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrEmailAlreadyExists
+		}
+
+		return nil, err
+	}
+
+	identity.UserID = created.ID
+	if err := createIdentity(ctx, tx, identity); err != nil {
+		return nil, err
+	}
+
+	err = insertEvent(ctx, tx, models.EventUserRegistered, models.UserRegistered{
+		UserID: created.ID,
+		Email:  created.Email,
+		Method: identity.Provider,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func createIdentity(ctx context.Context, q querier, identity models.Identity) error {
+	_, err := q.ExecContext(ctx, queryCreateIdentity, identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505":
+				return ErrIdentityAlreadyLinked
+			case "23503":
+				return ErrUserNotFound
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *IdentityStore) SaveState(ctx context.Context, state models.OIDCState) error {
+	_, err := s.db.ExecContext(ctx, querySaveOIDCState, state.State, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	return err
+}
+
+func (s *IdentityStore) TakeState(ctx context.Context, state string) (*models.OIDCState, error) {
+	return queryOne(ctx, s.db, ErrOIDCStateNotFound, scanIntoOIDCState, queryTakeOIDCState, state)
+}
+
+func (s *IdentityStore) DeleteExpiredStates(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, queryDeleteExpiredOIDCStates)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func scanIntoOIDCState(row scanner) (*models.OIDCState, error) {
+	st := &models.OIDCState{}
+	err := row.Scan(
+		&st.State,
+		&st.Provider,
+		&st.Nonce,
+		&st.CodeVerifier,
+		&st.ExpiresAt,
+	)
+
+	return st, err
+}
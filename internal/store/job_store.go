@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobNotFailed = errors.New("job has not failed")
+	ErrJobLeaseLost = errors.New("job is no longer held by this attempt")
+)
+
+const jobColumns = `
+	ID, KIND, PAYLOAD, STATUS, ATTEMPTS, MAX_ATTEMPTS, RUN_AT, LOCKED_UNTIL,
+	LAST_ERROR, CREATED_AT, FAILED_AT
+`
+
+const (
+	queryEnqueueJob = `
+		INSERT INTO JOBS(KIND, PAYLOAD, MAX_ATTEMPTS, RUN_AT)
+		VALUES($1, $2, $3, COALESCE($4, NOW()))
+		RETURNING ` + jobColumns
+	// a running job whose lease ran out was left by a worker that died, it
+	// is claimed again like a queued one
+	queryClaimJob = `
+		UPDATE JOBS SET
+			STATUS = 'running',
+			ATTEMPTS = ATTEMPTS + 1,
+			LOCKED_UNTIL = NOW() + MAKE_INTERVAL(SECS => $2)
+		WHERE ID = (
+			SELECT ID FROM JOBS
+			WHERE KIND = ANY($1) AND (
+				(STATUS = 'queued' AND RUN_AT <= NOW()) OR
+				(STATUS = 'running' AND LOCKED_UNTIL <= NOW())
+			)
+			ORDER BY RUN_AT, ID
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + jobColumns
+	// the attempt only finishes the job while it holds the lease, once the
+	// lease ran out the job may be running again in another worker
+	queryDeleteJob = `
+		DELETE FROM JOBS WHERE ID = $1 AND STATUS = 'running' AND ATTEMPTS = $2
+	`
+	// without a time for the next attempt the job has failed for good
+	queryJobFailed = `
+		UPDATE JOBS SET
+			STATUS = CASE WHEN $4::TIMESTAMPTZ IS NULL THEN 'failed' ELSE 'queued' END::JOB_STATUS,
+			RUN_AT = COALESCE($4, RUN_AT),
+			LOCKED_UNTIL = NULL,
+			LAST_ERROR = $3,
+			FAILED_AT = CASE WHEN $4::TIMESTAMPTZ IS NULL THEN NOW() END
+		WHERE ID = $1 AND STATUS = 'running' AND ATTEMPTS = $2
+	`
+	queryJobByID = `
+		SELECT ` + jobColumns + ` FROM JOBS WHERE ID = $1
+	`
+	queryListJobs = `
+		SELECT ` + jobColumns + ` FROM JOBS
+		WHERE ($1::TEXT = '' OR STATUS::TEXT = $1)
+			AND ($2 = '' OR KIND = $2)
+			AND ($3::BIGINT = 0 OR ID < $3)
+		ORDER BY ID DESC
+		LIMIT $4
+	`
+	queryRequeueJob = `
+		UPDATE JOBS SET
+			STATUS = 'queued',
+			ATTEMPTS = 0,
+			RUN_AT = NOW(),
+			FAILED_AT = NULL
+		WHERE ID = $1 AND STATUS = 'failed'
+		RETURNING ` + jobColumns
+	queryDeleteFailedJobs = `
+		DELETE FROM JOBS WHERE STATUS = 'failed' AND FAILED_AT < $1
+	`
+)
+
+var jobQueries = []string{
+	queryEnqueueJob,
+	queryClaimJob,
+	queryDeleteJob,
+	queryJobFailed,
+	queryJobByID,
+	queryListJobs,
+	queryRequeueJob,
+	queryDeleteFailedJobs,
+}
+
+type JobStorer interface {
+	// Enqueue adds the job, due at its RunAt or right away if that is zero.
+	Enqueue(ctx context.Context, job models.Job) (*models.Job, error)
+	// Claim returns the job of one of kinds that has been due longest,
+	// counts the attempt and hides it from other claims for lease. It
+	// returns ErrJobNotFound if no job is due.
+	Claim(ctx context.Context, kinds []string, lease time.Duration) (*models.Job, error)
+	// Succeeded deletes the job after its attempt succeeded. attempt is the
+	// Attempts of the claimed job, it returns ErrJobLeaseLost if the job
+	// was claimed again since.
+	Succeeded(ctx context.Context, id int64, attempt int) error
+	// Failed records the failed attempt. The job runs again at retryAt, or
+	// has failed for good if retryAt is nil. Like Succeeded it returns
+	// ErrJobLeaseLost if the job was claimed again since.
+	Failed(ctx context.Context, id int64, attempt int, reason string, retryAt *time.Time) error
+	GetByID(ctx context.Context, id int64) (*models.Job, error)
+	// List returns the jobs matching filter, newest first.
+	List(ctx context.Context, filter models.JobFilter) ([]models.Job, error)
+	// Requeue makes a failed job due again with all of its attempts left.
+	// It returns ErrJobNotFailed for a job that has not failed.
+	Requeue(ctx context.Context, id int64) (*models.Job, error)
+	// DeleteFailed deletes the jobs that failed before the given time.
+	DeleteFailed(ctx context.Context, before time.Time) (int64, error)
+}
+
+type JobStore struct {
+	db *DB
+}
+
+func NewJobStore(db *DB) *JobStore {
+	return &JobStore{
+		db: db,
+	}
+}
+
+func (s *JobStore) Enqueue(ctx context.Context, job models.Job) (*models.Job, error) {
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	return queryOne(
+		ctx,
+		s.db,
+		ErrJobNotFound,
+		scanIntoJob,
+		queryEnqueueJob,
+		job.Kind,
+		string(job.Payload),
+		job.MaxAttempts,
+		runAt,
+	)
+}
+
+func (s *JobStore) Claim(ctx context.Context, kinds []string, lease time.Duration) (*models.Job, error) {
+	return queryOne(ctx, s.db, ErrJobNotFound, scanIntoJob, queryClaimJob, pq.Array(kinds), lease.Seconds())
+}
+
+func (s *JobStore) Succeeded(ctx context.Context, id int64, attempt int) error {
+	return execOne(ctx, s.db, ErrJobLeaseLost, queryDeleteJob, id, attempt)
+}
+
+func (s *JobStore) Failed(ctx context.Context, id int64, attempt int, reason string, retryAt *time.Time) error {
+	return execOne(ctx, s.db, ErrJobLeaseLost, queryJobFailed, id, attempt, reason, retryAt)
+}
+
+func (s *JobStore) GetByID(ctx context.Context, id int64) (*models.Job, error) {
+	return queryOne(ctx, s.db, ErrJobNotFound, scanIntoJob, queryJobByID, id)
+}
+
+func (s *JobStore) List(ctx context.Context, filter models.JobFilter) ([]models.Job, error) {
+	jobs, err := queryAll(ctx, s.db, scanIntoJob, queryListJobs, filter.Status, filter.Kind, filter.BeforeID, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Job, 0, len(jobs))
+	for _, j := range jobs {
+		list = append(list, *j)
+	}
+
+	return list, nil
+}
+
+func (s *JobStore) Requeue(ctx context.Context, id int64) (*models.Job, error) {
+	job, err := queryOne(ctx, s.db, ErrJobNotFound, scanIntoJob, queryRequeueJob, id)
+	if errors.Is(err, ErrJobNotFound) {
+		// tell a job that is not there from one that has not failed
+		if _, err := s.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobNotFailed
+	}
+
+	return job, err
+}
+
+func (s *JobStore) DeleteFailed(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, queryDeleteFailedJobs, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func scanIntoJob(row scanner) (*models.Job, error) {
+	var (
+		j       = &models.Job{}
+		payload []byte
+	)
+	err := row.Scan(
+		&j.ID,
+		&j.Kind,
+		&payload,
+		&j.Status,
+		&j.Attempts,
+		&j.MaxAttempts,
+		&j.RunAt,
+		&j.LockedUntil,
+		&j.LastError,
+		&j.CreatedAt,
+		&j.FailedAt,
+	)
+	j.Payload = payload
+
+	return j, err
+}
@@ -0,0 +1,65 @@
+package store_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/store/pgtest"
+)
+
+func TestJobStoreLease(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	jobs := store.NewJobStore(db)
+	kinds := []string{"test"}
+
+	job, err := jobs.Enqueue(ctx, models.Job{Kind: "test", Payload: json.RawMessage(`{}`), MaxAttempts: 3})
+	if err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+
+	first, err := jobs.Claim(ctx, kinds, time.Millisecond)
+	if err != nil {
+		t.Fatalf("claim: %s", err)
+	}
+
+	// the first attempt outlives its lease and the job is claimed again
+	time.Sleep(10 * time.Millisecond)
+	second, err := jobs.Claim(ctx, kinds, time.Minute)
+	if err != nil {
+		t.Fatalf("claim after the lease: %s", err)
+	}
+	if second.ID != job.ID || second.Attempts != first.Attempts+1 {
+		t.Fatalf("got job %d attempt %d, want job %d attempt %d", second.ID, second.Attempts, job.ID, first.Attempts+1)
+	}
+
+	if err := jobs.Succeeded(ctx, job.ID, first.Attempts); !errors.Is(err, store.ErrJobLeaseLost) {
+		t.Fatalf("succeeded with a lost lease: got %v, want %v", err, store.ErrJobLeaseLost)
+	}
+	if err := jobs.Failed(ctx, job.ID, first.Attempts, "late", nil); !errors.Is(err, store.ErrJobLeaseLost) {
+		t.Fatalf("failed with a lost lease: got %v, want %v", err, store.ErrJobLeaseLost)
+	}
+
+	got, err := jobs.GetByID(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("get job: %s", err)
+	}
+	if got.Status != models.JobRunning || got.LastError != "" {
+		t.Fatalf("got job %+v, want it untouched by the late attempt", got)
+	}
+
+	retryAt := time.Now().Add(time.Hour)
+	if err := jobs.Failed(ctx, job.ID, second.Attempts, "boom", &retryAt); err != nil {
+		t.Fatalf("failed: %s", err)
+	}
+	// a queued job is held by no attempt
+	if err := jobs.Succeeded(ctx, job.ID, second.Attempts); !errors.Is(err, store.ErrJobLeaseLost) {
+		t.Fatalf("succeeded after failing: got %v, want %v", err, store.ErrJobLeaseLost)
+	}
+}
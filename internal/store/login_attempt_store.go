@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+var (
+	ErrLoginAttemptNotFound = errors.New("login attempt not found")
+)
+
+const loginAttemptColumns = `KEY, FAILURES, LAST_FAILED_AT, LOCKED_UNTIL`
+
+const (
+	queryLoginAttempt = `
+		SELECT ` + loginAttemptColumns + ` FROM LOGIN_ATTEMPTS WHERE KEY = $1
+	`
+	// the count starts over once the last failure left the window or the
+	// lockout ended
+	queryRecordLoginFailure = `
+		INSERT INTO LOGIN_ATTEMPTS(KEY, FAILURES, LAST_FAILED_AT) VALUES($1, 1, NOW())
+		ON CONFLICT (KEY) DO UPDATE SET
+			FAILURES = CASE
+				WHEN LOGIN_ATTEMPTS.LAST_FAILED_AT < $2 OR LOGIN_ATTEMPTS.LOCKED_UNTIL < NOW() THEN 1
+				ELSE LOGIN_ATTEMPTS.FAILURES + 1
+			END,
+			LOCKED_UNTIL = CASE
+				WHEN LOGIN_ATTEMPTS.LOCKED_UNTIL < NOW() THEN NULL
+				ELSE LOGIN_ATTEMPTS.LOCKED_UNTIL
+			END,
+			LAST_FAILED_AT = NOW()
+		RETURNING ` + loginAttemptColumns
+	queryLockLoginAttempt = `
+		UPDATE LOGIN_ATTEMPTS SET LOCKED_UNTIL = $1 WHERE KEY = $2
+	`
+	queryDeleteLoginAttempt = `
+		DELETE FROM LOGIN_ATTEMPTS WHERE KEY = $1
+	`
+	queryDeleteStaleLoginAttempts = `
+		DELETE FROM LOGIN_ATTEMPTS WHERE LAST_FAILED_AT < $1 AND (LOCKED_UNTIL IS NULL OR LOCKED_UNTIL < NOW())
+	`
+)
+
+var loginAttemptQueries = []string{
+	queryLoginAttempt,
+	queryRecordLoginFailure,
+	queryLockLoginAttempt,
+	queryDeleteLoginAttempt,
+	queryDeleteStaleLoginAttempts,
+}
+
+type LoginAttemptStorer interface {
+	Get(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// RecordFailure counts a failed login for key, forgetting the failures
+	// made before windowStart.
+	RecordFailure(ctx context.Context, key string, windowStart time.Time) (*models.LoginAttempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Delete(ctx context.Context, key string) error
+	DeleteStale(ctx context.Context, before time.Time) (int64, error)
+}
+
+type LoginAttemptStore struct {
+	db *DB
+}
+
+func NewLoginAttemptStore(db *DB) *LoginAttemptStore {
+	return &LoginAttemptStore{
+		db: db,
+	}
+}
+
+func (s *LoginAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	return queryOne(ctx, s.db, ErrLoginAttemptNotFound, scanIntoLoginAttempt, queryLoginAttempt, key)
+}
+
+func (s *LoginAttemptStore) RecordFailure(ctx context.Context, key string, windowStart time.Time) (*models.LoginAttempt, error) {
+	return queryOne(ctx, s.db, ErrLoginAttemptNotFound, scanIntoLoginAttempt, queryRecordLoginFailure, key, windowStart)
+}
+
+func (s *LoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return execOne(ctx, s.db, ErrLoginAttemptNotFound, queryLockLoginAttempt, until, key)
+}
+
+func (s *LoginAttemptStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, queryDeleteLoginAttempt, key)
+	return err
+}
+
+func (s *LoginAttemptStore) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, queryDeleteStaleLoginAttempts, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func scanIntoLoginAttempt(row scanner) (*models.LoginAttempt, error) {
+	a := &models.LoginAttempt{}
+	err := row.Scan(
+		&a.Key,
+		&a.Failures,
+		&a.LastFailedAt,
+		&a.LockedUntil,
+	)
+
+	return a, err
+}
@@ -0,0 +1,274 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.AccountDeletionStorer = (*AccountDeletionStore)(nil)
+
+type AccountDeletionStore struct {
+	db *DB
+}
+
+func NewAccountDeletionStore(db *DB) *AccountDeletionStore {
+	return &AccountDeletionStore{
+		db: db,
+	}
+}
+
+func (s *AccountDeletionStore) Schedule(ctx context.Context, userID, requestedBy int, scheduledFor time.Time) (*models.AccountDeletion, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[userID]; !ok {
+		return nil, store.ErrUserNotFound
+	}
+	if _, ok := s.db.pendingDeletion(userID); ok {
+		return nil, store.ErrAccountDeletionPending
+	}
+
+	d := models.AccountDeletion{
+		ID:           s.db.nextID("account_deletions"),
+		UserID:       userID,
+		Status:       models.DeletionPending,
+		RequestedBy:  &requestedBy,
+		RequestedAt:  time.Now(),
+		ScheduledFor: scheduledFor,
+	}
+	s.db.deletions[d.ID] = d
+
+	return &d, nil
+}
+
+func (s *AccountDeletionStore) Pending(ctx context.Context, userID int) (*models.AccountDeletion, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	d, ok := s.db.pendingDeletion(userID)
+	if !ok {
+		return nil, store.ErrAccountDeletionNotFound
+	}
+
+	return &d, nil
+}
+
+func (s *AccountDeletionStore) Cancel(ctx context.Context, userID, cancelledBy int) (*models.AccountDeletion, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	d, ok := s.db.pendingDeletion(userID)
+	if !ok {
+		return nil, store.ErrAccountDeletionNotFound
+	}
+
+	now := time.Now()
+	d.Status = models.DeletionCancelled
+	d.CancelledBy = &cancelledBy
+	d.CancelledAt = &now
+	s.db.deletions[d.ID] = d
+
+	return &d, nil
+}
+
+func (s *AccountDeletionStore) List(ctx context.Context, status string) ([]models.AccountDeletion, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	list := []models.AccountDeletion{}
+	for _, d := range s.db.deletions {
+		if status == "" || d.Status == status {
+			list = append(list, d)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+
+	return list, nil
+}
+
+func (s *AccountDeletionStore) Due(ctx context.Context) ([]models.AccountDeletion, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	now := time.Now()
+	list := []models.AccountDeletion{}
+	for _, d := range s.db.deletions {
+		if d.Status == models.DeletionPending && !d.ScheduledFor.After(now) {
+			list = append(list, d)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ScheduledFor.Before(list[j].ScheduledFor) })
+
+	return list, nil
+}
+
+func (s *AccountDeletionStore) Complete(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	d, ok := s.db.deletions[id]
+	if !ok || d.Status != models.DeletionPending || d.ScheduledFor.After(now) {
+		return store.ErrAccountDeletionNotFound
+	}
+
+	u, ok := s.db.users[d.UserID]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+
+	addresses := []string{u.Email}
+	if change, ok := s.db.emailChanges[u.ID]; ok {
+		addresses = append(addresses, change.Email)
+	}
+	if err := s.db.scrubAddress(u.ID, addresses); err != nil {
+		return err
+	}
+
+	u.Email = fmt.Sprintf("deleted-%d@deleted.invalid", u.ID)
+	u.FirstName = "Deleted"
+	u.LastName = ""
+	u.DateOfBirth = nil
+	u.Password = ""
+	u.Role = "customer"
+	u.UpdatedAt = now
+	s.db.users[u.ID] = u
+
+	// city and country are kept, they are needed for taxes
+	for _, o := range s.db.orders {
+		if o.UserID != u.ID {
+			continue
+		}
+
+		for _, item := range o.OrderItems {
+			details, ok := s.db.shippingDetails[item.ShippingDetailsID]
+			if !ok {
+				continue
+			}
+
+			details.AddressLine1 = ""
+			details.AddressLine2 = ""
+			details.PostalCode = ""
+			details.Notes = ""
+			details.UpdatedAt = now
+			s.db.shippingDetails[details.ID] = details
+		}
+	}
+
+	delete(s.db.twoFactor, u.ID)
+	for k, identity := range s.db.identities {
+		if identity.UserID == u.ID {
+			delete(s.db.identities, k)
+		}
+	}
+	for k, key := range s.db.apiKeys {
+		if key.UserID == u.ID {
+			delete(s.db.apiKeys, k)
+		}
+	}
+	for k, session := range s.db.sessions {
+		if session.UserID == u.ID {
+			delete(s.db.sessions, k)
+		}
+	}
+	delete(s.db.emailChanges, u.ID)
+	// an anonymized user has no address to send to
+	s.db.notifications[u.ID] = models.NotificationPreferences{UserID: u.ID, UpdatedAt: now}
+
+	d.Status = models.DeletionCompleted
+	d.CompletedAt = &now
+	s.db.deletions[d.ID] = d
+
+	return nil
+}
+
+// scrubAddress drops the address from the registration events of the user
+// and their webhook deliveries, and the queued emails to addresses. It must
+// be called with mu held.
+func (db *DB) scrubAddress(userID int, addresses []string) error {
+	for _, e := range db.outbox {
+		if e.event.Type != models.EventUserRegistered {
+			continue
+		}
+
+		data, err := withoutEmail(e.event.Data, userID)
+		if err != nil {
+			return err
+		}
+		e.event.Data = data
+	}
+
+	for id, d := range db.deliveries {
+		if d.EventType != models.EventUserRegistered {
+			continue
+		}
+
+		var payload map[string]json.RawMessage
+		if err := json.Unmarshal(d.Payload, &payload); err != nil {
+			return err
+		}
+		data, err := withoutEmail(payload["data"], userID)
+		if err != nil {
+			return err
+		}
+		payload["data"] = data
+		if d.Payload, err = json.Marshal(payload); err != nil {
+			return err
+		}
+		db.deliveries[id] = d
+	}
+
+	for id, job := range db.jobs {
+		if job.Kind != "mail.send" {
+			continue
+		}
+
+		var msg struct {
+			To string `json:"to"`
+		}
+		if err := json.Unmarshal(job.Payload, &msg); err != nil {
+			return err
+		}
+		for _, address := range addresses {
+			if strings.EqualFold(msg.To, address) {
+				delete(db.jobs, id)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// withoutEmail returns the data of a registration event without the email
+// if it is the registration of userID.
+func withoutEmail(data json.RawMessage, userID int) (json.RawMessage, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if id, _ := fields["user_id"].(float64); int(id) != userID {
+		return data, nil
+	}
+
+	delete(fields, "email")
+	return json.Marshal(fields)
+}
+
+// pendingDeletion must be called with mu held.
+func (db *DB) pendingDeletion(userID int) (models.AccountDeletion, bool) {
+	for _, d := range db.deletions {
+		if d.UserID == userID && d.Status == models.DeletionPending {
+			return d, true
+		}
+	}
+
+	return models.AccountDeletion{}, false
+}
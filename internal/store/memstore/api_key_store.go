@@ -0,0 +1,98 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.APIKeyStorer = (*APIKeyStore)(nil)
+
+type APIKeyStore struct {
+	db *DB
+}
+
+func NewAPIKeyStore(db *DB) *APIKeyStore {
+	return &APIKeyStore{
+		db: db,
+	}
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key models.APIKey) (*models.APIKey, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[key.UserID]; !ok {
+		return nil, store.ErrUserNotFound
+	}
+
+	key.ID = s.db.nextID("api_keys")
+	key.Scopes = append([]string(nil), key.Scopes...)
+	key.CreatedAt = time.Now()
+	key.LastUsedAt = nil
+	s.db.apiKeys[key.ID] = key
+
+	return &key, nil
+}
+
+func (s *APIKeyStore) List(ctx context.Context, userID int) ([]models.APIKey, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	list := []models.APIKey{}
+	for _, k := range s.db.apiKeys {
+		if k.UserID == userID {
+			list = append(list, k)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list, nil
+}
+
+func (s *APIKeyStore) GetByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	for _, k := range s.db.apiKeys {
+		if k.Prefix == prefix {
+			return &k, nil
+		}
+	}
+
+	return nil, store.ErrAPIKeyNotFound
+}
+
+func (s *APIKeyStore) Touch(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	k, ok := s.db.apiKeys[id]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	if k.LastUsedAt == nil || k.LastUsedAt.Before(now.Add(-time.Minute)) {
+		k.LastUsedAt = &now
+		s.db.apiKeys[id] = k
+	}
+
+	return nil
+}
+
+func (s *APIKeyStore) Delete(ctx context.Context, userID, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	k, ok := s.db.apiKeys[id]
+	if !ok || k.UserID != userID {
+		return store.ErrAPIKeyNotFound
+	}
+	delete(s.db.apiKeys, id)
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/escoutdoor/ecommerce/internal/audit"
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.AuditStorer = (*AuditStore)(nil)
+
+type AuditStore struct {
+	db *DB
+}
+
+func NewAuditStore(db *DB) *AuditStore {
+	return &AuditStore{
+		db: db,
+	}
+}
+
+func (s *AuditStore) Append(ctx context.Context, entry models.AuditEntry) (*models.AuditEntry, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	prev := audit.Genesis
+	if n := len(s.db.auditLog); n > 0 {
+		prev = s.db.auditLog[n-1].Hash
+	}
+
+	entry = audit.Chain(entry, prev)
+	entry.ID = int64(s.db.nextID("audit_log"))
+	s.db.auditLog = append(s.db.auditLog, entry)
+
+	return &entry, nil
+}
+
+func (s *AuditStore) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	list := []models.AuditEntry{}
+	for i := len(s.db.auditLog) - 1; i >= 0 && len(list) < filter.Limit; i-- {
+		e := s.db.auditLog[i]
+		if filter.ActorID != nil && (e.ActorID == nil || *e.ActorID != *filter.ActorID) ||
+			filter.Action != "" && e.Action != filter.Action ||
+			filter.EntityType != "" && e.EntityType != filter.EntityType ||
+			filter.EntityID != "" && e.EntityID != filter.EntityID ||
+			filter.Since != nil && e.CreatedAt.Before(*filter.Since) ||
+			filter.Until != nil && !e.CreatedAt.Before(*filter.Until) ||
+			filter.BeforeID != 0 && e.ID >= filter.BeforeID {
+			continue
+		}
+
+		list = append(list, e)
+	}
+
+	return list, nil
+}
+
+func (s *AuditStore) Chain(ctx context.Context, afterID int64, limit int) ([]models.AuditEntry, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	list := []models.AuditEntry{}
+	for _, e := range s.db.auditLog {
+		if len(list) == limit {
+			break
+		}
+		if e.ID > afterID {
+			list = append(list, e)
+		}
+	}
+
+	return list, nil
+}
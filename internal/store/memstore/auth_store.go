@@ -0,0 +1,104 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/pkg/password"
+)
+
+var _ store.AuthStorer = (*AuthStore)(nil)
+
+type AuthStore struct {
+	db *DB
+}
+
+func NewAuthStore(db *DB) *AuthStore {
+	return &AuthStore{
+		db: db,
+	}
+}
+
+func (s *AuthStore) Login(ctx context.Context, data models.LoginReq) (*models.User, error) {
+	s.db.mu.RLock()
+	u, ok := s.db.userByEmail(data.Email)
+	s.db.mu.RUnlock()
+	if !ok {
+		return nil, store.ErrInvalidEmailOrPassword
+	}
+
+	ok, rehash := password.Verify(u.Password, data.Password)
+	if !ok {
+		return nil, store.ErrInvalidEmailOrPassword
+	}
+
+	if rehash {
+		hashed, err := password.HashPassword(data.Password)
+		if err != nil {
+			return &u, nil
+		}
+
+		s.db.mu.Lock()
+		if current, ok := s.db.users[u.ID]; ok && current.Password == u.Password {
+			current.Password = hashed
+			s.db.users[u.ID] = current
+			u.Password = hashed
+		}
+		s.db.mu.Unlock()
+	}
+
+	return &u, nil
+}
+
+func (s *AuthStore) Register(ctx context.Context, data models.RegisterReq) (*models.User, error) {
+	birthdate, err := parseBirthdate(data.DateOfBirth)
+	if err != nil {
+		return nil, err
+	}
+
+	hashedPass, err := password.HashPassword(data.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.userByEmail(data.Email); ok {
+		return nil, store.ErrEmailAlreadyExists
+	}
+
+	now := time.Now()
+	u := models.User{
+		ID:          s.db.nextID("users"),
+		Email:       data.Email,
+		FirstName:   data.FirstName,
+		LastName:    data.LastName,
+		DateOfBirth: birthdate,
+		Password:    hashedPass,
+		Role:        "customer",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err = s.db.appendEvent(models.EventUserRegistered, models.UserRegistered{
+		UserID: u.ID,
+		Email:  u.Email,
+		Method: "password",
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.db.users[u.ID] = u
+
+	if data.Locale != "" {
+		prefs := *store.DefaultNotificationPreferences(u.ID)
+		prefs.Locale = data.Locale
+		prefs.UpdatedAt = now
+		s.db.notifications[u.ID] = prefs
+	}
+
+	return &u, nil
+}
@@ -0,0 +1,85 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.CategoryStorer = (*CategoryStore)(nil)
+
+type CategoryStore struct {
+	db *DB
+}
+
+func NewCategoryStore(db *DB) *CategoryStore {
+	return &CategoryStore{
+		db: db,
+	}
+}
+
+func (s *CategoryStore) Create(ctx context.Context, data models.CategoryReq) (*models.Category, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	c := models.Category{
+		ID:        s.db.nextID("categories"),
+		Name:      data.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.db.categories[c.ID] = c
+
+	return &c, nil
+}
+
+func (s *CategoryStore) GetByID(ctx context.Context, id int) (*models.Category, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	c, ok := s.db.categories[id]
+	if !ok {
+		return nil, store.ErrCategoryNotFound
+	}
+
+	return &c, nil
+}
+
+func (s *CategoryStore) Delete(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.categories[id]; !ok {
+		return store.ErrCategoryNotFound
+	}
+	delete(s.db.categories, id)
+
+	// products.category_id is ON DELETE SET NULL
+	for pid, p := range s.db.products {
+		if p.CategoryID == id {
+			p.CategoryID = 0
+			s.db.products[pid] = p
+		}
+	}
+
+	return nil
+}
+
+func (s *CategoryStore) Update(ctx context.Context, id int, data models.CategoryReq) (*models.Category, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	c, ok := s.db.categories[id]
+	if !ok {
+		return nil, store.ErrCategoryNotFound
+	}
+
+	c.Name = data.Name
+	c.UpdatedAt = time.Now()
+	s.db.categories[id] = c
+
+	return &c, nil
+}
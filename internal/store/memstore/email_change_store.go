@@ -0,0 +1,64 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.EmailChangeStorer = (*EmailChangeStore)(nil)
+
+type EmailChangeStore struct {
+	db *DB
+}
+
+func NewEmailChangeStore(db *DB) *EmailChangeStore {
+	return &EmailChangeStore{
+		db: db,
+	}
+}
+
+func (s *EmailChangeStore) Save(ctx context.Context, change models.EmailChange) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[change.UserID]; !ok {
+		return store.ErrUserNotFound
+	}
+
+	change.CreatedAt = time.Now()
+	s.db.emailChanges[change.UserID] = change
+
+	return nil
+}
+
+func (s *EmailChangeStore) Take(ctx context.Context, userID int, tokenHash string) (*models.EmailChange, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	change, ok := s.db.emailChanges[userID]
+	if !ok || change.TokenHash != tokenHash || !change.ExpiresAt.After(time.Now()) {
+		return nil, store.ErrEmailChangeNotFound
+	}
+	delete(s.db.emailChanges, userID)
+
+	return &change, nil
+}
+
+func (s *EmailChangeStore) DeleteExpired(ctx context.Context) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	var n int64
+	for id, change := range s.db.emailChanges {
+		if !change.ExpiresAt.After(now) {
+			delete(s.db.emailChanges, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,88 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.IdempotencyStorer = (*IdempotencyStore)(nil)
+
+type IdempotencyStore struct {
+	db *DB
+}
+
+func NewIdempotencyStore(db *DB) *IdempotencyStore {
+	return &IdempotencyStore{
+		db: db,
+	}
+}
+
+func (s *IdempotencyStore) Reserve(ctx context.Context, key models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	id := [2]string{key.Scope, key.Key}
+	if existing, ok := s.db.idempotencyKeys[id]; ok && existing.ExpiresAt.After(now) {
+		if existing.Status != nil || existing.LockedUntil.After(now) {
+			return &existing, false, nil
+		}
+	}
+
+	key.Status = nil
+	key.ContentType = ""
+	key.Body = nil
+	key.CreatedAt = now
+	s.db.idempotencyKeys[id] = key
+
+	return &key, true, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, scope, key string, lockedUntil time.Time, status int, contentType string, body []byte) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	id := [2]string{scope, key}
+	k, ok := s.db.idempotencyKeys[id]
+	if !ok || k.Status != nil || !k.LockedUntil.Equal(lockedUntil) {
+		return store.ErrIdempotencyKeyNotFound
+	}
+
+	k.Status = &status
+	k.ContentType = contentType
+	k.Body = append([]byte(nil), body...)
+	s.db.idempotencyKeys[id] = k
+
+	return nil
+}
+
+func (s *IdempotencyStore) Release(ctx context.Context, scope, key string, lockedUntil time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	id := [2]string{scope, key}
+	if k, ok := s.db.idempotencyKeys[id]; ok && k.Status == nil && k.LockedUntil.Equal(lockedUntil) {
+		delete(s.db.idempotencyKeys, id)
+	}
+
+	return nil
+}
+
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var n int64
+	now := time.Now()
+	for id, k := range s.db.idempotencyKeys {
+		if k.ExpiresAt.Before(now) {
+			delete(s.db.idempotencyKeys, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,151 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.IdentityStorer = (*IdentityStore)(nil)
+
+type IdentityStore struct {
+	db *DB
+}
+
+func NewIdentityStore(db *DB) *IdentityStore {
+	return &IdentityStore{
+		db: db,
+	}
+}
+
+func (s *IdentityStore) GetUser(ctx context.Context, provider, subject string) (*models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	k := [2]string{provider, subject}
+	identity, ok := s.db.identities[k]
+	if !ok {
+		return nil, store.ErrIdentityNotFound
+	}
+	u, ok := s.db.users[identity.UserID]
+	if !ok {
+		return nil, store.ErrIdentityNotFound
+	}
+
+	identity.LastLoginAt = time.Now()
+	s.db.identities[k] = identity
+
+	return &u, nil
+}
+
+func (s *IdentityStore) Link(ctx context.Context, identity models.Identity) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[identity.UserID]; !ok {
+		return store.ErrUserNotFound
+	}
+
+	return s.db.createIdentity(identity)
+}
+
+func (s *IdentityStore) CreateUser(ctx context.Context, user models.User, identity models.Identity) (*models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.userByEmail(user.Email); ok {
+		return nil, store.ErrEmailAlreadyExists
+	}
+	if _, ok := s.db.identities[[2]string{identity.Provider, identity.Subject}]; ok {
+		return nil, store.ErrIdentityAlreadyLinked
+	}
+
+	now := time.Now()
+	u := models.User{
+		ID:          s.db.nextID("users"),
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		DateOfBirth: user.DateOfBirth,
+		Role:        "customer",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.db.users[u.ID] = u
+
+	identity.UserID = u.ID
+	if err := s.db.createIdentity(identity); err != nil {
+		return nil, err
+	}
+
+	err := s.db.appendEvent(models.EventUserRegistered, models.UserRegistered{
+		UserID: u.ID,
+		Email:  u.Email,
+		Method: identity.Provider,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+// createIdentity must be called with mu held.
+func (db *DB) createIdentity(identity models.Identity) error {
+	k := [2]string{identity.Provider, identity.Subject}
+	if _, ok := db.identities[k]; ok {
+		return store.ErrIdentityAlreadyLinked
+	}
+
+	now := time.Now()
+	identity.ID = db.nextID("user_identities")
+	identity.CreatedAt = now
+	identity.LastLoginAt = now
+	db.identities[k] = identity
+
+	return nil
+}
+
+func (s *IdentityStore) SaveState(ctx context.Context, state models.OIDCState) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.oidcStates[state.State] = state
+
+	return nil
+}
+
+func (s *IdentityStore) TakeState(ctx context.Context, state string) (*models.OIDCState, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	st, ok := s.db.oidcStates[state]
+	if !ok {
+		return nil, store.ErrOIDCStateNotFound
+	}
+	delete(s.db.oidcStates, state)
+
+	if !st.ExpiresAt.After(time.Now()) {
+		return nil, store.ErrOIDCStateNotFound
+	}
+
+	return &st, nil
+}
+
+func (s *IdentityStore) DeleteExpiredStates(ctx context.Context) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	var n int64
+	for k, st := range s.db.oidcStates {
+		if !st.ExpiresAt.After(now) {
+			delete(s.db.oidcStates, k)
+			n++
+		}
+	}
+
+	return n, nil
+}
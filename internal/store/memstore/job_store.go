@@ -0,0 +1,187 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.JobStorer = (*JobStore)(nil)
+
+type JobStore struct {
+	db *DB
+}
+
+func NewJobStore(db *DB) *JobStore {
+	return &JobStore{
+		db: db,
+	}
+}
+
+func (s *JobStore) Enqueue(ctx context.Context, job models.Job) (*models.Job, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	job.ID = int64(s.db.nextID("jobs"))
+	job.Payload = append([]byte(nil), job.Payload...)
+	job.Status = models.JobQueued
+	job.Attempts = 0
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+	job.LockedUntil = nil
+	job.LastError = ""
+	job.CreatedAt = now
+	job.FailedAt = nil
+	s.db.jobs[job.ID] = job
+
+	return &job, nil
+}
+
+func (s *JobStore) Claim(ctx context.Context, kinds []string, lease time.Duration) (*models.Job, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	var due *models.Job
+	for _, j := range s.db.jobs {
+		j := j
+		if !contains(kinds, j.Kind) {
+			continue
+		}
+		if !(j.Status == models.JobQueued && !j.RunAt.After(now)) &&
+			!(j.Status == models.JobRunning && !j.LockedUntil.After(now)) {
+			continue
+		}
+		if due == nil || j.RunAt.Before(due.RunAt) || (j.RunAt.Equal(due.RunAt) && j.ID < due.ID) {
+			due = &j
+		}
+	}
+	if due == nil {
+		return nil, store.ErrJobNotFound
+	}
+
+	until := now.Add(lease)
+	due.Status = models.JobRunning
+	due.Attempts++
+	due.LockedUntil = &until
+	s.db.jobs[due.ID] = *due
+
+	return due, nil
+}
+
+func (s *JobStore) Succeeded(ctx context.Context, id int64, attempt int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if !s.db.holdsJob(id, attempt) {
+		return store.ErrJobLeaseLost
+	}
+	delete(s.db.jobs, id)
+
+	return nil
+}
+
+func (s *JobStore) Failed(ctx context.Context, id int64, attempt int, reason string, retryAt *time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if !s.db.holdsJob(id, attempt) {
+		return store.ErrJobLeaseLost
+	}
+	j := s.db.jobs[id]
+
+	if retryAt != nil {
+		j.Status = models.JobQueued
+		j.RunAt = *retryAt
+		j.FailedAt = nil
+	} else {
+		now := time.Now()
+		j.Status = models.JobFailed
+		j.FailedAt = &now
+	}
+	j.LockedUntil = nil
+	j.LastError = reason
+	s.db.jobs[id] = j
+
+	return nil
+}
+
+func (s *JobStore) GetByID(ctx context.Context, id int64) (*models.Job, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	j, ok := s.db.jobs[id]
+	if !ok {
+		return nil, store.ErrJobNotFound
+	}
+
+	return &j, nil
+}
+
+func (s *JobStore) List(ctx context.Context, filter models.JobFilter) ([]models.Job, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	list := []models.Job{}
+	for _, j := range s.db.jobs {
+		if (filter.Status != "" && j.Status != filter.Status) ||
+			(filter.Kind != "" && j.Kind != filter.Kind) ||
+			(filter.BeforeID != 0 && j.ID >= filter.BeforeID) {
+			continue
+		}
+		list = append(list, j)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	if len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+
+	return list, nil
+}
+
+func (s *JobStore) Requeue(ctx context.Context, id int64) (*models.Job, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	j, ok := s.db.jobs[id]
+	if !ok {
+		return nil, store.ErrJobNotFound
+	}
+	if j.Status != models.JobFailed {
+		return nil, store.ErrJobNotFailed
+	}
+
+	j.Status = models.JobQueued
+	j.Attempts = 0
+	j.RunAt = time.Now()
+	j.FailedAt = nil
+	s.db.jobs[id] = j
+
+	return &j, nil
+}
+
+func (s *JobStore) DeleteFailed(ctx context.Context, before time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var n int64
+	for id, j := range s.db.jobs {
+		if j.Status == models.JobFailed && j.FailedAt.Before(before) {
+			delete(s.db.jobs, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// holdsJob reports whether attempt of the job is the one running it.
+func (db *DB) holdsJob(id int64, attempt int) bool {
+	j, ok := db.jobs[id]
+	return ok && j.Status == models.JobRunning && j.Attempts == attempt
+}
@@ -0,0 +1,95 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.LoginAttemptStorer = (*LoginAttemptStore)(nil)
+
+type LoginAttemptStore struct {
+	db *DB
+}
+
+func NewLoginAttemptStore(db *DB) *LoginAttemptStore {
+	return &LoginAttemptStore{
+		db: db,
+	}
+}
+
+func (s *LoginAttemptStore) Get(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	a, ok := s.db.loginAttempts[key]
+	if !ok {
+		return nil, store.ErrLoginAttemptNotFound
+	}
+
+	return &a, nil
+}
+
+func (s *LoginAttemptStore) RecordFailure(ctx context.Context, key string, windowStart time.Time) (*models.LoginAttempt, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	a, ok := s.db.loginAttempts[key]
+	lockExpired := a.LockedUntil != nil && a.LockedUntil.Before(now)
+	if !ok || a.LastFailedAt.Before(windowStart) || lockExpired {
+		a.Failures = 0
+	}
+	if lockExpired {
+		a.LockedUntil = nil
+	}
+
+	a.Key = key
+	a.Failures++
+	a.LastFailedAt = now
+	s.db.loginAttempts[key] = a
+
+	return &a, nil
+}
+
+func (s *LoginAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	a, ok := s.db.loginAttempts[key]
+	if !ok {
+		return store.ErrLoginAttemptNotFound
+	}
+
+	a.LockedUntil = &until
+	s.db.loginAttempts[key] = a
+
+	return nil
+}
+
+func (s *LoginAttemptStore) Delete(ctx context.Context, key string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	delete(s.db.loginAttempts, key)
+
+	return nil
+}
+
+func (s *LoginAttemptStore) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var n int64
+	now := time.Now()
+	for key, a := range s.db.loginAttempts {
+		if a.LastFailedAt.Before(before) && (a.LockedUntil == nil || a.LockedUntil.Before(now)) {
+			delete(s.db.loginAttempts, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,74 @@
+// Package memstore provides in-memory implementations of the store
+// interfaces with the same error semantics as the Postgres stores, so the
+// HTTP layer can run without a database.
+package memstore
+
+import (
+	"sync"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+// DB holds the tables shared by every in-memory store. Stores created from
+// the same DB see each other's writes, like stores sharing a Postgres pool.
+type DB struct {
+	mu sync.RWMutex
+
+	users           map[int]models.User
+	categories      map[int]models.Category
+	products        map[int]models.Product
+	orders          map[int]models.Order
+	shippingDetails map[int]models.ShippingDetails
+	idempotencyKeys map[[2]string]models.IdempotencyKey
+	loginAttempts   map[string]models.LoginAttempt
+	twoFactor       map[int]models.TwoFactor
+	identities      map[[2]string]models.Identity
+	oidcStates      map[string]models.OIDCState
+	apiKeys         map[int]models.APIKey
+	sessions        map[string]models.Session
+	emailChanges    map[int]models.EmailChange
+	deletions       map[int]models.AccountDeletion
+	auditLog        []models.AuditEntry
+	outbox          []*outboxEvent
+	webhooks        map[int]models.Webhook
+	deliveries      map[int64]models.WebhookDelivery
+	jobs            map[int64]models.Job
+	notifications   map[int]models.NotificationPreferences
+	notified        map[int64]time.Time
+	orderListeners  map[int]func(orderID int)
+
+	seq map[string]int
+}
+
+func NewDB() *DB {
+	return &DB{
+		users:           make(map[int]models.User),
+		categories:      make(map[int]models.Category),
+		products:        make(map[int]models.Product),
+		orders:          make(map[int]models.Order),
+		shippingDetails: make(map[int]models.ShippingDetails),
+		idempotencyKeys: make(map[[2]string]models.IdempotencyKey),
+		loginAttempts:   make(map[string]models.LoginAttempt),
+		twoFactor:       make(map[int]models.TwoFactor),
+		identities:      make(map[[2]string]models.Identity),
+		oidcStates:      make(map[string]models.OIDCState),
+		apiKeys:         make(map[int]models.APIKey),
+		sessions:        make(map[string]models.Session),
+		emailChanges:    make(map[int]models.EmailChange),
+		deletions:       make(map[int]models.AccountDeletion),
+		webhooks:        make(map[int]models.Webhook),
+		deliveries:      make(map[int64]models.WebhookDelivery),
+		jobs:            make(map[int64]models.Job),
+		notifications:   make(map[int]models.NotificationPreferences),
+		notified:        make(map[int64]time.Time),
+		orderListeners:  make(map[int]func(orderID int)),
+		seq:             make(map[string]int),
+	}
+}
+
+// nextID emulates a SERIAL column. It must be called with mu held.
+func (db *DB) nextID(table string) int {
+	db.seq[table]++
+	return db.seq[table]
+}
@@ -0,0 +1,95 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.NotificationStorer = (*NotificationStore)(nil)
+
+type NotificationStore struct {
+	db *DB
+}
+
+func NewNotificationStore(db *DB) *NotificationStore {
+	return &NotificationStore{
+		db: db,
+	}
+}
+
+func (s *NotificationStore) Preferences(ctx context.Context, userID int) (*models.NotificationPreferences, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	prefs := s.db.notificationPreferences(userID)
+
+	return &prefs, nil
+}
+
+func (s *NotificationStore) SetPreferences(ctx context.Context, userID int, data models.NotificationPreferencesReq) (*models.NotificationPreferences, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[userID]; !ok {
+		return nil, store.ErrUserNotFound
+	}
+
+	prefs := models.NotificationPreferences{
+		UserID:      userID,
+		Locale:      data.Locale,
+		OrderPlaced: data.OrderPlaced,
+		OrderStatus: data.OrderStatus,
+		Refunds:     data.Refunds,
+		UpdatedAt:   time.Now(),
+	}
+	s.db.notifications[userID] = prefs
+
+	return &prefs, nil
+}
+
+func (s *NotificationStore) Notified(ctx context.Context, eventID int64) (bool, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	_, ok := s.db.notified[eventID]
+
+	return ok, nil
+}
+
+func (s *NotificationStore) MarkNotified(ctx context.Context, eventID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.notified[eventID]; !ok {
+		s.db.notified[eventID] = time.Now()
+	}
+
+	return nil
+}
+
+func (s *NotificationStore) DeleteNotified(ctx context.Context, before time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var n int64
+	for id, at := range s.db.notified {
+		if at.Before(before) {
+			delete(s.db.notified, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// notificationPreferences must be called with mu held.
+func (db *DB) notificationPreferences(userID int) models.NotificationPreferences {
+	if prefs, ok := db.notifications[userID]; ok {
+		return prefs
+	}
+
+	return *store.DefaultNotificationPreferences(userID)
+}
@@ -0,0 +1,37 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.OrderListener = (*OrderListener)(nil)
+
+// OrderListener is notified by the order store of the same DB. It only
+// sees the changes of this process, like the memstore itself.
+type OrderListener struct {
+	db *DB
+}
+
+func NewOrderListener(db *DB) *OrderListener {
+	return &OrderListener{
+		db: db,
+	}
+}
+
+func (l *OrderListener) Listen(ctx context.Context, notify func(orderID int)) error {
+	l.db.mu.Lock()
+	id := l.db.nextID("order_listeners")
+	// called with mu held, notify does not call back into the stores
+	l.db.orderListeners[id] = notify
+	l.db.mu.Unlock()
+
+	<-ctx.Done()
+
+	l.db.mu.Lock()
+	delete(l.db.orderListeners, id)
+	l.db.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.OrderStorer = (*OrderStore)(nil)
+
+type OrderStore struct {
+	db *DB
+}
+
+func NewOrderStore(db *DB) *OrderStore {
+	return &OrderStore{
+		db: db,
+	}
+}
+
+func (s *OrderStore) Create(ctx context.Context, userID int, data models.OrderReq) (*models.Order, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	total := 0.0
+	for _, v := range data.OrderItems {
+		if v.Quantity <= 0 {
+			return nil, store.ErrInvalidProductQuantity
+		}
+
+		product, ok := s.db.products[v.ProductID]
+		if !ok {
+			return nil, store.ErrProductNotFound
+		}
+
+		total += float64(v.Quantity) * product.Price
+	}
+
+	now := time.Now()
+	order := models.Order{
+		ID:        s.db.nextID("orders"),
+		Total:     total,
+		UserID:    userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	for _, item := range data.OrderItems {
+		details := models.ShippingDetails{
+			ID:           s.db.nextID("shipping_details"),
+			AddressLine1: item.ShippingDetails.AddressLine1,
+			AddressLine2: item.ShippingDetails.AddressLine2,
+			PostalCode:   item.ShippingDetails.PostalCode,
+			City:         item.ShippingDetails.City,
+			Country:      item.ShippingDetails.Country,
+			Notes:        item.ShippingDetails.Notes,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		s.db.shippingDetails[details.ID] = details
+
+		order.OrderItems = append(order.OrderItems, models.OrderItem{
+			ID:                s.db.nextID("order_items"),
+			Status:            "pending",
+			ProductID:         item.ProductID,
+			OrderID:           order.ID,
+			ShippingDetailsID: details.ID,
+			Quantity:          item.Quantity,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		})
+	}
+
+	if err := s.db.appendEvent(models.EventOrderCreated, models.OrderCreated{Order: order}); err != nil {
+		return nil, err
+	}
+	s.db.orders[order.ID] = order
+
+	return copyOrder(order), nil
+}
+
+func (s *OrderStore) GetByID(ctx context.Context, id int) (*models.Order, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	o, ok := s.db.orders[id]
+	if !ok {
+		return nil, store.ErrOrderNotFound
+	}
+
+	// the Postgres store only loads the order row, not its items
+	o.OrderItems = nil
+
+	return &o, nil
+}
+
+func (s *OrderStore) GetItem(ctx context.Context, orderID, itemID int) (*models.OrderItem, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return nil, store.ErrOrderItemNotFound
+	}
+
+	for _, item := range o.OrderItems {
+		if item.ID == itemID {
+			return &item, nil
+		}
+	}
+
+	return nil, store.ErrOrderItemNotFound
+}
+
+func (s *OrderStore) Delete(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.orders[id]; !ok {
+		return store.ErrOrderNotFound
+	}
+	delete(s.db.orders, id)
+
+	return nil
+}
+
+func (s *OrderStore) UpdateItemStatus(ctx context.Context, orderID, itemID int, status string) (*models.OrderItem, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return nil, store.ErrOrderItemNotFound
+	}
+
+	for i, item := range o.OrderItems {
+		if item.ID != itemID {
+			continue
+		}
+
+		if item.Status != status {
+			err := s.db.appendEvent(models.EventOrderStatusChanged, models.OrderStatusChanged{
+				OrderID:   orderID,
+				ItemID:    itemID,
+				UserID:    o.UserID,
+				OldStatus: item.Status,
+				NewStatus: status,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, notify := range s.db.orderListeners {
+				notify(orderID)
+			}
+		}
+
+		item.Status = status
+		item.UpdatedAt = time.Now()
+		o.OrderItems[i] = item
+
+		return &item, nil
+	}
+
+	return nil, store.ErrOrderItemNotFound
+}
+
+func (s *OrderStore) StatusEvents(ctx context.Context, orderID int, afterID int64, limit int) ([]models.Event, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	list := []models.Event{}
+	for _, e := range s.db.outbox {
+		if len(list) == limit {
+			break
+		}
+		if e.event.ID > afterID && isStatusEventOf(e.event, orderID) {
+			list = append(list, e.event)
+		}
+	}
+
+	return list, nil
+}
+
+func (s *OrderStore) LastStatusEvent(ctx context.Context, orderID int) (int64, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	var id int64
+	for _, e := range s.db.outbox {
+		if isStatusEventOf(e.event, orderID) {
+			id = e.event.ID
+		}
+	}
+
+	return id, nil
+}
+
+func isStatusEventOf(e models.Event, orderID int) bool {
+	if e.Type != models.EventOrderStatusChanged {
+		return false
+	}
+
+	var data models.OrderStatusChanged
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return false
+	}
+
+	return data.OrderID == orderID
+}
+
+func copyOrder(o models.Order) *models.Order {
+	o.OrderItems = append([]models.OrderItem(nil), o.OrderItems...)
+	return &o
+}
@@ -0,0 +1,127 @@
+package memstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.OutboxStorer = (*OutboxStore)(nil)
+
+type outboxEvent struct {
+	event         models.Event
+	nextAttemptAt time.Time
+	lastError     string
+	deliveredAt   *time.Time
+}
+
+type OutboxStore struct {
+	db *DB
+}
+
+func NewOutboxStore(db *DB) *OutboxStore {
+	return &OutboxStore{
+		db: db,
+	}
+}
+
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.Event, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	list := []models.Event{}
+	for _, e := range s.db.outbox {
+		if len(list) == limit {
+			break
+		}
+		if e.deliveredAt != nil || e.nextAttemptAt.After(now) {
+			continue
+		}
+
+		e.event.Attempts++
+		e.nextAttemptAt = now.Add(lease)
+		list = append(list, e.event)
+	}
+
+	return list, nil
+}
+
+func (s *OutboxStore) Delivered(ctx context.Context, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if e := s.db.outboxEvent(id); e != nil {
+		now := time.Now()
+		e.deliveredAt = &now
+		e.lastError = ""
+	}
+
+	return nil
+}
+
+func (s *OutboxStore) Failed(ctx context.Context, id int64, next time.Time, reason string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if e := s.db.outboxEvent(id); e != nil && e.deliveredAt == nil {
+		e.nextAttemptAt = next
+		e.lastError = reason
+	}
+
+	return nil
+}
+
+func (s *OutboxStore) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var n int64
+	kept := s.db.outbox[:0]
+	for _, e := range s.db.outbox {
+		if e.deliveredAt != nil && e.deliveredAt.Before(before) {
+			n++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	s.db.outbox = kept
+
+	return n, nil
+}
+
+// appendEvent writes an event to the outbox. It must be called with mu
+// held, by the store making the change.
+func (db *DB) appendEvent(eventType string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	db.outbox = append(db.outbox, &outboxEvent{
+		event: models.Event{
+			ID:        int64(db.nextID("outbox_events")),
+			Type:      eventType,
+			Data:      b,
+			CreatedAt: now,
+		},
+		nextAttemptAt: now,
+	})
+
+	return nil
+}
+
+// outboxEvent must be called with mu held.
+func (db *DB) outboxEvent(id int64) *outboxEvent {
+	for _, e := range db.outbox {
+		if e.event.ID == id {
+			return e
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.PersonalDataStorer = (*PersonalDataStore)(nil)
+
+type PersonalDataStore struct {
+	db *DB
+}
+
+func NewPersonalDataStore(db *DB) *PersonalDataStore {
+	return &PersonalDataStore{
+		db: db,
+	}
+}
+
+func (s *PersonalDataStore) Export(ctx context.Context, userID int) (*models.PersonalData, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	u, ok := s.db.users[userID]
+	if !ok {
+		return nil, store.ErrUserNotFound
+	}
+
+	data := &models.PersonalData{
+		ExportedAt: time.Now(),
+		Profile:    u,
+		Addresses:  []models.ShippingDetails{},
+		Orders:     []models.Order{},
+		Identities: []models.Identity{},
+		APIKeys:    []models.APIKey{},
+	}
+
+	for _, o := range s.db.orders {
+		if o.UserID != userID {
+			continue
+		}
+
+		data.Orders = append(data.Orders, *copyOrder(o))
+		for _, item := range o.OrderItems {
+			if details, ok := s.db.shippingDetails[item.ShippingDetailsID]; ok {
+				data.Addresses = append(data.Addresses, details)
+			}
+		}
+	}
+	sort.Slice(data.Orders, func(i, j int) bool { return data.Orders[i].ID < data.Orders[j].ID })
+	sort.Slice(data.Addresses, func(i, j int) bool { return data.Addresses[i].ID < data.Addresses[j].ID })
+
+	for _, identity := range s.db.identities {
+		if identity.UserID == userID {
+			data.Identities = append(data.Identities, identity)
+		}
+	}
+	sort.Slice(data.Identities, func(i, j int) bool { return data.Identities[i].ID < data.Identities[j].ID })
+
+	for _, k := range s.db.apiKeys {
+		if k.UserID == userID {
+			data.APIKeys = append(data.APIKeys, k)
+		}
+	}
+	sort.Slice(data.APIKeys, func(i, j int) bool { return data.APIKeys[i].ID < data.APIKeys[j].ID })
+
+	if tf, ok := s.db.twoFactor[userID]; ok {
+		data.TwoFactorEnabled = tf.EnabledAt != nil
+	}
+
+	data.Notifications = s.db.notificationPreferences(userID)
+
+	if d, ok := s.db.pendingDeletion(userID); ok {
+		data.Deletion = &d
+	}
+
+	return data, nil
+}
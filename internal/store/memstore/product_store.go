@@ -0,0 +1,112 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.ProductStorer = (*ProductStore)(nil)
+
+type ProductStore struct {
+	db *DB
+}
+
+func NewProductStore(db *DB) *ProductStore {
+	return &ProductStore{
+		db: db,
+	}
+}
+
+func (s *ProductStore) Create(ctx context.Context, data models.ProductReq) (*models.Product, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.categories[data.CategoryID]; !ok {
+		return nil, store.ErrCategoryNotFound
+	}
+
+	now := time.Now()
+	p := models.Product{
+		ID:          s.db.nextID("products"),
+		Name:        data.Name,
+		Description: data.Description,
+		Price:       data.Price,
+		CategoryID:  data.CategoryID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.db.products[p.ID] = p
+
+	return &p, nil
+}
+
+func (s *ProductStore) GetByID(ctx context.Context, id int) (*models.Product, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	p, ok := s.db.products[id]
+	if !ok {
+		return nil, store.ErrProductNotFound
+	}
+
+	return &p, nil
+}
+
+func (s *ProductStore) Delete(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.products[id]; !ok {
+		return store.ErrProductNotFound
+	}
+	delete(s.db.products, id)
+
+	// order_items.product_id is ON DELETE SET NULL
+	for oid, o := range s.db.orders {
+		for i := range o.OrderItems {
+			if o.OrderItems[i].ProductID == id {
+				o.OrderItems[i].ProductID = 0
+			}
+		}
+		s.db.orders[oid] = o
+	}
+
+	return nil
+}
+
+func (s *ProductStore) Update(ctx context.Context, id int, data models.ProductReq) (*models.Product, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p, ok := s.db.products[id]
+	if !ok {
+		return nil, store.ErrProductNotFound
+	}
+
+	if _, ok := s.db.categories[data.CategoryID]; !ok {
+		return nil, store.ErrCategoryNotFound
+	}
+
+	if p.Price != data.Price {
+		err := s.db.appendEvent(models.EventProductPriceChanged, models.ProductPriceChanged{
+			ProductID: id,
+			OldPrice:  p.Price,
+			NewPrice:  data.Price,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.Name = data.Name
+	p.Description = data.Description
+	p.Price = data.Price
+	p.CategoryID = data.CategoryID
+	p.UpdatedAt = time.Now()
+	s.db.products[id] = p
+
+	return &p, nil
+}
@@ -0,0 +1,81 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.SessionStorer = (*SessionStore)(nil)
+
+type SessionStore struct {
+	db *DB
+}
+
+func NewSessionStore(db *DB) *SessionStore {
+	return &SessionStore{
+		db: db,
+	}
+}
+
+func (s *SessionStore) Create(ctx context.Context, session models.Session) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[session.UserID]; !ok {
+		return store.ErrUserNotFound
+	}
+
+	session.CreatedAt = time.Now()
+	s.db.sessions[session.ID] = session
+
+	return nil
+}
+
+func (s *SessionStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	session, ok := s.db.sessions[id]
+	if !ok || !session.ExpiresAt.After(time.Now()) {
+		return nil, store.ErrSessionNotFound
+	}
+
+	return &session, nil
+}
+
+func (s *SessionStore) RevokeOthers(ctx context.Context, userID int, keepID string) (int64, error) {
+	return s.delete(func(session models.Session) bool {
+		return session.UserID == userID && session.ID != keepID
+	}), nil
+}
+
+func (s *SessionStore) RevokeAll(ctx context.Context, userID int) (int64, error) {
+	return s.delete(func(session models.Session) bool {
+		return session.UserID == userID
+	}), nil
+}
+
+func (s *SessionStore) DeleteExpired(ctx context.Context) (int64, error) {
+	now := time.Now()
+	return s.delete(func(session models.Session) bool {
+		return !session.ExpiresAt.After(now)
+	}), nil
+}
+
+func (s *SessionStore) delete(match func(models.Session) bool) int64 {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var n int64
+	for id, session := range s.db.sessions {
+		if match(session) {
+			delete(s.db.sessions, id)
+			n++
+		}
+	}
+
+	return n
+}
@@ -0,0 +1,135 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.TwoFactorStorer = (*TwoFactorStore)(nil)
+
+type TwoFactorStore struct {
+	db *DB
+}
+
+func NewTwoFactorStore(db *DB) *TwoFactorStore {
+	return &TwoFactorStore{
+		db: db,
+	}
+}
+
+func (s *TwoFactorStore) Get(ctx context.Context, userID int) (*models.TwoFactor, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	tf, ok := s.db.twoFactor[userID]
+	if !ok {
+		return nil, store.ErrTwoFactorNotFound
+	}
+	tf.RecoveryCodes = append([]string(nil), tf.RecoveryCodes...)
+
+	return &tf, nil
+}
+
+func (s *TwoFactorStore) Enroll(ctx context.Context, userID int, secret string) (*models.TwoFactor, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[userID]; !ok {
+		return nil, store.ErrUserNotFound
+	}
+	if tf, ok := s.db.twoFactor[userID]; ok && tf.EnabledAt != nil {
+		return nil, store.ErrTwoFactorAlreadyEnabled
+	}
+
+	tf := models.TwoFactor{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	}
+	s.db.twoFactor[userID] = tf
+
+	return &tf, nil
+}
+
+func (s *TwoFactorStore) Enable(ctx context.Context, userID int, step int64, recoveryCodes []string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	tf, ok := s.db.twoFactor[userID]
+	if !ok || tf.EnabledAt != nil {
+		return store.ErrTwoFactorNotFound
+	}
+
+	now := time.Now()
+	tf.EnabledAt = &now
+	tf.LastUsedStep = step
+	tf.RecoveryCodes = append([]string(nil), recoveryCodes...)
+	s.db.twoFactor[userID] = tf
+
+	return nil
+}
+
+func (s *TwoFactorStore) UseStep(ctx context.Context, userID int, step int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	tf, ok := s.db.twoFactor[userID]
+	if !ok || tf.LastUsedStep >= step {
+		return store.ErrInvalidTwoFactorCode
+	}
+
+	tf.LastUsedStep = step
+	s.db.twoFactor[userID] = tf
+
+	return nil
+}
+
+func (s *TwoFactorStore) UseRecoveryCode(ctx context.Context, userID int, hash string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	tf, ok := s.db.twoFactor[userID]
+	if !ok {
+		return store.ErrInvalidTwoFactorCode
+	}
+
+	for i, code := range tf.RecoveryCodes {
+		if code == hash {
+			tf.RecoveryCodes = append(tf.RecoveryCodes[:i:i], tf.RecoveryCodes[i+1:]...)
+			s.db.twoFactor[userID] = tf
+			return nil
+		}
+	}
+
+	return store.ErrInvalidTwoFactorCode
+}
+
+func (s *TwoFactorStore) SetRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	tf, ok := s.db.twoFactor[userID]
+	if !ok || tf.EnabledAt == nil {
+		return store.ErrTwoFactorNotFound
+	}
+
+	tf.RecoveryCodes = append([]string(nil), hashes...)
+	s.db.twoFactor[userID] = tf
+
+	return nil
+}
+
+func (s *TwoFactorStore) Delete(ctx context.Context, userID int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.twoFactor[userID]; !ok {
+		return store.ErrTwoFactorNotFound
+	}
+	delete(s.db.twoFactor, userID)
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/pkg/password"
+)
+
+var _ store.UserStorer = (*UserStore)(nil)
+
+type UserStore struct {
+	db *DB
+}
+
+func NewUserStore(db *DB) *UserStore {
+	return &UserStore{
+		db: db,
+	}
+}
+
+func (s *UserStore) GetByID(ctx context.Context, id int) (*models.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	u, ok := s.db.users[id]
+	if !ok {
+		return nil, store.ErrUserNotFound
+	}
+
+	return &u, nil
+}
+
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	u, ok := s.db.userByEmail(email)
+	if !ok {
+		return nil, store.ErrUserNotFound
+	}
+
+	return &u, nil
+}
+
+func (s *UserStore) Update(ctx context.Context, id int, data models.UpdateUserReq) (*models.User, error) {
+	birthdate, err := parseBirthdate(data.DateOfBirth)
+	if err != nil {
+		return nil, err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[id]
+	if !ok {
+		return nil, store.ErrUserNotFound
+	}
+
+	if other, ok := s.db.userByEmail(data.Email); ok && other.ID != id {
+		return nil, store.ErrEmailAlreadyExists
+	}
+
+	u.Email = data.Email
+	u.FirstName = data.FirstName
+	u.LastName = data.LastName
+	u.DateOfBirth = birthdate
+	u.UpdatedAt = time.Now()
+	s.db.users[id] = u
+
+	return &u, nil
+}
+
+func (s *UserStore) SetPassword(ctx context.Context, id int, pw string) error {
+	hashedPass, err := password.HashPassword(pw)
+	if err != nil {
+		return err
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u, ok := s.db.users[id]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+
+	u.Password = hashedPass
+	s.db.users[id] = u
+
+	return nil
+}
+
+func (s *UserStore) Delete(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.users[id]; !ok {
+		return store.ErrUserNotFound
+	}
+	for _, o := range s.db.orders {
+		if o.UserID == id {
+			return store.ErrUserHasOrders
+		}
+	}
+	delete(s.db.users, id)
+	delete(s.db.twoFactor, id)
+	for k, identity := range s.db.identities {
+		if identity.UserID == id {
+			delete(s.db.identities, k)
+		}
+	}
+	for k, key := range s.db.apiKeys {
+		if key.UserID == id {
+			delete(s.db.apiKeys, k)
+		}
+	}
+	for k, session := range s.db.sessions {
+		if session.UserID == id {
+			delete(s.db.sessions, k)
+		}
+	}
+	delete(s.db.emailChanges, id)
+	delete(s.db.notifications, id)
+	for k, d := range s.db.deletions {
+		if d.UserID == id {
+			delete(s.db.deletions, k)
+		}
+	}
+
+	return nil
+}
+
+// userByEmail must be called with mu held.
+func (db *DB) userByEmail(email string) (models.User, bool) {
+	for _, u := range db.users {
+		if u.Email == email {
+			return u, true
+		}
+	}
+
+	return models.User{}, false
+}
+
+func parseBirthdate(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	pb, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb, nil
+}
+
+// SetRole changes the role of a user, e.g. to promote a registered user to
+// admin, which the API itself never does.
+func (db *DB) SetRole(id int, role string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.users[id]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+
+	u.Role = role
+	db.users[id] = u
+
+	return nil
+}
@@ -0,0 +1,262 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+)
+
+var _ store.WebhookStorer = (*WebhookStore)(nil)
+
+type WebhookStore struct {
+	db *DB
+}
+
+func NewWebhookStore(db *DB) *WebhookStore {
+	return &WebhookStore{
+		db: db,
+	}
+}
+
+func (s *WebhookStore) Create(ctx context.Context, webhook models.Webhook) (*models.Webhook, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	webhook.ID = s.db.nextID("webhooks")
+	webhook.EventTypes = append([]string(nil), webhook.EventTypes...)
+	webhook.CreatedAt = now
+	webhook.UpdatedAt = now
+	s.db.webhooks[webhook.ID] = webhook
+
+	return &webhook, nil
+}
+
+func (s *WebhookStore) GetByID(ctx context.Context, id int) (*models.Webhook, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	w, ok := s.db.webhooks[id]
+	if !ok {
+		return nil, store.ErrWebhookNotFound
+	}
+
+	return &w, nil
+}
+
+func (s *WebhookStore) List(ctx context.Context) ([]models.Webhook, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	list := make([]models.Webhook, 0, len(s.db.webhooks))
+	for _, w := range s.db.webhooks {
+		list = append(list, w)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list, nil
+}
+
+func (s *WebhookStore) Update(ctx context.Context, id int, data models.WebhookReq) (*models.Webhook, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	w, ok := s.db.webhooks[id]
+	if !ok {
+		return nil, store.ErrWebhookNotFound
+	}
+
+	w.URL = data.URL
+	w.EventTypes = append([]string(nil), data.EventTypes...)
+	if data.Active != nil {
+		w.Active = *data.Active
+	}
+	w.UpdatedAt = time.Now()
+	s.db.webhooks[id] = w
+
+	return &w, nil
+}
+
+func (s *WebhookStore) Delete(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.webhooks[id]; !ok {
+		return store.ErrWebhookNotFound
+	}
+	delete(s.db.webhooks, id)
+
+	for k, d := range s.db.deliveries {
+		if d.WebhookID == id {
+			delete(s.db.deliveries, k)
+		}
+	}
+
+	return nil
+}
+
+func (s *WebhookStore) Enqueue(ctx context.Context, e models.Event, payload []byte) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, w := range s.db.webhooks {
+		if !w.Active || !contains(w.EventTypes, e.Type) || s.db.hasDelivery(w.ID, e.ID) {
+			continue
+		}
+
+		now := time.Now()
+		d := models.WebhookDelivery{
+			ID:            int64(s.db.nextID("webhook_deliveries")),
+			WebhookID:     w.ID,
+			EventID:       e.ID,
+			EventType:     e.Type,
+			Payload:       append([]byte(nil), payload...),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+		}
+		s.db.deliveries[d.ID] = d
+	}
+
+	return nil
+}
+
+func (s *WebhookStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := time.Now()
+	due := []models.WebhookDelivery{}
+	for _, d := range s.db.deliveries {
+		if d.Status == models.WebhookDeliveryPending && !d.NextAttemptAt.After(now) && s.db.webhooks[d.WebhookID].Active {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	next := now.Add(lease)
+	for i := range due {
+		due[i].Attempts++
+		due[i].NextAttemptAt = &next
+		s.db.deliveries[due[i].ID] = due[i]
+	}
+
+	return due, nil
+}
+
+func (s *WebhookStore) Succeeded(ctx context.Context, id int64, statusCode int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	d, ok := s.db.deliveries[id]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	d.Status = models.WebhookDeliverySucceeded
+	d.NextAttemptAt = nil
+	d.LastStatusCode = &statusCode
+	d.LastError = ""
+	d.DeliveredAt = &now
+	s.db.deliveries[id] = d
+
+	return nil
+}
+
+func (s *WebhookStore) Failed(ctx context.Context, id int64, statusCode int, reason string, retryAt *time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	d, ok := s.db.deliveries[id]
+	if !ok || d.Status != models.WebhookDeliveryPending {
+		return nil
+	}
+
+	if retryAt != nil {
+		next := *retryAt
+		d.NextAttemptAt = &next
+	} else {
+		d.Status = models.WebhookDeliveryDead
+		d.NextAttemptAt = nil
+	}
+	d.LastStatusCode = nil
+	if statusCode != 0 {
+		d.LastStatusCode = &statusCode
+	}
+	d.LastError = reason
+	s.db.deliveries[id] = d
+
+	return nil
+}
+
+func (s *WebhookStore) Deliveries(ctx context.Context, webhookID int, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	if _, ok := s.db.webhooks[webhookID]; !ok {
+		return nil, store.ErrWebhookNotFound
+	}
+
+	list := []models.WebhookDelivery{}
+	for _, d := range s.db.deliveries {
+		if d.WebhookID != webhookID ||
+			(filter.Status != "" && d.Status != filter.Status) ||
+			(filter.BeforeID != 0 && d.ID >= filter.BeforeID) {
+			continue
+		}
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	if len(list) > filter.Limit {
+		list = list[:filter.Limit]
+	}
+
+	return list, nil
+}
+
+func (s *WebhookStore) Redeliver(ctx context.Context, webhookID int, id int64) (*models.WebhookDelivery, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	d, ok := s.db.deliveries[id]
+	if !ok || d.WebhookID != webhookID {
+		return nil, store.ErrWebhookDeliveryNotFound
+	}
+
+	now := time.Now()
+	d.Status = models.WebhookDeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = &now
+	d.DeliveredAt = nil
+	s.db.deliveries[id] = d
+
+	return &d, nil
+}
+
+// hasDelivery must be called with mu held.
+func (db *DB) hasDelivery(webhookID int, eventID int64) bool {
+	for _, d := range db.deliveries {
+		if d.WebhookID == webhookID && d.EventID == eventID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+
+	return false
+}
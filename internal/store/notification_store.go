@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+const notificationPreferencesColumns = `USER_ID, LOCALE, ORDER_PLACED, ORDER_STATUS, REFUNDS, UPDATED_AT`
+
+const (
+	queryNotificationPreferences = `
+		SELECT ` + notificationPreferencesColumns + ` FROM NOTIFICATION_PREFERENCES WHERE USER_ID = $1
+	`
+	querySetNotificationPreferences = `
+		INSERT INTO NOTIFICATION_PREFERENCES(USER_ID, LOCALE, ORDER_PLACED, ORDER_STATUS, REFUNDS)
+		VALUES($1, $2, $3, $4, $5)
+		ON CONFLICT (USER_ID) DO UPDATE SET
+			LOCALE = EXCLUDED.LOCALE,
+			ORDER_PLACED = EXCLUDED.ORDER_PLACED,
+			ORDER_STATUS = EXCLUDED.ORDER_STATUS,
+			REFUNDS = EXCLUDED.REFUNDS,
+			UPDATED_AT = NOW()
+		RETURNING ` + notificationPreferencesColumns
+	// an anonymized user has no address to send to, so every notification
+	// is turned off
+	queryMuteNotifications = `
+		INSERT INTO NOTIFICATION_PREFERENCES(USER_ID, LOCALE, ORDER_PLACED, ORDER_STATUS, REFUNDS)
+		VALUES($1, '', FALSE, FALSE, FALSE)
+		ON CONFLICT (USER_ID) DO UPDATE SET
+			LOCALE = '',
+			ORDER_PLACED = FALSE,
+			ORDER_STATUS = FALSE,
+			REFUNDS = FALSE,
+			UPDATED_AT = NOW()
+	`
+	queryNotified = `
+		SELECT EXISTS(SELECT 1 FROM NOTIFIED_EVENTS WHERE EVENT_ID = $1)
+	`
+	queryMarkNotified = `
+		INSERT INTO NOTIFIED_EVENTS(EVENT_ID) VALUES($1) ON CONFLICT (EVENT_ID) DO NOTHING
+	`
+	queryDeleteNotified = `
+		DELETE FROM NOTIFIED_EVENTS WHERE NOTIFIED_AT < $1
+	`
+)
+
+var notificationQueries = []string{
+	queryNotificationPreferences,
+	querySetNotificationPreferences,
+	queryMuteNotifications,
+	queryNotified,
+	queryMarkNotified,
+	queryDeleteNotified,
+}
+
+type NotificationStorer interface {
+	// Preferences returns the preferences of the user, every notification
+	// turned on if they never set any.
+	Preferences(ctx context.Context, userID int) (*models.NotificationPreferences, error)
+	SetPreferences(ctx context.Context, userID int, data models.NotificationPreferencesReq) (*models.NotificationPreferences, error)
+
+	// Notified reports whether the email for the event was sent already,
+	// MarkNotified records that it was.
+	Notified(ctx context.Context, eventID int64) (bool, error)
+	MarkNotified(ctx context.Context, eventID int64) error
+	// DeleteNotified forgets the events notified before the given time.
+	// They are delivered by then and are not seen again.
+	DeleteNotified(ctx context.Context, before time.Time) (int64, error)
+}
+
+type NotificationStore struct {
+	db *DB
+}
+
+func NewNotificationStore(db *DB) *NotificationStore {
+	return &NotificationStore{
+		db: db,
+	}
+}
+
+func (s *NotificationStore) Preferences(ctx context.Context, userID int) (*models.NotificationPreferences, error) {
+	return notificationPreferences(ctx, s.db, userID)
+}
+
+func (s *NotificationStore) SetPreferences(ctx context.Context, userID int, data models.NotificationPreferencesReq) (*models.NotificationPreferences, error) {
+	prefs, err := setNotificationPreferences(ctx, s.db, userID, data)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+func (s *NotificationStore) Notified(ctx context.Context, eventID int64) (bool, error) {
+	var notified bool
+	err := s.db.QueryRowContext(ctx, queryNotified, eventID).Scan(&notified)
+
+	return notified, err
+}
+
+func (s *NotificationStore) MarkNotified(ctx context.Context, eventID int64) error {
+	_, err := s.db.ExecContext(ctx, queryMarkNotified, eventID)
+	return err
+}
+
+func (s *NotificationStore) DeleteNotified(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, queryDeleteNotified, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// notificationPreferences reads the preferences with q, so the export can
+// read them from its snapshot.
+func notificationPreferences(ctx context.Context, q querier, userID int) (*models.NotificationPreferences, error) {
+	prefs, err := scanIntoNotificationPreferences(q.QueryRowContext(ctx, queryNotificationPreferences, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultNotificationPreferences(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+// setNotificationPreferences writes the preferences with q, so the locale
+// picked at registration is saved with the user.
+func setNotificationPreferences(ctx context.Context, q querier, userID int, data models.NotificationPreferencesReq) (*models.NotificationPreferences, error) {
+	return scanIntoNotificationPreferences(q.QueryRowContext(
+		ctx,
+		querySetNotificationPreferences,
+		userID,
+		data.Locale,
+		data.OrderPlaced,
+		data.OrderStatus,
+		data.Refunds,
+	))
+}
+
+// DefaultNotificationPreferences are the preferences of a user who never
+// set any.
+func DefaultNotificationPreferences(userID int) *models.NotificationPreferences {
+	return &models.NotificationPreferences{
+		UserID:      userID,
+		OrderPlaced: true,
+		OrderStatus: true,
+		Refunds:     true,
+	}
+}
+
+func scanIntoNotificationPreferences(row scanner) (*models.NotificationPreferences, error) {
+	p := &models.NotificationPreferences{}
+	err := row.Scan(
+		&p.UserID,
+		&p.Locale,
+		&p.OrderPlaced,
+		&p.OrderStatus,
+		&p.Refunds,
+		&p.UpdatedAt,
+	)
+
+	return p, err
+}
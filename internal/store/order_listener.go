@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OrderListener tells about the status events of orders as they are
+// committed, also by other replicas.
+type OrderListener interface {
+	// Listen calls notify with the ID of an order when status events of it
+	// were committed, or with 0 when events of any order may have been
+	// missed, until ctx is done. notify must not block.
+	Listen(ctx context.Context, notify func(orderID int)) error
+}
+
+// PostgresOrderListener listens on OrderEventsChannel with a connection of
+// its own, outside of the pool.
+type PostgresOrderListener struct {
+	dsn string
+	// ping checks the connection while nothing is notified, a dead one is
+	// only noticed when it is used
+	ping time.Duration
+}
+
+// NewOrderListener returns a listener for the database configured from the
+// environment.
+func NewOrderListener() *PostgresOrderListener {
+	return &PostgresOrderListener{
+		dsn:  dsnFromEnv(),
+		ping: time.Minute,
+	}
+}
+
+func (l *PostgresOrderListener) Listen(ctx context.Context, notify func(orderID int)) error {
+	listener := pq.NewListener(l.dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("order events listener error: %s", err)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(OrderEventsChannel); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(l.ping)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil after the connection was lost and made again, whatever
+			// was notified meanwhile is gone
+			if n == nil {
+				notify(0)
+				continue
+			}
+
+			id, err := strconv.Atoi(n.Extra)
+			if err != nil {
+				log.Printf("invalid order events notification %q", n.Extra)
+				continue
+			}
+			notify(id)
+		case <-ticker.C:
+			// a failed ping makes the listener reconnect
+			listener.Ping()
+		}
+	}
+}
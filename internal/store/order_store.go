@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
+	"strconv"
 
 	"github.com/escoutdoor/ecommerce/internal/models"
 )
@@ -12,23 +12,109 @@ import (
 var (
 	ErrOrderNotFound          = errors.New("order not found")
 	ErrInvalidProductQuantity = errors.New("invalid product quantity")
+	ErrOrderItemNotFound      = errors.New("order item not found")
 )
 
+// OrderEventsChannel is notified with the ID of an order when status events
+// of it are committed.
+const OrderEventsChannel = "order_events"
+
+const (
+	orderColumns           = `ID, TOTAL, USER_ID, CREATED_AT, UPDATED_AT`
+	orderItemColumns       = `ID, STATUS, PRODUCT_ID, ORDER_ID, SHIPPING_DETAILS_ID, QUANTITY, CREATED_AT, UPDATED_AT`
+	shippingDetailsColumns = `ID, ADDRESS_LINE1, ADDRESS_LINE2, POSTAL_CODE, CITY, COUNTRY, NOTES, CREATED_AT, UPDATED_AT`
+)
+
+const (
+	queryOrderByID = `
+		SELECT ` + orderColumns + ` FROM ORDERS WHERE ID = $1
+	`
+	queryOrderItemByID = `
+		SELECT ` + orderItemColumns + ` FROM ORDER_ITEMS WHERE ID = $1 AND ORDER_ID = $2
+	`
+	queryDeleteOrder = `
+		DELETE FROM ORDERS WHERE ID = $1
+	`
+	queryCreateOrder = `
+		INSERT INTO ORDERS(TOTAL, USER_ID) VALUES ($1, $2)
+		RETURNING ` + orderColumns
+	queryCreateOrderItem = `
+		INSERT INTO ORDER_ITEMS(PRODUCT_ID, ORDER_ID, SHIPPING_DETAILS_ID, QUANTITY)
+		VALUES($1, $2, $3, $4)
+		RETURNING ` + orderItemColumns
+	queryCreateShippingDetails = `
+		INSERT INTO SHIPPING_DETAILS(ADDRESS_LINE1, ADDRESS_LINE2, POSTAL_CODE, CITY, COUNTRY, NOTES)
+		VALUES($1, $2, $3, $4, $5, $6)
+		RETURNING ` + shippingDetailsColumns
+	// status changes of an order wait for each other, so its events are
+	// committed in the order of their IDs. NO KEY UPDATE does not block the
+	// items inserted with a new order.
+	queryLockOrder = `
+		SELECT ID FROM ORDERS WHERE ID = $1 FOR NO KEY UPDATE
+	`
+	queryLockOrderItem = `
+		SELECT I.STATUS, O.USER_ID FROM ORDER_ITEMS I
+		JOIN ORDERS O ON O.ID = I.ORDER_ID
+		WHERE I.ID = $1 AND I.ORDER_ID = $2
+		FOR UPDATE OF I
+	`
+	queryUpdateOrderItemStatus = `
+		UPDATE ORDER_ITEMS SET STATUS = $1, UPDATED_AT = NOW()
+		WHERE ID = $2
+		RETURNING ` + orderItemColumns
+	queryNotifyOrderEvents = `
+		SELECT PG_NOTIFY('` + OrderEventsChannel + `', $1)
+	`
+	queryOrderStatusEvents = `
+		SELECT ` + outboxColumns + ` FROM OUTBOX_EVENTS
+		WHERE TYPE = 'order.status_changed' AND (DATA->>'order_id')::INTEGER = $1 AND ID > $2
+		ORDER BY ID
+		LIMIT $3
+	`
+	queryLastOrderStatusEvent = `
+		SELECT COALESCE(MAX(ID), 0) FROM OUTBOX_EVENTS
+		WHERE TYPE = 'order.status_changed' AND (DATA->>'order_id')::INTEGER = $1
+	`
+)
+
+var orderQueries = []string{
+	queryOrderByID,
+	queryOrderItemByID,
+	queryDeleteOrder,
+	queryCreateOrder,
+	queryCreateOrderItem,
+	queryCreateShippingDetails,
+	queryLockOrder,
+	queryLockOrderItem,
+	queryUpdateOrderItemStatus,
+	queryNotifyOrderEvents,
+	queryOrderStatusEvents,
+	queryLastOrderStatusEvent,
+}
+
 type OrderStorer interface {
 	Create(ctx context.Context, id int, data models.OrderReq) (*models.Order, error)
-	GetByID(id int) (*models.Order, error)
-	Delete(id int) error
+	GetByID(ctx context.Context, id int) (*models.Order, error)
+	// GetItem returns an item of the order, GetByID does not load them.
+	GetItem(ctx context.Context, orderID, itemID int) (*models.OrderItem, error)
+	Delete(ctx context.Context, id int) error
+	// UpdateItemStatus sets the status of an item of the order.
+	UpdateItemStatus(ctx context.Context, orderID, itemID int, status string) (*models.OrderItem, error)
+	// StatusEvents returns up to limit order.status_changed events of the
+	// order written after the event afterID, oldest first.
+	StatusEvents(ctx context.Context, orderID int, afterID int64, limit int) ([]models.Event, error)
+	// LastStatusEvent returns the ID of the latest order.status_changed
+	// event of the order, or 0 if there is none.
+	LastStatusEvent(ctx context.Context, orderID int) (int64, error)
 }
 
 type OrderStore struct {
-	db           *sql.DB
-	productStore ProductStore
+	db *DB
 }
 
-func NewOrderStore(db *sql.DB) *OrderStore {
+func NewOrderStore(db *DB) *OrderStore {
 	return &OrderStore{
-		db:           db,
-		productStore: ProductStore{db: db},
+		db: db,
 	}
 }
 
@@ -49,7 +135,7 @@ func (s *OrderStore) Create(ctx context.Context, userID int, data models.OrderRe
 		productsIDs[i] = v.ProductID
 	}
 
-	products, err := s.productStore.GetByIDs(productsIDs...)
+	products, err := getProductsByIDs(ctx, tx, productsIDs...)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +149,7 @@ func (s *OrderStore) Create(ctx context.Context, userID int, data models.OrderRe
 		total += float64(v.Quantity) * product.Price
 	}
 
-	order, err := s.createOrder(ctx, tx, userID, total)
+	order, err := queryOne(ctx, tx, ErrOrderNotFound, scanIntoOrder, queryCreateOrder, total, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -77,151 +163,142 @@ func (s *OrderStore) Create(ctx context.Context, userID int, data models.OrderRe
 		order.OrderItems = append(order.OrderItems, *orderItem)
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err := insertEvent(ctx, tx, models.EventOrderCreated, models.OrderCreated{Order: *order}); err != nil {
 		return nil, err
 	}
 
-	return order, err
-}
-
-func (s *OrderStore) GetByID(id int) (*models.Order, error) {
-	stmt, err := s.db.Prepare(`
-		SELECT * FROM ORDERS WHERE ID = $1
-	`)
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	rows, err := stmt.Query(id)
-	if err != nil {
-		return nil, err
-	}
+	return order, err
+}
 
-	if rows.Next() {
-		return scanIntoOrder(rows)
-	}
+func (s *OrderStore) GetByID(ctx context.Context, id int) (*models.Order, error) {
+	return queryOne(ctx, s.db, ErrOrderNotFound, scanIntoOrder, queryOrderByID, id)
+}
 
-	return nil, ErrOrderNotFound
+func (s *OrderStore) GetItem(ctx context.Context, orderID, itemID int) (*models.OrderItem, error) {
+	return queryOne(ctx, s.db, ErrOrderItemNotFound, scanIntoOrderItem, queryOrderItemByID, itemID, orderID)
 }
 
-func (s *OrderStore) Delete(id int) error {
-	stmt, err := s.db.Prepare(`
-		DELETE FROM ORDERS WHERE ID = $1
-	`)
-	if err != nil {
-		return err
-	}
+func (s *OrderStore) Delete(ctx context.Context, id int) error {
+	return execOne(ctx, s.db, ErrOrderNotFound, queryDeleteOrder, id)
+}
 
-	res, err := stmt.Exec(id)
+func (s *OrderStore) UpdateItemStatus(ctx context.Context, orderID, itemID int, status string) (*models.OrderItem, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
+	var lockedID int
+	if err := tx.QueryRowContext(ctx, queryLockOrder, orderID).Scan(&lockedID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderItemNotFound
+		}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("order cannot be deleted because it doesn't exist")
+		return nil, err
 	}
 
-	return err
-}
+	var (
+		oldStatus string
+		userID    int
+	)
+	if err := tx.QueryRowContext(ctx, queryLockOrderItem, itemID, orderID).Scan(&oldStatus, &userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderItemNotFound
+		}
 
-func (s *OrderStore) createOrder(ctx context.Context, tx *sql.Tx, userID int, total float64) (*models.Order, error) {
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO ORDERS(TOTAL, user_ID) VALUES ($1, $2) 
-		RETURNING *
-	`)
-	if err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.QueryContext(ctx, total, userID)
+	item, err := queryOne(ctx, tx, ErrOrderItemNotFound, scanIntoOrderItem, queryUpdateOrderItemStatus, status, itemID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	if rows.Next() {
-		return scanIntoOrder(rows)
-	}
 
-	return nil, err
-}
+	if oldStatus != item.Status {
+		err := insertEvent(ctx, tx, models.EventOrderStatusChanged, models.OrderStatusChanged{
+			OrderID:   orderID,
+			ItemID:    itemID,
+			UserID:    userID,
+			OldStatus: oldStatus,
+			NewStatus: item.Status,
+		})
+		if err != nil {
+			return nil, err
+		}
 
-func (s *OrderStore) createOrderItem(ctx context.Context, tx *sql.Tx, orderID int, data models.CreateOrderItemReq) (*models.OrderItem, error) {
-	shippingDetails, err := s.createShippingDetails(ctx, tx, data.ShippingDetails)
-	if err != nil {
-		return nil, err
+		// delivered on commit, to the streams of every replica
+		if _, err := tx.ExecContext(ctx, queryNotifyOrderEvents, strconv.Itoa(orderID)); err != nil {
+			return nil, err
+		}
 	}
 
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO ORDER_ITEMS(PRODUCT_ID, ORDER_ID, SHIPPING_DETAILS_ID, QUANTITY)
-		VALUES($1, $2, $3, $4)
-		RETURNING *
-	`)
-	if err != nil {
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.QueryContext(
-		ctx,
-		data.ProductID,
-		orderID,
-		shippingDetails.ID,
-		data.Quantity,
-	)
+	return item, nil
+}
+
+func (s *OrderStore) StatusEvents(ctx context.Context, orderID int, afterID int64, limit int) ([]models.Event, error) {
+	events, err := queryAll(ctx, s.db, scanIntoEvent, queryOrderStatusEvents, orderID, afterID, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	if rows.Next() {
-		return scanIntoOrderItem(rows)
+	list := make([]models.Event, 0, len(events))
+	for _, e := range events {
+		list = append(list, *e)
 	}
 
-	return nil, err
+	return list, nil
 }
 
-func (s *OrderStore) createShippingDetails(ctx context.Context, tx *sql.Tx, data models.ShippingDetailsReq) (*models.ShippingDetails, error) {
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO SHIPPING_DETAILS(ADDRESS_LINE1, ADDRESS_LINE2, POSTAL_CODE, CITY, COUNTRY, NOTES) 
-		VALUES($1, $2, $3, $4, $5, $6)
-		RETURNING *
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
+func (s *OrderStore) LastStatusEvent(ctx context.Context, orderID int) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, queryLastOrderStatusEvent, orderID).Scan(&id)
+
+	return id, err
+}
 
-	rows, err := stmt.QueryContext(
+func (s *OrderStore) createOrderItem(ctx context.Context, tx *Tx, orderID int, data models.CreateOrderItemReq) (*models.OrderItem, error) {
+	shippingDetails, err := queryOne(
 		ctx,
-		data.AddressLine1,
-		data.AddressLine2,
-		data.PostalCode,
-		data.City,
-		data.Country,
-		data.Notes,
+		tx,
+		ErrOrderNotFound,
+		scanIntoShippingDetails,
+		queryCreateShippingDetails,
+		data.ShippingDetails.AddressLine1,
+		data.ShippingDetails.AddressLine2,
+		data.ShippingDetails.PostalCode,
+		data.ShippingDetails.City,
+		data.ShippingDetails.Country,
+		data.ShippingDetails.Notes,
 	)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	if rows.Next() {
-		return scanIntoShippingDetails(rows)
-	}
 
-	return nil, err
+	return queryOne(
+		ctx,
+		tx,
+		ErrOrderNotFound,
+		scanIntoOrderItem,
+		queryCreateOrderItem,
+		data.ProductID,
+		orderID,
+		shippingDetails.ID,
+		data.Quantity,
+	)
 }
 
-func scanIntoOrder(rows *sql.Rows) (*models.Order, error) {
+func scanIntoOrder(row scanner) (*models.Order, error) {
 	order := &models.Order{}
-	err := rows.Scan(
+	err := row.Scan(
 		&order.ID,
 		&order.Total,
 		&order.UserID,
@@ -232,9 +309,9 @@ func scanIntoOrder(rows *sql.Rows) (*models.Order, error) {
 	return order, err
 }
 
-func scanIntoOrderItem(rows *sql.Rows) (*models.OrderItem, error) {
+func scanIntoOrderItem(row scanner) (*models.OrderItem, error) {
 	orderItem := &models.OrderItem{}
-	err := rows.Scan(
+	err := row.Scan(
 		&orderItem.ID,
 		&orderItem.Status,
 		&orderItem.ProductID,
@@ -248,9 +325,9 @@ func scanIntoOrderItem(rows *sql.Rows) (*models.OrderItem, error) {
 	return orderItem, err
 }
 
-func scanIntoShippingDetails(rows *sql.Rows) (*models.ShippingDetails, error) {
+func scanIntoShippingDetails(row scanner) (*models.ShippingDetails, error) {
 	shippingDetails := &models.ShippingDetails{}
-	err := rows.Scan(
+	err := row.Scan(
 		&shippingDetails.ID,
 		&shippingDetails.AddressLine1,
 		&shippingDetails.AddressLine2,
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+const outboxColumns = `ID, TYPE, DATA, CREATED_AT, ATTEMPTS`
+
+const (
+	queryInsertEvent = `
+		INSERT INTO OUTBOX_EVENTS(TYPE, DATA) VALUES($1, $2)
+	`
+	// SKIP LOCKED lets every replica run a dispatcher without two of them
+	// claiming the same event
+	queryClaimEvents = `
+		UPDATE OUTBOX_EVENTS SET
+			ATTEMPTS = ATTEMPTS + 1,
+			NEXT_ATTEMPT_AT = NOW() + MAKE_INTERVAL(SECS => $2)
+		WHERE ID IN (
+			SELECT ID FROM OUTBOX_EVENTS
+			WHERE DELIVERED_AT IS NULL AND NEXT_ATTEMPT_AT <= NOW()
+			ORDER BY ID
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxColumns
+	queryEventDelivered = `
+		UPDATE OUTBOX_EVENTS SET DELIVERED_AT = NOW(), LAST_ERROR = '' WHERE ID = $1
+	`
+	queryEventFailed = `
+		UPDATE OUTBOX_EVENTS SET NEXT_ATTEMPT_AT = $2, LAST_ERROR = $3
+		WHERE ID = $1 AND DELIVERED_AT IS NULL
+	`
+	queryDeleteDeliveredEvents = `
+		DELETE FROM OUTBOX_EVENTS WHERE DELIVERED_AT < $1
+	`
+)
+
+var outboxQueries = []string{
+	queryInsertEvent,
+	queryClaimEvents,
+	queryEventDelivered,
+	queryEventFailed,
+	queryDeleteDeliveredEvents,
+}
+
+// OutboxStorer hands the events written by the other stores to the
+// dispatcher. An event stays in the outbox until it is marked delivered, so
+// it is delivered at least once.
+type OutboxStorer interface {
+	// Claim returns up to limit events that are due, oldest first, and
+	// hides them from other claims for lease.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.Event, error)
+	Delivered(ctx context.Context, id int64) error
+	// Failed makes the event due again at next.
+	Failed(ctx context.Context, id int64, next time.Time, reason string) error
+	DeleteDelivered(ctx context.Context, before time.Time) (int64, error)
+}
+
+type OutboxStore struct {
+	db *DB
+}
+
+func NewOutboxStore(db *DB) *OutboxStore {
+	return &OutboxStore{
+		db: db,
+	}
+}
+
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.Event, error) {
+	events, err := queryAll(ctx, s.db, scanIntoEvent, queryClaimEvents, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Event, 0, len(events))
+	for _, e := range events {
+		list = append(list, *e)
+	}
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	return list, nil
+}
+
+func (s *OutboxStore) Delivered(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, queryEventDelivered, id)
+	return err
+}
+
+func (s *OutboxStore) Failed(ctx context.Context, id int64, next time.Time, reason string) error {
+	_, err := s.db.ExecContext(ctx, queryEventFailed, id, next, reason)
+	return err
+}
+
+func (s *OutboxStore) DeleteDelivered(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, queryDeleteDeliveredEvents, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// insertEvent writes an event to the outbox. It takes the transaction of
+// the change, so the event is only seen if the change is committed.
+func insertEvent(ctx context.Context, q querier, eventType string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, queryInsertEvent, eventType, string(b))
+	return err
+}
+
+func scanIntoEvent(row scanner) (*models.Event, error) {
+	var (
+		e    = &models.Event{}
+		data []byte
+	)
+	err := row.Scan(
+		&e.ID,
+		&e.Type,
+		&data,
+		&e.CreatedAt,
+		&e.Attempts,
+	)
+	e.Data = data
+
+	return e, err
+}
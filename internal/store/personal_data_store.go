@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+const identityColumns = `ID, USER_ID, PROVIDER, SUBJECT, EMAIL, CREATED_AT, LAST_LOGIN_AT`
+
+const (
+	queryOrdersByUserID = `
+		SELECT ` + orderColumns + ` FROM ORDERS WHERE USER_ID = $1 ORDER BY ID
+	`
+	queryOrderItemsByUserID = `
+		SELECT ` + orderItemColumns + ` FROM ORDER_ITEMS
+		WHERE ORDER_ID IN (SELECT ID FROM ORDERS WHERE USER_ID = $1)
+		ORDER BY ID
+	`
+	queryShippingDetailsByUserID = `
+		SELECT ` + shippingDetailsColumns + ` FROM SHIPPING_DETAILS
+		WHERE ID IN (
+			SELECT SHIPPING_DETAILS_ID FROM ORDER_ITEMS
+			WHERE ORDER_ID IN (SELECT ID FROM ORDERS WHERE USER_ID = $1)
+		)
+		ORDER BY ID
+	`
+	queryIdentitiesByUserID = `
+		SELECT ` + identityColumns + ` FROM USER_IDENTITIES WHERE USER_ID = $1 ORDER BY ID
+	`
+	queryTwoFactorEnabled = `
+		SELECT EXISTS(SELECT 1 FROM USER_TWO_FACTOR WHERE USER_ID = $1 AND ENABLED_AT IS NOT NULL)
+	`
+)
+
+var personalDataQueries = []string{
+	queryOrdersByUserID,
+	queryOrderItemsByUserID,
+	queryShippingDetailsByUserID,
+	queryIdentitiesByUserID,
+	queryTwoFactorEnabled,
+}
+
+type PersonalDataStorer interface {
+	// Export collects everything stored about the user.
+	Export(ctx context.Context, userID int) (*models.PersonalData, error)
+}
+
+type PersonalDataStore struct {
+	db *DB
+}
+
+func NewPersonalDataStore(db *DB) *PersonalDataStore {
+	return &PersonalDataStore{
+		db: db,
+	}
+}
+
+// Export reads from one snapshot, so an order placed meanwhile cannot show
+// up without its items.
+func (s *PersonalDataStore) Export(ctx context.Context, userID int) (*models.PersonalData, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user, err := queryOne(ctx, tx, ErrUserNotFound, scanIntoUser, queryUserByID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &models.PersonalData{
+		ExportedAt: time.Now(),
+		Profile:    *user,
+	}
+
+	orders, err := queryAll(ctx, tx, scanIntoOrder, queryOrdersByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := queryAll(ctx, tx, scanIntoOrderItem, queryOrderItemsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byOrder := make(map[int][]models.OrderItem)
+	for _, item := range items {
+		byOrder[item.OrderID] = append(byOrder[item.OrderID], *item)
+	}
+
+	data.Orders = make([]models.Order, 0, len(orders))
+	for _, o := range orders {
+		o.OrderItems = byOrder[o.ID]
+		data.Orders = append(data.Orders, *o)
+	}
+
+	addresses, err := queryAll(ctx, tx, scanIntoShippingDetails, queryShippingDetailsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Addresses = make([]models.ShippingDetails, 0, len(addresses))
+	for _, a := range addresses {
+		data.Addresses = append(data.Addresses, *a)
+	}
+
+	identities, err := queryAll(ctx, tx, scanIntoIdentity, queryIdentitiesByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Identities = make([]models.Identity, 0, len(identities))
+	for _, i := range identities {
+		data.Identities = append(data.Identities, *i)
+	}
+
+	keys, err := queryAll(ctx, tx, scanIntoAPIKey, queryAPIKeysByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	data.APIKeys = make([]models.APIKey, 0, len(keys))
+	for _, k := range keys {
+		data.APIKeys = append(data.APIKeys, *k)
+	}
+
+	if err := tx.QueryRowContext(ctx, queryTwoFactorEnabled, userID).Scan(&data.TwoFactorEnabled); err != nil {
+		return nil, err
+	}
+
+	notifications, err := notificationPreferences(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	data.Notifications = *notifications
+
+	deletion, err := queryOne(ctx, tx, ErrAccountDeletionNotFound, scanIntoAccountDeletion, queryPendingAccountDeletion, userID)
+	if err != nil && !errors.Is(err, ErrAccountDeletionNotFound) {
+		return nil, err
+	}
+	data.Deletion = deletion
+
+	return data, nil
+}
+
+func scanIntoIdentity(row scanner) (*models.Identity, error) {
+	i := &models.Identity{}
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Provider,
+		&i.Subject,
+		&i.Email,
+		&i.CreatedAt,
+		&i.LastLoginAt,
+	)
+
+	return i, err
+}
@@ -0,0 +1,91 @@
+package pgtest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// clusterPort only names the socket file, which lives in a private
+// directory, so it cannot clash with another server.
+const clusterPort = 5432
+
+// cluster is a throwaway Postgres instance listening on a unix socket in a
+// temporary directory.
+type cluster struct {
+	bin string
+	dir string
+}
+
+func startCluster() (*cluster, error) {
+	bin, err := findBin()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "pgtest")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cluster{bin: bin, dir: dir}
+
+	initdb := exec.Command(
+		filepath.Join(bin, "initdb"),
+		"-D", c.dataDir(),
+		"-U", "postgres",
+		"-A", "trust",
+		"--no-sync",
+	)
+	if out, err := initdb.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("initdb: %w: %s", err, out)
+	}
+
+	start := exec.Command(
+		filepath.Join(bin, "pg_ctl"),
+		"-D", c.dataDir(),
+		"-l", filepath.Join(dir, "postgres.log"),
+		"-o", fmt.Sprintf("-p %d -k %s -c listen_addresses='' -c fsync=off", clusterPort, dir),
+		"-w", "start",
+	)
+	if out, err := start.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("pg_ctl start: %w: %s", err, out)
+	}
+
+	return c, nil
+}
+
+func (c *cluster) dataDir() string {
+	return filepath.Join(c.dir, "data")
+}
+
+func (c *cluster) dsn() string {
+	return fmt.Sprintf("host=%s port=%d user=postgres dbname=postgres sslmode=disable", c.dir, clusterPort)
+}
+
+func (c *cluster) stop() error {
+	defer os.RemoveAll(c.dir)
+
+	stop := exec.Command(filepath.Join(c.bin, "pg_ctl"), "-D", c.dataDir(), "-m", "fast", "-w", "stop")
+	if out, err := stop.CombinedOutput(); err != nil {
+		return fmt.Errorf("pg_ctl stop: %w: %s", err, out)
+	}
+
+	return nil
+}
+
+func findBin() (string, error) {
+	if bin := os.Getenv("PG_BIN"); bin != "" {
+		return bin, nil
+	}
+
+	path, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		return "", fmt.Errorf("set TEST_DATABASE_URL or put initdb and pg_ctl in PATH or PG_BIN")
+	}
+
+	return filepath.Dir(path), nil
+}
@@ -0,0 +1,165 @@
+// Package pgtest runs the Postgres stores against a real database in tests.
+//
+// Every call to New creates an isolated schema with all migrations applied
+// and drops it when the test finishes. The database is taken from
+// TEST_DATABASE_URL; if it is not set, a throwaway cluster is started from
+// the initdb and pg_ctl binaries found in PG_BIN or PATH. Tests are skipped
+// when neither is available unless PGTEST_REQUIRED is set.
+package pgtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/migrate"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/migrations"
+	"github.com/lib/pq"
+)
+
+// PoolSize bounds the pool of every test database like DB_MAX_OPEN_CONNS
+// bounds the production one, so leaked rows and statements show up as
+// requests waiting for a connection.
+const PoolSize = 10
+
+var (
+	once     sync.Once
+	baseDSN  string
+	startErr error
+	local    *cluster
+)
+
+// Main runs the tests of a package and stops the local cluster started for
+// them, if any. Call it from TestMain:
+//
+//	func TestMain(m *testing.M) { os.Exit(pgtest.Main(m)) }
+func Main(m *testing.M) int {
+	code := m.Run()
+	if local != nil {
+		if err := local.stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "pgtest: stop postgres: %s\n", err)
+		}
+	}
+
+	return code
+}
+
+// New returns a store.DB bound to a fresh schema with all migrations applied.
+func New(tb testing.TB) *store.DB {
+	tb.Helper()
+
+	dsn, err := server()
+	if err != nil {
+		if os.Getenv("PGTEST_REQUIRED") != "" {
+			tb.Fatalf("pgtest: postgres unavailable: %s", err)
+		}
+		tb.Skipf("pgtest: postgres unavailable: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		tb.Fatalf("pgtest: open: %s", err)
+	}
+
+	schema, err := schemaName()
+	if err != nil {
+		tb.Fatalf("pgtest: %s", err)
+	}
+
+	if _, err := admin.ExecContext(ctx, "CREATE SCHEMA "+pq.QuoteIdentifier(schema)); err != nil {
+		admin.Close()
+		tb.Fatalf("pgtest: create schema: %s", err)
+	}
+	tb.Cleanup(func() {
+		defer admin.Close()
+
+		if _, err := admin.Exec("DROP SCHEMA " + pq.QuoteIdentifier(schema) + " CASCADE"); err != nil {
+			tb.Errorf("pgtest: drop schema %s: %s", schema, err)
+		}
+	})
+
+	conn, err := sql.Open("postgres", withSearchPath(dsn, schema))
+	if err != nil {
+		tb.Fatalf("pgtest: open: %s", err)
+	}
+	conn.SetMaxOpenConns(PoolSize)
+	conn.SetMaxIdleConns(PoolSize)
+
+	if err := applyMigrations(ctx, conn); err != nil {
+		conn.Close()
+		tb.Fatalf("pgtest: migrate: %s", err)
+	}
+
+	db := store.NewDB(conn)
+	tb.Cleanup(func() {
+		db.Close()
+	})
+
+	if err := db.Prepare(ctx); err != nil {
+		tb.Fatalf("pgtest: prepare statements: %s", err)
+	}
+
+	return db
+}
+
+func server() (string, error) {
+	once.Do(func() {
+		if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" {
+			baseDSN = dsn
+			return
+		}
+
+		local, startErr = startCluster()
+		if startErr == nil {
+			baseDSN = local.dsn()
+		}
+	})
+
+	return baseDSN, startErr
+}
+
+func schemaName() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "test_" + hex.EncodeToString(b), nil
+}
+
+// withSearchPath makes every connection of the pool resolve unqualified
+// names in schema. lib/pq sends unknown connection parameters to the server
+// as run-time settings.
+func withSearchPath(dsn, schema string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+
+		return dsn + sep + "search_path=" + schema
+	}
+
+	return dsn + " search_path=" + schema
+}
+
+func applyMigrations(ctx context.Context, conn *sql.DB) error {
+	migrator, err := migrate.New(conn, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up(ctx)
+	return err
+}
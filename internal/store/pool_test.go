@@ -0,0 +1,132 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/store/pgtest"
+)
+
+// TestPoolStaysBounded runs many more concurrent store calls than the pool
+// has connections, through single row, multi row and transaction helpers,
+// and checks the pool never grows past its limit and gets every connection
+// back. A leaked *sql.Rows or statement keeps its connection in use.
+func TestPoolStaysBounded(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	var (
+		categories = store.NewCategoryStore(db)
+		products   = store.NewProductStore(db)
+		orders     = store.NewOrderStore(db)
+	)
+
+	category, err := categories.Create(ctx, models.CategoryReq{Name: "Books"})
+	if err != nil {
+		t.Fatalf("create category: %s", err)
+	}
+	product, err := products.Create(ctx, models.ProductReq{Name: "Book", Price: 10, CategoryID: category.ID})
+	if err != nil {
+		t.Fatalf("create product: %s", err)
+	}
+	user := registerUser(t, db, "pool@example.com")
+
+	const (
+		workers    = 100
+		iterations = 20
+	)
+
+	calls := []func(ctx context.Context) error{
+		func(ctx context.Context) error {
+			_, err := products.GetByID(ctx, product.ID)
+			return err
+		},
+		func(ctx context.Context) error {
+			// sql.ErrNoRows has to release the connection too
+			_, err := categories.GetByID(ctx, -1)
+			if errors.Is(err, store.ErrCategoryNotFound) {
+				return nil
+			}
+			return err
+		},
+		func(ctx context.Context) error {
+			_, err := orders.StatusEvents(ctx, 1, 0, 10)
+			return err
+		},
+		func(ctx context.Context) error {
+			_, err := orders.Create(ctx, user.ID, models.OrderReq{OrderItems: []models.CreateOrderItemReq{{
+				ProductID:       product.ID,
+				Quantity:        1,
+				ShippingDetails: models.ShippingDetailsReq{AddressLine1: "Main 1", City: "Kyiv", Country: "Ukraine"},
+			}}})
+			return err
+		},
+	}
+
+	done := make(chan struct{})
+	peak := make(chan int, 1)
+	go func() {
+		var max int
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-ticker.C:
+				if open := db.Stats().OpenConnections; open > max {
+					max = open
+				}
+			}
+		}
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+				err := calls[(w+i)%len(calls)](ctx)
+				cancel()
+
+				if err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("worker %d call %d: %w", w, i, err))
+					mu.Unlock()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(done)
+
+	for _, err := range errs {
+		t.Error(err)
+	}
+
+	stats := db.Stats()
+	if max := <-peak; max > stats.MaxOpenConnections {
+		t.Errorf("pool grew to %d open connections, the limit is %d", max, stats.MaxOpenConnections)
+	}
+	if stats.OpenConnections > stats.MaxOpenConnections {
+		t.Errorf("%d open connections after the load, the limit is %d", stats.OpenConnections, stats.MaxOpenConnections)
+	}
+	if stats.InUse != 0 {
+		t.Errorf("%d connections still in use after the load, rows or statements leaked", stats.InUse)
+	}
+}
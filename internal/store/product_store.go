@@ -1,10 +1,9 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"strings"
 
 	"github.com/escoutdoor/ecommerce/internal/models"
 	"github.com/lib/pq"
@@ -14,32 +13,63 @@ var (
 	ErrProductNotFound = errors.New("product not found")
 )
 
+const productColumns = `ID, NAME, DESCRIPTION, PRICE, CATEGORY_ID, CREATED_AT, UPDATED_AT`
+
+const (
+	queryCreateProduct = `
+		INSERT INTO PRODUCTS(NAME, DESCRIPTION, PRICE, CATEGORY_ID)
+		VALUES($1, $2, $3, $4)
+		RETURNING ` + productColumns
+	queryProductByID   = `SELECT ` + productColumns + ` FROM PRODUCTS WHERE ID = $1`
+	queryDeleteProduct = "DELETE FROM PRODUCTS WHERE ID = $1"
+	queryUpdateProduct = `
+		UPDATE PRODUCTS SET
+			NAME = $1,
+			DESCRIPTION = $2,
+			PRICE = $3,
+			CATEGORY_ID = $4
+		WHERE ID = $5
+		RETURNING ` + productColumns
+	queryProductsByIDs    = `SELECT ` + productColumns + ` FROM PRODUCTS WHERE ID = ANY($1)`
+	queryLockProductPrice = `SELECT PRICE FROM PRODUCTS WHERE ID = $1 FOR UPDATE`
+)
+
+var productQueries = []string{
+	queryCreateProduct,
+	queryProductByID,
+	queryDeleteProduct,
+	queryUpdateProduct,
+	queryProductsByIDs,
+	queryLockProductPrice,
+}
+
 type ProductStorer interface {
-	Create(data models.ProductReq) (*models.Product, error)
-	GetByID(id int) (*models.Product, error)
-	Delete(id int) error
-	Update(id int, data models.ProductReq) (*models.Product, error)
+	Create(ctx context.Context, data models.ProductReq) (*models.Product, error)
+	GetByID(ctx context.Context, id int) (*models.Product, error)
+	Delete(ctx context.Context, id int) error
+	Update(ctx context.Context, id int, data models.ProductReq) (*models.Product, error)
 }
 
 type ProductStore struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewProductStore(db *sql.DB) *ProductStore {
+func NewProductStore(db *DB) *ProductStore {
 	return &ProductStore{db: db}
 }
 
-func (s *ProductStore) Create(data models.ProductReq) (*models.Product, error) {
-	stmt, err := s.db.Prepare(`
-		INSERT INTO PRODUCTS(NAME, DESCRIPTION, PRICE, CATEGORY_ID)
-		VALUES($1, $2, $3, $4)
-		RETURNING *
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := stmt.Query(data.Name, data.Description, data.Price, data.CategoryID)
+func (s *ProductStore) Create(ctx context.Context, data models.ProductReq) (*models.Product, error) {
+	product, err := queryOne(
+		ctx,
+		s.db,
+		ErrProductNotFound,
+		scanIntoProduct,
+		queryCreateProduct,
+		data.Name,
+		data.Description,
+		data.Price,
+		data.CategoryID,
+	)
 	if err != nil {
 		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" {
 			return nil, ErrCategoryNotFound
@@ -48,69 +78,45 @@ func (s *ProductStore) Create(data models.ProductReq) (*models.Product, error) {
 		return nil, err
 	}
 
-	if rows.Next() {
-		return scanIntoProduct(rows)
-	}
-
-	return nil, err
+	return product, nil
 }
 
-func (s *ProductStore) GetByID(id int) (*models.Product, error) {
-	stmt, err := s.db.Prepare(`SELECT * FROM PRODUCTS WHERE ID = $1`)
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := stmt.Query(id)
-	if err != nil {
-		return nil, err
-	}
-
-	if rows.Next() {
-		return scanIntoProduct(rows)
-	}
-
-	return nil, ErrProductNotFound
+func (s *ProductStore) GetByID(ctx context.Context, id int) (*models.Product, error) {
+	return queryOne(ctx, s.db, ErrProductNotFound, scanIntoProduct, queryProductByID, id)
 }
 
-func (s *ProductStore) Delete(id int) error {
-	stmt, err := s.db.Prepare("DELETE FROM PRODUCTS WHERE ID = $1")
-	if err != nil {
-		return err
-	}
-
-	res, err := stmt.Exec(id)
-	if err != nil {
-		return err
-	}
+func (s *ProductStore) Delete(ctx context.Context, id int) error {
+	return execOne(ctx, s.db, ErrProductNotFound, queryDeleteProduct, id)
+}
 
-	rowsAffected, err := res.RowsAffected()
+func (s *ProductStore) Update(ctx context.Context, id int, data models.ProductReq) (*models.Product, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
-	}
-
-	if rowsAffected == 0 {
-		return fmt.Errorf("product cannot be deleted because it doesn't exist")
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	return err
-}
+	var oldPrice float64
+	if err := tx.QueryRowContext(ctx, queryLockProductPrice, id).Scan(&oldPrice); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProductNotFound
+		}
 
-func (s *ProductStore) Update(id int, data models.ProductReq) (*models.Product, error) {
-	stmt, err := s.db.Prepare(`
-		UPDATE PRODUCTS SET
-			NAME = $1,
-			DESCRIPTION = $2,
-			PRICE = $3,
-			CATEGORY_ID = $4
-		WHERE ID = $5
-		RETURNING *
-	`)
-	if err != nil {
 		return nil, err
 	}
 
-	rows, err := stmt.Query(data.Name, data.Description, data.Price, data.CategoryID, id)
+	product, err := queryOne(
+		ctx,
+		tx,
+		ErrProductNotFound,
+		scanIntoProduct,
+		queryUpdateProduct,
+		data.Name,
+		data.Description,
+		data.Price,
+		data.CategoryID,
+		id,
+	)
 	if err != nil {
 		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23503" {
 			return nil, ErrCategoryNotFound
@@ -119,51 +125,50 @@ func (s *ProductStore) Update(id int, data models.ProductReq) (*models.Product,
 		return nil, err
 	}
 
-	if rows.Next() {
-		return scanIntoProduct(rows)
+	if product.Price != oldPrice {
+		err := insertEvent(ctx, tx, models.EventProductPriceChanged, models.ProductPriceChanged{
+			ProductID: id,
+			OldPrice:  oldPrice,
+			NewPrice:  product.Price,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 
-	return nil, err
+	return product, nil
 }
 
-func (s *ProductStore) GetByIDs(ids ...int) (map[int]models.Product, error) {
-	params := make([]string, len(ids))
-	for i := range ids {
-		params[i] = fmt.Sprintf("$%d", i+1)
-	}
-	query := fmt.Sprintf("SELECT * FROM PRODUCTS WHERE ID IN (%s)", strings.Join(params, ","))
+func (s *ProductStore) GetByIDs(ctx context.Context, ids ...int) (map[int]models.Product, error) {
+	return getProductsByIDs(ctx, s.db, ids...)
+}
 
-	values := make([]interface{}, len(ids))
+func getProductsByIDs(ctx context.Context, q querier, ids ...int) (map[int]models.Product, error) {
+	values := make([]int64, len(ids))
 	for i, v := range ids {
-		values[i] = v
+		values[i] = int64(v)
 	}
 
-	stmt, err := s.db.Prepare(query)
+	list, err := queryAll(ctx, q, scanIntoProduct, queryProductsByIDs, pq.Array(values))
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := stmt.Query(values...)
-	if err != nil {
-		return nil, err
-	}
-
-	products := make(map[int]models.Product)
-	for rows.Next() {
-		p, err := scanIntoProduct(rows)
-		if err != nil {
-			return nil, err
-		}
-
+	products := make(map[int]models.Product, len(list))
+	for _, p := range list {
 		products[p.ID] = *p
 	}
 
 	return products, nil
 }
 
-func scanIntoProduct(rows *sql.Rows) (*models.Product, error) {
+func scanIntoProduct(row scanner) (*models.Product, error) {
 	product := &models.Product{}
-	err := rows.Scan(
+	err := row.Scan(
 		&product.ID,
 		&product.Name,
 		&product.Description,
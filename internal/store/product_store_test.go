@@ -0,0 +1,53 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/store/pgtest"
+)
+
+func TestProductStoreUnknownCategory(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	categories := store.NewCategoryStore(db)
+	products := store.NewProductStore(db)
+
+	category, err := categories.Create(ctx, models.CategoryReq{Name: "Books"})
+	if err != nil {
+		t.Fatalf("create category: %s", err)
+	}
+
+	_, err = products.Create(ctx, models.ProductReq{Name: "Orphan", Price: 1, CategoryID: category.ID + 1})
+	if !errors.Is(err, store.ErrCategoryNotFound) {
+		t.Fatalf("create with unknown category: got %v, want %v", err, store.ErrCategoryNotFound)
+	}
+
+	product, err := products.Create(ctx, models.ProductReq{Name: "Book", Price: 10, CategoryID: category.ID})
+	if err != nil {
+		t.Fatalf("create product: %s", err)
+	}
+
+	_, err = products.Update(ctx, product.ID, models.ProductReq{Name: "Book", Price: 12, CategoryID: category.ID + 1})
+	if !errors.Is(err, store.ErrCategoryNotFound) {
+		t.Fatalf("update with unknown category: got %v, want %v", err, store.ErrCategoryNotFound)
+	}
+
+	// the failed update is rolled back with its price change event
+	got, err := products.GetByID(ctx, product.ID)
+	if err != nil {
+		t.Fatalf("get product: %s", err)
+	}
+	if got.Price != 10 || got.CategoryID != category.ID {
+		t.Errorf("got product %+v after failed update, want it unchanged", got)
+	}
+
+	_, err = products.Update(ctx, product.ID+1, models.ProductReq{Name: "Book", Price: 12, CategoryID: category.ID})
+	if !errors.Is(err, store.ErrProductNotFound) {
+		t.Errorf("update unknown product: got %v, want %v", err, store.ErrProductNotFound)
+	}
+}
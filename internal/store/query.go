@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// statements lists every static query issued by the stores. They are
+// prepared once when the pool is opened so broken SQL fails at startup.
+var statements = [][]string{
+	userQueries,
+	authQueries,
+	categoryQueries,
+	productQueries,
+	orderQueries,
+	healthQueries,
+	idempotencyQueries,
+	rateLimitQueries,
+	loginAttemptQueries,
+	twoFactorQueries,
+	identityQueries,
+	apiKeyQueries,
+	sessionQueries,
+	emailChangeQueries,
+	accountDeletionQueries,
+	personalDataQueries,
+	auditQueries,
+	outboxQueries,
+	webhookQueries,
+	jobQueries,
+	notificationQueries,
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// DB wraps a connection pool with a cache of prepared statements shared by
+// every store, so a statement is prepared once instead of on every request.
+type DB struct {
+	conn *sql.DB
+
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func NewDB(conn *sql.DB) *DB {
+	return &DB{
+		conn:  conn,
+		stmts: make(map[string]*sql.Stmt),
+	}
+}
+
+// Prepare prepares and caches all static store queries.
+func (db *DB) Prepare(ctx context.Context) error {
+	for _, queries := range statements {
+		for _, query := range queries {
+			if _, err := db.stmt(ctx, query); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) stmt(ctx context.Context, query string) (*sql.Stmt, error) {
+	db.mu.RLock()
+	stmt, ok := db.stmts[query]
+	db.mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if stmt, ok := db.stmts[query]; ok {
+		return stmt, nil
+	}
+
+	stmt, err := db.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	db.stmts[query] = stmt
+
+	return stmt, nil
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := db.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	stmt, err := db.stmt(ctx, query)
+	if err != nil {
+		// sql.Row can only carry an error produced by the driver, so fall
+		// back to an unprepared query which reports the same failure on Scan.
+		return db.conn.QueryRowContext(ctx, query, args...)
+	}
+
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := db.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.conn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{tx: tx, db: db}, nil
+}
+
+func (db *DB) PingContext(ctx context.Context) error {
+	return db.conn.PingContext(ctx)
+}
+
+func (db *DB) Stats() sql.DBStats {
+	return db.conn.Stats()
+}
+
+// Close closes every cached statement and then the underlying pool.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	for query, stmt := range db.stmts {
+		stmt.Close()
+		delete(db.stmts, query)
+	}
+	db.mu.Unlock()
+
+	return db.conn.Close()
+}
+
+// Tx runs cached statements inside a transaction.
+type Tx struct {
+	tx *sql.Tx
+	db *DB
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := tx.db.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.tx.StmtContext(ctx, stmt).QueryContext(ctx, args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	stmt, err := tx.db.stmt(ctx, query)
+	if err != nil {
+		return tx.tx.QueryRowContext(ctx, query, args...)
+	}
+
+	return tx.tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := tx.db.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+}
+
+func (tx *Tx) Commit() error {
+	return tx.tx.Commit()
+}
+
+func (tx *Tx) Rollback() error {
+	return tx.tx.Rollback()
+}
+
+// queryOne runs a query expected to return a single row and maps an empty
+// result to notFound.
+func queryOne[T any](ctx context.Context, q querier, notFound error, scan func(scanner) (T, error), query string, args ...any) (T, error) {
+	v, err := scan(q.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		var zero T
+		if errors.Is(err, sql.ErrNoRows) {
+			return zero, notFound
+		}
+
+		return zero, err
+	}
+
+	return v, nil
+}
+
+// queryAll scans every row returned by query and always closes the result set.
+func queryAll[T any](ctx context.Context, q querier, scan func(scanner) (T, error), query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, v)
+	}
+
+	return items, rows.Err()
+}
+
+// execOne runs a statement expected to affect at least one row and maps no
+// affected rows to notFound.
+func execOne(ctx context.Context, q querier, notFound error, query string, args ...any) error {
+	res, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return notFound
+	}
+
+	return nil
+}
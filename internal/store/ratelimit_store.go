@@ -0,0 +1,171 @@
+package store
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+)
+
+const (
+	queryCreateRateLimitBucket = `
+		INSERT INTO RATE_LIMIT_BUCKETS(KEY, TOKENS, UPDATED_AT) VALUES($1, $2, NOW())
+		ON CONFLICT (KEY) DO NOTHING
+	`
+	queryLockRateLimitBucket = `
+		SELECT TOKENS, UPDATED_AT, NOW() FROM RATE_LIMIT_BUCKETS WHERE KEY = $1 FOR UPDATE
+	`
+	queryUpdateRateLimitBucket = `
+		UPDATE RATE_LIMIT_BUCKETS SET TOKENS = $1, UPDATED_AT = $2 WHERE KEY = $3
+	`
+	queryDeleteStaleRateLimitBuckets = `
+		DELETE FROM RATE_LIMIT_BUCKETS WHERE UPDATED_AT < $1
+	`
+)
+
+var rateLimitQueries = []string{
+	queryCreateRateLimitBucket,
+	queryLockRateLimitBucket,
+	queryUpdateRateLimitBucket,
+	queryDeleteStaleRateLimitBuckets,
+}
+
+type RateLimitStorer interface {
+	// Take takes a token from the bucket of key, creating a full bucket if
+	// there is none.
+	Take(ctx context.Context, key string, limit models.RateLimit) (models.RateLimitResult, error)
+	// DeleteStale deletes buckets untouched since before, buckets that are
+	// full again behave the same as missing ones.
+	DeleteStale(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RateLimitStore keeps the buckets in Postgres so replicas share limits.
+type RateLimitStore struct {
+	db *DB
+}
+
+func NewRateLimitStore(db *DB) *RateLimitStore {
+	return &RateLimitStore{
+		db: db,
+	}
+}
+
+func (s *RateLimitStore) Take(ctx context.Context, key string, limit models.RateLimit) (models.RateLimitResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.RateLimitResult{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, queryCreateRateLimitBucket, key, limit.Burst); err != nil {
+		return models.RateLimitResult{}, err
+	}
+
+	var (
+		tokens    float64
+		updatedAt time.Time
+		now       time.Time
+	)
+	if err := tx.QueryRowContext(ctx, queryLockRateLimitBucket, key).Scan(&tokens, &updatedAt, &now); err != nil {
+		return models.RateLimitResult{}, err
+	}
+
+	tokens, res := takeToken(tokens, updatedAt, now, limit)
+	if _, err := tx.ExecContext(ctx, queryUpdateRateLimitBucket, tokens, now, key); err != nil {
+		return models.RateLimitResult{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.RateLimitResult{}, err
+	}
+
+	return res, nil
+}
+
+func (s *RateLimitStore) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, queryDeleteStaleRateLimitBuckets, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// LocalRateLimitStore keeps the buckets in process, every replica limits
+// on its own.
+type LocalRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]bucket
+}
+
+func NewLocalRateLimitStore() *LocalRateLimitStore {
+	return &LocalRateLimitStore{
+		buckets: make(map[string]bucket),
+	}
+}
+
+func (s *LocalRateLimitStore) Take(ctx context.Context, key string, limit models.RateLimit) (models.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = bucket{tokens: float64(limit.Burst), updatedAt: now}
+	}
+
+	tokens, res := takeToken(b.tokens, b.updatedAt, now, limit)
+	s.buckets[key] = bucket{tokens: tokens, updatedAt: now}
+
+	return res, nil
+}
+
+func (s *LocalRateLimitStore) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for key, b := range s.buckets {
+		if b.updatedAt.Before(before) {
+			delete(s.buckets, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// takeToken refills a bucket that held tokens at updatedAt up to now and
+// takes one token from it if it can. It returns the tokens left.
+func takeToken(tokens float64, updatedAt, now time.Time, limit models.RateLimit) (float64, models.RateLimitResult) {
+	burst := float64(limit.Burst)
+	perSecond := burst / limit.Period.Seconds()
+
+	if elapsed := now.Sub(updatedAt).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*perSecond)
+	}
+
+	res := models.RateLimitResult{Limit: limit.Burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / perSecond)
+	}
+
+	res.Remaining = int(tokens)
+	res.Reset = seconds((burst - tokens) / perSecond)
+
+	return tokens, res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+var ErrSessionNotFound = errors.New("session not found or revoked")
+
+const sessionColumns = `ID, USER_ID, CREATED_AT, EXPIRES_AT`
+
+const (
+	queryCreateSession = `
+		INSERT INTO USER_SESSIONS(ID, USER_ID, EXPIRES_AT) VALUES($1, $2, $3)
+	`
+	querySessionByID = `
+		SELECT ` + sessionColumns + ` FROM USER_SESSIONS WHERE ID = $1 AND EXPIRES_AT > NOW()
+	`
+	queryDeleteOtherSessions = `
+		DELETE FROM USER_SESSIONS WHERE USER_ID = $1 AND ID <> $2
+	`
+	queryDeleteUserSessions = `
+		DELETE FROM USER_SESSIONS WHERE USER_ID = $1
+	`
+	queryDeleteExpiredSessions = `
+		DELETE FROM USER_SESSIONS WHERE EXPIRES_AT <= NOW()
+	`
+)
+
+var sessionQueries = []string{
+	queryCreateSession,
+	querySessionByID,
+	queryDeleteOtherSessions,
+	queryDeleteUserSessions,
+	queryDeleteExpiredSessions,
+}
+
+type SessionStorer interface {
+	Create(ctx context.Context, session models.Session) error
+	// Get returns the session unless it expired or was revoked.
+	Get(ctx context.Context, id string) (*models.Session, error)
+	// RevokeOthers revokes every session of the user except keepID.
+	RevokeOthers(ctx context.Context, userID int, keepID string) (int64, error)
+	RevokeAll(ctx context.Context, userID int) (int64, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type SessionStore struct {
+	db *DB
+}
+
+func NewSessionStore(db *DB) *SessionStore {
+	return &SessionStore{
+		db: db,
+	}
+}
+
+func (s *SessionStore) Create(ctx context.Context, session models.Session) error {
+	_, err := s.db.ExecContext(ctx, queryCreateSession, session.ID, session.UserID, session.ExpiresAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrUserNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *SessionStore) Get(ctx context.Context, id string) (*models.Session, error) {
+	return queryOne(ctx, s.db, ErrSessionNotFound, scanIntoSession, querySessionByID, id)
+}
+
+func (s *SessionStore) RevokeOthers(ctx context.Context, userID int, keepID string) (int64, error) {
+	return s.delete(ctx, queryDeleteOtherSessions, userID, keepID)
+}
+
+func (s *SessionStore) RevokeAll(ctx context.Context, userID int) (int64, error) {
+	return s.delete(ctx, queryDeleteUserSessions, userID)
+}
+
+func (s *SessionStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return s.delete(ctx, queryDeleteExpiredSessions)
+}
+
+func (s *SessionStore) delete(ctx context.Context, query string, args ...any) (int64, error) {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func scanIntoSession(row scanner) (*models.Session, error) {
+	session := &models.Session{}
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+	)
+
+	return session, err
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrTwoFactorNotFound       = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor authentication code")
+)
+
+const twoFactorColumns = `USER_ID, SECRET, RECOVERY_CODES, LAST_USED_STEP, ENABLED_AT, CREATED_AT`
+
+const (
+	queryTwoFactorByUserID = `
+		SELECT ` + twoFactorColumns + ` FROM USER_TWO_FACTOR WHERE USER_ID = $1
+	`
+	// enrolling again replaces a secret that was never confirmed, but not
+	// an enabled one
+	queryEnrollTwoFactor = `
+		INSERT INTO USER_TWO_FACTOR(USER_ID, SECRET) VALUES($1, $2)
+		ON CONFLICT (USER_ID) DO UPDATE SET SECRET = EXCLUDED.SECRET, CREATED_AT = NOW()
+		WHERE USER_TWO_FACTOR.ENABLED_AT IS NULL
+		RETURNING ` + twoFactorColumns
+	queryEnableTwoFactor = `
+		UPDATE USER_TWO_FACTOR SET ENABLED_AT = NOW(), LAST_USED_STEP = $1, RECOVERY_CODES = $2
+		WHERE USER_ID = $3 AND ENABLED_AT IS NULL
+	`
+	queryUseTwoFactorStep = `
+		UPDATE USER_TWO_FACTOR SET LAST_USED_STEP = $1 WHERE USER_ID = $2 AND LAST_USED_STEP < $1
+	`
+	queryUseRecoveryCode = `
+		UPDATE USER_TWO_FACTOR SET RECOVERY_CODES = ARRAY_REMOVE(RECOVERY_CODES, $1)
+		WHERE USER_ID = $2 AND $1 = ANY(RECOVERY_CODES)
+	`
+	querySetRecoveryCodes = `
+		UPDATE USER_TWO_FACTOR SET RECOVERY_CODES = $1 WHERE USER_ID = $2 AND ENABLED_AT IS NOT NULL
+	`
+	queryDeleteTwoFactor = `
+		DELETE FROM USER_TWO_FACTOR WHERE USER_ID = $1
+	`
+)
+
+var twoFactorQueries = []string{
+	queryTwoFactorByUserID,
+	queryEnrollTwoFactor,
+	queryEnableTwoFactor,
+	queryUseTwoFactorStep,
+	queryUseRecoveryCode,
+	querySetRecoveryCodes,
+	queryDeleteTwoFactor,
+}
+
+type TwoFactorStorer interface {
+	Get(ctx context.Context, userID int) (*models.TwoFactor, error)
+	// Enroll stores a new, not yet enabled secret for the user.
+	Enroll(ctx context.Context, userID int, secret string) (*models.TwoFactor, error)
+	// Enable enables the enrollment once the user proved it with the code
+	// of step.
+	Enable(ctx context.Context, userID int, step int64, recoveryCodes []string) error
+	// UseStep marks the code of step as used, failing with
+	// ErrInvalidTwoFactorCode if it or a later one already was.
+	UseStep(ctx context.Context, userID int, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int, hash string) error
+	SetRecoveryCodes(ctx context.Context, userID int, hashes []string) error
+	Delete(ctx context.Context, userID int) error
+}
+
+type TwoFactorStore struct {
+	db *DB
+}
+
+func NewTwoFactorStore(db *DB) *TwoFactorStore {
+	return &TwoFactorStore{
+		db: db,
+	}
+}
+
+func (s *TwoFactorStore) Get(ctx context.Context, userID int) (*models.TwoFactor, error) {
+	return queryOne(ctx, s.db, ErrTwoFactorNotFound, scanIntoTwoFactor, queryTwoFactorByUserID, userID)
+}
+
+func (s *TwoFactorStore) Enroll(ctx context.Context, userID int, secret string) (*models.TwoFactor, error) {
+	tf, err := queryOne(ctx, s.db, ErrTwoFactorAlreadyEnabled, scanIntoTwoFactor, queryEnrollTwoFactor, userID, secret)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return nil, ErrUserNotFound
+		}
+
+		return nil, err
+	}
+
+	return tf, nil
+}
+
+func (s *TwoFactorStore) Enable(ctx context.Context, userID int, step int64, recoveryCodes []string) error {
+	return execOne(ctx, s.db, ErrTwoFactorNotFound, queryEnableTwoFactor, step, pq.Array(recoveryCodes), userID)
+}
+
+func (s *TwoFactorStore) UseStep(ctx context.Context, userID int, step int64) error {
+	return execOne(ctx, s.db, ErrInvalidTwoFactorCode, queryUseTwoFactorStep, step, userID)
+}
+
+func (s *TwoFactorStore) UseRecoveryCode(ctx context.Context, userID int, hash string) error {
+	return execOne(ctx, s.db, ErrInvalidTwoFactorCode, queryUseRecoveryCode, hash, userID)
+}
+
+func (s *TwoFactorStore) SetRecoveryCodes(ctx context.Context, userID int, hashes []string) error {
+	return execOne(ctx, s.db, ErrTwoFactorNotFound, querySetRecoveryCodes, pq.Array(hashes), userID)
+}
+
+func (s *TwoFactorStore) Delete(ctx context.Context, userID int) error {
+	return execOne(ctx, s.db, ErrTwoFactorNotFound, queryDeleteTwoFactor, userID)
+}
+
+func scanIntoTwoFactor(row scanner) (*models.TwoFactor, error) {
+	tf := &models.TwoFactor{}
+	err := row.Scan(
+		&tf.UserID,
+		&tf.Secret,
+		pq.Array(&tf.RecoveryCodes),
+		&tf.LastUsedStep,
+		&tf.EnabledAt,
+		&tf.CreatedAt,
+	)
+
+	return tf, err
+}
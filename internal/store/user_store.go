@@ -1,12 +1,13 @@
 package store
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/pkg/password"
 	"github.com/lib/pq"
 )
 
@@ -14,77 +15,72 @@ var (
 	ErrUserNotFound = errors.New("user not found")
 )
 
+const userColumns = `ID, EMAIL, FIRST_NAME, LAST_NAME, DATE_OF_BIRTH, PASSWORD, ROLE, CREATED_AT, UPDATED_AT`
+
+const (
+	queryUserByID = `
+		SELECT ` + userColumns + ` FROM USERS WHERE ID = $1
+	`
+	queryUserByEmail = `
+		SELECT ` + userColumns + ` FROM USERS WHERE EMAIL = $1
+	`
+	queryUpdateUser = `
+		UPDATE USERS
+		SET
+			EMAIL = $1,
+			FIRST_NAME = $2,
+			LAST_NAME = $3,
+			DATE_OF_BIRTH = $4
+		WHERE ID = $5
+		RETURNING ` + userColumns
+	queryDeleteUser = `
+		DELETE FROM USERS WHERE ID = $1
+	`
+	querySetUserRole = `
+		UPDATE USERS SET ROLE = $1 WHERE ID = $2
+	`
+	querySetUserPassword = `
+		UPDATE USERS SET PASSWORD = $1 WHERE ID = $2
+	`
+)
+
+var userQueries = []string{
+	queryUserByID,
+	queryUserByEmail,
+	queryUpdateUser,
+	queryDeleteUser,
+	querySetUserRole,
+	querySetUserPassword,
+}
+
 type UserStorer interface {
-	GetByID(id int) (*models.User, error)
-	Update(id int, data models.UpdateUserReq) (*models.User, error)
-	Delete(id int) error
+	GetByID(ctx context.Context, id int) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	Update(ctx context.Context, id int, data models.UpdateUserReq) (*models.User, error)
+	// SetPassword hashes and stores the new password of the user.
+	SetPassword(ctx context.Context, id int, pw string) error
+	Delete(ctx context.Context, id int) error
 }
 
 type UserStore struct {
-	db *sql.DB
+	db *DB
 }
 
-func NewUserStore(db *sql.DB) *UserStore {
+func NewUserStore(db *DB) *UserStore {
 	return &UserStore{
 		db: db,
 	}
 }
 
-func (s *UserStore) GetByID(id int) (*models.User, error) {
-	stmt, err := s.db.Prepare(`
-		SELECT * FROM USERS WHERE ID = $1
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := stmt.Query(id)
-	if err != nil {
-		return nil, err
-	}
-
-	if rows.Next() {
-		return scanIntoUser(rows)
-	}
-
-	return nil, ErrUserNotFound
+func (s *UserStore) GetByID(ctx context.Context, id int) (*models.User, error) {
+	return queryOne(ctx, s.db, ErrUserNotFound, scanIntoUser, queryUserByID, id)
 }
 
-func (s *UserStore) GetByEmail(email string) (*models.User, error) {
-	stmt, err := s.db.Prepare(`
-		SELECT * FROM USERS WHERE EMAIL = $1
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	rows, err := stmt.Query(email)
-	if err != nil {
-		return nil, err
-	}
-
-	if rows.Next() {
-		return scanIntoUser(rows)
-	}
-
-	return nil, ErrUserNotFound
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return queryOne(ctx, s.db, ErrUserNotFound, scanIntoUser, queryUserByEmail, email)
 }
 
-func (s *UserStore) Update(id int, data models.UpdateUserReq) (*models.User, error) {
-	stmt, err := s.db.Prepare(`
-		UPDATE USERS 
-		SET 
-			EMAIL = $1,
-			FIRST_NAME = $2,
-			LAST_NAME = $3,
-			DATE_OF_BIRTH = $4
-		WHERE ID = $5
-		RETURNING *
-	`)
-	if err != nil {
-		return nil, err
-	}
-
+func (s *UserStore) Update(ctx context.Context, id int, data models.UpdateUserReq) (*models.User, error) {
 	var birthdate *time.Time
 	if data.DateOfBirth != "" {
 		pb, err := time.Parse("2006-01-02", data.DateOfBirth)
@@ -95,7 +91,12 @@ func (s *UserStore) Update(id int, data models.UpdateUserReq) (*models.User, err
 		birthdate = &pb
 	}
 
-	rows, err := stmt.Query(
+	user, err := queryOne(
+		ctx,
+		s.db,
+		ErrUserNotFound,
+		scanIntoUser,
+		queryUpdateUser,
 		data.Email,
 		data.FirstName,
 		data.LastName,
@@ -117,45 +118,36 @@ func (s *UserStore) Update(id int, data models.UpdateUserReq) (*models.User, err
 		return nil, err
 	}
 
-	if rows.Next() {
-		return scanIntoUser(rows)
-	}
-
-	return nil, err
+	return user, nil
 }
 
-func (s *UserStore) Delete(id int) error {
-	if _, err := s.GetByID(id); err != nil {
-		return err
+// Delete deletes a user without orders. Users with orders fail with
+// ErrUserHasOrders, they are anonymized through AccountDeletionStorer.
+func (s *UserStore) Delete(ctx context.Context, id int) error {
+	err := execOne(ctx, s.db, ErrUserNotFound, queryDeleteUser, id)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+		return ErrUserHasOrders
 	}
 
-	stmt, err := s.db.Prepare(`
-		DELETE FROM USERS WHERE ID = $1
-	`)
-	if err != nil {
-		return err
-	}
+	return err
+}
 
-	res, err := stmt.Exec(id)
-	if err != nil {
-		return err
-	}
+func (s *UserStore) SetRole(ctx context.Context, id int, role string) error {
+	return execOne(ctx, s.db, ErrUserNotFound, querySetUserRole, role, id)
+}
 
-	rowsAffected, err := res.RowsAffected()
+func (s *UserStore) SetPassword(ctx context.Context, id int, pw string) error {
+	hashedPass, err := password.HashPassword(pw)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("user cannot be deleted because it doesn't exist")
-	}
-
-	return err
+	return execOne(ctx, s.db, ErrUserNotFound, querySetUserPassword, hashedPass, id)
 }
 
-func scanIntoUser(rows *sql.Rows) (*models.User, error) {
+func scanIntoUser(row scanner) (*models.User, error) {
 	u := &models.User{}
-	err := rows.Scan(
+	err := row.Scan(
 		&u.ID,
 		&u.Email,
 		&u.FirstName,
@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/escoutdoor/ecommerce/internal/store"
+	"github.com/escoutdoor/ecommerce/internal/store/pgtest"
+)
+
+func TestUserStoreUpdateTakenEmail(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	users := store.NewUserStore(db)
+	jane := registerUser(t, db, "jane@example.com")
+	registerUser(t, db, "john@example.com")
+
+	_, err := users.Update(ctx, jane.ID, models.UpdateUserReq{Email: "john@example.com", FirstName: "Jane"})
+	if !errors.Is(err, store.ErrEmailAlreadyExists) {
+		t.Fatalf("update to taken email: got %v, want %v", err, store.ErrEmailAlreadyExists)
+	}
+
+	updated, err := users.Update(ctx, jane.ID, models.UpdateUserReq{Email: "jane@example.com", FirstName: "Janet"})
+	if err != nil {
+		t.Fatalf("update: %s", err)
+	}
+	if updated.FirstName != "Janet" {
+		t.Errorf("got first name %q, want Janet", updated.FirstName)
+	}
+
+	_, err = users.Update(ctx, jane.ID+100, models.UpdateUserReq{Email: "nobody@example.com", FirstName: "Nobody"})
+	if !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("update unknown user: got %v, want %v", err, store.ErrUserNotFound)
+	}
+}
+
+func TestAuthStoreRegisterAdmin(t *testing.T) {
+	db := pgtest.New(t)
+	ctx := context.Background()
+
+	admin, err := store.NewAuthStore(db).RegisterAdmin(ctx, models.RegisterReq{
+		Email:     "admin@example.com",
+		FirstName: "Admin",
+		Password:  "Passw0rd!23",
+	})
+	if err != nil {
+		t.Fatalf("register admin: %s", err)
+	}
+
+	stored, err := store.NewUserStore(db).GetByEmail(ctx, "admin@example.com")
+	if err != nil {
+		t.Fatalf("get admin: %s", err)
+	}
+	if admin.Role != "admin" || stored.Role != "admin" {
+		t.Errorf("got roles %q and %q, want admin", admin.Role, stored.Role)
+	}
+}
+
+func registerUser(t *testing.T, db *store.DB, email string) *models.User {
+	t.Helper()
+
+	user, err := store.NewAuthStore(db).Register(context.Background(), models.RegisterReq{
+		Email:     email,
+		FirstName: "Test",
+		Password:  "Passw0rd!23",
+	})
+	if err != nil {
+		t.Fatalf("register %s: %s", email, err)
+	}
+
+	return user
+}
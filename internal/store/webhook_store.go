@@ -0,0 +1,297 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/internal/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrWebhookNotFound         = errors.New("webhook not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+const (
+	webhookColumns         = `ID, URL, SECRET, EVENT_TYPES, ACTIVE, CREATED_AT, UPDATED_AT`
+	webhookDeliveryColumns = `
+		ID, WEBHOOK_ID, EVENT_ID, EVENT_TYPE, PAYLOAD, STATUS, ATTEMPTS,
+		CASE WHEN STATUS = 'pending' THEN NEXT_ATTEMPT_AT END,
+		LAST_STATUS_CODE, LAST_ERROR, CREATED_AT, DELIVERED_AT
+	`
+)
+
+const (
+	queryCreateWebhook = `
+		INSERT INTO WEBHOOKS(URL, SECRET, EVENT_TYPES, ACTIVE)
+		VALUES($1, $2, $3, $4)
+		RETURNING ` + webhookColumns
+	queryWebhookByID = `
+		SELECT ` + webhookColumns + ` FROM WEBHOOKS WHERE ID = $1
+	`
+	queryListWebhooks = `
+		SELECT ` + webhookColumns + ` FROM WEBHOOKS ORDER BY ID
+	`
+	queryUpdateWebhook = `
+		UPDATE WEBHOOKS SET
+			URL = $1,
+			EVENT_TYPES = $2,
+			ACTIVE = COALESCE($3, ACTIVE),
+			UPDATED_AT = NOW()
+		WHERE ID = $4
+		RETURNING ` + webhookColumns
+	queryDeleteWebhook = `
+		DELETE FROM WEBHOOKS WHERE ID = $1
+	`
+	queryEnqueueWebhookDeliveries = `
+		INSERT INTO WEBHOOK_DELIVERIES(WEBHOOK_ID, EVENT_ID, EVENT_TYPE, PAYLOAD)
+		SELECT ID, $1, $2, $3 FROM WEBHOOKS WHERE ACTIVE AND $2 = ANY(EVENT_TYPES)
+		ON CONFLICT (WEBHOOK_ID, EVENT_ID) DO NOTHING
+	`
+	// deliveries of inactive webhooks wait until they are activated again
+	queryClaimWebhookDeliveries = `
+		UPDATE WEBHOOK_DELIVERIES SET
+			ATTEMPTS = ATTEMPTS + 1,
+			NEXT_ATTEMPT_AT = NOW() + MAKE_INTERVAL(SECS => $2)
+		WHERE ID IN (
+			SELECT ID FROM WEBHOOK_DELIVERIES
+			WHERE STATUS = 'pending' AND NEXT_ATTEMPT_AT <= NOW()
+				AND WEBHOOK_ID IN (SELECT ID FROM WEBHOOKS WHERE ACTIVE)
+			ORDER BY ID
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns
+	queryWebhookDeliverySucceeded = `
+		UPDATE WEBHOOK_DELIVERIES SET
+			STATUS = 'succeeded',
+			LAST_STATUS_CODE = $2,
+			LAST_ERROR = '',
+			DELIVERED_AT = NOW()
+		WHERE ID = $1
+	`
+	// without a time for the next attempt the delivery is dead
+	queryWebhookDeliveryFailed = `
+		UPDATE WEBHOOK_DELIVERIES SET
+			STATUS = CASE WHEN $4::TIMESTAMPTZ IS NULL THEN 'dead' ELSE 'pending' END::WEBHOOK_DELIVERY_STATUS,
+			NEXT_ATTEMPT_AT = COALESCE($4, NEXT_ATTEMPT_AT),
+			LAST_STATUS_CODE = $2,
+			LAST_ERROR = $3
+		WHERE ID = $1 AND STATUS = 'pending'
+	`
+	queryListWebhookDeliveries = `
+		SELECT ` + webhookDeliveryColumns + ` FROM WEBHOOK_DELIVERIES
+		WHERE WEBHOOK_ID = $1
+			AND ($2::TEXT = '' OR STATUS::TEXT = $2)
+			AND ($3::BIGINT = 0 OR ID < $3)
+		ORDER BY ID DESC
+		LIMIT $4
+	`
+	queryRedeliverWebhookDelivery = `
+		UPDATE WEBHOOK_DELIVERIES SET
+			STATUS = 'pending',
+			ATTEMPTS = 0,
+			NEXT_ATTEMPT_AT = NOW(),
+			DELIVERED_AT = NULL
+		WHERE ID = $1 AND WEBHOOK_ID = $2
+		RETURNING ` + webhookDeliveryColumns
+)
+
+var webhookQueries = []string{
+	queryCreateWebhook,
+	queryWebhookByID,
+	queryListWebhooks,
+	queryUpdateWebhook,
+	queryDeleteWebhook,
+	queryEnqueueWebhookDeliveries,
+	queryClaimWebhookDeliveries,
+	queryWebhookDeliverySucceeded,
+	queryWebhookDeliveryFailed,
+	queryListWebhookDeliveries,
+	queryRedeliverWebhookDelivery,
+}
+
+type WebhookStorer interface {
+	Create(ctx context.Context, webhook models.Webhook) (*models.Webhook, error)
+	GetByID(ctx context.Context, id int) (*models.Webhook, error)
+	List(ctx context.Context) ([]models.Webhook, error)
+	// Update keeps the active flag if data leaves it out.
+	Update(ctx context.Context, id int, data models.WebhookReq) (*models.Webhook, error)
+	Delete(ctx context.Context, id int) error
+
+	// Enqueue adds a delivery of e for every active webhook subscribed to
+	// its type, once per webhook however often e is enqueued.
+	Enqueue(ctx context.Context, e models.Event, payload []byte) error
+	// Claim returns up to limit pending deliveries that are due, oldest
+	// first, counts the attempt and hides them from other claims for lease.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	Succeeded(ctx context.Context, id int64, statusCode int) error
+	// Failed records the failed attempt, statusCode is 0 without a
+	// response. The delivery is tried again at retryAt, or is dead if
+	// retryAt is nil.
+	Failed(ctx context.Context, id int64, statusCode int, reason string, retryAt *time.Time) error
+	// Deliveries returns the deliveries of the webhook, newest first.
+	Deliveries(ctx context.Context, webhookID int, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error)
+	// Redeliver makes the delivery pending and due again, with all of its
+	// attempts left.
+	Redeliver(ctx context.Context, webhookID int, id int64) (*models.WebhookDelivery, error)
+}
+
+type WebhookStore struct {
+	db *DB
+}
+
+func NewWebhookStore(db *DB) *WebhookStore {
+	return &WebhookStore{
+		db: db,
+	}
+}
+
+func (s *WebhookStore) Create(ctx context.Context, webhook models.Webhook) (*models.Webhook, error) {
+	return queryOne(
+		ctx,
+		s.db,
+		ErrWebhookNotFound,
+		scanIntoWebhook,
+		queryCreateWebhook,
+		webhook.URL,
+		webhook.Secret,
+		pq.Array(webhook.EventTypes),
+		webhook.Active,
+	)
+}
+
+func (s *WebhookStore) GetByID(ctx context.Context, id int) (*models.Webhook, error) {
+	return queryOne(ctx, s.db, ErrWebhookNotFound, scanIntoWebhook, queryWebhookByID, id)
+}
+
+func (s *WebhookStore) List(ctx context.Context) ([]models.Webhook, error) {
+	webhooks, err := queryAll(ctx, s.db, scanIntoWebhook, queryListWebhooks)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Webhook, 0, len(webhooks))
+	for _, w := range webhooks {
+		list = append(list, *w)
+	}
+
+	return list, nil
+}
+
+func (s *WebhookStore) Update(ctx context.Context, id int, data models.WebhookReq) (*models.Webhook, error) {
+	return queryOne(
+		ctx,
+		s.db,
+		ErrWebhookNotFound,
+		scanIntoWebhook,
+		queryUpdateWebhook,
+		data.URL,
+		pq.Array(data.EventTypes),
+		data.Active,
+		id,
+	)
+}
+
+func (s *WebhookStore) Delete(ctx context.Context, id int) error {
+	return execOne(ctx, s.db, ErrWebhookNotFound, queryDeleteWebhook, id)
+}
+
+func (s *WebhookStore) Enqueue(ctx context.Context, e models.Event, payload []byte) error {
+	_, err := s.db.ExecContext(ctx, queryEnqueueWebhookDeliveries, e.ID, e.Type, string(payload))
+	return err
+}
+
+func (s *WebhookStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	deliveries, err := s.deliveries(ctx, queryClaimWebhookDeliveries, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+
+	return deliveries, nil
+}
+
+func (s *WebhookStore) Succeeded(ctx context.Context, id int64, statusCode int) error {
+	_, err := s.db.ExecContext(ctx, queryWebhookDeliverySucceeded, id, statusCode)
+	return err
+}
+
+func (s *WebhookStore) Failed(ctx context.Context, id int64, statusCode int, reason string, retryAt *time.Time) error {
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	_, err := s.db.ExecContext(ctx, queryWebhookDeliveryFailed, id, code, reason, retryAt)
+	return err
+}
+
+func (s *WebhookStore) Deliveries(ctx context.Context, webhookID int, filter models.WebhookDeliveryFilter) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetByID(ctx, webhookID); err != nil {
+		return nil, err
+	}
+
+	return s.deliveries(ctx, queryListWebhookDeliveries, webhookID, filter.Status, filter.BeforeID, filter.Limit)
+}
+
+func (s *WebhookStore) Redeliver(ctx context.Context, webhookID int, id int64) (*models.WebhookDelivery, error) {
+	return queryOne(ctx, s.db, ErrWebhookDeliveryNotFound, scanIntoWebhookDelivery, queryRedeliverWebhookDelivery, id, webhookID)
+}
+
+func (s *WebhookStore) deliveries(ctx context.Context, query string, args ...any) ([]models.WebhookDelivery, error) {
+	deliveries, err := queryAll(ctx, s.db, scanIntoWebhookDelivery, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		list = append(list, *d)
+	}
+
+	return list, nil
+}
+
+func scanIntoWebhook(row scanner) (*models.Webhook, error) {
+	w := &models.Webhook{}
+	err := row.Scan(
+		&w.ID,
+		&w.URL,
+		&w.Secret,
+		pq.Array(&w.EventTypes),
+		&w.Active,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+
+	return w, err
+}
+
+func scanIntoWebhookDelivery(row scanner) (*models.WebhookDelivery, error) {
+	var (
+		d       = &models.WebhookDelivery{}
+		payload []byte
+	)
+	err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.EventID,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	)
+	d.Payload = payload
+
+	return d, err
+}
@@ -1,23 +1,79 @@
 package respond
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
 
+	"github.com/escoutdoor/ecommerce/pkg/password"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-playground/validator/v10"
 )
 
+const ProblemContentType = "application/problem+json"
+
+const (
+	CodeValidationFailed = "validation_failed"
+	CodeInternal         = "internal_error"
+	CodeTimeout          = "timeout"
+)
+
 var (
 	ErrUnauthorized = errors.New("unauthorized")
 	ErrForbidden    = errors.New("forbidden")
 )
 
-type ApiError struct {
-	Error string `json:"error"`
+var (
+	codesMu sync.RWMutex
+	codes   = []codedError{
+		{err: ErrUnauthorized, code: "unauthorized"},
+		{err: ErrForbidden, code: "forbidden"},
+	}
+)
+
+type codedError struct {
+	err  error
+	code string
+}
+
+// Problem is an RFC 7807 problem details document. Code is a stable,
+// machine-readable identifier clients can branch on instead of Detail.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Code     string       `json:"code"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// RegisterCode assigns a stable problem code to a sentinel error. Errors
+// wrapping err are reported with the same code.
+func RegisterCode(err error, code string) {
+	codesMu.Lock()
+	defer codesMu.Unlock()
+
+	for i, c := range codes {
+		if c.err == err {
+			codes[i].code = code
+			return
+		}
+	}
+
+	codes = append(codes, codedError{err: err, code: code})
 }
 
 func JSON(w http.ResponseWriter, status int, v any) {
@@ -27,36 +83,119 @@ func JSON(w http.ResponseWriter, status int, v any) {
 	json.NewEncoder(w).Encode(v)
 }
 
-func Error(w http.ResponseWriter, status int, err error) {
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(status)
+// Error writes err as a problem details response. The details of server
+// errors are logged with the request id and never sent to the client.
+func Error(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusGatewayTimeout
+	}
+
+	p := newProblem(r, status, codeOf(err, status))
+	switch {
+	case status == http.StatusGatewayTimeout:
+		p.Detail = "the request timed out"
+	case status >= http.StatusInternalServerError:
+		p.Detail = "an internal error occurred"
+	default:
+		p.Detail = err.Error()
+	}
+
+	if status >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %s", p.Instance, r.Method, r.URL.Path, err)
+	}
 
-	resp := ApiError{Error: err.Error()}
-	json.NewEncoder(w).Encode(resp)
+	WriteProblem(w, p)
 }
 
-func ValidationError(errors validator.ValidationErrors) error {
-	var msgs []string
+// ValidationError writes a 400 problem listing every invalid field.
+func ValidationError(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) {
+	p := newProblem(r, http.StatusBadRequest, CodeValidationFailed)
+	p.Detail = "the request body is not valid"
 
-	for _, err := range errors {
-		switch err.ActualTag() {
-		case "required":
-			msgs = append(msgs, fmt.Sprintf("field %s is a required field", err.Field()))
-		case "min":
-			if err.Kind() == reflect.String {
-				msgs = append(msgs, fmt.Sprintf("field %s should be at least %v characters long", err.Field(), err.Param()))
-				break
-			}
+	for _, err := range errs {
+		p.Errors = append(p.Errors, FieldError{
+			Field:   fieldName(err),
+			Rule:    err.ActualTag(),
+			Message: fieldMessage(err),
+		})
+	}
 
-			msgs = append(msgs, fmt.Sprintf("field %s should contain at least %v items", err.Field(), err.Param()))
-		case "max":
-			msgs = append(msgs, fmt.Sprintf("field %s should not exceed %s symbols long", err.Field(), err.Param()))
-		case "containsany":
-			msgs = append(msgs, fmt.Sprintf("field %s should contain at least one special character (%s)", err.Field(), err.Param()))
-		default:
-			msgs = append(msgs, fmt.Sprintf("field %s is not valid", err.Field()))
+	WriteProblem(w, p)
+}
+
+// WriteProblem writes an already built problem.
+func WriteProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+
+	json.NewEncoder(w).Encode(p)
+}
+
+func newProblem(r *http.Request, status int, code string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Code:     code,
+		Instance: middleware.GetReqID(r.Context()),
+	}
+}
+
+func codeOf(err error, status int) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeTimeout
+	}
+
+	codesMu.RLock()
+	defer codesMu.RUnlock()
+
+	for _, c := range codes {
+		if errors.Is(err, c.err) {
+			return c.code
 		}
 	}
 
-	return fmt.Errorf(strings.Join(msgs, ", "))
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// fieldName returns the path of the field without the name of the root
+// struct, e.g. order_items[0].quantity.
+func fieldName(err validator.FieldError) string {
+	ns := err.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+
+	return err.Field()
+}
+
+func fieldMessage(err validator.FieldError) string {
+	switch err.ActualTag() {
+	case "required":
+		return fmt.Sprintf("field %s is a required field", err.Field())
+	case "min":
+		switch err.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("field %s should be at least %v characters long", err.Field(), err.Param())
+		case reflect.Slice, reflect.Map, reflect.Array:
+			return fmt.Sprintf("field %s should contain at least %v items", err.Field(), err.Param())
+		default:
+			return fmt.Sprintf("field %s should be at least %v", err.Field(), err.Param())
+		}
+	case "max":
+		return fmt.Sprintf("field %s should not exceed %s symbols long", err.Field(), err.Param())
+	case password.Tag:
+		p := password.CurrentPolicy()
+		return fmt.Sprintf("field %s should be %d to %d characters long and not a commonly used password", err.Field(), p.MinLength, p.MaxLength)
+	case "containsany":
+		return fmt.Sprintf("field %s should contain at least one special character (%s)", err.Field(), err.Param())
+	case "email":
+		return fmt.Sprintf("field %s should be a valid email address", err.Field())
+	default:
+		return fmt.Sprintf("field %s is not valid", err.Field())
+	}
 }
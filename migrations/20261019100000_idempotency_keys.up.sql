@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys(
+    "scope" VARCHAR NOT NULL,
+    "key" VARCHAR(255) NOT NULL,
+    "method" VARCHAR(10) NOT NULL,
+    "path" TEXT NOT NULL,
+    "fingerprint" CHAR(64) NOT NULL,
+    "status" INTEGER NULL,
+    "content_type" TEXT NOT NULL DEFAULT '',
+    "body" BYTEA NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    "expires_at" TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY ("scope", "key")
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys ("expires_at");
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_attempts(
+    "key" VARCHAR(255) PRIMARY KEY,
+    "failures" INTEGER NOT NULL,
+    "last_failed_at" TIMESTAMP WITH TIME ZONE NOT NULL,
+    "locked_until" TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_last_failed_at_idx ON login_attempts ("last_failed_at");
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_two_factor(
+    "user_id" INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    "secret" TEXT NOT NULL,
+    "recovery_codes" TEXT[] NOT NULL DEFAULT '{}',
+    "last_used_step" BIGINT NOT NULL DEFAULT 0,
+    "enabled_at" TIMESTAMP WITH TIME ZONE NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
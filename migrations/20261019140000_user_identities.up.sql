@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS user_identities(
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "provider" VARCHAR NOT NULL,
+    "subject" VARCHAR NOT NULL,
+    "email" VARCHAR NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    "last_login_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE ("provider", "subject")
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_user_id_idx ON user_identities ("user_id");
+
+CREATE TABLE IF NOT EXISTS oidc_login_states(
+    "state" VARCHAR PRIMARY KEY,
+    "provider" VARCHAR NOT NULL,
+    "nonce" VARCHAR NOT NULL,
+    "code_verifier" VARCHAR NOT NULL,
+    "expires_at" TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS api_keys(
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "name" VARCHAR NOT NULL,
+    "prefix" VARCHAR UNIQUE NOT NULL,
+    "hash" VARCHAR NOT NULL,
+    "scopes" TEXT[] NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    "last_used_at" TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys ("user_id");
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS user_sessions(
+    "id" VARCHAR PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    "expires_at" TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_user_id_idx ON user_sessions ("user_id");
+
+CREATE TABLE IF NOT EXISTS email_changes(
+    "user_id" INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    "email" VARCHAR NOT NULL,
+    "token_hash" VARCHAR NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    "expires_at" TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS account_deletions;
+
+DROP INDEX IF EXISTS orders_user_id_idx;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS "fk_user";
+ALTER TABLE orders ADD CONSTRAINT "fk_user" FOREIGN KEY ("user_id")
+    REFERENCES users ("id")
+    ON DELETE SET NULL;
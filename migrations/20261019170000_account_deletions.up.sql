@@ -0,0 +1,27 @@
+-- orders are kept for accounting when their user deletes the account, the
+-- user row is anonymized instead of deleted. SET NULL could never work on
+-- the NOT NULL column, deleting a user who still has orders is refused now.
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS "fk_user";
+ALTER TABLE orders ADD CONSTRAINT "fk_user" FOREIGN KEY ("user_id")
+    REFERENCES users ("id")
+    ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS orders_user_id_idx ON orders ("user_id");
+
+CREATE TABLE IF NOT EXISTS account_deletions(
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    "requested_by" INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    "requested_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    "scheduled_for" TIMESTAMP WITH TIME ZONE NOT NULL,
+    "cancelled_by" INTEGER NULL REFERENCES users(id) ON DELETE SET NULL,
+    "cancelled_at" TIMESTAMP WITH TIME ZONE NULL,
+    "completed_at" TIMESTAMP WITH TIME ZONE NULL
+);
+
+-- a user has at most one pending deletion
+CREATE UNIQUE INDEX IF NOT EXISTS account_deletions_pending_idx ON account_deletions ("user_id")
+    WHERE "cancelled_at" IS NULL AND "completed_at" IS NULL;
+
+CREATE INDEX IF NOT EXISTS account_deletions_scheduled_for_idx ON account_deletions ("scheduled_for")
+    WHERE "cancelled_at" IS NULL AND "completed_at" IS NULL;
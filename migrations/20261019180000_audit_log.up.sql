@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS audit_log(
+    "id" BIGSERIAL PRIMARY KEY,
+    -- no foreign key, entries outlive the users they mention
+    "actor_id" INTEGER NULL,
+    "action" VARCHAR NOT NULL,
+    "entity_type" VARCHAR NOT NULL,
+    "entity_id" VARCHAR NOT NULL DEFAULT '',
+    -- JSON rather than JSONB keeps the text the hashes were computed over
+    "before" JSON NULL,
+    "after" JSON NULL,
+    "ip" VARCHAR NOT NULL,
+    "request_id" VARCHAR NOT NULL DEFAULT '',
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL,
+    "prev_hash" CHAR(64) NOT NULL,
+    "hash" CHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log ("actor_id");
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log ("entity_type", "entity_id");
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log ("created_at");
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS outbox_events(
+    "id" BIGSERIAL PRIMARY KEY,
+    "type" VARCHAR NOT NULL,
+    "data" JSONB NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    -- also pushed forward when an event is claimed, so a dispatcher that
+    -- dies while delivering only delays it
+    "next_attempt_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "last_error" VARCHAR NOT NULL DEFAULT '',
+    "delivered_at" TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbox_events_pending_idx ON outbox_events ("next_attempt_at") WHERE "delivered_at" IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_events_delivered_at_idx ON outbox_events ("delivered_at") WHERE "delivered_at" IS NOT NULL;
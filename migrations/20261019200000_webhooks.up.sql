@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS webhooks(
+    "id" SERIAL PRIMARY KEY,
+    "url" VARCHAR NOT NULL,
+    -- kept in clear text, it is needed to sign every delivery
+    "secret" VARCHAR NOT NULL,
+    "event_types" VARCHAR[] NOT NULL,
+    "active" BOOLEAN NOT NULL DEFAULT TRUE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    "updated_at" TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TYPE webhook_delivery_status AS ENUM('pending', 'succeeded', 'dead');
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+    "id" BIGSERIAL PRIMARY KEY,
+    "webhook_id" INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    "event_id" BIGINT NOT NULL,
+    "event_type" VARCHAR NOT NULL,
+    -- the body posted to the webhook, JSON rather than JSONB keeps its bytes
+    "payload" JSON NOT NULL,
+    "status" webhook_delivery_status NOT NULL DEFAULT 'pending',
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "next_attempt_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "last_status_code" INTEGER NULL,
+    "last_error" VARCHAR NOT NULL DEFAULT '',
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "delivered_at" TIMESTAMP WITH TIME ZONE NULL,
+    -- events are handed out at least once, each is delivered once per webhook
+    UNIQUE ("webhook_id", "event_id")
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries ("next_attempt_at") WHERE "status" = 'pending';
@@ -0,0 +1,22 @@
+CREATE TYPE job_status AS ENUM('queued', 'running', 'failed');
+
+-- succeeded jobs are deleted, the table only holds pending work and the
+-- failures to look into
+CREATE TABLE IF NOT EXISTS jobs(
+    "id" BIGSERIAL PRIMARY KEY,
+    "kind" VARCHAR NOT NULL,
+    "payload" JSONB NOT NULL,
+    "status" job_status NOT NULL DEFAULT 'queued',
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "max_attempts" INTEGER NOT NULL,
+    "run_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- a running job whose worker died is picked up again after this
+    "locked_until" TIMESTAMP WITH TIME ZONE NULL,
+    "last_error" VARCHAR NOT NULL DEFAULT '',
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "failed_at" TIMESTAMP WITH TIME ZONE NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_queued_idx ON jobs ("run_at") WHERE "status" = 'queued';
+CREATE INDEX IF NOT EXISTS jobs_running_idx ON jobs ("locked_until") WHERE "status" = 'running';
+CREATE INDEX IF NOT EXISTS jobs_failed_at_idx ON jobs ("failed_at") WHERE "status" = 'failed';
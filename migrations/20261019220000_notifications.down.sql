@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS notified_events;
+DROP TABLE IF EXISTS notification_preferences;
+
+-- enum values cannot be dropped, the type is created again without it
+UPDATE order_items SET "status" = 'cancelled' WHERE "status" = 'refunded';
+ALTER TYPE order_status RENAME TO order_status_old;
+CREATE TYPE order_status as ENUM('pending', 'processing', 'shipped', 'delivered', 'cancelled');
+ALTER TABLE order_items ALTER COLUMN "status" DROP DEFAULT;
+ALTER TABLE order_items ALTER COLUMN "status" TYPE order_status USING "status"::TEXT::order_status;
+ALTER TABLE order_items ALTER COLUMN "status" SET DEFAULT 'pending';
+DROP TYPE order_status_old;
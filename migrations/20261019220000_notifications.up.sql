@@ -0,0 +1,19 @@
+-- set by hand once the payment of an item was refunded
+ALTER TYPE order_status ADD VALUE IF NOT EXISTS 'refunded';
+
+-- users without a row get every notification in the default locale
+CREATE TABLE IF NOT EXISTS notification_preferences(
+    "user_id" INTEGER PRIMARY KEY REFERENCES users ("id") ON DELETE CASCADE,
+    "locale" VARCHAR NOT NULL DEFAULT '',
+    "order_placed" BOOLEAN NOT NULL DEFAULT TRUE,
+    "order_status" BOOLEAN NOT NULL DEFAULT TRUE,
+    "refunds" BOOLEAN NOT NULL DEFAULT TRUE,
+    "updated_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- events the notification emails were sent for, so an event delivered
+-- twice does not send the email twice
+CREATE TABLE IF NOT EXISTS notified_events(
+    "event_id" BIGINT PRIMARY KEY,
+    "notified_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS outbox_events_order_status_idx;
@@ -0,0 +1,5 @@
+-- the status events of one order, read by its event stream after the last
+-- event the client has seen
+CREATE INDEX IF NOT EXISTS outbox_events_order_status_idx
+    ON outbox_events ((("data"->>'order_id')::INTEGER), "id")
+    WHERE "type" = 'order.status_changed';
@@ -0,0 +1,4 @@
+-- a request holds its key only until the lease runs out, a retry takes over
+-- the key of a request that crashed instead of waiting for it to expire.
+-- keys reserved before the lease existed are free to take over.
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS "locked_until" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
@@ -0,0 +1,58 @@
+// Package apikey generates personal api keys. A key looks like
+// eck_<prefix>_<secret>, the prefix is stored in the clear to find the key
+// and show it to its owner, the whole key only as a hash.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	Scheme = "eck"
+
+	prefixBytes = 5
+	secretBytes = 20
+)
+
+var encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Generate returns a new key and its prefix.
+func Generate() (key, prefix string, err error) {
+	b := make([]byte, prefixBytes+secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	prefix = encoding.EncodeToString(b[:prefixBytes])
+	secret := encoding.EncodeToString(b[prefixBytes:])
+
+	return Scheme + "_" + prefix + "_" + secret, prefix, nil
+}
+
+// Prefix returns the prefix of key, and false if key is not formatted like
+// one.
+func Prefix(key string) (string, bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != Scheme || len(parts[1]) == 0 || len(parts[2]) == 0 {
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+// Hash returns the hash of key to store. Keys are random enough that a fast
+// hash is as good as a password hash.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify reports whether key hashes to hash, in constant time.
+func Verify(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(key)), []byte(hash)) == 1
+}
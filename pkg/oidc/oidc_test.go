@@ -0,0 +1,114 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/pkg/oidc"
+	"github.com/escoutdoor/ecommerce/pkg/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testUser = oidctest.User{
+	Subject:       "sub-1",
+	Email:         "jane@example.com",
+	EmailVerified: true,
+	GivenName:     "Jane",
+}
+
+func startIssuer(t *testing.T) (*oidctest.Issuer, *oidc.Provider) {
+	t.Helper()
+
+	iss, srv, err := oidctest.Start("client", "secret", testUser)
+	if err != nil {
+		t.Fatalf("start issuer: %s", err)
+	}
+	t.Cleanup(srv.Close)
+
+	return iss, oidc.NewProvider(oidc.Config{
+		Issuer:       iss.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+	})
+}
+
+// authorize runs the flow up to the redirect back to the client and
+// returns the code.
+func authorize(t *testing.T, iss *oidctest.Issuer, p *oidc.Provider, nonce, verifier string) string {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("auth code url: %s", err)
+	}
+
+	code, state, err := iss.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("authorize: %s", err)
+	}
+	if state != "state" {
+		t.Fatalf("got state %q back, want state", state)
+	}
+
+	return code
+}
+
+func TestExchange(t *testing.T) {
+	iss, p := startIssuer(t)
+	ctx := context.Background()
+
+	code := authorize(t, iss, p, "nonce", "verifier")
+	claims, err := p.Exchange(ctx, code, "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("exchange: %s", err)
+	}
+	if claims.Subject != testUser.Subject || claims.Email != testUser.Email || !bool(claims.EmailVerified) {
+		t.Errorf("got claims %+v, want those of %+v", claims, testUser)
+	}
+
+	// codes are single use
+	_, err = p.Exchange(ctx, code, "verifier", "nonce")
+	if !errors.Is(err, oidc.ErrInvalidGrant) {
+		t.Errorf("reused code: got %v, want %v", err, oidc.ErrInvalidGrant)
+	}
+}
+
+func TestExchangeWrongVerifier(t *testing.T) {
+	iss, p := startIssuer(t)
+
+	code := authorize(t, iss, p, "nonce", "verifier")
+	_, err := p.Exchange(context.Background(), code, "another verifier", "nonce")
+	if !errors.Is(err, oidc.ErrInvalidGrant) {
+		t.Fatalf("got %v, want %v", err, oidc.ErrInvalidGrant)
+	}
+}
+
+func TestExchangeRefusesIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		nonce  string
+		claims func(jwt.MapClaims)
+	}{
+		{name: "wrong nonce", nonce: "another nonce"},
+		{name: "wrong audience", nonce: "nonce", claims: func(c jwt.MapClaims) { c["aud"] = "another client" }},
+		{name: "wrong issuer", nonce: "nonce", claims: func(c jwt.MapClaims) { c["iss"] = "https://issuer.example.com" }},
+		{name: "expired", nonce: "nonce", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no subject", nonce: "nonce", claims: func(c jwt.MapClaims) { delete(c, "sub") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss, p := startIssuer(t)
+			iss.SetClaims(tt.claims)
+
+			code := authorize(t, iss, p, "nonce", "verifier")
+			_, err := p.Exchange(context.Background(), code, "verifier", tt.nonce)
+			if !errors.Is(err, oidc.ErrInvalidIDToken) {
+				t.Fatalf("got %v, want %v", err, oidc.ErrInvalidIDToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+// Package oidctest is a minimal OpenID Connect provider to log in against
+// in tests and during local development. It authorizes every request
+// without asking, as the user in Claims or the one named by login_hint.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/escoutdoor/ecommerce/pkg/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const kid = "oidctest"
+
+// User is the identity the provider logs everyone in as.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+type Issuer struct {
+	// URL is the issuer url, set by Start or by the caller before serving.
+	URL          string
+	ClientID     string
+	ClientSecret string
+
+	mu    sync.Mutex
+	user  User
+	key   *rsa.PrivateKey
+	codes map[string]grant
+	// claims changes the claims of every id token before it is signed
+	claims func(jwt.MapClaims)
+}
+
+type grant struct {
+	user        User
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	expiresAt   time.Time
+}
+
+// New returns an issuer for url that logs everyone in as user.
+func New(url, clientID, clientSecret string, user User) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Issuer{
+		URL:          url,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		user:         user,
+		key:          key,
+		codes:        make(map[string]grant),
+	}, nil
+}
+
+// Start serves a new issuer on a local port until the returned server is
+// closed.
+func Start(clientID, clientSecret string, user User) (*Issuer, *httptest.Server, error) {
+	iss, err := New("", clientID, clientSecret, user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	srv := httptest.NewServer(iss)
+	iss.URL = srv.URL
+
+	return iss, srv, nil
+}
+
+// SetUser changes the user logged in by later authorizations.
+func (iss *Issuer) SetUser(user User) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	iss.user = user
+}
+
+// SetClaims makes the issuer pass the claims of every later id token
+// through change before signing it, to hand out tokens clients have to
+// refuse.
+func (iss *Issuer) SetClaims(change func(jwt.MapClaims)) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+
+	iss.claims = change
+}
+
+// Authorize runs the browser part of the flow: it follows authURL like a
+// browser would and returns the code and state from the redirect back to
+// the client.
+func (iss *Issuer) Authorize(authURL string) (code, state string, err error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		return "", "", fmt.Errorf("authorize: unexpected status %d", resp.StatusCode)
+	}
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", "", err
+	}
+
+	return loc.Query().Get("code"), loc.Query().Get("state"), nil
+}
+
+func (iss *Issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		iss.handleDiscovery(w, r)
+	case "/authorize":
+		iss.handleAuthorize(w, r)
+	case "/token":
+		iss.handleToken(w, r)
+	case "/jwks":
+		iss.handleJWKS(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (iss *Issuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                iss.URL,
+		"authorization_endpoint":                iss.URL + "/authorize",
+		"token_endpoint":                        iss.URL + "/token",
+		"jwks_uri":                              iss.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (iss *Issuer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != iss.ClientID {
+		http.Error(w, "invalid client or response type", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "pkce with S256 is required", http.StatusBadRequest)
+		return
+	}
+	if !strings.Contains(" "+q.Get("scope")+" ", " openid ") {
+		http.Error(w, "openid scope is required", http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	code, err := oidc.RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	iss.mu.Lock()
+	user := iss.user
+	if hint := q.Get("login_hint"); hint != "" {
+		user = User{Subject: hint, Email: hint, EmailVerified: true, GivenName: strings.Split(hint, "@")[0]}
+	}
+	iss.codes[code] = grant{
+		user:        user,
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		expiresAt:   time.Now().Add(time.Minute),
+	}
+	iss.mu.Unlock()
+
+	v := redirect.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	redirect.RawQuery = v.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (iss *Issuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != iss.ClientID || clientSecret != iss.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	iss.mu.Lock()
+	g, ok := iss.codes[code]
+	delete(iss.codes, code)
+	change := iss.claims
+	iss.mu.Unlock()
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		tokenError(w, "unsupported_grant_type")
+		return
+	case !ok || time.Now().After(g.expiresAt) || g.clientID != clientID:
+		tokenError(w, "invalid_grant")
+		return
+	case r.PostForm.Get("redirect_uri") != g.redirectURI:
+		tokenError(w, "invalid_grant")
+		return
+	case oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            iss.URL,
+		"sub":            g.user.Subject,
+		"aud":            clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          g.nonce,
+		"email":          g.user.Email,
+		"email_verified": g.user.EmailVerified,
+		"given_name":     g.user.GivenName,
+		"family_name":    g.user.FamilyName,
+	}
+	if change != nil {
+		change(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	idToken, err := token.SignedString(iss.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "oidctest-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (iss *Issuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := iss.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
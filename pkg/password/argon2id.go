@@ -0,0 +1,115 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2id hashes with argon2id (RFC 9106). Memory is in KiB.
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// DefaultArgon2id uses the second recommended option of RFC 9106, for
+// machines that cannot spare 2 GiB per hash.
+func DefaultArgon2id() Argon2id {
+	return Argon2id{
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+func (a Argon2id) Hash(pw string) (string, error) {
+	salt := make([]byte, a.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(pw), salt, a.Time, a.Memory, a.Threads, a.KeyLen)
+
+	return fmt.Sprintf(
+		"%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		a.Memory,
+		a.Time,
+		a.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a Argon2id) Current(hash string) bool {
+	h, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+
+	return h.version == argon2.Version &&
+		h.params.Time == a.Time &&
+		h.params.Memory == a.Memory &&
+		h.params.Threads == a.Threads &&
+		uint32(len(h.salt)) == a.SaltLen &&
+		uint32(len(h.key)) == a.KeyLen
+}
+
+type argon2idHash struct {
+	version int
+	params  Argon2id
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2id parses a hash in the PHC string format.
+func parseArgon2id(hash string) (*argon2idHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("not an argon2id hash")
+	}
+
+	h := &argon2idHash{}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &h.version); err != nil {
+		return nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.params.Memory, &h.params.Time, &h.params.Threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	if h.params.Time == 0 || h.params.Threads == 0 {
+		return nil, fmt.Errorf("invalid argon2id parameters")
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, fmt.Errorf("invalid argon2id key")
+	}
+
+	return h, nil
+}
+
+func verifyArgon2id(hash, pw string) bool {
+	h, err := parseArgon2id(hash)
+	if err != nil || h.version != argon2.Version {
+		return false
+	}
+
+	key := argon2.IDKey([]byte(pw), h.salt, h.params.Time, h.params.Memory, h.params.Threads, uint32(len(h.key)))
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
@@ -0,0 +1,43 @@
+package password
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptMaxBytes is the longest password bcrypt hashes.
+const BcryptMaxBytes = 72
+
+// Bcrypt hashes with bcrypt, which only reads the first BcryptMaxBytes of a
+// password, so longer ones are refused. Its hashes are verified whatever
+// the configured hasher, as all passwords used to be hashed with it.
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(pw string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), b.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (b Bcrypt) Current(hash string) bool {
+	if !isBcrypt(hash) {
+		return false
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost == b.Cost
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func verifyBcrypt(hash, pw string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil
+}
@@ -0,0 +1,96 @@
+package password
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ConfigureFromEnv sets the hasher and the policy from the environment:
+//
+//   - PASSWORD_HASHER selects argon2id, the default, or bcrypt
+//   - ARGON2_TIME, ARGON2_MEMORY_KIB and ARGON2_THREADS tune argon2id
+//   - BCRYPT_COST tunes bcrypt
+//   - PASSWORD_MIN_LENGTH and PASSWORD_MAX_LENGTH bound new passwords,
+//     with bcrypt to at most BcryptMaxBytes
+//   - PASSWORD_BREACHED_FILE lists passwords that are refused, see
+//     Policy.LoadBreached
+//
+// Changed hasher parameters apply to existing passwords as their users log
+// in.
+func ConfigureFromEnv() error {
+	p := DefaultPolicy()
+
+	switch v := os.Getenv("PASSWORD_HASHER"); v {
+	case "", "argon2id":
+		a := DefaultArgon2id()
+		if err := uintEnv("ARGON2_TIME", &a.Time, 32); err != nil {
+			return err
+		}
+		if err := uintEnv("ARGON2_MEMORY_KIB", &a.Memory, 32); err != nil {
+			return err
+		}
+		threads := uint32(a.Threads)
+		if err := uintEnv("ARGON2_THREADS", &threads, 8); err != nil {
+			return err
+		}
+		a.Threads = uint8(threads)
+
+		if a.Time == 0 || a.Threads == 0 || a.Memory < 8*uint32(a.Threads) {
+			return fmt.Errorf("invalid argon2id parameters: t=%d m=%d p=%d", a.Time, a.Memory, a.Threads)
+		}
+		SetHasher(a)
+	case "bcrypt":
+		cost := uint32(12)
+		if err := uintEnv("BCRYPT_COST", &cost, 32); err != nil {
+			return err
+		}
+		if cost < 10 || cost > 31 {
+			return fmt.Errorf("invalid BCRYPT_COST: %d, want 10 to 31", cost)
+		}
+		SetHasher(Bcrypt{Cost: int(cost)})
+		// longer passwords would pass the policy and fail to hash
+		p.MaxLength, p.MaxBytes = BcryptMaxBytes, BcryptMaxBytes
+	default:
+		return fmt.Errorf("invalid PASSWORD_HASHER: %q", v)
+	}
+
+	minLength, maxLength := uint32(p.MinLength), uint32(p.MaxLength)
+	if err := uintEnv("PASSWORD_MIN_LENGTH", &minLength, 16); err != nil {
+		return err
+	}
+	if err := uintEnv("PASSWORD_MAX_LENGTH", &maxLength, 16); err != nil {
+		return err
+	}
+	if p.MaxBytes > 0 && maxLength > uint32(p.MaxBytes) {
+		maxLength = uint32(p.MaxBytes)
+	}
+	if minLength == 0 || maxLength < minLength {
+		return fmt.Errorf("invalid password lengths: min %d, max %d", minLength, maxLength)
+	}
+	p.MinLength, p.MaxLength = int(minLength), int(maxLength)
+
+	if path := os.Getenv("PASSWORD_BREACHED_FILE"); path != "" {
+		if err := p.LoadBreached(path); err != nil {
+			return fmt.Errorf("load breached passwords: %w", err)
+		}
+	}
+	SetPolicy(p)
+
+	return nil
+}
+
+func uintEnv(key string, v *uint32, bits int) error {
+	s := os.Getenv(key)
+	if s == "" {
+		return nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, bits)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	*v = uint32(n)
+
+	return nil
+}
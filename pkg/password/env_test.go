@@ -0,0 +1,41 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigureBcryptBoundsLength(t *testing.T) {
+	t.Cleanup(func() {
+		SetHasher(DefaultArgon2id())
+		SetPolicy(DefaultPolicy())
+	})
+	t.Setenv("PASSWORD_HASHER", "bcrypt")
+	t.Setenv("BCRYPT_COST", "10")
+	t.Setenv("PASSWORD_MAX_LENGTH", "256")
+
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatalf("configure: %s", err)
+	}
+	if p := CurrentPolicy(); p.MaxLength != BcryptMaxBytes {
+		t.Errorf("max length %d, want %d", p.MaxLength, BcryptMaxBytes)
+	}
+
+	for _, pw := range []string{
+		strings.Repeat("a", BcryptMaxBytes+1),
+		// fewer characters than the limit, but more bytes
+		strings.Repeat("ї", BcryptMaxBytes/2+1),
+	} {
+		if err := Check(pw); err != ErrTooLong {
+			t.Errorf("check %d bytes: got %v, want %v", len(pw), err, ErrTooLong)
+		}
+	}
+
+	pw := strings.Repeat("ї", BcryptMaxBytes/2)
+	if err := Check(pw); err != nil {
+		t.Fatalf("check %d bytes: %s", len(pw), err)
+	}
+	if _, err := HashPassword(pw); err != nil {
+		t.Errorf("hash %d bytes: %s", len(pw), err)
+	}
+}
@@ -1,17 +1,50 @@
+// Package password hashes and checks user passwords. New hashes are made
+// by the configured Hasher, argon2id by default, while hashes of every
+// supported algorithm still verify, so the algorithm and its parameters can
+// change without resetting passwords.
 package password
 
-import "golang.org/x/crypto/bcrypt"
+import "strings"
+
+// Hasher makes password hashes that describe their algorithm and
+// parameters, like $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>.
+type Hasher interface {
+	Hash(pw string) (string, error)
+	// Current reports whether hash was made by this hasher with its current
+	// parameters.
+	Current(hash string) bool
+}
+
+var hasher Hasher = DefaultArgon2id()
+
+// SetHasher replaces the hasher of HashPassword. It is not safe to call
+// while passwords are being hashed.
+func SetHasher(h Hasher) {
+	hasher = h
+}
 
 func HashPassword(pw string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	return hasher.Hash(pw)
+}
+
+// Verify reports whether pw matches hashed, and whether hashed should be
+// replaced with a new HashPassword(pw) because it was made by another
+// algorithm or with outdated parameters. An empty hash, of a user who
+// never set a password, matches nothing.
+func Verify(hashed, pw string) (ok, rehash bool) {
+	switch {
+	case strings.HasPrefix(hashed, argon2idPrefix):
+		ok = verifyArgon2id(hashed, pw)
+	case isBcrypt(hashed):
+		ok = verifyBcrypt(hashed, pw)
+	default:
+		return false, false
 	}
 
-	return string(hash), nil
+	return ok, ok && !hasher.Current(hashed)
 }
 
 func ComparePasswords(hashed string, pw string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(pw))
-	return err == nil
+	ok, _ := Verify(hashed, pw)
+	return ok
 }
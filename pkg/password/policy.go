@@ -0,0 +1,130 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrTooShort = errors.New("password is too short")
+	ErrTooLong  = errors.New("password is too long")
+	ErrBreached = errors.New("password appears in a list of breached passwords")
+)
+
+// Policy decides which new passwords are accepted. Lengths are counted in
+// characters.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes bounds the length of the UTF-8 encoding, for hashers that
+	// only read part of a longer password. 0 is no bound.
+	MaxBytes int
+
+	// breached holds the SHA-1 digests of the breached passwords
+	breached map[[sha1.Size]byte]struct{}
+}
+
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength: 8,
+		MaxLength: 256,
+	}
+}
+
+var policy = DefaultPolicy()
+
+// SetPolicy replaces the policy of Check. It is not safe to call while
+// passwords are being checked.
+func SetPolicy(p *Policy) {
+	policy = p
+}
+
+// CurrentPolicy returns the policy of Check.
+func CurrentPolicy() *Policy {
+	return policy
+}
+
+// Check checks pw against the current policy.
+func Check(pw string) error {
+	return policy.Check(pw)
+}
+
+func (p *Policy) Check(pw string) error {
+	n := utf8.RuneCountInString(pw)
+	if n < p.MinLength {
+		return ErrTooShort
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return ErrTooLong
+	}
+	if p.MaxBytes > 0 && len(pw) > p.MaxBytes {
+		return ErrTooLong
+	}
+
+	if _, ok := p.breached[sha1.Sum([]byte(pw))]; ok {
+		return ErrBreached
+	}
+
+	return nil
+}
+
+// LoadBreached adds the passwords listed in the file at path, one per line,
+// to the breached passwords. Lines are passwords in the clear or their
+// SHA-1 hex digest as in the Pwned Passwords downloads, where a :count
+// suffix is ignored. The list is kept in memory, so it is meant for lists
+// of the most common passwords rather than whole breach corpora.
+func (p *Policy) LoadBreached(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if p.breached == nil {
+		p.breached = make(map[[sha1.Size]byte]struct{})
+	}
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		entry := strings.TrimRight(sc.Text(), "\r")
+		if entry == "" {
+			continue
+		}
+
+		if digest, ok := sha1Digest(entry); ok {
+			p.breached[digest] = struct{}{}
+			continue
+		}
+
+		p.breached[sha1.Sum([]byte(entry))] = struct{}{}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// sha1Digest parses an entry of the Pwned Passwords format, HASH:count.
+func sha1Digest(entry string) ([sha1.Size]byte, bool) {
+	var digest [sha1.Size]byte
+
+	hash, _, _ := strings.Cut(entry, ":")
+	if len(hash) != 2*sha1.Size {
+		return digest, false
+	}
+
+	b, err := hex.DecodeString(hash)
+	if err != nil {
+		return digest, false
+	}
+	copy(digest[:], b)
+
+	return digest, true
+}
@@ -0,0 +1,14 @@
+package password
+
+import "github.com/go-playground/validator/v10"
+
+// Tag is the validate tag of fields holding a new password.
+const Tag = "password"
+
+// RegisterValidation makes v check fields tagged with Tag against the
+// current policy.
+func RegisterValidation(v *validator.Validate) error {
+	return v.RegisterValidation(Tag, func(fl validator.FieldLevel) bool {
+		return Check(fl.Field().String()) == nil
+	})
+}
@@ -0,0 +1,218 @@
+package tokens
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+	HS256 = "HS256"
+
+	minRSABits = 2048
+)
+
+// Key is one key of the keyset. The key that became active last signs new
+// tokens, so a key is rotated out by adding its successor with a later
+// ActiveFrom. Every key verifies tokens until it expires, which should be
+// at least a token lifetime after its successor became active.
+type Key struct {
+	ID         string
+	Algorithm  string
+	ActiveFrom time.Time
+	// ExpiresAt is zero for keys that do not expire.
+	ExpiresAt time.Time
+
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// keyConfig is an entry of the keyset file.
+type keyConfig struct {
+	ID             string     `json:"kid"`
+	Algorithm      string     `json:"alg"`
+	PrivateKeyFile string     `json:"private_key_file"`
+	ActiveFrom     time.Time  `json:"active_from"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// LoadKeys reads a keyset file, a json array like
+//
+//	[{"kid": "2026-10", "alg": "EdDSA", "private_key_file": "2026-10.pem", "active_from": "2026-10-01T00:00:00Z"}]
+//
+// Key files are PEM encoded private keys, relative paths are relative to
+// the keyset file.
+func LoadKeys(path string) ([]*Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []keyConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	keys := make([]*Key, 0, len(configs))
+	for _, c := range configs {
+		file := c.PrivateKeyFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(path), file)
+		}
+
+		pemBytes, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", c.ID, err)
+		}
+
+		var expiresAt time.Time
+		if c.ExpiresAt != nil {
+			expiresAt = *c.ExpiresAt
+		}
+
+		key, err := NewKey(c.ID, c.Algorithm, pemBytes, c.ActiveFrom, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// NewKey parses the PEM encoded private key of an RS256 or EdDSA key.
+func NewKey(id, alg string, privateKeyPEM []byte, activeFrom, expiresAt time.Time) (*Key, error) {
+	if id == "" {
+		return nil, fmt.Errorf("key without kid")
+	}
+
+	key := &Key{
+		ID:         id,
+		Algorithm:  alg,
+		ActiveFrom: activeFrom,
+		ExpiresAt:  expiresAt,
+	}
+
+	switch alg {
+	case RS256:
+		priv, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if priv.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("key %s: rsa keys need at least %d bits", id, minRSABits)
+		}
+
+		key.method = jwt.SigningMethodRS256
+		key.signKey = priv
+		key.verifyKey = &priv.PublicKey
+	case EdDSA:
+		priv, err := jwt.ParseEdPrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		key.method = jwt.SigningMethodEdDSA
+		key.signKey = priv
+		key.verifyKey = priv.(ed25519.PrivateKey).Public()
+	default:
+		return nil, fmt.Errorf("key %s: unsupported alg %q, want %s or %s", id, alg, RS256, EdDSA)
+	}
+
+	return key, nil
+}
+
+// secretKey is the HS256 key used when no keyset is configured. Only we
+// can verify its tokens, so it is never published.
+func secretKey(secret string) *Key {
+	return &Key{
+		ID:        "hs256",
+		Algorithm: HS256,
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+func (k *Key) expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// GenerateKey returns a new PKCS #8 PEM encoded private key for alg.
+func GenerateKey(alg string) ([]byte, error) {
+	var priv any
+	switch alg {
+	case RS256:
+		k, err := rsa.GenerateKey(rand.Reader, 3072)
+		if err != nil {
+			return nil, err
+		}
+		priv = k
+	case EdDSA:
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		priv = k
+	default:
+		return nil, fmt.Errorf("unsupported alg %q, want %s or %s", alg, RS256, EdDSA)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve and X are the curve and public key of Ed25519 keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) jwk() (JWK, bool) {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm}
+
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JWK{}, false
+	}
+
+	return jwk, true
+}
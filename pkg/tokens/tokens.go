@@ -3,7 +3,9 @@ package tokens
 import (
 	"errors"
 	"fmt"
+	"log"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 
@@ -11,60 +13,235 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func VerifyToken(tokenStr string) (int, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return 0, fmt.Errorf("jwt is empty verifyToken err")
+// AccessTokenTTL is how long access tokens, and the sessions they belong
+// to, are valid.
+const AccessTokenTTL = 24 * time.Hour
+
+const (
+	challengePurpose = "2fa"
+	challengeTTL     = 5 * time.Minute
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrWrongPurpose = errors.New("token cannot be used for this request")
+	ErrNoSigningKey = errors.New("no active signing key")
+)
+
+// Issuer creates and verifies the tokens of one issuer and audience with
+// a rotating set of keys.
+type Issuer struct {
+	// keys are sorted by ActiveFrom
+	keys     []*Key
+	issuer   string
+	audience string
+}
+
+func NewIssuer(keys []*Key, issuer, audience string) (*Issuer, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys")
 	}
 
-	var claims models.TokenClaims
-	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if seen[k.ID] {
+			return nil, fmt.Errorf("duplicate kid %q", k.ID)
+		}
+		seen[k.ID] = true
+	}
+
+	keys = append([]*Key(nil), keys...)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].ActiveFrom.Before(keys[j].ActiveFrom)
 	})
 
-	if err != nil {
-		switch {
-		case errors.Is(err, jwt.ErrTokenMalformed):
-			return 0, fmt.Errorf("That's not even a token")
-		case errors.Is(err, jwt.ErrTokenSignatureInvalid):
-			return 0, fmt.Errorf("Invalid token signature")
-		case errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet):
-			return 0, fmt.Errorf("Token is either expired or not active yet")
-		default:
-			return 0, fmt.Errorf("Couldn't handle this token: %s", err.Error())
+	return &Issuer{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+	}, nil
+}
+
+// FromEnv creates the issuer from the keyset in JWT_KEYS_FILE, or from
+// JWT_SECRET with HS256 if there is none.
+func FromEnv() (*Issuer, error) {
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "ecommerce"
+	}
+
+	audience := os.Getenv("JWT_AUDIENCE")
+	if audience == "" {
+		audience = "ecommerce-api"
+	}
+
+	var keys []*Key
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		k, err := LoadKeys(path)
+		if err != nil {
+			return nil, err
 		}
+		keys = k
+	} else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		log.Println("JWT_KEYS_FILE is not set, signing tokens with JWT_SECRET, other services cannot verify them")
+		keys = []*Key{secretKey(secret)}
+	} else {
+		return nil, fmt.Errorf("set JWT_KEYS_FILE or JWT_SECRET")
+	}
+
+	return NewIssuer(keys, issuer, audience)
+}
+
+// CreateJWT creates an access token of the session for the user id, logged
+// in with the authentication methods amr. The session id is the jti claim.
+func (i *Issuer) CreateJWT(id int, sessionID string, amr ...string) (string, error) {
+	return i.create(id, AccessTokenTTL, "", sessionID, amr)
+}
+
+// CreateChallenge creates a short lived token that only proves the user id
+// passed the first step of a two-step login, with the methods in amr.
+func (i *Issuer) CreateChallenge(id int, amr ...string) (string, error) {
+	return i.create(id, challengeTTL, challengePurpose, "", amr)
+}
+
+// VerifyToken verifies an access token and returns its claims.
+func (i *Issuer) VerifyToken(tokenStr string) (*models.TokenClaims, error) {
+	claims, err := i.parse(tokenStr)
+	if err != nil {
+		return nil, err
 	}
 
-	if token.Valid {
+	if claims.Purpose != "" {
+		return nil, ErrWrongPurpose
+	}
+
+	return claims, nil
+}
+
+// VerifyChallenge verifies a token made by CreateChallenge and returns the
+// id of the user it was issued to and the methods of the first step.
+func (i *Issuer) VerifyChallenge(tokenStr string) (int, []string, error) {
+	claims, err := i.parse(tokenStr)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if claims.Purpose != challengePurpose {
+		return 0, nil, ErrWrongPurpose
 	}
 
 	id, err := strconv.Atoi(claims.ID)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+
+	return id, claims.AMR, nil
+}
+
+// JWKS returns the public keys that verify tokens now or will once they
+// become active, so verifiers learn about a key before it is used.
+func (i *Issuer) JWKS() JWKS {
+	now := time.Now()
+	jwks := JWKS{Keys: []JWK{}}
+	for _, k := range i.keys {
+		if k.expired(now) {
+			continue
+		}
+
+		if jwk, ok := k.jwk(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	return jwks
+}
+
+// signingKey is the key that became active last and has not expired.
+func (i *Issuer) signingKey(now time.Time) (*Key, error) {
+	for j := len(i.keys) - 1; j >= 0; j-- {
+		k := i.keys[j]
+		if !k.ActiveFrom.After(now) && !k.expired(now) {
+			return k, nil
+		}
+	}
+
+	return nil, ErrNoSigningKey
+}
+
+func (i *Issuer) verificationKey(kid string, now time.Time) (*Key, bool) {
+	for _, k := range i.keys {
+		if k.ID == kid && !k.expired(now) {
+			return k, true
+		}
 	}
 
-	return id, nil
+	return nil, false
 }
 
-func CreateJWT(id int) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "", fmt.Errorf("jwt is empty createToken err")
+func (i *Issuer) create(id int, ttl time.Duration, purpose, jti string, amr []string) (string, error) {
+	now := time.Now()
+	key, err := i.signingKey(now)
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, models.TokenClaims{
+	token := jwt.NewWithClaims(key.method, models.TokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    i.issuer,
+			Subject:   strconv.Itoa(id),
+			Audience:  jwt.ClaimStrings{i.audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
 		},
-		ID: fmt.Sprintf("%d", id),
+		ID:      strconv.Itoa(id),
+		Purpose: purpose,
+		AMR:     amr,
 	})
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.signKey)
+}
+
+func (i *Issuer) parse(tokenStr string) (*models.TokenClaims, error) {
+	now := time.Now()
+
+	var claims models.TokenClaims
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := i.verificationKey(kid, now)
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+
+		// the alg header must match the key, or a public key could be
+		// used as an HMAC secret
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("kid %q does not sign with %s", kid, t.Method.Alg())
+		}
 
-	tokenStr, err := token.SignedString([]byte(secret))
+		return key.verifyKey, nil
+	},
+		jwt.WithValidMethods([]string{RS256, EdDSA, HS256}),
+		jwt.WithIssuer(i.issuer),
+		jwt.WithAudience(i.audience),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
-		return "", err
+		switch {
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+		case errors.Is(err, jwt.ErrTokenExpired) || errors.Is(err, jwt.ErrTokenNotValidYet):
+			return nil, fmt.Errorf("%w: token is either expired or not active yet", ErrInvalidToken)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+		}
+	}
+
+	if !token.Valid {
+		return nil, ErrInvalidToken
 	}
 
-	return tokenStr, nil
+	return &claims, nil
 }